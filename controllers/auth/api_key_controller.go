@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"gopkg.in/guregu/null.v4"
+)
+
+type ApiKeyController struct {
+	ApiKeyRepository models.ApiKeyRepository
+}
+
+func NewApiKeyController(apiKeyRepository models.ApiKeyRepository) *ApiKeyController {
+	return &ApiKeyController{apiKeyRepository}
+}
+
+type CreateApiKeyPayload struct {
+	Name      string    `json:"name"`
+	Scopes    string    `json:"scopes"`
+	ExpiresAt null.Time `json:"expires_at"`
+}
+
+// ApiKeySecretResponse is the only place an API key secret is ever returned.
+type ApiKeySecretResponse struct {
+	models.ApiKey
+	Key string `json:"key"`
+}
+
+func (controller ApiKeyController) ListApiKeys(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	apiKeys, err := controller.ApiKeyRepository.GetApiKeysByOwner(user.ID.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKeys)
+
+	return
+}
+
+func (controller ApiKeyController) CreateApiKey(c *gin.Context) {
+	var payload CreateApiKeyPayload
+	user := c.MustGet("user").(models.User)
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(payload.Name) <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	if payload.ExpiresAt.Valid && payload.ExpiresAt.Time.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	apiKey, secret, err := models.NewApiKey(user.ID, payload.Name, payload.Scopes, payload.ExpiresAt)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = controller.ApiKeyRepository.CreateApiKey(apiKey, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, ApiKeySecretResponse{*apiKey, secret})
+
+	return
+}
+
+func (controller ApiKeyController) DeleteApiKey(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	err := controller.ApiKeyRepository.DeleteApiKey(c.Param("id"), user.ID.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
@@ -1,31 +1,36 @@
 package auth
 
 import (
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
-	"os"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/i18n"
 	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/directory"
 	"github.com/thiagoferolla/go-auth/providers/email"
 	"github.com/thiagoferolla/go-auth/providers/jwt"
 	"gopkg.in/guregu/null.v4"
 )
 
 type AuthController struct {
-	UserRepository         models.UserRepository
-	RefreshTokenRepository models.RefreshTokenRepository
-	JwtProvider            jwt.JWTProvider
-	EmailProvider          email.EmailProvider
-	Cache                  cache.CacheProvider
+	UserRepository               models.UserRepository
+	RefreshTokenRepository       models.RefreshTokenRepository
+	WebAuthnCredentialRepository models.WebAuthnCredentialRepository
+	IdentityRepository           models.IdentityRepository
+	JwtProvider                  jwt.JWTProvider
+	Outbox                       *email.Outbox
+	Cache                        cache.CacheProvider
+	Directories                  map[string]directory.DirectoryProvider
 }
 
-func NewAuthController(userRepository models.UserRepository, refreshTokenRepository models.RefreshTokenRepository, jwtProvider jwt.JWTProvider, emailProvider email.EmailProvider, cache cache.CacheProvider) *AuthController {
-	return &AuthController{userRepository, refreshTokenRepository, jwtProvider, emailProvider, cache}
+func NewAuthController(userRepository models.UserRepository, refreshTokenRepository models.RefreshTokenRepository, webAuthnCredentialRepository models.WebAuthnCredentialRepository, identityRepository models.IdentityRepository, jwtProvider jwt.JWTProvider, outbox *email.Outbox, cache cache.CacheProvider, directories map[string]directory.DirectoryProvider) *AuthController {
+	return &AuthController{userRepository, refreshTokenRepository, webAuthnCredentialRepository, identityRepository, jwtProvider, outbox, cache, directories}
 }
 
 type AuthResponse struct {
@@ -36,24 +41,24 @@ type AuthResponse struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-func (controller AuthController) SendEmailConfirmation(userID string, email string, name string) error {
+// SendEmailConfirmation enqueues the confirmation email within transaction,
+// the caller notifies the outbox after committing.
+func (controller AuthController) SendEmailConfirmation(user models.User, transaction *sql.Tx) error {
 	token, err := uuid.NewRandom()
 
 	if err != nil {
 		return err
 	}
 
-	err = controller.Cache.SetEx("email:"+token.String(), userID, int(24*time.Hour))
+	err = controller.Cache.SetEx("email:"+token.String(), user.ID.String(), 24*time.Hour)
 
 	if err != nil {
 		return err
 	}
 
-	err = controller.EmailProvider.SendEmail(
-		"no-reply@go-auth.com", name, email, os.Getenv("CONFIRM_EMAIL_TEMPLATE_ID"), map[string]string{"name": name},
+	return controller.Outbox.Enqueue(
+		"confirm_email:"+HashToken(token.String()), user.Name.String, user.Email, user.Locale, email.ConfirmEmail{Name: user.Name.String, Token: token.String()}, transaction,
 	)
-
-	return err
 }
 
 type CreateUserPayload struct {
@@ -79,6 +84,8 @@ func (controller AuthController) CreateUser(c *gin.Context) {
 		return
 	}
 
+	user.Locale = i18n.Negotiate(c.GetHeader("Accept-Language"))
+
 	transaction, err := controller.UserRepository.BeginTransaction()
 
 	if err != nil {
@@ -87,7 +94,7 @@ func (controller AuthController) CreateUser(c *gin.Context) {
 		return
 	}
 
-	_, err = controller.UserRepository.CreateUser(user, transaction)
+	response, err := RegisterPasswordUser(controller.UserRepository, controller.IdentityRepository, controller.RefreshTokenRepository, controller.JwtProvider, user, transaction)
 
 	if err != nil {
 		transaction.Rollback()
@@ -96,17 +103,7 @@ func (controller AuthController) CreateUser(c *gin.Context) {
 		return
 	}
 
-	refreshToken := models.NewRefreshToken(user.ID)
-	_, err = controller.RefreshTokenRepository.CreateRefreshToken(refreshToken, transaction)
-
-	if err != nil {
-		transaction.Rollback()
-		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	token, err := controller.JwtProvider.GenerateToken(*user)
+	err = controller.SendEmailConfirmation(*user, transaction)
 
 	if err != nil {
 		transaction.Rollback()
@@ -123,26 +120,10 @@ func (controller AuthController) CreateUser(c *gin.Context) {
 		return
 	}
 
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-
-	go func() {
-		controller.SendEmailConfirmation(user.ID.String(), user.Email, user.Name.String)
-		wg.Done()
-	}()
-
-	response := AuthResponse{
-		ID:           user.ID.String(),
-		Email:        user.Email,
-		IsNewUser:    true,
-		IDToken:      token,
-		RefreshToken: refreshToken.Token.String(),
-	}
+	controller.Outbox.Notify()
 
 	c.JSON(http.StatusCreated, response)
 
-	wg.Wait()
-
 	return
 }
 
@@ -165,19 +146,57 @@ func (controller AuthController) Login(c *gin.Context) {
 		return
 	}
 
-	user, err := controller.UserRepository.GetUserByEmail(payload.Email)
+	var user models.User
+	var err error
 
-	if err != nil {
-		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid email or password"})
-		return
+	if directoryProvider, ok := directory.DirectoryForEmail(controller.Directories, payload.Email); ok {
+		user, err = controller.loginWithDirectory(directoryProvider, payload.Email, payload.Password, i18n.Negotiate(c.GetHeader("Accept-Language")))
+
+		if errors.Is(err, directory.ErrInvalidCredentials) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email or password"})
+			return
+		} else if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid email or password"})
+			return
+		}
+	} else {
+		user, err = controller.UserRepository.GetUserByEmail(payload.Email)
+
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid email or password"})
+			return
+		}
+
+		validPassword := user.VerifyPassword(payload.Password)
+
+		if !validPassword {
+			log.Println(err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email or password"})
+			return
+		}
+
+		identities, err := LoginIdentities(controller.IdentityRepository, controller.WebAuthnCredentialRepository, user)
+
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid email or password"})
+			return
+		}
+
+		if !HasIdentity(identities, "password") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email or password"})
+			return
+		}
 	}
 
-	validPassword := user.VerifyPassword(payload.Password)
+	if !user.IsActive() {
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrUserDeactivated.Error()})
+		return
+	}
 
-	if !validPassword {
-		log.Println(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email or password"})
+	if challengeSecondFactor(c, controller.Cache, controller.WebAuthnCredentialRepository, user, "") {
 		return
 	}
 
@@ -226,7 +245,9 @@ func (controller AuthController) RefreshToken(c *gin.Context) {
 
 	refreshToken, err := controller.RefreshTokenRepository.GetRefreshTokenByToken(payload.RefreshToken)
 
-	if err != nil || len(refreshToken.Owner.String()) <= 0 {
+	// Tokens issued to third-party clients are redeemed through the OAuth
+	// token endpoint, here they would turn into a full session.
+	if err != nil || len(refreshToken.Owner.String()) <= 0 || !refreshToken.Valid || refreshToken.ClientID.Valid {
 		log.Println(err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refresh token"})
 		return
@@ -234,7 +255,7 @@ func (controller AuthController) RefreshToken(c *gin.Context) {
 
 	user, err := controller.UserRepository.GetUserByID(refreshToken.Owner.String())
 
-	if err != nil || len(user.ID.String()) <= 0 {
+	if err != nil || len(user.ID.String()) <= 0 || !user.IsActive() {
 		log.Print(err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refresh token"})
 		return
@@ -327,7 +348,7 @@ func (controller AuthController) SendPasswordReset(c *gin.Context) {
 		return
 	}
 
-	err = controller.Cache.SetEx("password:"+token.String(), user.ID.String(), int(24*time.Hour))
+	err = controller.Cache.SetEx("password:"+token.String(), user.ID.String(), 24*time.Hour)
 
 	if err != nil {
 		log.Println(err)
@@ -335,8 +356,8 @@ func (controller AuthController) SendPasswordReset(c *gin.Context) {
 		return
 	}
 
-	err = controller.EmailProvider.SendEmail(
-		"no-reply@go-auth.com", user.Name.String, user.Email, os.Getenv("RESET_PASSWORD_TEMPLATE_ID"), map[string]string{"name": user.Name.String},
+	err = controller.Outbox.Enqueue(
+		"reset_password:"+HashToken(token.String()), user.Name.String, user.Email, user.Locale, email.ResetPassword{Name: user.Name.String, Token: token.String()}, nil,
 	)
 
 	if err != nil {
@@ -359,7 +380,7 @@ func (controller AuthController) ConfirmEmail(c *gin.Context) {
 		return
 	}
 
-	userID, err := controller.Cache.Get("email:" + token)
+	userID, err := controller.Cache.GetDel("email:" + token)
 
 	if err != nil {
 		log.Println(err)
@@ -372,6 +393,12 @@ func (controller AuthController) ConfirmEmail(c *gin.Context) {
 
 	user, err := controller.UserRepository.GetUserByID(userID)
 
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token"})
+		return
+	}
+
 	user.EmailVerifiedAt = null.NewTime(time.Now(), true)
 
 	_, err = controller.UserRepository.UpdateUser(&user, nil)
@@ -408,7 +435,9 @@ func (controller AuthController) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	userID, err := controller.Cache.Get("password:" + token)
+	// The token is spent even if the update below fails, a new link can be
+	// requested.
+	userID, err := controller.Cache.GetDel("password:" + token)
 
 	if err != nil {
 		log.Println(err)
@@ -418,6 +447,12 @@ func (controller AuthController) ResetPassword(c *gin.Context) {
 
 	user, err := controller.UserRepository.GetUserByID(userID)
 
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token"})
+		return
+	}
+
 	user.Password = payload.Password
 	err = user.HashPassword()
 
@@ -427,7 +462,7 @@ func (controller AuthController) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	_, err = controller.UserRepository.UpdateUser(&user, nil)
+	transaction, err := controller.UserRepository.BeginTransaction()
 
 	if err != nil {
 		log.Println(err)
@@ -435,6 +470,29 @@ func (controller AuthController) ResetPassword(c *gin.Context) {
 		return
 	}
 
+	_, err = controller.UserRepository.UpdateUser(&user, transaction)
+
+	if err == nil {
+		err = controller.Outbox.Enqueue(
+			"password_changed:"+HashToken(token), user.Name.String, user.Email, user.Locale, email.PasswordChanged{Name: user.Name.String}, transaction,
+		)
+	}
+
+	if err != nil {
+		transaction.Rollback()
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	if err = transaction.Commit(); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	controller.Outbox.Notify()
+
 	c.Status(http.StatusNoContent)
 	c.Abort()
 
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/directory"
+	"gopkg.in/guregu/null.v4"
+)
+
+// loginWithDirectory checks the password against the directory that owns the
+// email domain and keeps a local shadow user in sync with it. New shadow
+// users get locale.
+func (controller AuthController) loginWithDirectory(directoryProvider directory.DirectoryProvider, email string, password string, locale string) (models.User, error) {
+	directoryUser, err := directoryProvider.Authenticate(email, password)
+
+	if err != nil {
+		return models.User{}, err
+	}
+
+	provider := "ldap:" + directoryProvider.Name()
+
+	linked, err := controller.IdentityRepository.GetIdentity(provider, directoryUser.Subject)
+
+	if err == nil {
+		user, err := controller.UserRepository.GetUserByID(linked.Owner.String())
+
+		if err != nil {
+			return user, err
+		}
+
+		if user.Role != directoryUser.Role || (len(directoryUser.Name) > 0 && user.Name.String != directoryUser.Name) {
+			user.Role = directoryUser.Role
+
+			if len(directoryUser.Name) > 0 {
+				user.Name = null.NewString(directoryUser.Name, true)
+			}
+
+			_, err = controller.UserRepository.UpdateUser(&user, nil)
+		}
+
+		return user, err
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, err
+	}
+
+	user, err := controller.UserRepository.GetUserByEmail(directoryUser.Email)
+
+	if err == nil {
+		_, err = controller.IdentityRepository.CreateIdentity(models.NewIdentity(user.ID, provider, directoryUser.Subject), nil)
+
+		return user, err
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return user, err
+	}
+
+	newUser, err := models.NewPasswordlessUser(directoryUser.Name, directoryUser.Email, "ldap")
+
+	if err != nil {
+		return models.User{}, err
+	}
+
+	newUser.Role = directoryUser.Role
+	newUser.EmailVerifiedAt = null.NewTime(time.Now(), true)
+	newUser.Locale = locale
+
+	err = createUserWithIdentity(controller.UserRepository, controller.IdentityRepository, newUser, models.NewIdentity(newUser.ID, provider, directoryUser.Subject))
+
+	return *newUser, err
+}
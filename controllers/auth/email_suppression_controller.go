@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/email"
+	"gopkg.in/guregu/null.v4"
+)
+
+// EmailSuppressionController takes bounce and complaint events from the
+// email providers and lets admins manage the resulting suppression list.
+type EmailSuppressionController struct {
+	UserRepository             models.UserRepository
+	EmailSuppressionRepository models.EmailSuppressionRepository
+	Webhooks                   map[string]email.EmailWebhook
+}
+
+func NewEmailSuppressionController(userRepository models.UserRepository, emailSuppressionRepository models.EmailSuppressionRepository, webhooks map[string]email.EmailWebhook) *EmailSuppressionController {
+	return &EmailSuppressionController{userRepository, emailSuppressionRepository, webhooks}
+}
+
+// suppress adds the address to the list and flags the user it belongs to,
+// if any, in the same transaction.
+func (controller EmailSuppressionController) suppress(suppression *models.EmailSuppression, address string) error {
+	transaction, err := controller.UserRepository.BeginTransaction()
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = controller.EmailSuppressionRepository.CreateEmailSuppression(suppression, transaction); err != nil {
+		transaction.Rollback()
+		return err
+	}
+
+	user, err := controller.UserRepository.GetUserByEmail(address)
+
+	if err == nil && user.EmailDeliverable() {
+		user.EmailUndeliverableAt = null.NewTime(time.Now(), true)
+		_, err = controller.UserRepository.UpdateUser(&user, transaction)
+	} else if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+
+	if err != nil {
+		transaction.Rollback()
+		return err
+	}
+
+	return transaction.Commit()
+}
+
+func (controller EmailSuppressionController) HandleWebhook(c *gin.Context) {
+	webhook, ok := controller.Webhooks[c.Param("provider")]
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, err := webhook.ParseEvents(c.Request.Header, body)
+
+	if errors.Is(err, email.ErrInvalidSignature) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		return
+	} else if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid events"})
+		return
+	}
+
+	for _, event := range events {
+		if !models.ValidateEmail(event.Email) {
+			continue
+		}
+
+		err = controller.suppress(models.NewEmailSuppression(event.Email, event.Reason, c.Param("provider"), event.Detail), event.Email)
+
+		// Failing makes the provider deliver the batch again, suppressing
+		// is idempotent so the events already stored are harmless.
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
+
+func (controller EmailSuppressionController) ListSuppressions(c *gin.Context) {
+	suppressions, err := controller.EmailSuppressionRepository.GetEmailSuppressions()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, suppressions)
+
+	return
+}
+
+type CreateSuppressionPayload struct {
+	Email  string `json:"email"`
+	Detail string `json:"detail"`
+}
+
+func (controller EmailSuppressionController) CreateSuppression(c *gin.Context) {
+	var payload CreateSuppressionPayload
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !models.ValidateEmail(payload.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email"})
+		return
+	}
+
+	suppression := models.NewEmailSuppression(payload.Email, models.SuppressionManual, "admin", payload.Detail)
+
+	if err := controller.suppress(suppression, payload.Email); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, suppression)
+
+	return
+}
+
+// DeleteSuppression lifts the suppression, for instance once the user fixed
+// their mailbox, and clears the flag on the user.
+func (controller EmailSuppressionController) DeleteSuppression(c *gin.Context) {
+	suppression, err := controller.EmailSuppressionRepository.GetEmailSuppression(c.Param("email"))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	} else if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	transaction, err := controller.UserRepository.BeginTransaction()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = controller.EmailSuppressionRepository.DeleteEmailSuppression(suppression.Email, transaction)
+
+	if err == nil {
+		var user models.User
+		user, err = controller.UserRepository.GetUserByEmail(suppression.Email)
+
+		if err == nil && !user.EmailDeliverable() {
+			user.EmailUndeliverableAt = null.Time{}
+			_, err = controller.UserRepository.UpdateUser(&user, transaction)
+		} else if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+		}
+	}
+
+	if err != nil {
+		transaction.Rollback()
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = transaction.Commit(); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
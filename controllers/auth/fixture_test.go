@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/email"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"github.com/thiagoferolla/go-auth/repositories/memory"
+)
+
+// authFixture holds the in-memory repositories the controllers of this
+// package run on, each test registers the routes it needs on engine.
+type authFixture struct {
+	engine        *gin.Engine
+	users         *memory.UserRepository
+	refreshTokens *memory.RefreshTokenRepository
+	credentials   *memory.WebAuthnCredentialRepository
+	identities    *memory.IdentityRepository
+	outbox        *memory.OutboxEmailRepository
+	jwt           *jwt.JWTBaseProvider
+	cache         *cache.MemoryProvider
+}
+
+func newAuthFixture(t *testing.T) authFixture {
+	gin.SetMode(gin.TestMode)
+
+	cacheProvider := cache.NewMemoryProvider(0, 0)
+	t.Cleanup(cacheProvider.Close)
+
+	return authFixture{
+		engine:        gin.New(),
+		users:         memory.NewUserRepository(),
+		refreshTokens: memory.NewRefreshTokenRepository(),
+		credentials:   memory.NewWebAuthnCredentialRepository(),
+		identities:    memory.NewIdentityRepository(),
+		outbox:        memory.NewOutboxEmailRepository(),
+		jwt:           jwt.NewBaseProvider(),
+		cache:         cacheProvider,
+	}
+}
+
+// createUser stores the user, a passwordless one when password is empty.
+func (f authFixture) createUser(t *testing.T, email string, password string) *models.User {
+	var user *models.User
+	var err error
+
+	if len(password) > 0 {
+		user, err = models.NewUser("Jane", email, password, "password")
+	} else {
+		user, err = models.NewPasswordlessUser("Jane", email, "email")
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = f.users.CreateUser(user, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+// emailOutbox queues into the outbox repository without sending, tests read
+// the substitutions back from the pending emails.
+func (f authFixture) emailOutbox() *email.Outbox {
+	return email.NewOutbox(f.outbox, email.NewMockEmailProvider(), "")
+}
+
+// lastEmail returns the substitutions of the latest email queued.
+func (f authFixture) lastEmail(t *testing.T) map[string]string {
+	emails, _ := f.outbox.GetOutboxEmailsByStatus(models.OutboxPending)
+
+	if len(emails) <= 0 {
+		t.Fatal("no email was queued")
+	}
+
+	return emails[len(emails)-1].Substitutions
+}
+
+func (f authFixture) do(t *testing.T, method string, path string, token string, payload any) *httptest.ResponseRecorder {
+	body, err := json.Marshal(payload)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest(method, path, bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+
+	if len(token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	recorder := httptest.NewRecorder()
+	f.engine.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+// signedIn stands in for WithAuth, it sets the user whose id is in the
+// X-User header.
+func (f authFixture) signedIn(c *gin.Context) {
+	user, err := f.users.GetUserByID(c.GetHeader("X-User"))
+
+	if err != nil {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	c.Set("user", user)
+}
+
+// as sends the request as user to the routes behind signedIn.
+func (f authFixture) as(t *testing.T, user *models.User, method string, path string, payload any) *httptest.ResponseRecorder {
+	body, err := json.Marshal(payload)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest(method, path, bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-User", user.ID.String())
+
+	recorder := httptest.NewRecorder()
+	f.engine.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+func (f authFixture) post(t *testing.T, path string, payload any) int {
+	return f.do(t, http.MethodPost, path, "", payload).Code
+}
+
+// wrongCode is a six digit code other than code.
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+
+	return "000000"
+}
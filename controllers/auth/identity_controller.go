@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+)
+
+type IdentityController struct {
+	UserRepository               models.UserRepository
+	IdentityRepository           models.IdentityRepository
+	WebAuthnCredentialRepository models.WebAuthnCredentialRepository
+	Cache                        cache.CacheProvider
+}
+
+func NewIdentityController(userRepository models.UserRepository, identityRepository models.IdentityRepository, webAuthnCredentialRepository models.WebAuthnCredentialRepository, cache cache.CacheProvider) *IdentityController {
+	return &IdentityController{userRepository, identityRepository, webAuthnCredentialRepository, cache}
+}
+
+func (controller IdentityController) ListIdentities(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	identities, err := controller.IdentityRepository.GetIdentitiesByOwner(user.ID.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, identities)
+
+	return
+}
+
+type ReauthenticatePayload struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type ReauthenticateResponse struct {
+	ReauthToken string `json:"reauth_token"`
+}
+
+// Reauthenticate accepts the account password or, for accounts without one,
+// a code requested through /passwordless/send.
+func (controller IdentityController) Reauthenticate(c *gin.Context) {
+	var payload ReauthenticatePayload
+	user := c.MustGet("user").(models.User)
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	valid := false
+
+	if len(payload.Password) > 0 {
+		valid = user.VerifyPassword(payload.Password)
+	} else if len(payload.Code) > 0 {
+		// Same limit as signing in with the code, a stolen session must not
+		// be enough to guess it.
+		err := CountAttempt(controller.Cache, passwordlessEmailKey(user.Email), maxPasswordlessAttempts, passwordlessExpiration)
+
+		if errors.Is(err, ErrTooManyAttempts) {
+			revokePasswordless(controller.Cache, user.Email)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts"})
+			return
+		} else if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		emailAddress, err := controller.Cache.GetDel(passwordlessKey(user.Email, payload.Code, "code"))
+		valid = err == nil && emailAddress == user.Email
+
+		if valid {
+			controller.Cache.Delete(passwordlessEmailKey(user.Email))
+			ResetAttempts(controller.Cache, passwordlessEmailKey(user.Email))
+		}
+	}
+
+	if !valid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	token, err := CreateReauthToken(controller.Cache, user.ID.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, ReauthenticateResponse{ReauthToken: token})
+
+	return
+}
+
+type LinkPasswordPayload struct {
+	ReauthToken string `json:"reauth_token"`
+	Password    string `json:"password"`
+}
+
+func (controller IdentityController) LinkPassword(c *gin.Context) {
+	var payload LinkPasswordPayload
+	user := c.MustGet("user").(models.User)
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !ValidateReauthToken(controller.Cache, payload.ReauthToken, user.ID.String()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Reauthentication required"})
+		return
+	}
+
+	if len(payload.Password) <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password is required"})
+		return
+	}
+
+	_, err := controller.IdentityRepository.GetIdentity("password", user.ID.String())
+
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Password already linked"})
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	user.Password = payload.Password
+
+	if err = user.HashPassword(); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	transaction, err := controller.UserRepository.BeginTransaction()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = controller.UserRepository.UpdateUser(&user, transaction)
+
+	if err != nil {
+		transaction.Rollback()
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	identity, err := controller.IdentityRepository.CreateIdentity(models.NewIdentity(user.ID, "password", user.ID.String()), transaction)
+
+	if err != nil {
+		transaction.Rollback()
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = transaction.Commit()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, identity)
+
+	return
+}
+
+type UnlinkIdentityPayload struct {
+	ReauthToken string `json:"reauth_token"`
+}
+
+func (controller IdentityController) UnlinkIdentity(c *gin.Context) {
+	var payload UnlinkIdentityPayload
+	user := c.MustGet("user").(models.User)
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !ValidateReauthToken(controller.Cache, payload.ReauthToken, user.ID.String()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Reauthentication required"})
+		return
+	}
+
+	identities, err := controller.IdentityRepository.GetIdentitiesByOwner(user.ID.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var identity *models.Identity
+
+	for i := range identities {
+		if identities[i].ID.String() == c.Param("id") {
+			identity = &identities[i]
+		}
+	}
+
+	if identity == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	methods, err := CountLoginMethods(controller.IdentityRepository, controller.WebAuthnCredentialRepository, user.ID.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if methods <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot remove the last login method"})
+		return
+	}
+
+	transaction, err := controller.UserRepository.BeginTransaction()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = controller.IdentityRepository.DeleteIdentity(identity.ID.String(), user.ID.String(), transaction)
+
+	if err != nil {
+		transaction.Rollback()
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if identity.Provider == "password" {
+		user.Password = ""
+
+		_, err = controller.UserRepository.UpdateUser(&user, transaction)
+
+		if err != nil {
+			transaction.Rollback()
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	err = transaction.Commit()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
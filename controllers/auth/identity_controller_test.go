@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/directory"
+)
+
+type identityFixture struct {
+	authFixture
+	user *models.User
+}
+
+// newIdentityFixture signs up nothing, the user is stored the way accounts
+// older than identities were: a password and no identity at all.
+func newIdentityFixture(t *testing.T) identityFixture {
+	fixture := newAuthFixture(t)
+	user := fixture.createUser(t, "jane@example.com", "password123")
+	outbox := fixture.emailOutbox()
+
+	authController := NewAuthController(fixture.users, fixture.refreshTokens, fixture.credentials, fixture.identities, fixture.jwt, outbox, fixture.cache, map[string]directory.DirectoryProvider{})
+	passwordlessController := NewPasswordlessController(fixture.users, fixture.refreshTokens, fixture.credentials, fixture.identities, fixture.jwt, outbox, fixture.cache)
+	identityController := NewIdentityController(fixture.users, fixture.identities, fixture.credentials, fixture.cache)
+
+	fixture.engine.POST("/login", authController.Login)
+	fixture.engine.POST("/passwordless/send", passwordlessController.SendPasswordless)
+	fixture.engine.POST("/passwordless/verify", passwordlessController.VerifyPasswordless)
+	fixture.engine.POST("/reauthenticate", func(c *gin.Context) { c.Set("user", *user) }, identityController.Reauthenticate)
+
+	return identityFixture{fixture, user}
+}
+
+func (f identityFixture) passwordlessLogin(t *testing.T) int {
+	f.post(t, "/passwordless/send", SendPasswordlessPayload{Email: f.user.Email, Method: "link"})
+
+	return f.post(t, "/passwordless/verify", VerifyPasswordlessPayload{Token: f.lastEmail(t)["token"]})
+}
+
+func TestLoginBackfillsIdentities(t *testing.T) {
+	fixture := newIdentityFixture(t)
+
+	if status := fixture.post(t, "/login", LoginPayload{Email: fixture.user.Email, Password: "password123"}); status != http.StatusOK {
+		t.Fatalf("login: got status %d", status)
+	}
+
+	identities, _ := fixture.identities.GetIdentitiesByOwner(fixture.user.ID.String())
+
+	if !HasIdentity(identities, "password") || !HasIdentity(identities, "email") || len(identities) != 2 {
+		t.Fatalf("identities: got %+v", identities)
+	}
+
+	if status := fixture.post(t, "/login", LoginPayload{Email: fixture.user.Email, Password: "password123"}); status != http.StatusOK {
+		t.Fatalf("second login: got status %d", status)
+	}
+
+	if identities, _ = fixture.identities.GetIdentitiesByOwner(fixture.user.ID.String()); len(identities) != 2 {
+		t.Fatalf("identities were backfilled twice: %+v", identities)
+	}
+}
+
+func TestPasswordlessLoginRequiresEmailIdentity(t *testing.T) {
+	fixture := newIdentityFixture(t)
+
+	if status := fixture.passwordlessLogin(t); status != http.StatusOK {
+		t.Fatalf("legacy account: got status %d", status)
+	}
+
+	identities, _ := fixture.identities.GetIdentitiesByOwner(fixture.user.ID.String())
+
+	for _, identity := range identities {
+		if identity.Provider == "email" {
+			fixture.identities.DeleteIdentity(identity.ID.String(), fixture.user.ID.String(), nil)
+		}
+	}
+
+	if status := fixture.passwordlessLogin(t); status != http.StatusBadRequest {
+		t.Fatalf("unlinked email: got status %d, want 400", status)
+	}
+
+	if identities, _ = fixture.identities.GetIdentitiesByOwner(fixture.user.ID.String()); HasIdentity(identities, "email") {
+		t.Fatal("the unlinked email identity came back")
+	}
+}
+
+func TestReauthenticateCodeAttemptsAreCapped(t *testing.T) {
+	fixture := newIdentityFixture(t)
+
+	if status := fixture.post(t, "/passwordless/send", SendPasswordlessPayload{Email: fixture.user.Email, Method: "code"}); status != http.StatusNoContent {
+		t.Fatalf("send: got status %d", status)
+	}
+
+	code := fixture.lastEmail(t)["code"]
+
+	for i := 0; i < maxPasswordlessAttempts; i++ {
+		if status := fixture.post(t, "/reauthenticate", ReauthenticatePayload{Code: wrongCode(code)}); status != http.StatusForbidden {
+			t.Fatalf("attempt %d: got status %d, want 403", i+1, status)
+		}
+	}
+
+	if status := fixture.post(t, "/reauthenticate", ReauthenticatePayload{Code: code}); status != http.StatusTooManyRequests {
+		t.Fatalf("over the limit: got status %d, want 429", status)
+	}
+
+	// The code was burnt, it doesn't sign in either.
+	if status := fixture.post(t, "/passwordless/verify", VerifyPasswordlessPayload{Email: fixture.user.Email, Code: code}); status == http.StatusOK {
+		t.Fatal("the code still signs in")
+	}
+}
+
+func TestReauthenticateWithCode(t *testing.T) {
+	fixture := newIdentityFixture(t)
+
+	fixture.post(t, "/passwordless/send", SendPasswordlessPayload{Email: fixture.user.Email, Method: "code"})
+	code := fixture.lastEmail(t)["code"]
+
+	fixture.post(t, "/reauthenticate", ReauthenticatePayload{Code: wrongCode(code)})
+
+	if status := fixture.post(t, "/reauthenticate", ReauthenticatePayload{Code: code}); status != http.StatusOK {
+		t.Fatalf("right code: got status %d", status)
+	}
+
+	if status := fixture.post(t, "/reauthenticate", ReauthenticatePayload{Code: code}); status != http.StatusForbidden {
+		t.Fatalf("replayed code: got status %d, want 403", status)
+	}
+}
@@ -0,0 +1,465 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/i18n"
+	"github.com/thiagoferolla/go-auth/providers/email"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"gopkg.in/guregu/null.v4"
+)
+
+type InvitationController struct {
+	UserRepository         models.UserRepository
+	RefreshTokenRepository models.RefreshTokenRepository
+	IdentityRepository     models.IdentityRepository
+	OrganizationRepository models.OrganizationRepository
+	MembershipRepository   models.MembershipRepository
+	InvitationRepository   models.InvitationRepository
+	JwtProvider            jwt.JWTProvider
+	Outbox                 *email.Outbox
+}
+
+func NewInvitationController(userRepository models.UserRepository, refreshTokenRepository models.RefreshTokenRepository, identityRepository models.IdentityRepository, organizationRepository models.OrganizationRepository, membershipRepository models.MembershipRepository, invitationRepository models.InvitationRepository, jwtProvider jwt.JWTProvider, outbox *email.Outbox) *InvitationController {
+	return &InvitationController{userRepository, refreshTokenRepository, identityRepository, organizationRepository, membershipRepository, invitationRepository, jwtProvider, outbox}
+}
+
+// canManage lets member managers handle their organization's invitations and
+// platform admins handle invitations to the platform itself.
+func (controller InvitationController) canManage(user models.User, organization null.String) (models.Membership, bool) {
+	if !organization.Valid {
+		return models.Membership{}, user.Role == "admin"
+	}
+
+	membership, err := controller.MembershipRepository.GetMembership(organization.String, user.ID.String())
+
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println(err)
+		}
+
+		return membership, false
+	}
+
+	return membership, membership.CanManageMembers()
+}
+
+// renewToken gives the invitation a new token and expiry, the token is only
+// kept hashed so it has to be emailed right away.
+func renewToken(invitation *models.Invitation) (string, error) {
+	token, err := uuid.NewRandom()
+
+	if err != nil {
+		return "", err
+	}
+
+	invitation.TokenHash = HashToken(token.String())
+	invitation.ExpiresAt = time.Now().Add(models.InvitationExpiration)
+
+	return token.String(), nil
+}
+
+func (controller InvitationController) sendInvitation(invitation models.Invitation, inviter models.User, token string, transaction *sql.Tx) error {
+	message := email.Invitation{InviterName: inviter.Name.String, Token: token}
+
+	if invitation.Organization.Valid {
+		organization, err := controller.OrganizationRepository.GetOrganizationByID(invitation.Organization.String)
+
+		if err != nil {
+			return err
+		}
+
+		message.Organization = organization.Name
+	}
+
+	// The invitee has no locale yet, the inviter's is the best guess.
+	return controller.Outbox.Enqueue("invitation:"+invitation.TokenHash, "", invitation.Email, inviter.Locale, message, transaction)
+}
+
+type CreateInvitationPayload struct {
+	Email          string      `json:"email"`
+	Role           string      `json:"role"`
+	OrganizationID null.String `json:"organization_id"`
+}
+
+func (controller InvitationController) CreateInvitation(c *gin.Context) {
+	var payload CreateInvitationPayload
+	user := c.MustGet("user").(models.User)
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payload.Email = strings.TrimSpace(payload.Email)
+
+	if !models.ValidateEmail(payload.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email"})
+		return
+	}
+
+	membership, ok := controller.canManage(user, payload.OrganizationID)
+
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	if payload.OrganizationID.Valid {
+		if len(payload.Role) <= 0 {
+			payload.Role = models.MemberRole
+		}
+
+		if !models.ValidateMembershipRole(payload.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+			return
+		}
+
+		if payload.Role == models.OwnerRole && membership.Role != models.OwnerRole {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can invite owners"})
+			return
+		}
+
+		invitee, err := controller.UserRepository.GetUserByEmail(payload.Email)
+
+		if err == nil {
+			_, err = controller.MembershipRepository.GetMembership(payload.OrganizationID.String, invitee.ID.String())
+
+			if err == nil {
+				c.JSON(http.StatusConflict, gin.H{"error": "User is already a member"})
+				return
+			}
+		}
+
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		if len(payload.Role) <= 0 {
+			payload.Role = "user"
+		}
+
+		if !models.ValidatePlatformRole(payload.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+			return
+		}
+
+		_, err := controller.UserRepository.GetUserByEmail(payload.Email)
+
+		if err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
+			return
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	invitation := models.NewInvitation(user.ID, payload.Email, payload.OrganizationID, payload.Role)
+
+	token, err := renewToken(invitation)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	transaction, err := controller.UserRepository.BeginTransaction()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = controller.InvitationRepository.CreateInvitation(invitation, transaction)
+
+	if err == nil {
+		err = controller.sendInvitation(*invitation, user, token, transaction)
+	}
+
+	if err != nil {
+		transaction.Rollback()
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = transaction.Commit(); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	controller.Outbox.Notify()
+
+	c.JSON(http.StatusCreated, invitation)
+
+	return
+}
+
+func (controller InvitationController) ListInvitations(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	organization := null.NewString(c.Query("organization_id"), len(c.Query("organization_id")) > 0)
+
+	if _, ok := controller.canManage(user, organization); !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	invitations, err := controller.InvitationRepository.GetPendingInvitations(organization)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+
+	return
+}
+
+// pendingInvitation loads the invitation from the path, checking the user
+// may manage it and that it was not accepted or revoked yet.
+func (controller InvitationController) pendingInvitation(c *gin.Context) (models.Invitation, bool) {
+	user := c.MustGet("user").(models.User)
+
+	invitation, err := controller.InvitationRepository.GetInvitationByID(c.Param("id"))
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return invitation, false
+	}
+
+	if _, ok := controller.canManage(user, invitation.Organization); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return invitation, false
+	}
+
+	if invitation.Status != models.InvitationPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invitation is " + invitation.Status})
+		return invitation, false
+	}
+
+	return invitation, true
+}
+
+// ResendInvitation emails a new token, which also restarts the expiry.
+func (controller InvitationController) ResendInvitation(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	invitation, ok := controller.pendingInvitation(c)
+
+	if !ok {
+		return
+	}
+
+	token, err := renewToken(&invitation)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	transaction, err := controller.UserRepository.BeginTransaction()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = controller.InvitationRepository.UpdateInvitation(&invitation, transaction)
+
+	if err == nil {
+		err = controller.sendInvitation(invitation, user, token, transaction)
+	}
+
+	if err != nil {
+		transaction.Rollback()
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = transaction.Commit(); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	controller.Outbox.Notify()
+
+	c.JSON(http.StatusOK, invitation)
+
+	return
+}
+
+func (controller InvitationController) RevokeInvitation(c *gin.Context) {
+	invitation, ok := controller.pendingInvitation(c)
+
+	if !ok {
+		return
+	}
+
+	invitation.Status = models.InvitationRevoked
+
+	_, err := controller.InvitationRepository.UpdateInvitation(&invitation, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
+
+type AcceptInvitationPayload struct {
+	Token    string `json:"token"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// AcceptInvitation attaches the invited email's account to the organization
+// when it already exists, otherwise it signs the user up with the email
+// already verified since the token was delivered to it.
+func (controller InvitationController) AcceptInvitation(c *gin.Context) {
+	var payload AcceptInvitationPayload
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invitation, err := controller.InvitationRepository.GetInvitationByTokenHash(HashToken(payload.Token))
+
+	if err != nil || !invitation.IsOpen() {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		return
+	}
+
+	user, err := controller.UserRepository.GetUserByEmail(invitation.Email)
+	isNewUser := errors.Is(err, sql.ErrNoRows)
+
+	if err != nil && !isNewUser {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if isNewUser {
+		newUser, err := models.NewUser(payload.Name, invitation.Email, payload.Password, "password")
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user = *newUser
+		user.Locale = i18n.Negotiate(c.GetHeader("Accept-Language"))
+		user.OrganizationID = invitation.Organization
+
+		// Invitations sent before roles were checked may still be pending.
+		if !invitation.Organization.Valid && models.ValidatePlatformRole(invitation.Role) {
+			user.Role = invitation.Role
+		}
+	}
+
+	user.EmailVerifiedAt = null.NewTime(time.Now(), true)
+
+	transaction, err := controller.UserRepository.BeginTransaction()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Accepting first means a concurrent request with the same token waits on
+	// the row and then finds the invitation no longer pending.
+	_, err = controller.InvitationRepository.AcceptInvitation(&invitation, transaction)
+
+	if err != nil {
+		transaction.Rollback()
+
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var response AuthResponse
+
+	if isNewUser {
+		response, err = RegisterPasswordUser(controller.UserRepository, controller.IdentityRepository, controller.RefreshTokenRepository, controller.JwtProvider, &user, transaction)
+	} else {
+		_, err = controller.UserRepository.UpdateUser(&user, transaction)
+	}
+
+	if err != nil {
+		transaction.Rollback()
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if invitation.Organization.Valid {
+		organizationID, _ := uuid.Parse(invitation.Organization.String)
+
+		_, err = controller.MembershipRepository.GetMembership(invitation.Organization.String, user.ID.String())
+
+		if errors.Is(err, sql.ErrNoRows) {
+			_, err = controller.MembershipRepository.CreateMembership(models.NewMembership(organizationID, user.ID, invitation.Role), transaction)
+		}
+
+		if err != nil {
+			transaction.Rollback()
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	err = transaction.Commit()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if isNewUser {
+		c.JSON(http.StatusCreated, response)
+		return
+	}
+
+	c.JSON(http.StatusOK, invitation)
+
+	return
+}
@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/repositories/memory"
+	"gopkg.in/guregu/null.v4"
+)
+
+type invitationFixture struct {
+	authFixture
+	organizations *memory.OrganizationRepository
+	memberships   *memory.MembershipRepository
+	invitations   models.InvitationRepository
+	organization  models.Organization
+	owner         *models.User
+	member        *models.User
+}
+
+// newInvitationFixture sets up Acme with an owner and a plain member. The
+// routes act as the user whose id is in the X-User header.
+func newInvitationFixture(t *testing.T) invitationFixture {
+	return newInvitationFixtureWith(t, memory.NewInvitationRepository())
+}
+
+func newInvitationFixtureWith(t *testing.T, invitations models.InvitationRepository) invitationFixture {
+	fixture := invitationFixture{
+		authFixture: newAuthFixture(t),
+		memberships: memory.NewMembershipRepository(),
+		invitations: invitations,
+	}
+
+	organization, _ := models.NewOrganization("Acme")
+	fixture.organization = *organization
+	fixture.organizations = memory.NewOrganizationRepository(fixture.memberships)
+	fixture.organizations.CreateOrganization(organization, nil)
+
+	fixture.owner = fixture.createUser(t, "owner@example.com", "password123")
+	fixture.member = fixture.createUser(t, "member@example.com", "password123")
+	fixture.memberships.CreateMembership(models.NewMembership(organization.ID, fixture.owner.ID, models.OwnerRole), nil)
+	fixture.memberships.CreateMembership(models.NewMembership(organization.ID, fixture.member.ID, models.MemberRole), nil)
+
+	controller := NewInvitationController(fixture.users, fixture.refreshTokens, fixture.identities, fixture.organizations, fixture.memberships, invitations, fixture.jwt, fixture.emailOutbox())
+
+	fixture.engine.POST("/invitations/accept", controller.AcceptInvitation)
+	fixture.engine.POST("/invitations", fixture.signedIn, controller.CreateInvitation)
+	fixture.engine.POST("/invitations/:id/resend", fixture.signedIn, controller.ResendInvitation)
+	fixture.engine.POST("/invitations/:id/revoke", fixture.signedIn, controller.RevokeInvitation)
+
+	return fixture
+}
+
+// invite has the owner invite email to Acme and returns the invitation with
+// the token that was emailed.
+func (f invitationFixture) invite(t *testing.T, email string, role string) (models.Invitation, string) {
+	recorder := f.as(t, f.owner, http.MethodPost, "/invitations", CreateInvitationPayload{Email: email, Role: role, OrganizationID: null.StringFrom(f.organization.ID.String())})
+
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("invite: got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var invitation models.Invitation
+	json.Unmarshal(recorder.Body.Bytes(), &invitation)
+
+	return invitation, f.lastEmail(t)["token"]
+}
+
+func (f invitationFixture) accept(t *testing.T, token string) int {
+	return f.post(t, "/invitations/accept", AcceptInvitationPayload{Token: token, Name: "Joe", Password: "password123"})
+}
+
+func TestCreateInvitation(t *testing.T) {
+	fixture := newInvitationFixture(t)
+	admin := fixture.createUser(t, "admin@example.com", "password123")
+	fixture.memberships.CreateMembership(models.NewMembership(fixture.organization.ID, admin.ID, models.AdminRole), nil)
+
+	acme := null.StringFrom(fixture.organization.ID.String())
+
+	tests := []struct {
+		name    string
+		inviter *models.User
+		payload CreateInvitationPayload
+		status  int
+	}{
+		{"owner invites a member", fixture.owner, CreateInvitationPayload{Email: "joe@example.com", OrganizationID: acme}, http.StatusCreated},
+		{"admin invites an admin", admin, CreateInvitationPayload{Email: "joe@example.com", Role: models.AdminRole, OrganizationID: acme}, http.StatusCreated},
+		{"admin invites an owner", admin, CreateInvitationPayload{Email: "joe@example.com", Role: models.OwnerRole, OrganizationID: acme}, http.StatusForbidden},
+		{"member invites", fixture.member, CreateInvitationPayload{Email: "joe@example.com", OrganizationID: acme}, http.StatusForbidden},
+		{"unknown role", fixture.owner, CreateInvitationPayload{Email: "joe@example.com", Role: "superuser", OrganizationID: acme}, http.StatusBadRequest},
+		{"invalid email", fixture.owner, CreateInvitationPayload{Email: "joe", OrganizationID: acme}, http.StatusBadRequest},
+		{"existing member", fixture.owner, CreateInvitationPayload{Email: fixture.member.Email, OrganizationID: acme}, http.StatusConflict},
+		{"platform invitation by a non admin", fixture.owner, CreateInvitationPayload{Email: "joe@example.com"}, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := fixture.as(t, test.inviter, http.MethodPost, "/invitations", test.payload)
+
+			if recorder.Code != test.status {
+				t.Fatalf("got status %d, want %d: %s", recorder.Code, test.status, recorder.Body.String())
+			}
+
+			if test.status != http.StatusCreated {
+				return
+			}
+
+			var invitation models.Invitation
+			json.Unmarshal(recorder.Body.Bytes(), &invitation)
+
+			stored, err := fixture.invitations.GetInvitationByID(invitation.ID.String())
+
+			if err != nil || stored.TokenHash != HashToken(fixture.lastEmail(t)["token"]) || !stored.IsOpen() {
+				t.Fatalf("the emailed token doesn't open the invitation: %+v", stored)
+			}
+		})
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	fixture := newInvitationFixture(t)
+	invitation, token := fixture.invite(t, "joe@example.com", models.AdminRole)
+
+	if status := fixture.accept(t, token); status != http.StatusCreated {
+		t.Fatalf("got status %d, want 201", status)
+	}
+
+	user, err := fixture.users.GetUserByEmail("joe@example.com")
+
+	if err != nil || !user.EmailVerifiedAt.Valid {
+		t.Fatalf("got user %+v, %v", user, err)
+	}
+
+	membership, err := fixture.memberships.GetMembership(fixture.organization.ID.String(), user.ID.String())
+
+	if err != nil || membership.Role != models.AdminRole {
+		t.Fatalf("got membership %+v, %v", membership, err)
+	}
+
+	if stored, _ := fixture.invitations.GetInvitationByID(invitation.ID.String()); stored.Status != models.InvitationAccepted {
+		t.Fatalf("got status %q", stored.Status)
+	}
+
+	if status := fixture.accept(t, token); status != http.StatusBadRequest {
+		t.Fatalf("second accept: got status %d, want 400", status)
+	}
+}
+
+func TestAcceptInvitationJoinsExistingUser(t *testing.T) {
+	fixture := newInvitationFixture(t)
+	existing := fixture.createUser(t, "joe@example.com", "password123")
+	_, token := fixture.invite(t, existing.Email, "")
+
+	if status := fixture.accept(t, token); status != http.StatusOK {
+		t.Fatalf("got status %d, want 200", status)
+	}
+
+	membership, err := fixture.memberships.GetMembership(fixture.organization.ID.String(), existing.ID.String())
+
+	if err != nil || membership.Role != models.MemberRole {
+		t.Fatalf("got membership %+v, %v", membership, err)
+	}
+}
+
+func TestAcceptExpiredInvitation(t *testing.T) {
+	fixture := newInvitationFixture(t)
+	invitation, token := fixture.invite(t, "joe@example.com", "")
+
+	stored, _ := fixture.invitations.GetInvitationByID(invitation.ID.String())
+	stored.ExpiresAt = time.Now().Add(-time.Minute)
+	fixture.invitations.UpdateInvitation(&stored, nil)
+
+	if status := fixture.accept(t, token); status != http.StatusBadRequest {
+		t.Fatalf("got status %d, want 400", status)
+	}
+
+	if _, err := fixture.users.GetUserByEmail("joe@example.com"); err == nil {
+		t.Fatal("an expired invitation signed the user up")
+	}
+}
+
+// acceptedMeanwhile hands out the invitation as still pending, then has it
+// accepted by someone else before the request gets to accept it.
+type acceptedMeanwhile struct {
+	*memory.InvitationRepository
+}
+
+func (r acceptedMeanwhile) GetInvitationByTokenHash(tokenHash string) (models.Invitation, error) {
+	invitation, err := r.InvitationRepository.GetInvitationByTokenHash(tokenHash)
+
+	if err == nil {
+		accepted := invitation
+		r.InvitationRepository.AcceptInvitation(&accepted, nil)
+	}
+
+	return invitation, err
+}
+
+func TestAcceptInvitationOnlyOnce(t *testing.T) {
+	fixture := newInvitationFixtureWith(t, acceptedMeanwhile{memory.NewInvitationRepository()})
+	_, token := fixture.invite(t, "joe@example.com", "")
+
+	if status := fixture.accept(t, token); status != http.StatusBadRequest {
+		t.Fatalf("got status %d, want 400", status)
+	}
+
+	if _, err := fixture.users.GetUserByEmail("joe@example.com"); err == nil {
+		t.Fatal("a concurrent accept signed the user up twice")
+	}
+}
+
+func TestResendInvitation(t *testing.T) {
+	fixture := newInvitationFixture(t)
+	invitation, token := fixture.invite(t, "joe@example.com", "")
+
+	stored, _ := fixture.invitations.GetInvitationByID(invitation.ID.String())
+	stored.ExpiresAt = time.Now().Add(time.Hour)
+	fixture.invitations.UpdateInvitation(&stored, nil)
+
+	if recorder := fixture.as(t, fixture.member, http.MethodPost, "/invitations/"+invitation.ID.String()+"/resend", nil); recorder.Code != http.StatusNotFound {
+		t.Fatalf("member: got status %d, want 404", recorder.Code)
+	}
+
+	if recorder := fixture.as(t, fixture.owner, http.MethodPost, "/invitations/"+invitation.ID.String()+"/resend", nil); recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", recorder.Code)
+	}
+
+	resent := fixture.lastEmail(t)["token"]
+
+	if resent == token {
+		t.Fatal("the token was not renewed")
+	}
+
+	if stored, _ = fixture.invitations.GetInvitationByID(invitation.ID.String()); time.Until(stored.ExpiresAt) < models.InvitationExpiration-time.Minute {
+		t.Fatalf("the expiry was not restarted: %s", stored.ExpiresAt)
+	}
+
+	if status := fixture.accept(t, token); status != http.StatusBadRequest {
+		t.Fatalf("old token: got status %d, want 400", status)
+	}
+
+	if status := fixture.accept(t, resent); status != http.StatusCreated {
+		t.Fatalf("new token: got status %d, want 201", status)
+	}
+}
+
+func TestRevokeInvitation(t *testing.T) {
+	fixture := newInvitationFixture(t)
+	invitation, token := fixture.invite(t, "joe@example.com", "")
+	path := "/invitations/" + invitation.ID.String() + "/revoke"
+
+	if recorder := fixture.as(t, fixture.member, http.MethodPost, path, nil); recorder.Code != http.StatusNotFound {
+		t.Fatalf("member: got status %d, want 404", recorder.Code)
+	}
+
+	if recorder := fixture.as(t, fixture.owner, http.MethodPost, path, nil); recorder.Code != http.StatusNoContent {
+		t.Fatalf("got status %d, want 204", recorder.Code)
+	}
+
+	if recorder := fixture.as(t, fixture.owner, http.MethodPost, path, nil); recorder.Code != http.StatusConflict {
+		t.Fatalf("revoked twice: got status %d, want 409", recorder.Code)
+	}
+
+	if status := fixture.accept(t, token); status != http.StatusBadRequest {
+		t.Fatalf("accept: got status %d, want 400", status)
+	}
+}
@@ -0,0 +1,442 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"gopkg.in/guregu/null.v4"
+)
+
+type OrganizationController struct {
+	UserRepository               models.UserRepository
+	RefreshTokenRepository       models.RefreshTokenRepository
+	OrganizationRepository       models.OrganizationRepository
+	MembershipRepository         models.MembershipRepository
+	ProvisioningClientRepository models.ProvisioningClientRepository
+	JwtProvider                  jwt.JWTProvider
+}
+
+func NewOrganizationController(userRepository models.UserRepository, refreshTokenRepository models.RefreshTokenRepository, organizationRepository models.OrganizationRepository, membershipRepository models.MembershipRepository, provisioningClientRepository models.ProvisioningClientRepository, jwtProvider jwt.JWTProvider) *OrganizationController {
+	return &OrganizationController{userRepository, refreshTokenRepository, organizationRepository, membershipRepository, provisioningClientRepository, jwtProvider}
+}
+
+// membership loads the signed in user's membership in the organization from
+// the path, answering 404 when there is none so outsiders cannot probe ids.
+func (controller OrganizationController) membership(c *gin.Context) (models.Membership, bool) {
+	user := c.MustGet("user").(models.User)
+
+	membership, err := controller.MembershipRepository.GetMembership(c.Param("id"), user.ID.String())
+
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println(err)
+		}
+
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return membership, false
+	}
+
+	return membership, true
+}
+
+func (controller OrganizationController) ListOrganizations(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	organizations, err := controller.OrganizationRepository.GetOrganizationsByMember(user.ID.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, organizations)
+
+	return
+}
+
+type OrganizationPayload struct {
+	Name string `json:"name"`
+}
+
+// CreateOrganization makes the user its owner, and its active organization
+// when they had none.
+func (controller OrganizationController) CreateOrganization(c *gin.Context) {
+	var payload OrganizationPayload
+	user := c.MustGet("user").(models.User)
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	organization, err := models.NewOrganization(payload.Name)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transaction, err := controller.OrganizationRepository.BeginTransaction()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = controller.OrganizationRepository.CreateOrganization(organization, transaction)
+
+	if err != nil {
+		transaction.Rollback()
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = controller.MembershipRepository.CreateMembership(models.NewMembership(organization.ID, user.ID, models.OwnerRole), transaction)
+
+	if err != nil {
+		transaction.Rollback()
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !user.OrganizationID.Valid {
+		user.OrganizationID = null.NewString(organization.ID.String(), true)
+
+		_, err = controller.UserRepository.UpdateUser(&user, transaction)
+
+		if err != nil {
+			transaction.Rollback()
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	err = transaction.Commit()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, organization)
+
+	return
+}
+
+func (controller OrganizationController) GetOrganization(c *gin.Context) {
+	if _, ok := controller.membership(c); !ok {
+		return
+	}
+
+	organization, err := controller.OrganizationRepository.GetOrganizationByID(c.Param("id"))
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, organization)
+
+	return
+}
+
+// SwitchOrganization changes the active organization and issues tokens
+// carrying it in the org claim.
+func (controller OrganizationController) SwitchOrganization(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	membership, ok := controller.membership(c)
+
+	if !ok {
+		return
+	}
+
+	user.OrganizationID = null.NewString(membership.Organization.String(), true)
+
+	_, err := controller.UserRepository.UpdateUser(&user, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := IssueAuthResponse(controller.JwtProvider, controller.RefreshTokenRepository, user, false, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(issueErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+
+	return
+}
+
+func (controller OrganizationController) ListMembers(c *gin.Context) {
+	if _, ok := controller.membership(c); !ok {
+		return
+	}
+
+	memberships, err := controller.MembershipRepository.GetMembershipsByOrganization(c.Param("id"))
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, memberships)
+
+	return
+}
+
+type AddMemberPayload struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// AddMember attaches an existing user to the organization.
+func (controller OrganizationController) AddMember(c *gin.Context) {
+	var payload AddMemberPayload
+
+	current, ok := controller.membership(c)
+
+	if !ok {
+		return
+	}
+
+	if !current.CanManageMembers() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(payload.Role) <= 0 {
+		payload.Role = models.MemberRole
+	}
+
+	if !models.ValidateMembershipRole(payload.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+		return
+	}
+
+	if payload.Role == models.OwnerRole && current.Role != models.OwnerRole {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can add owners"})
+		return
+	}
+
+	member, err := controller.UserRepository.GetUserByEmail(payload.Email)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	_, err = controller.MembershipRepository.GetMembership(current.Organization.String(), member.ID.String())
+
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member"})
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	membership, err := controller.MembershipRepository.CreateMembership(models.NewMembership(current.Organization, member.ID, payload.Role), nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, membership)
+
+	return
+}
+
+type UpdateMemberPayload struct {
+	Role string `json:"role"`
+}
+
+func (controller OrganizationController) UpdateMember(c *gin.Context) {
+	var payload UpdateMemberPayload
+
+	current, ok := controller.membership(c)
+
+	if !ok {
+		return
+	}
+
+	if !current.CanManageMembers() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !models.ValidateMembershipRole(payload.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+		return
+	}
+
+	membership, err := controller.MembershipRepository.GetMembership(current.Organization.String(), c.Param("user_id"))
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	if (payload.Role == models.OwnerRole || membership.Role == models.OwnerRole) && current.Role != models.OwnerRole {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can change owners"})
+		return
+	}
+
+	if membership.Role == models.OwnerRole && payload.Role != models.OwnerRole && !controller.hasOtherOwner(c, membership) {
+		return
+	}
+
+	membership.Role = payload.Role
+
+	_, err = controller.MembershipRepository.UpdateMembership(&membership, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, membership)
+
+	return
+}
+
+// RemoveMember is open to member managers and to members leaving on their
+// own, the removed user's active organization is cleared if it was this one.
+func (controller OrganizationController) RemoveMember(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	current, ok := controller.membership(c)
+
+	if !ok {
+		return
+	}
+
+	if !current.CanManageMembers() && c.Param("user_id") != user.ID.String() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	membership, err := controller.MembershipRepository.GetMembership(current.Organization.String(), c.Param("user_id"))
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	if membership.Role == models.OwnerRole && membership.User != user.ID && current.Role != models.OwnerRole {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can remove owners"})
+		return
+	}
+
+	if membership.Role == models.OwnerRole && !controller.hasOtherOwner(c, membership) {
+		return
+	}
+
+	member, err := controller.UserRepository.GetUserByID(membership.User.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	transaction, err := controller.OrganizationRepository.BeginTransaction()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = controller.MembershipRepository.DeleteMembership(membership.Organization.String(), membership.User.String(), transaction)
+
+	if err != nil {
+		transaction.Rollback()
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if member.OrganizationID.String == membership.Organization.String() {
+		member.OrganizationID = null.String{}
+
+		_, err = controller.UserRepository.UpdateUser(&member, transaction)
+
+		if err != nil {
+			transaction.Rollback()
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	err = transaction.Commit()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
+
+// hasOtherOwner keeps every organization with at least one owner.
+func (controller OrganizationController) hasOtherOwner(c *gin.Context, membership models.Membership) bool {
+	owners, err := controller.MembershipRepository.CountMembershipsByRole(membership.Organization.String(), models.OwnerRole)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+
+	if owners <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Organization must keep an owner"})
+		return false
+	}
+
+	return true
+}
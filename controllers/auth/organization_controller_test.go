@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/repositories/memory"
+)
+
+type organizationFixture struct {
+	authFixture
+	memberships *memory.MembershipRepository
+	acme        models.Organization
+	globex      models.Organization
+	owner       *models.User
+	member      *models.User
+	outsider    *models.User
+}
+
+// newOrganizationFixture sets up Acme with an owner and a member, and Globex
+// owned by an outsider to Acme.
+func newOrganizationFixture(t *testing.T) organizationFixture {
+	fixture := organizationFixture{
+		authFixture: newAuthFixture(t),
+		memberships: memory.NewMembershipRepository(),
+	}
+
+	organizations := memory.NewOrganizationRepository(fixture.memberships)
+
+	acme, _ := models.NewOrganization("Acme")
+	globex, _ := models.NewOrganization("Globex")
+	organizations.CreateOrganization(acme, nil)
+	organizations.CreateOrganization(globex, nil)
+	fixture.acme = *acme
+	fixture.globex = *globex
+
+	fixture.owner = fixture.createUser(t, "owner@example.com", "password123")
+	fixture.member = fixture.createUser(t, "member@example.com", "password123")
+	fixture.outsider = fixture.createUser(t, "outsider@example.com", "password123")
+	fixture.memberships.CreateMembership(models.NewMembership(acme.ID, fixture.owner.ID, models.OwnerRole), nil)
+	fixture.memberships.CreateMembership(models.NewMembership(acme.ID, fixture.member.ID, models.MemberRole), nil)
+	fixture.memberships.CreateMembership(models.NewMembership(globex.ID, fixture.outsider.ID, models.OwnerRole), nil)
+
+	controller := NewOrganizationController(fixture.users, fixture.refreshTokens, organizations, fixture.memberships, nil, fixture.jwt)
+
+	group := fixture.engine.Group("/organizations", fixture.signedIn)
+	group.GET("/:id", controller.GetOrganization)
+	group.GET("/:id/members", controller.ListMembers)
+	group.POST("/:id/members", controller.AddMember)
+	group.PATCH("/:id/members/:user_id", controller.UpdateMember)
+	group.DELETE("/:id/members/:user_id", controller.RemoveMember)
+	group.POST("/:id/switch", controller.SwitchOrganization)
+
+	return fixture
+}
+
+func (f organizationFixture) path(organization models.Organization, rest string) string {
+	return "/organizations/" + organization.ID.String() + rest
+}
+
+// Outsiders get the same 404 as for an organization that doesn't exist, so
+// they can't tell which ids are taken.
+func TestOrganizationRefusesOutsiders(t *testing.T) {
+	fixture := newOrganizationFixture(t)
+	member := "/members/" + fixture.member.ID.String()
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		payload any
+	}{
+		{"get", http.MethodGet, fixture.path(fixture.acme, ""), nil},
+		{"list members", http.MethodGet, fixture.path(fixture.acme, "/members"), nil},
+		{"add member", http.MethodPost, fixture.path(fixture.acme, "/members"), AddMemberPayload{Email: fixture.outsider.Email}},
+		{"update member", http.MethodPatch, fixture.path(fixture.acme, member), UpdateMemberPayload{Role: models.OwnerRole}},
+		{"remove member", http.MethodDelete, fixture.path(fixture.acme, member), nil},
+		{"switch", http.MethodPost, fixture.path(fixture.acme, "/switch"), nil},
+		{"member through their own organization", http.MethodDelete, fixture.path(fixture.globex, member), nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if recorder := fixture.as(t, fixture.outsider, test.method, test.path, test.payload); recorder.Code != http.StatusNotFound {
+				t.Fatalf("got status %d, want 404: %s", recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+
+	if _, err := fixture.memberships.GetMembership(fixture.acme.ID.String(), fixture.member.ID.String()); err != nil {
+		t.Fatalf("the member was removed: %v", err)
+	}
+
+	if _, err := fixture.memberships.GetMembership(fixture.acme.ID.String(), fixture.outsider.ID.String()); err == nil {
+		t.Fatal("the outsider joined Acme")
+	}
+
+	if user, _ := fixture.users.GetUserByID(fixture.outsider.ID.String()); user.OrganizationID.String == fixture.acme.ID.String() {
+		t.Fatal("the outsider switched to Acme")
+	}
+}
+
+func TestOrganizationKeepsAnOwner(t *testing.T) {
+	fixture := newOrganizationFixture(t)
+	owner := "/members/" + fixture.owner.ID.String()
+
+	if recorder := fixture.as(t, fixture.owner, http.MethodDelete, fixture.path(fixture.acme, owner), nil); recorder.Code != http.StatusConflict {
+		t.Fatalf("last owner leaving: got status %d, want 409", recorder.Code)
+	}
+
+	if recorder := fixture.as(t, fixture.owner, http.MethodPatch, fixture.path(fixture.acme, owner), UpdateMemberPayload{Role: models.MemberRole}); recorder.Code != http.StatusConflict {
+		t.Fatalf("last owner stepping down: got status %d, want 409", recorder.Code)
+	}
+
+	member := "/members/" + fixture.member.ID.String()
+
+	if recorder := fixture.as(t, fixture.owner, http.MethodPatch, fixture.path(fixture.acme, member), UpdateMemberPayload{Role: models.OwnerRole}); recorder.Code != http.StatusOK {
+		t.Fatalf("promoting a second owner: got status %d", recorder.Code)
+	}
+
+	if recorder := fixture.as(t, fixture.owner, http.MethodDelete, fixture.path(fixture.acme, owner), nil); recorder.Code != http.StatusNoContent {
+		t.Fatalf("leaving with another owner: got status %d, want 204", recorder.Code)
+	}
+
+	if owners, _ := fixture.memberships.CountMembershipsByRole(fixture.acme.ID.String(), models.OwnerRole); owners != 1 {
+		t.Fatalf("got %d owners, want 1", owners)
+	}
+}
+
+func TestRemoveMemberPermissions(t *testing.T) {
+	fixture := newOrganizationFixture(t)
+	admin := fixture.createUser(t, "admin@example.com", "password123")
+	fixture.memberships.CreateMembership(models.NewMembership(fixture.acme.ID, admin.ID, models.AdminRole), nil)
+
+	tests := []struct {
+		name   string
+		actor  *models.User
+		target *models.User
+		status int
+	}{
+		{"member removes another", fixture.member, admin, http.StatusForbidden},
+		{"admin removes an owner", admin, fixture.owner, http.StatusForbidden},
+		{"member leaves", fixture.member, fixture.member, http.StatusNoContent},
+		{"owner removes an admin", fixture.owner, admin, http.StatusNoContent},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := fixture.path(fixture.acme, "/members/"+test.target.ID.String())
+
+			if recorder := fixture.as(t, test.actor, http.MethodDelete, path, nil); recorder.Code != test.status {
+				t.Fatalf("got status %d, want %d", recorder.Code, test.status)
+			}
+		})
+	}
+}
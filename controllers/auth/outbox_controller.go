@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/email"
+)
+
+// OutboxController lets admins see emails that could not be delivered and
+// put them back in the queue.
+type OutboxController struct {
+	OutboxEmailRepository models.OutboxEmailRepository
+	Outbox                *email.Outbox
+}
+
+func NewOutboxController(outboxEmailRepository models.OutboxEmailRepository, outbox *email.Outbox) *OutboxController {
+	return &OutboxController{outboxEmailRepository, outbox}
+}
+
+// ListEmails shows dead-lettered emails unless another status is asked for.
+func (controller OutboxController) ListEmails(c *gin.Context) {
+	status := c.DefaultQuery("status", models.OutboxDead)
+
+	if status != models.OutboxPending && status != models.OutboxSent && status != models.OutboxDead && status != models.OutboxSuppressed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+		return
+	}
+
+	emails, err := controller.OutboxEmailRepository.GetOutboxEmailsByStatus(status)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, emails)
+
+	return
+}
+
+func (controller OutboxController) GetEmail(c *gin.Context) {
+	outboxEmail, err := controller.OutboxEmailRepository.GetOutboxEmailByID(c.Param("id"))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	} else if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, outboxEmail)
+
+	return
+}
+
+func (controller OutboxController) RetryEmail(c *gin.Context) {
+	outboxEmail, err := controller.OutboxEmailRepository.GetOutboxEmailByID(c.Param("id"))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	} else if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if outboxEmail.Status != models.OutboxDead && outboxEmail.Status != models.OutboxSuppressed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only failed emails can be retried"})
+		return
+	}
+
+	// The tokens it carried were cleared, the user has to ask for a new one.
+	if !outboxEmail.HasContent() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email content was cleared and can't be sent again"})
+		return
+	}
+
+	outboxEmail.Retry()
+
+	_, err = controller.OutboxEmailRepository.UpdateOutboxEmail(&outboxEmail, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	controller.Outbox.Notify()
+
+	c.JSON(http.StatusOK, outboxEmail)
+
+	return
+}
@@ -0,0 +1,489 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+)
+
+const passkeySessionExpiration = 5 * time.Minute
+
+type PasskeyController struct {
+	UserRepository               models.UserRepository
+	RefreshTokenRepository       models.RefreshTokenRepository
+	WebAuthnCredentialRepository models.WebAuthnCredentialRepository
+	IdentityRepository           models.IdentityRepository
+	JwtProvider                  jwt.JWTProvider
+	Cache                        cache.CacheProvider
+	WebAuthn                     *webauthn.WebAuthn
+}
+
+func NewPasskeyController(userRepository models.UserRepository, refreshTokenRepository models.RefreshTokenRepository, webAuthnCredentialRepository models.WebAuthnCredentialRepository, identityRepository models.IdentityRepository, jwtProvider jwt.JWTProvider, cache cache.CacheProvider, webAuthn *webauthn.WebAuthn) *PasskeyController {
+	return &PasskeyController{userRepository, refreshTokenRepository, webAuthnCredentialRepository, identityRepository, jwtProvider, cache, webAuthn}
+}
+
+// passkeyUser adapts a user and its stored credentials to webauthn.User.
+type passkeyUser struct {
+	User        models.User
+	Credentials []models.WebAuthnCredential
+}
+
+func (u passkeyUser) WebAuthnID() []byte {
+	return u.User.ID[:]
+}
+
+func (u passkeyUser) WebAuthnName() string {
+	return u.User.Email
+}
+
+func (u passkeyUser) WebAuthnDisplayName() string {
+	if u.User.Name.Valid && len(u.User.Name.String) > 0 {
+		return u.User.Name.String
+	}
+
+	return u.User.Email
+}
+
+func (u passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.Credentials))
+
+	for _, credential := range u.Credentials {
+		credentials = append(credentials, toWebAuthnCredential(credential))
+	}
+
+	return credentials
+}
+
+func toWebAuthnCredential(credential models.WebAuthnCredential) webauthn.Credential {
+	transports := []protocol.AuthenticatorTransport{}
+
+	for _, transport := range strings.Split(credential.Transports, ",") {
+		if len(transport) > 0 {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+	}
+
+	return webauthn.Credential{
+		ID:              credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transport:       transports,
+		Flags:           webauthn.NewCredentialFlags(protocol.AuthenticatorFlags(credential.Flags)),
+		Authenticator: webauthn.Authenticator{
+			AAGUID:       credential.AAGUID,
+			SignCount:    credential.SignCount,
+			CloneWarning: credential.CloneWarning,
+		},
+	}
+}
+
+func fromWebAuthnCredential(owner uuid.UUID, credential webauthn.Credential) *models.WebAuthnCredential {
+	transports := make([]string, 0, len(credential.Transport))
+
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	return &models.WebAuthnCredential{
+		ID:              credential.ID,
+		Owner:           owner,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		CloneWarning:    credential.Authenticator.CloneWarning,
+		Flags:           byte(credential.Flags.ProtocolValue()),
+	}
+}
+
+func (controller PasskeyController) loadPasskeyUser(userID string) (passkeyUser, error) {
+	user, err := controller.UserRepository.GetUserByID(userID)
+
+	if err != nil {
+		return passkeyUser{}, err
+	}
+
+	credentials, err := controller.WebAuthnCredentialRepository.GetCredentialsByOwner(user.ID.String())
+
+	if err != nil {
+		return passkeyUser{}, err
+	}
+
+	return passkeyUser{user, credentials}, nil
+}
+
+func (controller PasskeyController) findDiscoverableUser(rawID []byte, userHandle []byte) (webauthn.User, error) {
+	id, err := uuid.FromBytes(userHandle)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return controller.loadPasskeyUser(id.String())
+}
+
+// passkeySession is the ceremony state kept between the options and verify
+// calls, MFAToken is the challenge a second factor login will spend.
+type passkeySession struct {
+	Session  webauthn.SessionData `json:"session"`
+	MFAToken string               `json:"mfa_token,omitempty"`
+}
+
+func (controller PasskeyController) saveSession(session *webauthn.SessionData, mfaToken string) (string, error) {
+	sessionID, err := uuid.NewRandom()
+
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(passkeySession{*session, mfaToken})
+
+	if err != nil {
+		return "", err
+	}
+
+	err = controller.Cache.SetEx("webauthn:"+sessionID.String(), string(data), passkeySessionExpiration)
+
+	return sessionID.String(), err
+}
+
+// getSession spends the session, a ceremony can only be finished once.
+func (controller PasskeyController) getSession(sessionID string) (passkeySession, error) {
+	var session passkeySession
+
+	if len(sessionID) <= 0 {
+		return session, errors.New("invalid session")
+	}
+
+	data, err := controller.Cache.GetDel("webauthn:" + sessionID)
+
+	if err != nil {
+		return session, err
+	}
+
+	err = json.Unmarshal([]byte(data), &session)
+
+	return session, err
+}
+
+type PasskeyOptionsResponse struct {
+	SessionID string `json:"session_id"`
+	Options   any    `json:"options"`
+}
+
+type PasskeyResponse struct {
+	ID         string    `json:"id"`
+	Transports []string  `json:"transports"`
+	SignCount  uint32    `json:"sign_count"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (controller PasskeyController) BeginRegistration(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	pu, err := controller.loadPasskeyUser(user.ID.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	options, session, err := controller.WebAuthn.BeginRegistration(
+		pu,
+		webauthn.WithExclusions(webauthn.Credentials(pu.WebAuthnCredentials()).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	sessionID, err := controller.saveSession(session, "")
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, PasskeyOptionsResponse{SessionID: sessionID, Options: options})
+
+	return
+}
+
+func (controller PasskeyController) FinishRegistration(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	session, err := controller.getSession(c.Query("session_id"))
+
+	if err != nil || string(session.Session.UserID) != string(user.ID[:]) {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session"})
+		return
+	}
+
+	pu, err := controller.loadPasskeyUser(user.ID.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	credential, err := controller.WebAuthn.FinishRegistration(pu, session.Session, c.Request)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential"})
+		return
+	}
+
+	created, err := controller.WebAuthnCredentialRepository.CreateCredential(fromWebAuthnCredential(user.ID, *credential), nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newPasskeyResponse(*created))
+
+	return
+}
+
+type BeginPasskeyLoginPayload struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+func (controller PasskeyController) BeginLogin(c *gin.Context) {
+	var payload BeginPasskeyLoginPayload
+
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var options *protocol.CredentialAssertion
+	var session *webauthn.SessionData
+	var err error
+
+	if len(payload.MFAToken) > 0 {
+		userID, err := GetMFAChallenge(controller.Cache, payload.MFAToken)
+
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mfa token"})
+			return
+		}
+
+		pu, err := controller.loadPasskeyUser(userID)
+
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mfa token"})
+			return
+		}
+
+		options, session, err = controller.WebAuthn.BeginLogin(pu)
+	} else {
+		options, session, err = controller.WebAuthn.BeginDiscoverableLogin()
+	}
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	sessionID, err := controller.saveSession(session, payload.MFAToken)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, PasskeyOptionsResponse{SessionID: sessionID, Options: options})
+
+	return
+}
+
+func (controller PasskeyController) FinishLogin(c *gin.Context) {
+	session, err := controller.getSession(c.Query("session_id"))
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session"})
+		return
+	}
+
+	var pu passkeyUser
+	var credential *webauthn.Credential
+
+	if len(session.Session.UserID) > 0 {
+		id, err := uuid.FromBytes(session.Session.UserID)
+
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session"})
+			return
+		}
+
+		pu, err = controller.loadPasskeyUser(id.String())
+
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential"})
+			return
+		}
+
+		credential, err = controller.WebAuthn.FinishLogin(pu, session.Session, c.Request)
+	} else {
+		var user webauthn.User
+
+		user, credential, err = controller.WebAuthn.FinishPasskeyLogin(controller.findDiscoverableUser, session.Session, c.Request)
+
+		if err == nil {
+			pu = user.(passkeyUser)
+		}
+	}
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential"})
+		return
+	}
+
+	err = controller.WebAuthnCredentialRepository.UpdateSignCount(fromWebAuthnCredential(pu.User.ID, *credential))
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A counter that went backwards means the key was copied, the flag is
+	// stored above and the passkey stays refused until the user removes it.
+	if credential.Authenticator.CloneWarning {
+		log.Println("Passkey ", base64.RawURLEncoding.EncodeToString(credential.ID), " of user ", pu.User.ID.String(), " may have been cloned")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Passkey may have been cloned"})
+		return
+	}
+
+	if len(session.MFAToken) > 0 {
+		if _, err = ConsumeMFAChallenge(controller.Cache, session.MFAToken); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mfa token"})
+			return
+		}
+	}
+
+	response, err := IssueAuthResponse(controller.JwtProvider, controller.RefreshTokenRepository, pu.User, false, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(issueErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+
+	return
+}
+
+func (controller PasskeyController) ListPasskeys(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	credentials, err := controller.WebAuthnCredentialRepository.GetCredentialsByOwner(user.ID.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]PasskeyResponse, 0, len(credentials))
+
+	for _, credential := range credentials {
+		response = append(response, newPasskeyResponse(credential))
+	}
+
+	c.JSON(http.StatusOK, response)
+
+	return
+}
+
+func (controller PasskeyController) DeletePasskey(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	id, err := base64.RawURLEncoding.DecodeString(c.Param("id"))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	methods, err := CountLoginMethods(controller.IdentityRepository, controller.WebAuthnCredentialRepository, user.ID.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if methods <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot remove the last login method"})
+		return
+	}
+
+	err = controller.WebAuthnCredentialRepository.DeleteCredential(id, user.ID.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
+
+func newPasskeyResponse(credential models.WebAuthnCredential) PasskeyResponse {
+	transports := []string{}
+
+	for _, transport := range strings.Split(credential.Transports, ",") {
+		if len(transport) > 0 {
+			transports = append(transports, transport)
+		}
+	}
+
+	return PasskeyResponse{
+		ID:         base64.RawURLEncoding.EncodeToString(credential.ID),
+		Transports: transports,
+		SignCount:  credential.SignCount,
+		CreatedAt:  credential.CreatedAt,
+		UpdatedAt:  credential.UpdatedAt,
+	}
+}
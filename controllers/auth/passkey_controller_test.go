@@ -0,0 +1,342 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"github.com/thiagoferolla/go-auth/repositories/memory"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:3000"
+)
+
+// softwareAuthenticator is a P-256 platform authenticator with a "none"
+// attestation, enough to drive both ceremonies without a browser.
+type softwareAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	counter      uint32
+}
+
+func newSoftwareAuthenticator(t *testing.T) *softwareAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+
+	return &softwareAuthenticator{key: key, credentialID: credentialID}
+}
+
+func (a *softwareAuthenticator) authenticatorData(attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	flags := byte(0x01 | 0x04)
+
+	if attested != nil {
+		flags |= 0x40
+	}
+
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+
+	return append(data, attested...)
+}
+
+func (a *softwareAuthenticator) clientData(t *testing.T, ceremony string, challenge string) []byte {
+	data, err := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge, "origin": testOrigin})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+// create answers navigator.credentials.create for the given challenge.
+func (a *softwareAuthenticator) create(t *testing.T, challenge string, userHandle string) []byte {
+	handle, err := base64.RawURLEncoding.DecodeString(userHandle)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.userHandle = handle
+
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.PublicKey.X.FillBytes(x)
+	a.key.PublicKey.Y.FillBytes(y)
+
+	publicKey, err := webauthncbor.Marshal(map[int]any{1: 2, 3: -7, -1: 1, -2: x, -3: y})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attested := make([]byte, 16)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authenticatorData(attested),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(a.clientData(t, "webauthn.create", challenge)),
+		"attestationObject": base64.RawURLEncoding.EncodeToString(attestation),
+	})
+}
+
+// get answers navigator.credentials.get, counter is the signature counter the
+// authenticator reports.
+func (a *softwareAuthenticator) get(t *testing.T, challenge string, counter uint32) []byte {
+	a.counter = counter
+
+	authenticatorData := a.authenticatorData(nil)
+	clientData := a.clientData(t, "webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authenticatorData...), clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+		"authenticatorData": base64.RawURLEncoding.EncodeToString(authenticatorData),
+		"signature":         base64.RawURLEncoding.EncodeToString(signature),
+		"userHandle":        base64.RawURLEncoding.EncodeToString(a.userHandle),
+	})
+}
+
+func (a *softwareAuthenticator) credential(t *testing.T, response map[string]string) []byte {
+	id := base64.RawURLEncoding.EncodeToString(a.credentialID)
+
+	data, err := json.Marshal(map[string]any{"id": id, "rawId": id, "type": "public-key", "response": response})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+type passkeyFixture struct {
+	engine      *gin.Engine
+	user        models.User
+	cache       cache.CacheProvider
+	credentials *memory.WebAuthnCredentialRepository
+}
+
+func newPasskeyFixture(t *testing.T) passkeyFixture {
+	gin.SetMode(gin.TestMode)
+
+	webAuthn, err := webauthn.New(&webauthn.Config{RPID: testRPID, RPDisplayName: "Test", RPOrigins: []string{testOrigin}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := memory.NewUserRepository()
+	credentials := memory.NewWebAuthnCredentialRepository()
+	cacheProvider := cache.NewMemoryProvider(0, 0)
+	t.Cleanup(cacheProvider.Close)
+
+	user, err := models.NewUser("Jane", "jane@example.com", "password123", "email")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users.CreateUser(user, nil)
+
+	controller := NewPasskeyController(users, memory.NewRefreshTokenRepository(), credentials, memory.NewIdentityRepository(), jwt.NewBaseProvider(), cacheProvider, webAuthn)
+
+	engine := gin.New()
+	withUser := func(c *gin.Context) { c.Set("user", *user) }
+	engine.POST("/register/options", withUser, controller.BeginRegistration)
+	engine.POST("/register/verify", withUser, controller.FinishRegistration)
+	engine.POST("/login/options", controller.BeginLogin)
+	engine.POST("/login/verify", controller.FinishLogin)
+
+	return passkeyFixture{engine, *user, cacheProvider, credentials}
+}
+
+func (f passkeyFixture) post(path string, body []byte) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	f.engine.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+type testPasskeyOptions struct {
+	SessionID string `json:"session_id"`
+	Options   struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			User      struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	} `json:"options"`
+}
+
+func (f passkeyFixture) options(t *testing.T, path string, body []byte) testPasskeyOptions {
+	recorder := f.post(path, body)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("%s: status %d: %s", path, recorder.Code, recorder.Body.String())
+	}
+
+	var options testPasskeyOptions
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &options); err != nil {
+		t.Fatal(err)
+	}
+
+	return options
+}
+
+func (f passkeyFixture) register(t *testing.T, authenticator *softwareAuthenticator) {
+	options := f.options(t, "/register/options", nil)
+	credential := authenticator.create(t, options.Options.PublicKey.Challenge, options.Options.PublicKey.User.ID)
+
+	if recorder := f.post("/register/verify?session_id="+options.SessionID, credential); recorder.Code != http.StatusCreated {
+		t.Fatalf("register: status %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func (f passkeyFixture) login(t *testing.T, authenticator *softwareAuthenticator, counter uint32, body []byte) *httptest.ResponseRecorder {
+	options := f.options(t, "/login/options", body)
+
+	return f.post("/login/verify?session_id="+options.SessionID, authenticator.get(t, options.Options.PublicKey.Challenge, counter))
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	fixture := newPasskeyFixture(t)
+	authenticator := newSoftwareAuthenticator(t)
+
+	fixture.register(t, authenticator)
+
+	recorder := fixture.login(t, authenticator, 1, nil)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var response AuthResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+
+	if response.ID != fixture.user.ID.String() || len(response.IDToken) <= 0 {
+		t.Fatalf("login: unexpected response %+v", response)
+	}
+
+	credential, _ := fixture.credentials.GetCredentialByID(authenticator.credentialID)
+
+	if credential.SignCount != 1 {
+		t.Fatalf("sign count: got %d, want 1", credential.SignCount)
+	}
+}
+
+func TestPasskeySessionIsSingleUse(t *testing.T) {
+	fixture := newPasskeyFixture(t)
+	authenticator := newSoftwareAuthenticator(t)
+
+	fixture.register(t, authenticator)
+
+	options := fixture.options(t, "/login/options", nil)
+	assertion := authenticator.get(t, options.Options.PublicKey.Challenge, 1)
+
+	if recorder := fixture.post("/login/verify?session_id="+options.SessionID, assertion); recorder.Code != http.StatusOK {
+		t.Fatalf("first login: status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	if recorder := fixture.post("/login/verify?session_id="+options.SessionID, assertion); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("replayed login: got status %d, want 400", recorder.Code)
+	}
+}
+
+func TestPasskeyLoginRefusesClonedAuthenticator(t *testing.T) {
+	fixture := newPasskeyFixture(t)
+	authenticator := newSoftwareAuthenticator(t)
+
+	fixture.register(t, authenticator)
+
+	if recorder := fixture.login(t, authenticator, 5, nil); recorder.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	if recorder := fixture.login(t, authenticator, 3, nil); recorder.Code != http.StatusForbidden {
+		t.Fatalf("regressed counter: got status %d, want 403", recorder.Code)
+	}
+
+	credential, _ := fixture.credentials.GetCredentialByID(authenticator.credentialID)
+
+	if !credential.CloneWarning {
+		t.Fatal("credential was not flagged as cloned")
+	}
+
+	if recorder := fixture.login(t, authenticator, 10, nil); recorder.Code != http.StatusForbidden {
+		t.Fatalf("flagged credential: got status %d, want 403", recorder.Code)
+	}
+}
+
+func TestPasskeyLoginConsumesMFAChallenge(t *testing.T) {
+	fixture := newPasskeyFixture(t)
+	authenticator := newSoftwareAuthenticator(t)
+
+	fixture.register(t, authenticator)
+
+	mfaToken, err := CreateMFAChallenge(fixture.cache, fixture.user.ID.String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(BeginPasskeyLoginPayload{MFAToken: mfaToken})
+
+	if recorder := fixture.login(t, authenticator, 1, body); recorder.Code != http.StatusOK {
+		t.Fatalf("mfa login: status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	if _, err := GetMFAChallenge(fixture.cache, mfaToken); err == nil {
+		t.Fatal("mfa challenge was not consumed")
+	}
+
+	if recorder := fixture.post("/login/options", body); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("spent mfa token: got status %d, want 400", recorder.Code)
+	}
+}
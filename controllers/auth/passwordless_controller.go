@@ -0,0 +1,310 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/i18n"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/email"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"gopkg.in/guregu/null.v4"
+)
+
+const passwordlessExpiration = 15 * time.Minute
+const maxPasswordlessAttempts = 5
+
+type PasswordlessController struct {
+	UserRepository               models.UserRepository
+	RefreshTokenRepository       models.RefreshTokenRepository
+	WebAuthnCredentialRepository models.WebAuthnCredentialRepository
+	IdentityRepository           models.IdentityRepository
+	JwtProvider                  jwt.JWTProvider
+	Outbox                       *email.Outbox
+	Cache                        cache.CacheProvider
+}
+
+func NewPasswordlessController(userRepository models.UserRepository, refreshTokenRepository models.RefreshTokenRepository, webAuthnCredentialRepository models.WebAuthnCredentialRepository, identityRepository models.IdentityRepository, jwtProvider jwt.JWTProvider, outbox *email.Outbox, cache cache.CacheProvider) *PasswordlessController {
+	return &PasswordlessController{userRepository, refreshTokenRepository, webAuthnCredentialRepository, identityRepository, jwtProvider, outbox, cache}
+}
+
+func signUpOpen() bool {
+	return os.Getenv("SIGN_UP_OPEN") == "true"
+}
+
+func generateCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// Links are looked up by their own hash, codes are too short for that and are
+// scoped to the email they were sent to.
+func passwordlessKey(email string, token string, method string) string {
+	if method == "code" {
+		return "passwordless:" + HashToken(strings.ToLower(email)+":"+token)
+	}
+
+	return "passwordless:" + HashToken(token)
+}
+
+// passwordlessEmailKey scopes what is tracked per address, the latest link or
+// code sent to it and the guesses made at its codes.
+func passwordlessEmailKey(email string) string {
+	return "passwordless:email:" + HashToken(strings.ToLower(email))
+}
+
+// replacePasswordless stores the new link or code and revokes the one sent
+// before, only the latest email works.
+func (controller PasswordlessController) replacePasswordless(email string, key string) error {
+	previous, err := controller.Cache.GetDel(passwordlessEmailKey(email))
+
+	if err == nil && len(previous) > 0 {
+		if err := controller.Cache.Delete(previous); err != nil {
+			return err
+		}
+	} else if err != nil && !errors.Is(err, cache.ErrNotFound) {
+		return err
+	}
+
+	err = controller.Cache.SetEx(key, email, passwordlessExpiration)
+
+	if err != nil {
+		return err
+	}
+
+	return controller.Cache.SetEx(passwordlessEmailKey(email), key, passwordlessExpiration)
+}
+
+// revokePasswordless drops whatever was last sent to the address.
+func revokePasswordless(cacheProvider cache.CacheProvider, email string) {
+	previous, err := cacheProvider.GetDel(passwordlessEmailKey(email))
+
+	if err == nil && len(previous) > 0 {
+		cacheProvider.Delete(previous)
+	}
+}
+
+type SendPasswordlessPayload struct {
+	Email  string `json:"email"`
+	Method string `json:"method"`
+}
+
+func (controller PasswordlessController) SendPasswordless(c *gin.Context) {
+	var payload SendPasswordlessPayload
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(payload.Method) <= 0 {
+		payload.Method = "link"
+	}
+
+	if !models.ValidateEmail(payload.Email) || (payload.Method != "link" && payload.Method != "code") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email or method"})
+		return
+	}
+
+	user, err := controller.UserRepository.GetUserByEmail(payload.Email)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid email"})
+		return
+	}
+
+	// Answer the same way whether the account exists or not.
+	if err != nil && !signUpOpen() {
+		c.Status(http.StatusNoContent)
+		c.Abort()
+		return
+	}
+
+	var token string
+	var message email.Message
+
+	if payload.Method == "code" {
+		token, err = generateCode()
+		message = email.PasswordlessCode{Name: user.Name.String, Code: token}
+	} else {
+		var link uuid.UUID
+		link, err = uuid.NewRandom()
+		token = link.String()
+		message = email.PasswordlessLink{Name: user.Name.String, Email: payload.Email, Token: token}
+	}
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid email"})
+		return
+	}
+
+	err = controller.replacePasswordless(payload.Email, passwordlessKey(payload.Email, token, payload.Method))
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid email"})
+		return
+	}
+
+	// Unknown addresses get the email in the language the request asks for.
+	locale := user.Locale
+
+	if len(locale) <= 0 {
+		locale = i18n.Negotiate(c.GetHeader("Accept-Language"))
+	}
+
+	err = controller.Outbox.Enqueue(
+		message.Template()+":"+HashToken(payload.Email+":"+token), user.Name.String, payload.Email, locale, message, nil,
+	)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid email"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
+
+type VerifyPasswordlessPayload struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+	Token string `json:"token"`
+}
+
+func (controller PasswordlessController) VerifyPasswordless(c *gin.Context) {
+	var payload VerifyPasswordlessPayload
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var key string
+
+	if len(payload.Token) > 0 {
+		key = passwordlessKey(payload.Email, payload.Token, "link")
+	} else if len(payload.Code) > 0 && models.ValidateEmail(payload.Email) {
+		key = passwordlessKey(payload.Email, payload.Code, "code")
+
+		// Six digits don't survive guessing, past the limit the code is
+		// burnt and the address has to wait for the window to pass.
+		err := CountAttempt(controller.Cache, passwordlessEmailKey(payload.Email), maxPasswordlessAttempts, passwordlessExpiration)
+
+		if errors.Is(err, ErrTooManyAttempts) {
+			revokePasswordless(controller.Cache, payload.Email)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts"})
+			return
+		} else if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	emailAddress, err := controller.Cache.GetDel(key)
+
+	if err != nil || len(emailAddress) <= 0 {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	controller.Cache.Delete(passwordlessEmailKey(emailAddress))
+	ResetAttempts(controller.Cache, passwordlessEmailKey(emailAddress))
+
+	isNewUser := false
+	user, err := controller.UserRepository.GetUserByEmail(emailAddress)
+
+	if errors.Is(err, sql.ErrNoRows) && signUpOpen() {
+		newUser, err := models.NewPasswordlessUser("", emailAddress, "email")
+
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		newUser.EmailVerifiedAt = null.NewTime(time.Now(), true)
+		newUser.Locale = i18n.Negotiate(c.GetHeader("Accept-Language"))
+
+		err = createUserWithIdentity(controller.UserRepository, controller.IdentityRepository, newUser, models.NewIdentity(newUser.ID, "email", emailAddress))
+
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		user = *newUser
+		isNewUser = true
+	} else if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	if !isNewUser {
+		identities, err := LoginIdentities(controller.IdentityRepository, controller.WebAuthnCredentialRepository, user)
+
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// The code still serves reauthentication, but signing in with it
+		// takes the email identity the user may have unlinked.
+		if !HasIdentity(identities, "email") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token"})
+			return
+		}
+	}
+
+	if !isNewUser && challengeSecondFactor(c, controller.Cache, controller.WebAuthnCredentialRepository, user, "") {
+		return
+	}
+
+	response, err := IssueAuthResponse(controller.JwtProvider, controller.RefreshTokenRepository, user, isNewUser, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(issueErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if isNewUser {
+		c.JSON(http.StatusCreated, response)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+
+	return
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+)
+
+type passwordlessFixture struct {
+	authFixture
+}
+
+func newPasswordlessFixture(t *testing.T) passwordlessFixture {
+	fixture := newAuthFixture(t)
+	fixture.createUser(t, "jane@example.com", "")
+
+	controller := NewPasswordlessController(fixture.users, fixture.refreshTokens, fixture.credentials, fixture.identities, fixture.jwt, fixture.emailOutbox(), fixture.cache)
+
+	fixture.engine.POST("/passwordless/send", controller.SendPasswordless)
+	fixture.engine.POST("/passwordless/verify", controller.VerifyPasswordless)
+
+	return passwordlessFixture{fixture}
+}
+
+// send asks for a new email and returns the substitution it carries.
+func (f passwordlessFixture) send(t *testing.T, method string, substitution string) string {
+	if status := f.post(t, "/passwordless/send", SendPasswordlessPayload{Email: "jane@example.com", Method: method}); status != http.StatusNoContent {
+		t.Fatalf("send: got status %d", status)
+	}
+
+	return f.lastEmail(t)[substitution]
+}
+
+func TestPasswordlessLinkIsSingleUse(t *testing.T) {
+	fixture := newPasswordlessFixture(t)
+	token := fixture.send(t, "link", "token")
+
+	if status := fixture.post(t, "/passwordless/verify", VerifyPasswordlessPayload{Token: token}); status != http.StatusOK {
+		t.Fatalf("verify: got status %d", status)
+	}
+
+	if status := fixture.post(t, "/passwordless/verify", VerifyPasswordlessPayload{Token: token}); status != http.StatusBadRequest {
+		t.Fatalf("replayed link: got status %d, want 400", status)
+	}
+}
+
+func TestPasswordlessResendRevokesEarlierCode(t *testing.T) {
+	fixture := newPasswordlessFixture(t)
+	first := fixture.send(t, "code", "code")
+	second := fixture.send(t, "code", "code")
+
+	if first == second {
+		t.Skip("both codes came out the same")
+	}
+
+	if status := fixture.post(t, "/passwordless/verify", VerifyPasswordlessPayload{Email: "jane@example.com", Code: first}); status != http.StatusBadRequest {
+		t.Fatalf("earlier code: got status %d, want 400", status)
+	}
+
+	if status := fixture.post(t, "/passwordless/verify", VerifyPasswordlessPayload{Email: "Jane@example.com", Code: second}); status != http.StatusOK {
+		t.Fatalf("latest code: got status %d", status)
+	}
+}
+
+func TestPasswordlessCodeAttemptsAreCapped(t *testing.T) {
+	fixture := newPasswordlessFixture(t)
+	code := fixture.send(t, "code", "code")
+
+	wrong := wrongCode(code)
+
+	for i := 0; i < maxPasswordlessAttempts; i++ {
+		if status := fixture.post(t, "/passwordless/verify", VerifyPasswordlessPayload{Email: "jane@example.com", Code: wrong}); status != http.StatusBadRequest {
+			t.Fatalf("attempt %d: got status %d, want 400", i+1, status)
+		}
+	}
+
+	if status := fixture.post(t, "/passwordless/verify", VerifyPasswordlessPayload{Email: "jane@example.com", Code: code}); status != http.StatusTooManyRequests {
+		t.Fatalf("over the limit: got status %d, want 429", status)
+	}
+
+	fixture.send(t, "code", "code")
+
+	if status := fixture.post(t, "/passwordless/verify", VerifyPasswordlessPayload{Email: "jane@example.com", Code: code}); status != http.StatusTooManyRequests {
+		t.Fatalf("resend within the window: got status %d, want 429", status)
+	}
+}
@@ -0,0 +1,346 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"github.com/thiagoferolla/go-auth/providers/sms"
+	"gopkg.in/guregu/null.v4"
+)
+
+const smsCodeExpiration = 10 * time.Minute
+const maxSmsAttempts = 5
+
+var errInvalidCode = errors.New("invalid code")
+
+type PhoneController struct {
+	UserRepository               models.UserRepository
+	RefreshTokenRepository       models.RefreshTokenRepository
+	WebAuthnCredentialRepository models.WebAuthnCredentialRepository
+	JwtProvider                  jwt.JWTProvider
+	SmsProvider                  sms.SmsProvider
+	Cache                        cache.CacheProvider
+}
+
+func NewPhoneController(userRepository models.UserRepository, refreshTokenRepository models.RefreshTokenRepository, webAuthnCredentialRepository models.WebAuthnCredentialRepository, jwtProvider jwt.JWTProvider, smsProvider sms.SmsProvider, cache cache.CacheProvider) *PhoneController {
+	return &PhoneController{userRepository, refreshTokenRepository, webAuthnCredentialRepository, jwtProvider, smsProvider, cache}
+}
+
+// sendCode texts a fresh code to the phone, the purpose keeps a code issued
+// for one flow from being accepted by another.
+func (controller PhoneController) sendCode(purpose string, phone string) error {
+	code, err := generateCode()
+
+	if err != nil {
+		return err
+	}
+
+	err = controller.Cache.SetEx("sms:"+HashToken(purpose+":"+phone+":"+code), phone, smsCodeExpiration)
+
+	if err != nil {
+		return err
+	}
+
+	return controller.SmsProvider.SendSms(phone, "Your go-auth verification code is "+code)
+}
+
+// verifyCode spends the code, guesses are counted per phone and flow so a
+// fresh mfa token or user doesn't buy more of them.
+func (controller PhoneController) verifyCode(purpose string, phone string, code string) error {
+	if len(code) <= 0 || len(phone) <= 0 {
+		return errInvalidCode
+	}
+
+	flow, _, _ := strings.Cut(purpose, ":")
+	attemptsKey := "sms:" + HashToken(flow+":"+phone)
+
+	err := CountAttempt(controller.Cache, attemptsKey, maxSmsAttempts, smsCodeExpiration)
+
+	if err != nil {
+		return err
+	}
+
+	value, err := controller.Cache.GetDel("sms:" + HashToken(purpose+":"+phone+":"+code))
+
+	if err != nil || value != phone {
+		return errInvalidCode
+	}
+
+	return ResetAttempts(controller.Cache, attemptsKey)
+}
+
+// rejectCode answers a failed verifyCode, telling a locked out phone apart
+// from a wrong code.
+func rejectCode(c *gin.Context, err error) {
+	if errors.Is(err, ErrTooManyAttempts) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts"})
+		return
+	}
+
+	if !errors.Is(err, errInvalidCode) {
+		log.Println(err)
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+}
+
+type PhonePayload struct {
+	Phone string `json:"phone"`
+}
+
+type PhoneCodePayload struct {
+	Phone string `json:"phone"`
+	Code  string `json:"code"`
+}
+
+type MFACodePayload struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+func (controller PhoneController) SetPhone(c *gin.Context) {
+	var payload PhonePayload
+	user := c.MustGet("user").(models.User)
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !models.ValidatePhone(payload.Phone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone"})
+		return
+	}
+
+	err := controller.sendCode("verify:"+user.ID.String(), payload.Phone)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
+
+func (controller PhoneController) VerifyPhone(c *gin.Context) {
+	var payload PhoneCodePayload
+	user := c.MustGet("user").(models.User)
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := controller.verifyCode("verify:"+user.ID.String(), payload.Phone, payload.Code); err != nil {
+		rejectCode(c, err)
+		return
+	}
+
+	existing, err := controller.UserRepository.GetUserByPhone(payload.Phone)
+
+	if err == nil && existing.ID != user.ID {
+		c.JSON(http.StatusConflict, gin.H{"error": "Phone already in use"})
+		return
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	user.Phone = null.NewString(payload.Phone, true)
+	user.PhoneVerifiedAt = null.NewTime(time.Now(), true)
+
+	_, err = controller.UserRepository.UpdateUser(&user, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+
+	return
+}
+
+func (controller PhoneController) SendLoginCode(c *gin.Context) {
+	var payload PhonePayload
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !models.ValidatePhone(payload.Phone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone"})
+		return
+	}
+
+	user, err := controller.UserRepository.GetUserByPhone(payload.Phone)
+
+	// Answer the same way whether the phone is registered or not.
+	if err != nil || !user.PhoneVerifiedAt.Valid {
+		c.Status(http.StatusNoContent)
+		c.Abort()
+		return
+	}
+
+	err = controller.sendCode("login", payload.Phone)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
+
+func (controller PhoneController) VerifyLoginCode(c *gin.Context) {
+	var payload PhoneCodePayload
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := controller.verifyCode("login", payload.Phone, payload.Code); err != nil {
+		rejectCode(c, err)
+		return
+	}
+
+	user, err := controller.UserRepository.GetUserByPhone(payload.Phone)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	// The code already proved possession of the phone, only other factors
+	// can serve as a second one.
+	if challengeSecondFactor(c, controller.Cache, controller.WebAuthnCredentialRepository, user, "sms") {
+		return
+	}
+
+	response, err := IssueAuthResponse(controller.JwtProvider, controller.RefreshTokenRepository, user, false, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(issueErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+
+	return
+}
+
+type MFATokenPayload struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+func (controller PhoneController) SendMFACode(c *gin.Context) {
+	var payload MFATokenPayload
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := GetMFAChallenge(controller.Cache, payload.MFAToken)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mfa token"})
+		return
+	}
+
+	user, err := controller.UserRepository.GetUserByID(userID)
+
+	if err != nil || !user.PhoneVerifiedAt.Valid {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mfa token"})
+		return
+	}
+
+	err = controller.sendCode("mfa:"+payload.MFAToken, user.Phone.String)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
+
+func (controller PhoneController) VerifyMFACode(c *gin.Context) {
+	var payload MFACodePayload
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := GetMFAChallenge(controller.Cache, payload.MFAToken)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mfa token"})
+		return
+	}
+
+	user, err := controller.UserRepository.GetUserByID(userID)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if err := controller.verifyCode("mfa:"+payload.MFAToken, user.Phone.String, payload.Code); err != nil {
+		rejectCode(c, err)
+		return
+	}
+
+	// A wrong code leaves the challenge for another try, a right one spends it.
+	if _, err := ConsumeMFAChallenge(controller.Cache, payload.MFAToken); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mfa token"})
+		return
+	}
+
+	response, err := IssueAuthResponse(controller.JwtProvider, controller.RefreshTokenRepository, user, false, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(issueErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+
+	return
+}
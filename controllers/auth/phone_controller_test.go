@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/sms"
+	"gopkg.in/guregu/null.v4"
+)
+
+const testPhone = "+5511999999999"
+
+type phoneFixture struct {
+	authFixture
+	user models.User
+	sms  *sms.MockSmsProvider
+}
+
+func newPhoneFixture(t *testing.T) phoneFixture {
+	fixture := newAuthFixture(t)
+	smsProvider := sms.NewMockSmsProvider()
+
+	user := fixture.createUser(t, "jane@example.com", "")
+	user.Phone = null.NewString(testPhone, true)
+	user.PhoneVerifiedAt = null.NewTime(time.Now(), true)
+	fixture.users.UpdateUser(user, nil)
+
+	controller := NewPhoneController(fixture.users, fixture.refreshTokens, fixture.credentials, fixture.jwt, smsProvider, fixture.cache)
+
+	fixture.engine.POST("/sms/send", controller.SendLoginCode)
+	fixture.engine.POST("/sms/verify", controller.VerifyLoginCode)
+	fixture.engine.POST("/mfa/sms/send", controller.SendMFACode)
+	fixture.engine.POST("/mfa/sms/verify", controller.VerifyMFACode)
+
+	return phoneFixture{fixture, *user, smsProvider}
+}
+
+func (f phoneFixture) lastCode(t *testing.T) string {
+	message, ok := f.sms.LastMessage(testPhone)
+
+	if !ok {
+		t.Fatal("no sms was sent")
+	}
+
+	return message.Message[strings.LastIndex(message.Message, " ")+1:]
+}
+
+func TestSmsLoginCodeIsSingleUse(t *testing.T) {
+	fixture := newPhoneFixture(t)
+
+	fixture.post(t, "/sms/send", PhonePayload{Phone: testPhone})
+	code := fixture.lastCode(t)
+
+	if status := fixture.post(t, "/sms/verify", PhoneCodePayload{Phone: testPhone, Code: code}); status != http.StatusOK {
+		t.Fatalf("verify: got status %d", status)
+	}
+
+	if status := fixture.post(t, "/sms/verify", PhoneCodePayload{Phone: testPhone, Code: code}); status != http.StatusBadRequest {
+		t.Fatalf("replayed code: got status %d, want 400", status)
+	}
+}
+
+func TestSmsLoginAttemptsAreCapped(t *testing.T) {
+	fixture := newPhoneFixture(t)
+
+	fixture.post(t, "/sms/send", PhonePayload{Phone: testPhone})
+	code := fixture.lastCode(t)
+
+	for i := 0; i < maxSmsAttempts; i++ {
+		if status := fixture.post(t, "/sms/verify", PhoneCodePayload{Phone: testPhone, Code: wrongCode(code)}); status != http.StatusBadRequest {
+			t.Fatalf("attempt %d: got status %d, want 400", i+1, status)
+		}
+	}
+
+	if status := fixture.post(t, "/sms/verify", PhoneCodePayload{Phone: testPhone, Code: code}); status != http.StatusTooManyRequests {
+		t.Fatalf("over the limit: got status %d, want 429", status)
+	}
+}
+
+func TestSmsMFAConsumesChallenge(t *testing.T) {
+	fixture := newPhoneFixture(t)
+
+	mfaToken, err := CreateMFAChallenge(fixture.cache, fixture.user.ID.String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := fixture.post(t, "/mfa/sms/send", MFATokenPayload{MFAToken: mfaToken}); status != http.StatusNoContent {
+		t.Fatalf("send: got status %d", status)
+	}
+
+	code := fixture.lastCode(t)
+
+	if status := fixture.post(t, "/mfa/sms/verify", MFACodePayload{MFAToken: mfaToken, Code: wrongCode(code)}); status != http.StatusBadRequest {
+		t.Fatalf("wrong code: got status %d, want 400", status)
+	}
+
+	if status := fixture.post(t, "/mfa/sms/verify", MFACodePayload{MFAToken: mfaToken, Code: code}); status != http.StatusOK {
+		t.Fatalf("right code: got status %d", status)
+	}
+
+	if _, err := GetMFAChallenge(fixture.cache, mfaToken); err == nil {
+		t.Fatal("mfa challenge was not consumed")
+	}
+}
+
+func TestSmsMFAAttemptsSurviveNewChallenges(t *testing.T) {
+	fixture := newPhoneFixture(t)
+
+	for i := 0; i < maxSmsAttempts; i++ {
+		mfaToken, _ := CreateMFAChallenge(fixture.cache, fixture.user.ID.String())
+		fixture.post(t, "/mfa/sms/send", MFATokenPayload{MFAToken: mfaToken})
+		fixture.post(t, "/mfa/sms/verify", MFACodePayload{MFAToken: mfaToken, Code: wrongCode(fixture.lastCode(t))})
+	}
+
+	mfaToken, _ := CreateMFAChallenge(fixture.cache, fixture.user.ID.String())
+	fixture.post(t, "/mfa/sms/send", MFATokenPayload{MFAToken: mfaToken})
+
+	if status := fixture.post(t, "/mfa/sms/verify", MFACodePayload{MFAToken: mfaToken, Code: fixture.lastCode(t)}); status != http.StatusTooManyRequests {
+		t.Fatalf("fresh challenge over the limit: got status %d, want 429", status)
+	}
+}
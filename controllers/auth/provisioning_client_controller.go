@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"gopkg.in/guregu/null.v4"
+)
+
+type CreateProvisioningClientPayload struct {
+	Name string `json:"name"`
+}
+
+// ProvisioningTokenResponse is the only place a provisioning token is ever
+// returned.
+type ProvisioningTokenResponse struct {
+	models.ProvisioningClient
+	Token string `json:"token"`
+}
+
+func (controller OrganizationController) ListProvisioningClients(c *gin.Context) {
+	membership, ok := controller.membership(c)
+
+	if !ok {
+		return
+	}
+
+	if !membership.CanManageMembers() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	clients, err := controller.ProvisioningClientRepository.GetProvisioningClientsByOrganization(membership.Organization.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, clients)
+
+	return
+}
+
+// CreateProvisioningClient issues the bearer token an identity provider uses
+// to push the organization's members through SCIM.
+func (controller OrganizationController) CreateProvisioningClient(c *gin.Context) {
+	var payload CreateProvisioningClientPayload
+
+	membership, ok := controller.membership(c)
+
+	if !ok {
+		return
+	}
+
+	if !membership.CanManageMembers() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(payload.Name) <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	client, token, err := models.NewProvisioningClient(membership.Organization, payload.Name)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = controller.ProvisioningClientRepository.CreateProvisioningClient(client, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, ProvisioningTokenResponse{*client, token})
+
+	return
+}
+
+func (controller OrganizationController) RevokeProvisioningClient(c *gin.Context) {
+	membership, ok := controller.membership(c)
+
+	if !ok {
+		return
+	}
+
+	if !membership.CanManageMembers() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	client, err := controller.ProvisioningClientRepository.GetProvisioningClientByID(c.Param("client_id"))
+
+	if err != nil || client.Organization != membership.Organization {
+		log.Println(err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	client.RevokedAt = null.NewTime(time.Now(), true)
+
+	_, err = controller.ProvisioningClientRepository.UpdateProvisioningClient(&client, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
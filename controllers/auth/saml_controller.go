@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/i18n"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"github.com/thiagoferolla/go-auth/providers/sso"
+	"gopkg.in/guregu/null.v4"
+)
+
+const samlRequestExpiration = 10 * time.Minute
+
+type SamlController struct {
+	UserRepository         models.UserRepository
+	RefreshTokenRepository models.RefreshTokenRepository
+	IdentityRepository     models.IdentityRepository
+	MembershipRepository   models.MembershipRepository
+	JwtProvider            jwt.JWTProvider
+	Cache                  cache.CacheProvider
+	Connections            map[string]*sso.SamlConnection
+}
+
+func NewSamlController(userRepository models.UserRepository, refreshTokenRepository models.RefreshTokenRepository, identityRepository models.IdentityRepository, membershipRepository models.MembershipRepository, jwtProvider jwt.JWTProvider, cache cache.CacheProvider, connections map[string]*sso.SamlConnection) *SamlController {
+	return &SamlController{userRepository, refreshTokenRepository, identityRepository, membershipRepository, jwtProvider, cache, connections}
+}
+
+func (controller SamlController) Metadata(c *gin.Context) {
+	connection, ok := controller.Connections[c.Param("connection")]
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	metadata, err := connection.Metadata()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+
+	return
+}
+
+func (controller SamlController) Login(c *gin.Context) {
+	connection, ok := controller.Connections[c.Param("connection")]
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	relayState, err := uuid.NewRandom()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	requestID, redirect, err := connection.AuthenticationRequest(relayState.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = controller.Cache.SetEx("saml:"+relayState.String(), requestID, samlRequestExpiration)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusFound, redirect)
+
+	return
+}
+
+// AssertionConsumerService receives both SP-initiated responses, matched to
+// their request through the relay state, and unsolicited IdP-initiated ones.
+// Relay states and assertions are single use either way. MFA is left to the
+// IdP, enterprise policies are enforced there.
+func (controller SamlController) AssertionConsumerService(c *gin.Context) {
+	connection, ok := controller.Connections[c.Param("connection")]
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	requestIDs := []string{}
+
+	if relayState := c.PostForm("RelayState"); len(relayState) > 0 {
+		requestID, err := controller.Cache.GetDel("saml:" + relayState)
+
+		if err == nil && len(requestID) > 0 {
+			requestIDs = append(requestIDs, requestID)
+		}
+	}
+
+	samlIdentity, err := connection.ParseResponse(c.Request, requestIDs)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid SAML response"})
+		return
+	}
+
+	fresh, err := controller.Cache.SetNX("saml:assertion:"+samlIdentity.Connection+":"+samlIdentity.AssertionID, samlIdentity.Subject, samlIdentity.ExpiresIn)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !fresh {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid SAML response"})
+		return
+	}
+
+	if !models.ValidateEmail(samlIdentity.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email"})
+		return
+	}
+
+	if !connection.AllowsEmail(samlIdentity.Email) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email domain is not allowed for this connection"})
+		return
+	}
+
+	provider := "saml:" + samlIdentity.Connection
+	isNewUser := false
+	var user models.User
+
+	linked, err := controller.IdentityRepository.GetIdentity(provider, samlIdentity.Subject)
+
+	if err == nil {
+		user, err = controller.UserRepository.GetUserByID(linked.Owner.String())
+	} else if errors.Is(err, sql.ErrNoRows) {
+		// Accounts are only reached through the identity the connection
+		// provisioned, an IdP can't take over one by asserting its email.
+		_, err = controller.UserRepository.GetUserByEmail(samlIdentity.Email)
+
+		if err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "An account already exists with this email"})
+			return
+		} else if errors.Is(err, sql.ErrNoRows) {
+			// Just-in-time provisioning, the IdP vouches for the account.
+			var newUser *models.User
+			newUser, err = models.NewPasswordlessUser(samlIdentity.Name, samlIdentity.Email, "saml")
+
+			if err == nil {
+				newUser.EmailVerifiedAt = null.NewTime(time.Now(), true)
+				newUser.Locale = i18n.Negotiate(c.GetHeader("Accept-Language"))
+
+				err = controller.provisionUser(connection, newUser, samlIdentity)
+				user = *newUser
+				isNewUser = true
+			}
+		}
+	}
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !isNewUser {
+		err = controller.syncAttributes(&user, connection, samlIdentity)
+
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	response, err := IssueAuthResponse(controller.JwtProvider, controller.RefreshTokenRepository, user, isNewUser, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(issueErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+
+	return
+}
+
+// provisionUser creates the user with its identity and, when the connection
+// belongs to an organization, its membership there.
+func (controller SamlController) provisionUser(connection *sso.SamlConnection, user *models.User, samlIdentity sso.SamlIdentity) error {
+	organization := connection.Config.Organization
+
+	if len(organization) > 0 {
+		user.OrganizationID = null.NewString(organization, true)
+	}
+
+	transaction, err := controller.UserRepository.BeginTransaction()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = controller.UserRepository.CreateUser(user, transaction)
+
+	if err != nil {
+		transaction.Rollback()
+		return err
+	}
+
+	_, err = controller.IdentityRepository.CreateIdentity(models.NewIdentity(user.ID, "saml:"+samlIdentity.Connection, samlIdentity.Subject), transaction)
+
+	if err != nil {
+		transaction.Rollback()
+		return err
+	}
+
+	if len(organization) > 0 {
+		_, err = controller.MembershipRepository.CreateMembership(models.NewMembership(uuid.MustParse(organization), user.ID, samlIdentity.Role), transaction)
+
+		if err != nil {
+			transaction.Rollback()
+			return err
+		}
+	}
+
+	return transaction.Commit()
+}
+
+// syncAttributes keeps the name and the organization role following the IdP,
+// which stays the source of truth for them. The platform wide User.Role is
+// never touched, an IdP only speaks for its own organization. Owners keep
+// their role so the organization can't be left without one.
+func (controller SamlController) syncAttributes(user *models.User, connection *sso.SamlConnection, samlIdentity sso.SamlIdentity) error {
+	if len(samlIdentity.Name) > 0 && user.Name.String != samlIdentity.Name {
+		user.Name = null.NewString(samlIdentity.Name, true)
+
+		_, err := controller.UserRepository.UpdateUser(user, nil)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	organization := connection.Config.Organization
+
+	if len(organization) <= 0 {
+		return nil
+	}
+
+	membership, err := controller.MembershipRepository.GetMembership(organization, user.ID.String())
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = controller.MembershipRepository.CreateMembership(models.NewMembership(uuid.MustParse(organization), user.ID, samlIdentity.Role), nil)
+
+		return err
+	}
+
+	if err != nil || membership.Role == models.OwnerRole || membership.Role == samlIdentity.Role {
+		return err
+	}
+
+	membership.Role = samlIdentity.Role
+	_, err = controller.MembershipRepository.UpdateMembership(&membership, nil)
+
+	return err
+}
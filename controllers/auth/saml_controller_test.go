@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"github.com/thiagoferolla/go-auth/providers/sso"
+	"github.com/thiagoferolla/go-auth/repositories/memory"
+)
+
+// The signed responses are the sso package fixtures, issued for the "acme"
+// connection on 2026-01-01 and valid for five minutes.
+const (
+	samlTestdata     = "../../providers/sso/testdata/"
+	samlOrganization = "6f1c2a54-9d0e-4c1b-8a57-3f2e1d0c9b8a"
+)
+
+type samlFixture struct {
+	engine      *gin.Engine
+	cache       *cache.MemoryProvider
+	users       *memory.UserRepository
+	identities  *memory.IdentityRepository
+	memberships *memory.MembershipRepository
+}
+
+func newSamlFixture(t *testing.T) samlFixture {
+	gin.SetMode(gin.TestMode)
+
+	previous := saml.TimeNow
+	saml.TimeNow = func() time.Time { return time.Date(2026, 1, 1, 0, 1, 0, 0, time.UTC) }
+	t.Cleanup(func() { saml.TimeNow = previous })
+
+	idpCertificate, err := os.ReadFile(samlTestdata + "idp.crt")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, certificate, err := sso.LoadServiceProviderKeyPair(samlTestdata+"sp.crt", samlTestdata+"sp.key")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connection, err := sso.NewSamlConnection(sso.SamlConfig{
+		Name:              "acme",
+		Organization:      samlOrganization,
+		EmailDomains:      []string{"acme.example"},
+		IdpEntityID:       "https://idp.acme.example/metadata",
+		IdpSsoURL:         "https://idp.acme.example/sso",
+		IdpCertificate:    string(idpCertificate),
+		AllowIdpInitiated: true,
+		EmailAttribute:    "email",
+		NameAttribute:     "name",
+		RoleAttribute:     "groups",
+		RoleMapping:       map[string]string{"go-auth-admins": "admin"},
+	}, "https://sp.example.com/saml", key, certificate)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := memory.NewUserRepository()
+	identities := memory.NewIdentityRepository()
+	memberships := memory.NewMembershipRepository()
+	cacheProvider := cache.NewMemoryProvider(0, 0)
+	t.Cleanup(cacheProvider.Close)
+
+	controller := NewSamlController(users, memory.NewRefreshTokenRepository(), identities, memberships, jwt.NewBaseProvider(), cacheProvider, map[string]*sso.SamlConnection{"acme": connection})
+
+	engine := gin.New()
+	engine.GET("/saml/:connection/login", controller.Login)
+	engine.POST("/saml/:connection/acs", controller.AssertionConsumerService)
+
+	return samlFixture{engine, cacheProvider, users, identities, memberships}
+}
+
+// forget drops the record of an assertion, the IdP would issue a new one
+// with its own ID for every login but the fixtures are signed once.
+func (f samlFixture) forget(fixture string) {
+	f.cache.Delete("saml:assertion:acme:id-" + fixture)
+}
+
+func (f samlFixture) post(t *testing.T, fixture string, edit func(string) string) int {
+	return f.postWithRelayState(t, fixture, edit, "")
+}
+
+func (f samlFixture) postWithRelayState(t *testing.T, fixture string, edit func(string) string, relayState string) int {
+	data, err := os.ReadFile(samlTestdata + fixture + ".xml")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := string(data)
+
+	if edit != nil {
+		response = edit(response)
+	}
+
+	body := url.Values{"SAMLResponse": {base64.StdEncoding.EncodeToString([]byte(response))}}
+
+	if len(relayState) > 0 {
+		body.Set("RelayState", relayState)
+	}
+	request := httptest.NewRequest(http.MethodPost, "https://sp.example.com/saml/acme/acs", strings.NewReader(body.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	recorder := httptest.NewRecorder()
+	f.engine.ServeHTTP(recorder, request)
+
+	return recorder.Code
+}
+
+func (f samlFixture) membership(t *testing.T, user models.User) models.Membership {
+	membership, err := f.memberships.GetMembership(samlOrganization, user.ID.String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return membership
+}
+
+func TestSamlProvisionsOrganizationMembers(t *testing.T) {
+	fixture := newSamlFixture(t)
+
+	if status := fixture.post(t, "jane_admin", nil); status != http.StatusOK {
+		t.Fatalf("first login: got status %d", status)
+	}
+
+	user, err := fixture.users.GetUserByEmail("jane@acme.example")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Role != "user" || user.OrganizationID.String != samlOrganization {
+		t.Fatalf("got role %q in organization %q", user.Role, user.OrganizationID.String)
+	}
+
+	if role := fixture.membership(t, user).Role; role != models.AdminRole {
+		t.Fatalf("membership role: got %q, want admin", role)
+	}
+
+	if _, err := fixture.identities.GetIdentity("saml:acme", "jane-id"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSamlSyncsOrganizationRoleOnly(t *testing.T) {
+	fixture := newSamlFixture(t)
+
+	fixture.post(t, "jane_admin", nil)
+
+	user, _ := fixture.users.GetUserByEmail("jane@acme.example")
+	user.Role = "support"
+	fixture.users.UpdateUser(&user, nil)
+
+	if status := fixture.post(t, "jane_member", nil); status != http.StatusOK {
+		t.Fatalf("second login: got status %d", status)
+	}
+
+	user, _ = fixture.users.GetUserByEmail("jane@acme.example")
+
+	if user.Role != "support" || user.Name.String != "Jane Doe" {
+		t.Fatalf("got role %q and name %q", user.Role, user.Name.String)
+	}
+
+	membership := fixture.membership(t, user)
+
+	if membership.Role != models.MemberRole {
+		t.Fatalf("membership role: got %q, want member", membership.Role)
+	}
+
+	membership.Role = models.OwnerRole
+	fixture.memberships.UpdateMembership(&membership, nil)
+
+	fixture.forget("jane_admin")
+
+	if status := fixture.post(t, "jane_admin", nil); status != http.StatusOK {
+		t.Fatalf("third login: got status %d", status)
+	}
+
+	if role := fixture.membership(t, user).Role; role != models.OwnerRole {
+		t.Fatalf("owner: got %q", role)
+	}
+}
+
+func TestSamlDoesNotLinkExistingAccounts(t *testing.T) {
+	fixture := newSamlFixture(t)
+
+	user, _ := models.NewUser("John", "john@acme.example", "password123", "password")
+	fixture.users.CreateUser(user, nil)
+
+	if status := fixture.post(t, "john", nil); status != http.StatusConflict {
+		t.Fatalf("existing account: got status %d, want 409", status)
+	}
+
+	if _, err := fixture.identities.GetIdentity("saml:acme", "john-id"); err == nil {
+		t.Fatal("identity was linked by email")
+	}
+
+	if _, err := fixture.memberships.GetMembership(samlOrganization, user.ID.String()); err == nil {
+		t.Fatal("existing account joined the organization")
+	}
+}
+
+func TestSamlRejectsUnscopedOrForgedResponses(t *testing.T) {
+	fixture := newSamlFixture(t)
+
+	if status := fixture.post(t, "mallory", nil); status != http.StatusForbidden {
+		t.Fatalf("other domain: got status %d, want 403", status)
+	}
+
+	forged := func(response string) string {
+		return strings.Replace(response, "jane@acme.example", "john@acme.example", 1)
+	}
+
+	if status := fixture.post(t, "jane_admin", forged); status != http.StatusForbidden {
+		t.Fatalf("forged response: got status %d, want 403", status)
+	}
+
+	if _, err := fixture.users.GetUserByEmail("mallory@other.example"); err == nil {
+		t.Fatal("user was provisioned outside the connection's domains")
+	}
+}
+
+func TestSamlAssertionsAreSingleUse(t *testing.T) {
+	fixture := newSamlFixture(t)
+
+	if status := fixture.post(t, "jane_admin", nil); status != http.StatusOK {
+		t.Fatalf("first use: got status %d", status)
+	}
+
+	if status := fixture.post(t, "jane_admin", nil); status != http.StatusForbidden {
+		t.Fatalf("replayed assertion: got status %d, want 403", status)
+	}
+}
+
+func TestSamlRelayStateIsSingleUse(t *testing.T) {
+	fixture := newSamlFixture(t)
+
+	recorder := httptest.NewRecorder()
+	fixture.engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/saml/acme/login", nil))
+
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("login: got status %d", recorder.Code)
+	}
+
+	location, err := url.Parse(recorder.Header().Get("Location"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relayState := location.Query().Get("RelayState")
+
+	if status := fixture.postWithRelayState(t, "jane_admin", nil, relayState); status != http.StatusOK {
+		t.Fatalf("first use: got status %d", status)
+	}
+
+	if _, err := fixture.cache.Get("saml:" + relayState); err == nil {
+		t.Fatal("relay state is still stored")
+	}
+}
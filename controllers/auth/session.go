@@ -0,0 +1,341 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+)
+
+const mfaChallengeExpiration = 5 * time.Minute
+const reauthExpiration = 5 * time.Minute
+
+var ErrUserDeactivated = errors.New("user is deactivated")
+
+// ErrTooManyAttempts is returned once a short code was guessed too many times.
+var ErrTooManyAttempts = errors.New("too many attempts")
+
+type MFAResponse struct {
+	MFARequired bool     `json:"mfa_required"`
+	MFAToken    string   `json:"mfa_token"`
+	Methods     []string `json:"methods"`
+}
+
+// IssueAuthResponse creates a refresh token and an id token for the user,
+// the same way Login and CreateUser do.
+func IssueAuthResponse(jwtProvider jwt.JWTProvider, refreshTokenRepository models.RefreshTokenRepository, user models.User, isNewUser bool, transaction *sql.Tx) (AuthResponse, error) {
+	if !user.IsActive() {
+		return AuthResponse{}, ErrUserDeactivated
+	}
+
+	refreshToken := models.NewRefreshToken(user.ID)
+	_, err := refreshTokenRepository.CreateRefreshToken(refreshToken, transaction)
+
+	if err != nil {
+		return AuthResponse{}, err
+	}
+
+	token, err := jwtProvider.GenerateToken(user)
+
+	if err != nil {
+		return AuthResponse{}, err
+	}
+
+	return AuthResponse{
+		ID:           user.ID.String(),
+		Email:        user.Email,
+		IsNewUser:    isNewUser,
+		IDToken:      token,
+		RefreshToken: refreshToken.Token.String(),
+	}, nil
+}
+
+// RegisterPasswordUser stores a new password user along with its password
+// and email identities and issues its first tokens, all inside the caller's
+// transaction.
+func RegisterPasswordUser(userRepository models.UserRepository, identityRepository models.IdentityRepository, refreshTokenRepository models.RefreshTokenRepository, jwtProvider jwt.JWTProvider, user *models.User, transaction *sql.Tx) (AuthResponse, error) {
+	_, err := userRepository.CreateUser(user, transaction)
+
+	if err != nil {
+		return AuthResponse{}, err
+	}
+
+	_, err = identityRepository.CreateIdentity(models.NewIdentity(user.ID, "password", user.ID.String()), transaction)
+
+	if err != nil {
+		return AuthResponse{}, err
+	}
+
+	_, err = identityRepository.CreateIdentity(models.NewIdentity(user.ID, "email", user.Email), transaction)
+
+	if err != nil {
+		return AuthResponse{}, err
+	}
+
+	return IssueAuthResponse(jwtProvider, refreshTokenRepository, *user, true, transaction)
+}
+
+// issueErrorStatus tells deactivated users apart from server failures when
+// IssueAuthResponse fails.
+func issueErrorStatus(err error) int {
+	if errors.Is(err, ErrUserDeactivated) {
+		return http.StatusForbidden
+	}
+
+	return http.StatusInternalServerError
+}
+
+// CreateMFAChallenge stores a short lived token proving the user already
+// passed the first factor, to be exchanged by a second factor endpoint.
+func CreateMFAChallenge(cacheProvider cache.CacheProvider, userID string) (string, error) {
+	token, err := uuid.NewRandom()
+
+	if err != nil {
+		return "", err
+	}
+
+	err = cacheProvider.SetEx("mfa:"+token.String(), userID, mfaChallengeExpiration)
+
+	return token.String(), err
+}
+
+// GetMFAChallenge reads the challenge without spending it, for the steps
+// that come before the second factor is checked.
+func GetMFAChallenge(cacheProvider cache.CacheProvider, token string) (string, error) {
+	return readMFAChallenge(cacheProvider.Get, token)
+}
+
+// ConsumeMFAChallenge spends the challenge once the second factor passed, so
+// it can't be exchanged for tokens twice.
+func ConsumeMFAChallenge(cacheProvider cache.CacheProvider, token string) (string, error) {
+	return readMFAChallenge(cacheProvider.GetDel, token)
+}
+
+func readMFAChallenge(read func(key string) (string, error), token string) (string, error) {
+	if len(token) <= 0 {
+		return "", errors.New("invalid mfa token")
+	}
+
+	userID, err := read("mfa:" + token)
+
+	if err != nil || len(userID) <= 0 {
+		return "", errors.New("invalid mfa token")
+	}
+
+	return userID, nil
+}
+
+// MFAMethods lists the second factors the user has enrolled, an empty list
+// means the first factor is enough to sign in.
+func MFAMethods(webAuthnCredentialRepository models.WebAuthnCredentialRepository, user models.User) ([]string, error) {
+	methods := []string{}
+
+	credentials, err := webAuthnCredentialRepository.GetCredentialsByOwner(user.ID.String())
+
+	if err != nil {
+		return methods, err
+	}
+
+	if len(credentials) > 0 {
+		methods = append(methods, "passkey")
+	}
+
+	if user.PhoneVerifiedAt.Valid {
+		methods = append(methods, "sms")
+	}
+
+	return methods, nil
+}
+
+// challengeSecondFactor answers with an MFA challenge when the user enrolled
+// a second factor, leaving out firstFactor when the user just signed in with
+// one of them. It returns false when the caller should go on issuing tokens,
+// and true once it answered, errors included.
+func challengeSecondFactor(c *gin.Context, cacheProvider cache.CacheProvider, webAuthnCredentialRepository models.WebAuthnCredentialRepository, user models.User, firstFactor string) bool {
+	methods, err := MFAMethods(webAuthnCredentialRepository, user)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+
+	secondFactors := []string{}
+
+	for _, method := range methods {
+		if method != firstFactor {
+			secondFactors = append(secondFactors, method)
+		}
+	}
+
+	if len(secondFactors) <= 0 {
+		return false
+	}
+
+	mfaToken, err := CreateMFAChallenge(cacheProvider, user.ID.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+
+	c.JSON(http.StatusOK, MFAResponse{MFARequired: true, MFAToken: mfaToken, Methods: secondFactors})
+
+	return true
+}
+
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateReauthToken records that the user just proved who they are again,
+// sensitive account changes ask for one on top of the id token.
+func CreateReauthToken(cacheProvider cache.CacheProvider, userID string) (string, error) {
+	token, err := uuid.NewRandom()
+
+	if err != nil {
+		return "", err
+	}
+
+	err = cacheProvider.SetEx("reauth:"+token.String(), userID, reauthExpiration)
+
+	return token.String(), err
+}
+
+// ValidateReauthToken spends the token, each sensitive change needs its own.
+func ValidateReauthToken(cacheProvider cache.CacheProvider, token string, userID string) bool {
+	if len(token) <= 0 {
+		return false
+	}
+
+	value, err := cacheProvider.GetDel("reauth:" + token)
+
+	return err == nil && value == userID
+}
+
+// CountAttempt counts a guess at a short code and fails with
+// ErrTooManyAttempts past max, the count starts over once window elapsed.
+func CountAttempt(cacheProvider cache.CacheProvider, key string, max int64, window time.Duration) error {
+	attempts, err := cacheProvider.Incr("attempts:"+key, window)
+
+	if err != nil {
+		return err
+	}
+
+	if attempts > max {
+		return ErrTooManyAttempts
+	}
+
+	return nil
+}
+
+// ResetAttempts clears the count once the code was guessed right.
+func ResetAttempts(cacheProvider cache.CacheProvider, key string) error {
+	return cacheProvider.Delete("attempts:" + key)
+}
+
+// CountLoginMethods counts every way the user can still sign in, linked
+// identities and passkeys alike.
+func CountLoginMethods(identityRepository models.IdentityRepository, webAuthnCredentialRepository models.WebAuthnCredentialRepository, userID string) (int, error) {
+	identities, err := identityRepository.GetIdentitiesByOwner(userID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	credentials, err := webAuthnCredentialRepository.GetCredentialsByOwner(userID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(identities) + len(credentials), nil
+}
+
+// LoginIdentities lists the identities the user can sign in with, creating
+// them for accounts older than identities: a password identity while a
+// password is set, since unlinking it clears the password, and an email
+// identity for accounts with no identity nor passkey at all.
+func LoginIdentities(identityRepository models.IdentityRepository, webAuthnCredentialRepository models.WebAuthnCredentialRepository, user models.User) ([]models.Identity, error) {
+	identities, err := identityRepository.GetIdentitiesByOwner(user.ID.String())
+
+	if err != nil {
+		return identities, err
+	}
+
+	backfill := []*models.Identity{}
+
+	if len(identities) <= 0 {
+		credentials, err := webAuthnCredentialRepository.GetCredentialsByOwner(user.ID.String())
+
+		if err != nil {
+			return identities, err
+		}
+
+		if len(credentials) <= 0 {
+			backfill = append(backfill, models.NewIdentity(user.ID, "email", user.Email))
+		}
+	}
+
+	if len(user.Password) > 0 && !HasIdentity(identities, "password") {
+		backfill = append(backfill, models.NewIdentity(user.ID, "password", user.ID.String()))
+	}
+
+	for _, identity := range backfill {
+		created, err := identityRepository.CreateIdentity(identity, nil)
+
+		if err != nil {
+			return identities, err
+		}
+
+		identities = append(identities, *created)
+	}
+
+	return identities, nil
+}
+
+func HasIdentity(identities []models.Identity, provider string) bool {
+	for _, identity := range identities {
+		if identity.Provider == provider {
+			return true
+		}
+	}
+
+	return false
+}
+
+func createUserWithIdentity(userRepository models.UserRepository, identityRepository models.IdentityRepository, user *models.User, identity *models.Identity) error {
+	transaction, err := userRepository.BeginTransaction()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = userRepository.CreateUser(user, transaction)
+
+	if err != nil {
+		transaction.Rollback()
+		return err
+	}
+
+	_, err = identityRepository.CreateIdentity(identity, transaction)
+
+	if err != nil {
+		transaction.Rollback()
+		return err
+	}
+
+	return transaction.Commit()
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/thiagoferolla/go-auth/providers/cache"
+)
+
+func TestReauthTokenIsSingleUse(t *testing.T) {
+	cacheProvider := cache.NewMemoryProvider(0, 0)
+	defer cacheProvider.Close()
+
+	token, err := CreateReauthToken(cacheProvider, "user-1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ValidateReauthToken(cacheProvider, token, "user-2") {
+		t.Fatal("token accepted for another user")
+	}
+
+	token, _ = CreateReauthToken(cacheProvider, "user-1")
+
+	if !ValidateReauthToken(cacheProvider, token, "user-1") {
+		t.Fatal("fresh token refused")
+	}
+
+	if ValidateReauthToken(cacheProvider, token, "user-1") {
+		t.Fatal("token accepted twice")
+	}
+}
+
+func TestMFAChallengeIsConsumedOnce(t *testing.T) {
+	cacheProvider := cache.NewMemoryProvider(0, 0)
+	defer cacheProvider.Close()
+
+	token, err := CreateMFAChallenge(cacheProvider, "user-1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if userID, err := GetMFAChallenge(cacheProvider, token); err != nil || userID != "user-1" {
+		t.Fatalf("peek: got %q, %v", userID, err)
+	}
+
+	if userID, err := ConsumeMFAChallenge(cacheProvider, token); err != nil || userID != "user-1" {
+		t.Fatalf("consume: got %q, %v", userID, err)
+	}
+
+	if _, err := ConsumeMFAChallenge(cacheProvider, token); err == nil {
+		t.Fatal("challenge consumed twice")
+	}
+}
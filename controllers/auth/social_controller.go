@@ -0,0 +1,338 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/i18n"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"github.com/thiagoferolla/go-auth/providers/social"
+	"golang.org/x/oauth2"
+	"gopkg.in/guregu/null.v4"
+)
+
+const socialStateExpiration = 10 * time.Minute
+
+// socialStateCookie holds the secret that ties the round trip to the browser
+// that started it, a callback URL handed to someone else is refused.
+const socialStateCookie = "go_auth_social_state"
+
+type SocialController struct {
+	UserRepository               models.UserRepository
+	RefreshTokenRepository       models.RefreshTokenRepository
+	WebAuthnCredentialRepository models.WebAuthnCredentialRepository
+	IdentityRepository           models.IdentityRepository
+	JwtProvider                  jwt.JWTProvider
+	Cache                        cache.CacheProvider
+	Providers                    map[string]social.SocialProvider
+}
+
+func NewSocialController(userRepository models.UserRepository, refreshTokenRepository models.RefreshTokenRepository, webAuthnCredentialRepository models.WebAuthnCredentialRepository, identityRepository models.IdentityRepository, jwtProvider jwt.JWTProvider, cache cache.CacheProvider, providers map[string]social.SocialProvider) *SocialController {
+	return &SocialController{userRepository, refreshTokenRepository, webAuthnCredentialRepository, identityRepository, jwtProvider, cache, providers}
+}
+
+// socialState survives the round trip through the provider, LinkUserID is
+// set when an already signed in user is adding the provider to the account.
+// Binding is the hash of the secret kept in the browser cookie.
+type socialState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+	LinkUserID   string `json:"link_user_id,omitempty"`
+	Binding      string `json:"binding"`
+}
+
+func (controller SocialController) authorizationURL(c *gin.Context, provider social.SocialProvider, linkUserID string) (string, error) {
+	state, err := uuid.NewRandom()
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := uuid.NewRandom()
+
+	if err != nil {
+		return "", err
+	}
+
+	binding, err := uuid.NewRandom()
+
+	if err != nil {
+		return "", err
+	}
+
+	codeVerifier := oauth2.GenerateVerifier()
+
+	data, err := json.Marshal(socialState{
+		Provider:     provider.Name(),
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce.String(),
+		LinkUserID:   linkUserID,
+		Binding:      HashToken(binding.String()),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	err = controller.Cache.SetEx("social:"+state.String(), string(data), socialStateExpiration)
+
+	if err != nil {
+		return "", err
+	}
+
+	setSocialStateCookie(c, binding.String(), int(socialStateExpiration.Seconds()))
+
+	return provider.AuthCodeURL(state.String(), codeVerifier, nonce.String()), nil
+}
+
+// setSocialStateCookie is Lax so it comes back on the provider's redirect, an
+// empty value with a negative age clears it.
+func setSocialStateCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(socialStateCookie, value, maxAge, "/", "", gin.Mode() == gin.ReleaseMode, true)
+}
+
+func (controller SocialController) Authorize(c *gin.Context) {
+	provider, ok := controller.Providers[c.Param("provider")]
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	url, err := controller.authorizationURL(c, provider, "")
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusFound, url)
+
+	return
+}
+
+type LinkSocialPayload struct {
+	ReauthToken string `json:"reauth_token"`
+}
+
+type LinkSocialResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// Link starts the provider round trip for the signed in user, the callback
+// then attaches the provider identity instead of signing in. The state cookie
+// is set on this response, so the client must keep cookies for the API.
+func (controller SocialController) Link(c *gin.Context) {
+	var payload LinkSocialPayload
+	user := c.MustGet("user").(models.User)
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !ValidateReauthToken(controller.Cache, payload.ReauthToken, user.ID.String()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Reauthentication required"})
+		return
+	}
+
+	provider, ok := controller.Providers[c.Param("provider")]
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	url, err := controller.authorizationURL(c, provider, user.ID.String())
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, LinkSocialResponse{AuthorizationURL: url})
+
+	return
+}
+
+func (controller SocialController) Callback(c *gin.Context) {
+	provider, ok := controller.Providers[c.Param("provider")]
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	if len(c.Query("error")) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": c.Query("error")})
+		return
+	}
+
+	if len(c.Query("state")) <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
+		return
+	}
+
+	data, err := controller.Cache.GetDel("social:" + c.Query("state"))
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
+		return
+	}
+
+	var state socialState
+
+	if err = json.Unmarshal([]byte(data), &state); err != nil || state.Provider != provider.Name() {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
+		return
+	}
+
+	binding, err := c.Cookie(socialStateCookie)
+
+	if err != nil || subtle.ConstantTimeCompare([]byte(HashToken(binding)), []byte(state.Binding)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
+		return
+	}
+
+	setSocialStateCookie(c, "", -1)
+
+	identity, err := provider.Exchange(c.Request.Context(), c.Query("code"), state.CodeVerifier, state.Nonce)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authorization code"})
+		return
+	}
+
+	if len(state.LinkUserID) > 0 {
+		controller.linkIdentity(c, state.LinkUserID, identity)
+		return
+	}
+
+	isNewUser := false
+	var user models.User
+
+	linked, err := controller.IdentityRepository.GetIdentity(identity.Provider, identity.Subject)
+
+	if err == nil {
+		user, err = controller.UserRepository.GetUserByID(linked.Owner.String())
+
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized"})
+			return
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else {
+		if !identity.EmailVerified || !models.ValidateEmail(identity.Email) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A verified email is required"})
+			return
+		}
+
+		user, err = controller.UserRepository.GetUserByEmail(identity.Email)
+
+		if err == nil {
+			// Accounts are only found through their identities, joining one
+			// by address would undo an unlink and hand the account to
+			// whoever controls the provider account.
+			c.JSON(http.StatusConflict, gin.H{"error": "Sign in and link the provider from your account"})
+			return
+		} else if errors.Is(err, sql.ErrNoRows) && signUpOpen() {
+			newUser, err := models.NewPasswordlessUser(identity.Name, identity.Email, identity.Provider)
+
+			if err != nil {
+				log.Println(err)
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			newUser.EmailVerifiedAt = null.NewTime(time.Now(), true)
+			newUser.Locale = i18n.Negotiate(c.GetHeader("Accept-Language"))
+
+			err = createUserWithIdentity(controller.UserRepository, controller.IdentityRepository, newUser, models.NewIdentity(newUser.ID, identity.Provider, identity.Subject))
+
+			if err != nil {
+				log.Println(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			user = *newUser
+			isNewUser = true
+		} else {
+			log.Println(err)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized"})
+			return
+		}
+	}
+
+	if !isNewUser && challengeSecondFactor(c, controller.Cache, controller.WebAuthnCredentialRepository, user, "") {
+		return
+	}
+
+	response, err := IssueAuthResponse(controller.JwtProvider, controller.RefreshTokenRepository, user, isNewUser, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(issueErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+
+	return
+}
+
+func (controller SocialController) linkIdentity(c *gin.Context, userID string, identity social.SocialIdentity) {
+	linked, err := controller.IdentityRepository.GetIdentity(identity.Provider, identity.Subject)
+
+	if err == nil {
+		if linked.Owner.String() == userID {
+			c.JSON(http.StatusOK, linked)
+			return
+		}
+
+		c.JSON(http.StatusConflict, gin.H{"error": "Identity already linked to another account"})
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	owner, err := uuid.Parse(userID)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
+		return
+	}
+
+	created, err := controller.IdentityRepository.CreateIdentity(models.NewIdentity(owner, identity.Provider, identity.Subject), nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"github.com/thiagoferolla/go-auth/providers/social"
+	"github.com/thiagoferolla/go-auth/repositories/memory"
+	"gopkg.in/guregu/null.v4"
+)
+
+// fakeSocialProvider approves every round trip with the same identity, the
+// OIDC exchange itself is covered in the social package.
+type fakeSocialProvider struct {
+	identity social.SocialIdentity
+}
+
+func (provider fakeSocialProvider) Name() string {
+	return provider.identity.Provider
+}
+
+func (provider fakeSocialProvider) AuthCodeURL(state string, codeVerifier string, nonce string) string {
+	return "https://provider.test/authorize?" + url.Values{"state": {state}}.Encode()
+}
+
+func (provider fakeSocialProvider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (social.SocialIdentity, error) {
+	return provider.identity, nil
+}
+
+type socialFixture struct {
+	engine     *gin.Engine
+	users      *memory.UserRepository
+	identities *memory.IdentityRepository
+}
+
+func newSocialFixture(t *testing.T) socialFixture {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("SIGN_UP_OPEN", "true")
+
+	users := memory.NewUserRepository()
+	identities := memory.NewIdentityRepository()
+	cacheProvider := cache.NewMemoryProvider(0, 0)
+	t.Cleanup(cacheProvider.Close)
+
+	provider := fakeSocialProvider{social.SocialIdentity{Provider: "fake", Subject: "subject-1", Email: "jane@example.com", EmailVerified: true, Name: "Jane"}}
+
+	controller := NewSocialController(users, memory.NewRefreshTokenRepository(), memory.NewWebAuthnCredentialRepository(), identities, jwt.NewBaseProvider(), cacheProvider, map[string]social.SocialProvider{"fake": provider})
+
+	engine := gin.New()
+	engine.GET("/social/:provider/authorize", controller.Authorize)
+	engine.GET("/social/:provider/callback", controller.Callback)
+
+	return socialFixture{engine, users, identities}
+}
+
+// authorize starts the round trip and returns the state and the cookie the
+// browser was given.
+func (f socialFixture) authorize(t *testing.T) (string, *http.Cookie) {
+	recorder := httptest.NewRecorder()
+	f.engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/social/fake/authorize", nil))
+
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("authorize: got status %d", recorder.Code)
+	}
+
+	location, _ := url.Parse(recorder.Header().Get("Location"))
+	cookies := recorder.Result().Cookies()
+
+	if len(cookies) != 1 || cookies[0].Name != socialStateCookie || !cookies[0].HttpOnly {
+		t.Fatalf("authorize: unexpected cookies %v", cookies)
+	}
+
+	return location.Query().Get("state"), cookies[0]
+}
+
+func (f socialFixture) callback(state string, cookie *http.Cookie) int {
+	request := httptest.NewRequest(http.MethodGet, "/social/fake/callback?"+url.Values{"state": {state}, "code": {"code"}}.Encode(), nil)
+
+	if cookie != nil {
+		request.AddCookie(cookie)
+	}
+
+	recorder := httptest.NewRecorder()
+	f.engine.ServeHTTP(recorder, request)
+
+	return recorder.Code
+}
+
+func TestSocialStateIsSingleUse(t *testing.T) {
+	fixture := newSocialFixture(t)
+	state, cookie := fixture.authorize(t)
+
+	if status := fixture.callback(state, cookie); status != http.StatusOK {
+		t.Fatalf("callback: got status %d", status)
+	}
+
+	if status := fixture.callback(state, cookie); status != http.StatusBadRequest {
+		t.Fatalf("replayed state: got status %d, want 400", status)
+	}
+}
+
+func TestSocialStateIsBoundToBrowser(t *testing.T) {
+	fixture := newSocialFixture(t)
+	state, _ := fixture.authorize(t)
+	_, otherCookie := fixture.authorize(t)
+
+	if status := fixture.callback(state, nil); status != http.StatusBadRequest {
+		t.Fatalf("no cookie: got status %d, want 400", status)
+	}
+
+	state, _ = fixture.authorize(t)
+
+	if status := fixture.callback(state, otherCookie); status != http.StatusBadRequest {
+		t.Fatalf("another browser's cookie: got status %d, want 400", status)
+	}
+}
+
+func TestSocialLoginDoesNotJoinAccountsByEmail(t *testing.T) {
+	fixture := newSocialFixture(t)
+
+	user, _ := models.NewUser("Jane", "jane@example.com", "password123", "password")
+	user.EmailVerifiedAt = null.NewTime(time.Now(), true)
+	fixture.users.CreateUser(user, nil)
+
+	state, cookie := fixture.authorize(t)
+
+	if status := fixture.callback(state, cookie); status != http.StatusConflict {
+		t.Fatalf("existing account: got status %d, want 409", status)
+	}
+
+	if _, err := fixture.identities.GetIdentity("fake", "subject-1"); err == nil {
+		t.Fatal("identity was linked by email")
+	}
+
+	linked, _ := fixture.identities.CreateIdentity(models.NewIdentity(user.ID, "fake", "subject-1"), nil)
+
+	state, cookie = fixture.authorize(t)
+
+	if status := fixture.callback(state, cookie); status != http.StatusOK {
+		t.Fatalf("linked account: got status %d", status)
+	}
+
+	fixture.identities.DeleteIdentity(linked.ID.String(), user.ID.String(), nil)
+
+	state, cookie = fixture.authorize(t)
+
+	if status := fixture.callback(state, cookie); status != http.StatusConflict {
+		t.Fatalf("unlinked account: got status %d, want 409", status)
+	}
+}
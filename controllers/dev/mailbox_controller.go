@@ -0,0 +1,46 @@
+package dev
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/providers/email"
+)
+
+// MailboxController exposes the emails captured by the mailbox provider, it
+// is only registered in development.
+type MailboxController struct {
+	Mailbox *email.MailboxEmailProvider
+}
+
+func NewMailboxController(mailbox *email.MailboxEmailProvider) *MailboxController {
+	return &MailboxController{mailbox}
+}
+
+func (controller MailboxController) ListEmails(c *gin.Context) {
+	c.JSON(http.StatusOK, controller.Mailbox.Emails(c.Query("to")))
+
+	return
+}
+
+func (controller MailboxController) GetEmail(c *gin.Context) {
+	captured, ok := controller.Mailbox.Email(c.Param("id"))
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, captured)
+
+	return
+}
+
+func (controller MailboxController) ClearEmails(c *gin.Context) {
+	controller.Mailbox.Clear(c.Query("to"))
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
@@ -0,0 +1,186 @@
+package dev
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/controllers/auth"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/email"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"github.com/thiagoferolla/go-auth/repositories/memory"
+)
+
+const testEmail = "jane@example.com"
+
+type mailboxFixture struct {
+	engine *gin.Engine
+	users  *memory.UserRepository
+	outbox *email.Outbox
+}
+
+// newMailboxFixture wires the auth routes to an outbox delivering into the
+// mailbox, the way EMAIL_PROVIDER=mailbox runs locally.
+func newMailboxFixture(t *testing.T) mailboxFixture {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("PUBLIC_BASE_URL", "https://app.example.com")
+
+	users := memory.NewUserRepository()
+	cacheProvider := cache.NewMemoryProvider(0, 0)
+	t.Cleanup(cacheProvider.Close)
+
+	mailbox := email.NewMailboxEmailProvider()
+	outbox := email.NewOutbox(memory.NewOutboxEmailRepository(), mailbox, "")
+
+	authController := auth.NewAuthController(users, memory.NewRefreshTokenRepository(), memory.NewWebAuthnCredentialRepository(), memory.NewIdentityRepository(), jwt.NewBaseProvider(), outbox, cacheProvider, nil)
+	mailboxController := NewMailboxController(mailbox)
+
+	engine := gin.New()
+	engine.POST("/auth/sign_in", authController.CreateUser)
+	engine.POST("/auth/login", authController.Login)
+	engine.POST("/auth/send_reset_password", authController.SendPasswordReset)
+	engine.POST("/auth/confirm_email", authController.ConfirmEmail)
+	engine.POST("/auth/reset_password", authController.ResetPassword)
+
+	engine.GET("/dev/mailbox/", mailboxController.ListEmails)
+	engine.GET("/dev/mailbox/:id", mailboxController.GetEmail)
+	engine.DELETE("/dev/mailbox/", mailboxController.ClearEmails)
+
+	return mailboxFixture{engine, users, outbox}
+}
+
+func (f mailboxFixture) do(t *testing.T, method string, path string, payload any) *httptest.ResponseRecorder {
+	var body []byte
+
+	if payload != nil {
+		var err error
+
+		if body, err = json.Marshal(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	request := httptest.NewRequest(method, path, bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	f.engine.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+// latest delivers what the outbox holds and reads the newest email for the
+// address back through the mailbox API.
+func (f mailboxFixture) latest(t *testing.T, template string) email.CapturedEmail {
+	f.outbox.Dispatch()
+
+	recorder := f.do(t, http.MethodGet, "/dev/mailbox/?to="+url.QueryEscape(testEmail), nil)
+
+	var emails []email.CapturedEmail
+	json.Unmarshal(recorder.Body.Bytes(), &emails)
+
+	if recorder.Code != http.StatusOK || len(emails) <= 0 {
+		t.Fatalf("mailbox: got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	if emails[0].Template != template || len(emails[0].Subject) <= 0 {
+		t.Fatalf("got %q email %q, want %q", emails[0].Template, emails[0].Subject, template)
+	}
+
+	recorder = f.do(t, http.MethodGet, "/dev/mailbox/"+emails[0].ID, nil)
+
+	var captured email.CapturedEmail
+	json.Unmarshal(recorder.Body.Bytes(), &captured)
+
+	if recorder.Code != http.StatusOK || captured.ID != emails[0].ID {
+		t.Fatalf("get email: got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	return captured
+}
+
+func token(t *testing.T, captured email.CapturedEmail) string {
+	if len(captured.Tokens) != 1 || len(captured.Links) <= 0 {
+		t.Fatalf("got tokens %v in links %v", captured.Tokens, captured.Links)
+	}
+
+	return captured.Tokens[0]
+}
+
+func TestConfirmEmailThroughMailbox(t *testing.T) {
+	fixture := newMailboxFixture(t)
+
+	recorder := fixture.do(t, http.MethodPost, "/auth/sign_in", auth.CreateUserPayload{Name: "Jane", Email: testEmail, Password: "password123"})
+
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("sign in: got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	confirmation := token(t, fixture.latest(t, email.ConfirmEmailTemplate))
+
+	if status := fixture.do(t, http.MethodPost, "/auth/confirm_email?token="+confirmation, nil).Code; status != http.StatusNoContent {
+		t.Fatalf("confirm: got status %d", status)
+	}
+
+	user, _ := fixture.users.GetUserByEmail(testEmail)
+
+	if !user.EmailVerifiedAt.Valid {
+		t.Fatal("email was not verified")
+	}
+
+	if status := fixture.do(t, http.MethodPost, "/auth/confirm_email?token="+confirmation, nil).Code; status != http.StatusBadRequest {
+		t.Fatalf("replayed confirmation: got status %d, want 400", status)
+	}
+
+	if status := fixture.do(t, http.MethodDelete, "/dev/mailbox/?to="+url.QueryEscape(testEmail), nil).Code; status != http.StatusNoContent {
+		t.Fatalf("clear: got status %d", status)
+	}
+
+	recorder = fixture.do(t, http.MethodGet, "/dev/mailbox/", nil)
+
+	if recorder.Body.String() != "[]" {
+		t.Fatalf("mailbox after clearing: got %s", recorder.Body.String())
+	}
+}
+
+func TestResetPasswordThroughMailbox(t *testing.T) {
+	fixture := newMailboxFixture(t)
+
+	if status := fixture.do(t, http.MethodPost, "/auth/sign_in", auth.CreateUserPayload{Name: "Jane", Email: testEmail, Password: "password123"}).Code; status != http.StatusCreated {
+		t.Fatalf("sign in: got status %d", status)
+	}
+
+	if status := fixture.do(t, http.MethodPost, "/auth/send_reset_password", auth.SendPasswordResetPayload{Email: testEmail}).Code; status != http.StatusNoContent {
+		t.Fatalf("send reset: got status %d", status)
+	}
+
+	reset := token(t, fixture.latest(t, email.ResetPasswordTemplate))
+
+	if status := fixture.do(t, http.MethodPost, "/auth/reset_password?token="+reset, auth.ResetPasswordPayload{Password: "another-password"}).Code; status != http.StatusNoContent {
+		t.Fatalf("reset: got status %d", status)
+	}
+
+	if captured := fixture.latest(t, email.PasswordChangedTemplate); len(captured.Tokens) > 0 {
+		t.Fatalf("password changed email carries tokens %v", captured.Tokens)
+	}
+
+	if status := fixture.do(t, http.MethodPost, "/auth/login", auth.LoginPayload{Email: testEmail, Password: "another-password"}).Code; status != http.StatusOK {
+		t.Fatalf("login with the new password: got status %d", status)
+	}
+
+	if status := fixture.do(t, http.MethodPost, "/auth/login", auth.LoginPayload{Email: testEmail, Password: "password123"}).Code; status == http.StatusOK {
+		t.Fatal("the old password still works")
+	}
+
+	if status := fixture.do(t, http.MethodPost, "/auth/reset_password?token="+reset, auth.ResetPasswordPayload{Password: "third-password"}).Code; status != http.StatusBadRequest {
+		t.Fatalf("replayed reset: got status %d, want 400", status)
+	}
+
+	if status := fixture.do(t, http.MethodGet, "/dev/mailbox/unknown", nil).Code; status != http.StatusNotFound {
+		t.Fatalf("unknown email: got status %d, want 404", status)
+	}
+}
@@ -0,0 +1,148 @@
+package oauth
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"gopkg.in/guregu/null.v4"
+)
+
+type OAuthClientController struct {
+	OAuthClientRepository models.OAuthClientRepository
+}
+
+func NewOAuthClientController(oauthClientRepository models.OAuthClientRepository) *OAuthClientController {
+	return &OAuthClientController{oauthClientRepository}
+}
+
+type CreateClientPayload struct {
+	Name         string `json:"name"`
+	RedirectURIs string `json:"redirect_uris"`
+	Scopes       string `json:"scopes"`
+	Confidential bool   `json:"confidential"`
+}
+
+// ClientSecretResponse is the only place a client secret is ever returned.
+type ClientSecretResponse struct {
+	models.OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func (controller OAuthClientController) ListClients(c *gin.Context) {
+	clients, err := controller.OAuthClientRepository.GetClients()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, clients)
+
+	return
+}
+
+func (controller OAuthClientController) CreateClient(c *gin.Context) {
+	var payload CreateClientPayload
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(payload.Name) <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	client := models.NewOAuthClient(payload.Name, payload.RedirectURIs, payload.Scopes)
+	secret := ""
+
+	if payload.Confidential {
+		var err error
+		secret, err = client.RotateSecret()
+
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	_, err := controller.OAuthClientRepository.CreateClient(client, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, ClientSecretResponse{*client, secret})
+
+	return
+}
+
+func (controller OAuthClientController) RotateSecret(c *gin.Context) {
+	client, err := controller.OAuthClientRepository.GetClientByID(c.Param("id"))
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	if client.IsRevoked() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Client is revoked"})
+		return
+	}
+
+	secret, err := client.RotateSecret()
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = controller.OAuthClientRepository.UpdateClient(&client, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, ClientSecretResponse{client, secret})
+
+	return
+}
+
+func (controller OAuthClientController) RevokeClient(c *gin.Context) {
+	client, err := controller.OAuthClientRepository.GetClientByID(c.Param("id"))
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	client.RevokedAt = null.NewTime(time.Now(), true)
+	client.SecretHash = null.String{}
+
+	_, err = controller.OAuthClientRepository.UpdateClient(&client, nil)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
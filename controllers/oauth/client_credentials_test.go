@@ -0,0 +1,113 @@
+package oauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+)
+
+func TestClientCredentialsGrant(t *testing.T) {
+	fixture := newOAuthFixture(t)
+
+	tests := []struct {
+		name      string
+		clientID  string
+		secret    string
+		basicAuth bool
+		scope     string
+		status    int
+		error     string
+		wantScope string
+	}{
+		{"registered scopes by default", fixture.confidential.ID, fixture.secret, false, "", http.StatusOK, "", "profile emails"},
+		{"basic authentication", fixture.confidential.ID, fixture.secret, true, "", http.StatusOK, "", "profile emails"},
+		{"narrower scope", fixture.confidential.ID, fixture.secret, false, "emails", http.StatusOK, "", "emails"},
+		{"scope outside the client", fixture.confidential.ID, fixture.secret, false, "profile admin", http.StatusBadRequest, "invalid_scope", ""},
+		{"wrong secret", fixture.confidential.ID, "wrong", false, "", http.StatusUnauthorized, "invalid_client", ""},
+		{"public client", fixture.public.ID, "", false, "", http.StatusUnauthorized, "invalid_client", ""},
+		{"unknown client", "unknown", fixture.secret, false, "", http.StatusUnauthorized, "invalid_client", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			form := url.Values{"grant_type": {"client_credentials"}}
+
+			if len(test.scope) > 0 {
+				form.Set("scope", test.scope)
+			}
+
+			if !test.basicAuth {
+				form.Set("client_id", test.clientID)
+				form.Set("client_secret", test.secret)
+			}
+
+			request := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			if test.basicAuth {
+				request.SetBasicAuth(test.clientID, test.secret)
+			}
+
+			recorder := fixture.do(request)
+
+			if recorder.Code != test.status {
+				t.Fatalf("got status %d, want %d: %s", recorder.Code, test.status, recorder.Body.String())
+			}
+
+			if test.status != http.StatusOK {
+				var response map[string]string
+				json.Unmarshal(recorder.Body.Bytes(), &response)
+
+				if response["error"] != test.error {
+					t.Fatalf("got error %q, want %q", response["error"], test.error)
+				}
+
+				return
+			}
+
+			var response TokenResponse
+			json.Unmarshal(recorder.Body.Bytes(), &response)
+
+			if response.Scope != test.wantScope || len(response.RefreshToken) > 0 {
+				t.Fatalf("got scope %q and refresh token %q", response.Scope, response.RefreshToken)
+			}
+
+			claims, err := jwt.NewBaseProvider().ValidateToken(response.AccessToken)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !claims.IsClient() || claims.Subject != fixture.confidential.ID || claims.Scope != test.wantScope {
+				t.Fatalf("got claims %+v", claims)
+			}
+		})
+	}
+}
+
+// Client tokens aren't tied to a user, the user routes behind WithAuth turn
+// them away whatever their scope.
+func TestWithAuthRefusesClientTokens(t *testing.T) {
+	fixture := newOAuthFixture(t)
+
+	_, response := fixture.token(url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {fixture.confidential.ID},
+		"client_secret": {fixture.secret},
+	})
+
+	if len(response.AccessToken) <= 0 {
+		t.Fatal("no access token was issued")
+	}
+
+	for _, path := range []string{"/profile", "/emails"} {
+		if recorder := fixture.get(path, response.AccessToken); recorder.Code != http.StatusForbidden {
+			t.Fatalf("%s: got status %d, want 403", path, recorder.Code)
+		}
+	}
+}
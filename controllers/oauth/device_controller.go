@@ -0,0 +1,454 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/thiagoferolla/go-auth/controllers/auth"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+)
+
+const deviceCodeExpiration = 10 * time.Minute
+const devicePollingInterval = 5
+
+// Wrong user codes are counted per user and per address, past the limit the
+// verification page stops answering until the window passes.
+const (
+	maxUserCodeAttemptsPerUser    = 10
+	maxUserCodeAttemptsPerAddress = 30
+)
+
+// Consonants only, so user codes never spell words and survive being read
+// aloud, as RFC 8628 suggests.
+const userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+
+const (
+	deviceStatusPending  = "pending"
+	deviceStatusApproved = "approved"
+	deviceStatusDenied   = "denied"
+	deviceStatusUsed     = "used"
+)
+
+// deviceAuthorization is written once when the device asks for a code. The
+// user's answer, the polling pace and the redemption each live under their
+// own key so concurrent requests never overwrite one another:
+//
+//   - device_decision: set once with SetNX, "denied" or "approved:<user id>"
+//   - device_poll: present while the device has to wait before polling again
+//   - device_slow_down: seconds added to the interval by slow_down answers
+//   - device_redeemed: set once with SetNX by the poll that gets the tokens
+type deviceAuthorization struct {
+	ClientID  string    `json:"client_id"`
+	Scope     string    `json:"scope"`
+	UserCode  string    `json:"user_code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+func generateUserCode() (string, error) {
+	code := make([]byte, 8)
+
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeCharset))))
+
+		if err != nil {
+			return "", err
+		}
+
+		code[i] = userCodeCharset[n.Int64()]
+	}
+
+	return string(code[:4]) + "-" + string(code[4:]), nil
+}
+
+func normalizeUserCode(userCode string) string {
+	userCode = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(userCode), "-", ""))
+
+	if len(userCode) != 8 {
+		return userCode
+	}
+
+	return userCode[:4] + "-" + userCode[4:]
+}
+
+func (controller OAuthController) saveDeviceAuthorization(deviceCodeHash string, authorization deviceAuthorization) error {
+	data, err := json.Marshal(authorization)
+
+	if err != nil {
+		return err
+	}
+
+	return controller.Cache.SetEx("device:"+deviceCodeHash, string(data), time.Until(authorization.ExpiresAt))
+}
+
+func (controller OAuthController) getDeviceAuthorization(deviceCodeHash string) (deviceAuthorization, bool) {
+	var authorization deviceAuthorization
+
+	data, err := controller.Cache.Get("device:" + deviceCodeHash)
+
+	if err != nil || len(data) <= 0 {
+		return authorization, false
+	}
+
+	if json.Unmarshal([]byte(data), &authorization) != nil || !time.Now().Before(authorization.ExpiresAt) {
+		return authorization, false
+	}
+
+	return authorization, true
+}
+
+// deviceStatus reads the user's answer, the user id comes along when they
+// approved.
+func (controller OAuthController) deviceStatus(deviceCodeHash string) (string, string, error) {
+	redeemed, err := controller.Cache.Get("device_redeemed:" + deviceCodeHash)
+
+	if err == nil && len(redeemed) > 0 {
+		return deviceStatusUsed, "", nil
+	} else if err != nil && !errors.Is(err, cache.ErrNotFound) {
+		return "", "", err
+	}
+
+	decision, err := controller.Cache.Get("device_decision:" + deviceCodeHash)
+
+	if errors.Is(err, cache.ErrNotFound) {
+		return deviceStatusPending, "", nil
+	} else if err != nil {
+		return "", "", err
+	}
+
+	if userID, ok := strings.CutPrefix(decision, deviceStatusApproved+":"); ok {
+		return deviceStatusApproved, userID, nil
+	}
+
+	return deviceStatusDenied, "", nil
+}
+
+func (controller OAuthController) DeviceAuthorization(c *gin.Context) {
+	client, ok := controller.authenticateClient(c)
+
+	if !ok {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	scope := c.PostForm("scope")
+
+	if len(scope) <= 0 {
+		scope = client.Scopes
+	}
+
+	if !client.AllowsScope(scope) {
+		oauthError(c, http.StatusBadRequest, "invalid_scope", "Requested scope is not allowed for this client")
+		return
+	}
+
+	deviceCode, err := uuid.NewRandom()
+
+	if err != nil {
+		log.Println(err)
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	userCode, err := generateUserCode()
+
+	if err != nil {
+		log.Println(err)
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	deviceCodeHash := auth.HashToken(deviceCode.String())
+
+	err = controller.saveDeviceAuthorization(deviceCodeHash, deviceAuthorization{
+		ClientID:  client.ID,
+		Scope:     scope,
+		UserCode:  userCode,
+		ExpiresAt: time.Now().Add(deviceCodeExpiration),
+	})
+
+	if err != nil {
+		log.Println(err)
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	err = controller.Cache.SetEx("device_user:"+userCode, deviceCodeHash, deviceCodeExpiration)
+
+	if err != nil {
+		log.Println(err)
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	verificationURI := os.Getenv("DEVICE_VERIFICATION_URI")
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode.String(),
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: redirectWithParams(verificationURI, map[string][]string{"user_code": {userCode}}),
+		ExpiresIn:               int(deviceCodeExpiration.Seconds()),
+		Interval:                devicePollingInterval,
+	})
+}
+
+type DeviceVerificationResponse struct {
+	UserCode   string `json:"user_code"`
+	ClientID   string `json:"client_id"`
+	ClientName string `json:"client_name"`
+	Scope      string `json:"scope"`
+	Status     string `json:"status"`
+}
+
+func (controller OAuthController) findDeviceByUserCode(userCode string) (string, deviceAuthorization, bool) {
+	deviceCodeHash, err := controller.Cache.Get("device_user:" + normalizeUserCode(userCode))
+
+	if err != nil || len(deviceCodeHash) <= 0 {
+		return "", deviceAuthorization{}, false
+	}
+
+	authorization, ok := controller.getDeviceAuthorization(deviceCodeHash)
+
+	return deviceCodeHash, authorization, ok
+}
+
+// countUserCodeGuess caps how many user codes one user, or one address, can
+// try, user codes are short enough to be guessed otherwise.
+func (controller OAuthController) countUserCodeGuess(c *gin.Context, user models.User) bool {
+	err := auth.CountAttempt(controller.Cache, "device_user_code:user:"+user.ID.String(), maxUserCodeAttemptsPerUser, deviceCodeExpiration)
+
+	if err == nil {
+		err = auth.CountAttempt(controller.Cache, "device_user_code:address:"+c.ClientIP(), maxUserCodeAttemptsPerAddress, deviceCodeExpiration)
+	}
+
+	if errors.Is(err, auth.ErrTooManyAttempts) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts"})
+		return false
+	} else if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+
+	return true
+}
+
+// GetDeviceVerification lets the verification page show which application
+// the signed in user is about to approve.
+func (controller OAuthController) GetDeviceVerification(c *gin.Context) {
+	if !controller.countUserCodeGuess(c, c.MustGet("user").(models.User)) {
+		return
+	}
+
+	deviceCodeHash, authorization, ok := controller.findDeviceByUserCode(c.Query("user_code"))
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	status, _, err := controller.deviceStatus(deviceCodeHash)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	client, err := controller.OAuthClientRepository.GetClientByID(authorization.ClientID)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, DeviceVerificationResponse{
+		UserCode:   authorization.UserCode,
+		ClientID:   client.ID,
+		ClientName: client.Name,
+		Scope:      authorization.Scope,
+		Status:     status,
+	})
+
+	return
+}
+
+type DeviceVerificationPayload struct {
+	UserCode string `json:"user_code"`
+	Approve  bool   `json:"approve"`
+}
+
+// VerifyDevice records the user's answer, only the first answer counts.
+func (controller OAuthController) VerifyDevice(c *gin.Context) {
+	var payload DeviceVerificationPayload
+	user := c.MustGet("user").(models.User)
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !controller.countUserCodeGuess(c, user) {
+		return
+	}
+
+	deviceCodeHash, authorization, ok := controller.findDeviceByUserCode(payload.UserCode)
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	decision := deviceStatusDenied
+
+	if payload.Approve {
+		decision = deviceStatusApproved + ":" + user.ID.String()
+	}
+
+	decided, err := controller.Cache.SetNX("device_decision:"+deviceCodeHash, decision, time.Until(authorization.ExpiresAt))
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !decided {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
+
+// pollTooFast tells whether the device polled before its interval was up,
+// each time it did the interval grows by five seconds as RFC 8628 asks.
+func (controller OAuthController) pollTooFast(deviceCodeHash string, authorization deviceAuthorization) (bool, error) {
+	remaining := time.Until(authorization.ExpiresAt)
+	interval := devicePollingInterval
+
+	slowDown, err := controller.Cache.Get("device_slow_down:" + deviceCodeHash)
+
+	if err == nil {
+		extra, _ := strconv.Atoi(slowDown)
+		interval += extra
+	} else if !errors.Is(err, cache.ErrNotFound) {
+		return false, err
+	}
+
+	onTime, err := controller.Cache.SetNX("device_poll:"+deviceCodeHash, "1", min(time.Duration(interval)*time.Second, remaining))
+
+	if err != nil || onTime {
+		return false, err
+	}
+
+	_, err = controller.Cache.IncrBy("device_slow_down:"+deviceCodeHash, 5, remaining)
+
+	return true, err
+}
+
+func (controller OAuthController) deviceCodeGrant(c *gin.Context) {
+	client, ok := controller.authenticateClient(c)
+
+	if !ok {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	deviceCodeHash := auth.HashToken(c.PostForm("device_code"))
+	authorization, ok := controller.getDeviceAuthorization(deviceCodeHash)
+
+	if !ok {
+		oauthError(c, http.StatusBadRequest, "expired_token", "The device code has expired")
+		return
+	}
+
+	if authorization.ClientID != client.ID {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid device code")
+		return
+	}
+
+	status, userID, err := controller.deviceStatus(deviceCodeHash)
+
+	if err != nil {
+		log.Println(err)
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	switch status {
+	case deviceStatusUsed:
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid device code")
+		return
+	case deviceStatusDenied:
+		oauthError(c, http.StatusBadRequest, "access_denied", "The user denied the request")
+		return
+	case deviceStatusPending:
+		tooFast, err := controller.pollTooFast(deviceCodeHash, authorization)
+
+		if err != nil {
+			log.Println(err)
+		}
+
+		if tooFast {
+			oauthError(c, http.StatusBadRequest, "slow_down", "Polling too frequently")
+			return
+		}
+
+		oauthError(c, http.StatusBadRequest, "authorization_pending", "The user has not approved the request yet")
+		return
+	}
+
+	// Concurrent polls may all see the approval, only the one that records
+	// the redemption gets the tokens.
+	redeemed, err := controller.Cache.SetNX("device_redeemed:"+deviceCodeHash, "1", time.Until(authorization.ExpiresAt))
+
+	if err != nil {
+		log.Println(err)
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	if !redeemed {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid device code")
+		return
+	}
+
+	controller.Cache.Delete("device_user:" + authorization.UserCode)
+
+	user, err := controller.UserRepository.GetUserByID(userID)
+
+	if err != nil || !user.IsActive() {
+		log.Println(err)
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid device code")
+		return
+	}
+
+	controller.issueUserTokens(c, user, client, authorization.Scope)
+}
@@ -0,0 +1,222 @@
+package oauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/thiagoferolla/go-auth/controllers/auth"
+)
+
+const deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+func (f oauthFixture) deviceAuthorization(t *testing.T) DeviceAuthorizationResponse {
+	request := httptest.NewRequest(http.MethodPost, "/device_authorization", strings.NewReader(url.Values{"client_id": {f.public.ID}}.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	recorder := f.do(request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("device authorization: got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var response DeviceAuthorizationResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+
+	return response
+}
+
+func (f oauthFixture) verifyDevice(userCode string, approve bool) int {
+	body, _ := json.Marshal(DeviceVerificationPayload{UserCode: userCode, Approve: approve})
+
+	request := httptest.NewRequest(http.MethodPost, "/device", strings.NewReader(string(body)))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+f.sessionToken)
+
+	return f.do(request).Code
+}
+
+// poll answers with the OAuth error code, empty when tokens were issued.
+func (f oauthFixture) poll(deviceCode string, clientID string) (string, TokenResponse) {
+	recorder, response := f.token(url.Values{"grant_type": {deviceGrantType}, "device_code": {deviceCode}, "client_id": {clientID}})
+
+	if recorder.Code == http.StatusOK {
+		return "", response
+	}
+
+	var failure map[string]string
+	json.Unmarshal(recorder.Body.Bytes(), &failure)
+
+	return failure["error"], response
+}
+
+func TestDeviceCodeGrant(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, f oauthFixture, device DeviceAuthorizationResponse)
+	}{
+		{
+			name: "pending",
+			run: func(t *testing.T, f oauthFixture, device DeviceAuthorizationResponse) {
+				if code, _ := f.poll(device.DeviceCode, f.public.ID); code != "authorization_pending" {
+					t.Fatalf("got %q", code)
+				}
+			},
+		},
+		{
+			name: "slow down",
+			run: func(t *testing.T, f oauthFixture, device DeviceAuthorizationResponse) {
+				f.poll(device.DeviceCode, f.public.ID)
+
+				for _, want := range []string{"slow_down", "slow_down"} {
+					if code, _ := f.poll(device.DeviceCode, f.public.ID); code != want {
+						t.Fatalf("got %q, want %q", code, want)
+					}
+				}
+
+				if slowDown, _ := f.cache.Get("device_slow_down:" + auth.HashToken(device.DeviceCode)); slowDown != "10" {
+					t.Fatalf("interval grew by %q seconds, want 10", slowDown)
+				}
+			},
+		},
+		{
+			name: "approved after a pending poll",
+			run: func(t *testing.T, f oauthFixture, device DeviceAuthorizationResponse) {
+				f.poll(device.DeviceCode, f.public.ID)
+
+				if status := f.verifyDevice(device.UserCode, true); status != http.StatusNoContent {
+					t.Fatalf("approve: got status %d", status)
+				}
+
+				// The pending poll above must not have undone the approval.
+				code, response := f.poll(device.DeviceCode, f.public.ID)
+
+				if code != "" || len(response.AccessToken) <= 0 || response.Scope != "profile" {
+					t.Fatalf("got %q, %+v", code, response)
+				}
+			},
+		},
+		{
+			name: "used",
+			run: func(t *testing.T, f oauthFixture, device DeviceAuthorizationResponse) {
+				f.verifyDevice(device.UserCode, true)
+
+				if code, _ := f.poll(device.DeviceCode, f.public.ID); code != "" {
+					t.Fatalf("first poll: got %q", code)
+				}
+
+				if code, _ := f.poll(device.DeviceCode, f.public.ID); code != "invalid_grant" {
+					t.Fatalf("second poll: got %q", code)
+				}
+
+				if status := f.verifyDevice(device.UserCode, true); status != http.StatusNotFound {
+					t.Fatalf("approve a used code: got status %d", status)
+				}
+			},
+		},
+		{
+			name: "redeemed once under concurrent polls",
+			run: func(t *testing.T, f oauthFixture, device DeviceAuthorizationResponse) {
+				f.verifyDevice(device.UserCode, true)
+
+				var wait sync.WaitGroup
+				var mutex sync.Mutex
+				issued := 0
+
+				for i := 0; i < 10; i++ {
+					wait.Add(1)
+
+					go func() {
+						defer wait.Done()
+
+						if code, _ := f.poll(device.DeviceCode, f.public.ID); code == "" {
+							mutex.Lock()
+							issued++
+							mutex.Unlock()
+						}
+					}()
+				}
+
+				wait.Wait()
+
+				if issued != 1 {
+					t.Fatalf("got tokens %d times", issued)
+				}
+			},
+		},
+		{
+			name: "denied",
+			run: func(t *testing.T, f oauthFixture, device DeviceAuthorizationResponse) {
+				if status := f.verifyDevice(device.UserCode, false); status != http.StatusNoContent {
+					t.Fatalf("deny: got status %d", status)
+				}
+
+				if status := f.verifyDevice(device.UserCode, true); status != http.StatusNotFound {
+					t.Fatalf("approve after denying: got status %d", status)
+				}
+
+				if code, _ := f.poll(device.DeviceCode, f.public.ID); code != "access_denied" {
+					t.Fatalf("got %q", code)
+				}
+			},
+		},
+		{
+			name: "another client",
+			run: func(t *testing.T, f oauthFixture, device DeviceAuthorizationResponse) {
+				f.verifyDevice(device.UserCode, true)
+
+				recorder, _ := f.token(url.Values{"grant_type": {deviceGrantType}, "device_code": {device.DeviceCode}, "client_id": {f.confidential.ID}, "client_secret": {f.secret}})
+
+				if !strings.Contains(recorder.Body.String(), "invalid_grant") {
+					t.Fatalf("got %s", recorder.Body.String())
+				}
+
+				if code, _ := f.poll(device.DeviceCode, f.public.ID); code != "" {
+					t.Fatalf("issuing client: got %q", code)
+				}
+			},
+		},
+		{
+			name: "unknown code",
+			run: func(t *testing.T, f oauthFixture, device DeviceAuthorizationResponse) {
+				if code, _ := f.poll("unknown", f.public.ID); code != "expired_token" {
+					t.Fatalf("got %q", code)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fixture := newOAuthFixture(t)
+			test.run(t, fixture, fixture.deviceAuthorization(t))
+		})
+	}
+}
+
+func TestVerifyDeviceCapsUserCodeGuesses(t *testing.T) {
+	fixture := newOAuthFixture(t)
+	device := fixture.deviceAuthorization(t)
+
+	for i := 0; i < maxUserCodeAttemptsPerUser; i++ {
+		if status := fixture.verifyDevice("BCDF-GHJK", true); status != http.StatusNotFound {
+			t.Fatalf("guess %d: got status %d", i+1, status)
+		}
+	}
+
+	if status := fixture.verifyDevice(device.UserCode, true); status != http.StatusTooManyRequests {
+		t.Fatalf("past the limit: got status %d, want 429", status)
+	}
+
+	if status := fixture.get("/device?user_code="+device.UserCode, fixture.sessionToken).Code; status != http.StatusTooManyRequests {
+		t.Fatalf("lookup past the limit: got status %d, want 429", status)
+	}
+
+	if code, _ := fixture.poll(device.DeviceCode, fixture.public.ID); code != "authorization_pending" {
+		t.Fatalf("got %q", code)
+	}
+}
@@ -0,0 +1,379 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/thiagoferolla/go-auth/controllers/auth"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+)
+
+const authorizationCodeExpiration = time.Minute
+
+type OAuthController struct {
+	UserRepository          models.UserRepository
+	RefreshTokenRepository  models.RefreshTokenRepository
+	OAuthClientRepository   models.OAuthClientRepository
+	ImpersonationRepository models.ImpersonationRepository
+	JwtProvider             jwt.JWTProvider
+	Cache                   cache.CacheProvider
+}
+
+func NewOAuthController(userRepository models.UserRepository, refreshTokenRepository models.RefreshTokenRepository, oauthClientRepository models.OAuthClientRepository, impersonationRepository models.ImpersonationRepository, jwtProvider jwt.JWTProvider, cache cache.CacheProvider) *OAuthController {
+	return &OAuthController{userRepository, refreshTokenRepository, oauthClientRepository, impersonationRepository, jwtProvider, cache}
+}
+
+type TokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int    `json:"expires_in"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+type authorizationCode struct {
+	ClientID      string `json:"client_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	UserID        string `json:"user_id"`
+	Scope         string `json:"scope"`
+	CodeChallenge string `json:"code_challenge"`
+}
+
+func oauthError(c *gin.Context, status int, code string, description string) {
+	c.JSON(status, gin.H{"error": code, "error_description": description})
+}
+
+func redirectWithParams(redirectURI string, params url.Values) string {
+	target, _ := url.Parse(redirectURI)
+	query := target.Query()
+
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+
+	target.RawQuery = query.Encode()
+
+	return target.String()
+}
+
+// verifyCodeChallenge implements the S256 method of RFC 7636.
+func verifyCodeChallenge(codeVerifier string, codeChallenge string) bool {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	expected := base64.RawURLEncoding.EncodeToString(hash[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(codeChallenge)) == 1
+}
+
+type AuthorizeResponse struct {
+	RedirectURI string `json:"redirect_uri"`
+}
+
+// Authorize is called by the login frontend on behalf of the signed in user,
+// it answers with the url to send the browser back to instead of redirecting
+// since the user's token travels in a header.
+func (controller OAuthController) Authorize(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	client, err := controller.OAuthClientRepository.GetClientByID(c.Query("client_id"))
+
+	if err != nil || client.IsRevoked() {
+		log.Println(err)
+		oauthError(c, http.StatusBadRequest, "invalid_client", "Unknown client")
+		return
+	}
+
+	redirectURI := c.Query("redirect_uri")
+
+	if !client.AllowsRedirectURI(redirectURI) {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for this client")
+		return
+	}
+
+	state := c.Query("state")
+
+	fail := func(code string, description string) {
+		params := url.Values{"error": {code}, "error_description": {description}}
+
+		if len(state) > 0 {
+			params.Set("state", state)
+		}
+
+		c.JSON(http.StatusOK, AuthorizeResponse{RedirectURI: redirectWithParams(redirectURI, params)})
+	}
+
+	if c.Query("response_type") != "code" {
+		fail("unsupported_response_type", "Only the code response type is supported")
+		return
+	}
+
+	if len(c.Query("code_challenge")) <= 0 || c.Query("code_challenge_method") != "S256" {
+		fail("invalid_request", "PKCE with the S256 method is required")
+		return
+	}
+
+	// Without a scope the client gets everything it was registered for,
+	// never more.
+	scope := c.Query("scope")
+
+	if len(scope) <= 0 {
+		scope = client.Scopes
+	}
+
+	if !client.AllowsScope(scope) {
+		fail("invalid_scope", "Requested scope is not allowed for this client")
+		return
+	}
+
+	code, err := uuid.NewRandom()
+
+	if err != nil {
+		log.Println(err)
+		fail("server_error", "Could not create authorization code")
+		return
+	}
+
+	data, err := json.Marshal(authorizationCode{
+		ClientID:      client.ID,
+		RedirectURI:   redirectURI,
+		UserID:        user.ID.String(),
+		Scope:         scope,
+		CodeChallenge: c.Query("code_challenge"),
+	})
+
+	if err != nil {
+		log.Println(err)
+		fail("server_error", "Could not create authorization code")
+		return
+	}
+
+	err = controller.Cache.SetEx("oauth_code:"+auth.HashToken(code.String()), string(data), authorizationCodeExpiration)
+
+	if err != nil {
+		log.Println(err)
+		fail("server_error", "Could not create authorization code")
+		return
+	}
+
+	params := url.Values{"code": {code.String()}}
+
+	if len(state) > 0 {
+		params.Set("state", state)
+	}
+
+	c.JSON(http.StatusOK, AuthorizeResponse{RedirectURI: redirectWithParams(redirectURI, params)})
+
+	return
+}
+
+func (controller OAuthController) Token(c *gin.Context) {
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		controller.authorizationCodeGrant(c)
+	case "refresh_token":
+		controller.refreshTokenGrant(c)
+	case "client_credentials":
+		controller.clientCredentialsGrant(c)
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		controller.deviceCodeGrant(c)
+	case "urn:ietf:params:oauth:grant-type:token-exchange":
+		controller.tokenExchangeGrant(c)
+	default:
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type")
+	}
+
+	return
+}
+
+// authenticateClient reads the client from HTTP Basic credentials or from the
+// form, confidential clients must present their secret while public ones
+// only identify themselves.
+func (controller OAuthController) authenticateClient(c *gin.Context) (models.OAuthClient, bool) {
+	clientID, clientSecret, ok := c.Request.BasicAuth()
+
+	if !ok {
+		clientID = c.PostForm("client_id")
+		clientSecret = c.PostForm("client_secret")
+	}
+
+	client, err := controller.OAuthClientRepository.GetClientByID(clientID)
+
+	if err != nil || client.IsRevoked() {
+		log.Println(err)
+		return client, false
+	}
+
+	if client.IsConfidential() && !client.VerifySecret(clientSecret) {
+		return client, false
+	}
+
+	return client, true
+}
+
+// consumeAuthorizationCode reads and deletes the code at once so it cannot be
+// redeemed twice.
+func (controller OAuthController) consumeAuthorizationCode(code string) (authorizationCode, bool) {
+	var data authorizationCode
+
+	value, err := controller.Cache.GetDel("oauth_code:" + auth.HashToken(code))
+
+	if err != nil || len(value) <= 0 {
+		return data, false
+	}
+
+	return data, json.Unmarshal([]byte(value), &data) == nil
+}
+
+func (controller OAuthController) authorizationCodeGrant(c *gin.Context) {
+	client, ok := controller.authenticateClient(c)
+
+	if !ok {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	code, ok := controller.consumeAuthorizationCode(c.PostForm("code"))
+
+	if !ok || code.ClientID != client.ID || code.RedirectURI != c.PostForm("redirect_uri") {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid authorization code")
+		return
+	}
+
+	if !verifyCodeChallenge(c.PostForm("code_verifier"), code.CodeChallenge) {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid code verifier")
+		return
+	}
+
+	user, err := controller.UserRepository.GetUserByID(code.UserID)
+
+	if err != nil || !user.IsActive() {
+		log.Println(err)
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid authorization code")
+		return
+	}
+
+	controller.issueUserTokens(c, user, client, code.Scope)
+}
+
+// issueUserTokens answers a grant made on behalf of the user, the access
+// token only carries scope and the refresh token can only be redeemed by the
+// same client.
+func (controller OAuthController) issueUserTokens(c *gin.Context, user models.User, client models.OAuthClient, scope string) {
+	refreshToken := models.NewClientRefreshToken(user.ID, client.ID, scope)
+	_, err := controller.RefreshTokenRepository.CreateRefreshToken(refreshToken, nil)
+
+	if err != nil {
+		log.Println(err)
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	token, err := controller.JwtProvider.GenerateDelegatedToken(user, client, scope)
+
+	if err != nil {
+		log.Println(err)
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, TokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(jwt.TokenExpiration.Seconds()),
+		RefreshToken: refreshToken.Token.String(),
+		Scope:        scope,
+	})
+}
+
+// refreshTokenGrant only serves refresh tokens issued to the authenticated
+// client, sessions of the first-party app refresh through /refresh_token.
+func (controller OAuthController) refreshTokenGrant(c *gin.Context) {
+	client, ok := controller.authenticateClient(c)
+
+	if !ok {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	refreshToken, err := controller.RefreshTokenRepository.GetRefreshTokenByToken(c.PostForm("refresh_token"))
+
+	if err != nil || !refreshToken.Valid || refreshToken.ClientID.String != client.ID {
+		log.Println(err)
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+		return
+	}
+
+	user, err := controller.UserRepository.GetUserByID(refreshToken.Owner.String())
+
+	if err != nil || !user.IsActive() {
+		log.Println(err)
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+		return
+	}
+
+	token, err := controller.JwtProvider.GenerateDelegatedToken(user, client, refreshToken.Scope)
+
+	if err != nil {
+		log.Println(err)
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, TokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(jwt.TokenExpiration.Seconds()),
+		RefreshToken: refreshToken.Token.String(),
+		Scope:        refreshToken.Scope,
+	})
+}
+
+func (controller OAuthController) clientCredentialsGrant(c *gin.Context) {
+	client, ok := controller.authenticateClient(c)
+
+	if !ok || !client.IsConfidential() {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	scope := c.PostForm("scope")
+
+	if len(scope) <= 0 {
+		scope = client.Scopes
+	}
+
+	if !client.AllowsScope(scope) {
+		oauthError(c, http.StatusBadRequest, "invalid_scope", "Requested scope is not allowed for this client")
+		return
+	}
+
+	token, err := controller.JwtProvider.GenerateClientToken(client, scope)
+
+	if err != nil {
+		log.Println(err)
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(jwt.TokenExpiration.Seconds()),
+		Scope:       scope,
+	})
+}
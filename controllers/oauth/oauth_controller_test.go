@@ -0,0 +1,279 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/controllers/auth"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/middlewares/auth_middleware"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"github.com/thiagoferolla/go-auth/repositories/memory"
+)
+
+const (
+	testRedirectURI  = "https://app.example.com/callback"
+	testCodeVerifier = "verifier-0123456789-0123456789-0123456789"
+)
+
+type oauthFixture struct {
+	engine        *gin.Engine
+	user          models.User
+	sessionToken  string
+	public        models.OAuthClient
+	confidential  models.OAuthClient
+	secret        string
+	refreshTokens *memory.RefreshTokenRepository
+	cache         *cache.MemoryProvider
+}
+
+func newOAuthFixture(t *testing.T) oauthFixture {
+	gin.SetMode(gin.TestMode)
+
+	users := memory.NewUserRepository()
+	clients := memory.NewOAuthClientRepository()
+	refreshTokens := memory.NewRefreshTokenRepository()
+	jwtProvider := jwt.NewBaseProvider()
+	cacheProvider := cache.NewMemoryProvider(0, 0)
+	t.Cleanup(cacheProvider.Close)
+
+	user, err := models.NewUser("Jane", "jane@example.com", "password123", "password")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users.CreateUser(user, nil)
+
+	public := models.NewOAuthClient("Public", testRedirectURI, "profile")
+	clients.CreateClient(public, nil)
+
+	confidential := models.NewOAuthClient("Confidential", testRedirectURI, "profile emails")
+	secret, _ := confidential.RotateSecret()
+	clients.CreateClient(confidential, nil)
+
+	sessionToken, _ := jwtProvider.GenerateToken(*user)
+
+	controller := NewOAuthController(users, refreshTokens, clients, nil, jwtProvider, cacheProvider)
+	authController := auth.NewAuthController(users, refreshTokens, memory.NewWebAuthnCredentialRepository(), memory.NewIdentityRepository(), jwtProvider, nil, cacheProvider, nil)
+	authMiddleware := auth_middleware.NewWithAuthMiddleware(users, clients, nil, jwtProvider)
+
+	engine := gin.New()
+	engine.POST("/token", controller.Token)
+	engine.POST("/device_authorization", controller.DeviceAuthorization)
+	engine.POST("/refresh_token", authController.RefreshToken)
+
+	withAuth := engine.Group("/")
+	withAuth.Use(authMiddleware.WithAuth())
+	withAuth.GET("/authorize", authMiddleware.DenyApiKey(), controller.Authorize)
+	withAuth.GET("/device", authMiddleware.DenyApiKey(), controller.GetDeviceVerification)
+	withAuth.POST("/device", authMiddleware.DenyApiKey(), controller.VerifyDevice)
+	withAuth.GET("/emails", authMiddleware.RequireScope("emails"), func(c *gin.Context) { c.Status(http.StatusOK) })
+	withAuth.GET("/profile", authMiddleware.RequireScope("profile"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	return oauthFixture{engine, *user, sessionToken, *public, *confidential, secret, refreshTokens, cacheProvider}
+}
+
+func (f oauthFixture) do(request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	f.engine.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+func (f oauthFixture) get(path string, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	return f.do(request)
+}
+
+func (f oauthFixture) token(form url.Values) (*httptest.ResponseRecorder, TokenResponse) {
+	return f.tokenAt("/token", form)
+}
+
+func (f oauthFixture) tokenAt(path string, form url.Values) (*httptest.ResponseRecorder, TokenResponse) {
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	recorder := f.do(request)
+
+	var response TokenResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+
+	return recorder, response
+}
+
+// authorize runs the consent step for the client and returns the redirect
+// the browser is sent back to.
+func (f oauthFixture) authorize(t *testing.T, client models.OAuthClient, scope string) url.Values {
+	challenge := sha256.Sum256([]byte(testCodeVerifier))
+
+	query := url.Values{
+		"client_id":             {client.ID},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {"code"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+		"scope":                 {scope},
+	}
+
+	recorder := f.get("/authorize?"+query.Encode(), f.sessionToken)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("authorize: got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var response AuthorizeResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+
+	redirect, _ := url.Parse(response.RedirectURI)
+
+	return redirect.Query()
+}
+
+func (f oauthFixture) exchange(t *testing.T, client models.OAuthClient, secret string, scope string) TokenResponse {
+	params := f.authorize(t, client, scope)
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {params.Get("code")},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testCodeVerifier},
+		"client_id":     {client.ID},
+		"client_secret": {secret},
+	}
+
+	recorder, response := f.token(form)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("token: got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	return response
+}
+
+func TestAuthorizeRejectsScopeOutsideClient(t *testing.T) {
+	fixture := newOAuthFixture(t)
+
+	params := fixture.authorize(t, fixture.public, "profile emails")
+
+	if params.Get("error") != "invalid_scope" || len(params.Get("code")) > 0 {
+		t.Fatalf("got %v, want an invalid_scope error", params)
+	}
+}
+
+func TestAuthorizationCodeTokenCarriesGrantedScope(t *testing.T) {
+	fixture := newOAuthFixture(t)
+
+	response := fixture.exchange(t, fixture.confidential, fixture.secret, "profile")
+
+	if response.Scope != "profile" {
+		t.Fatalf("scope: got %q", response.Scope)
+	}
+
+	if status := fixture.get("/profile", response.AccessToken).Code; status != http.StatusOK {
+		t.Fatalf("granted scope: got status %d", status)
+	}
+
+	if status := fixture.get("/emails", response.AccessToken).Code; status != http.StatusForbidden {
+		t.Fatalf("scope not granted: got status %d, want 403", status)
+	}
+
+	if status := fixture.get("/emails", fixture.sessionToken).Code; status != http.StatusOK {
+		t.Fatalf("first-party session: got status %d", status)
+	}
+
+	if status := fixture.get("/authorize", response.AccessToken).Code; status != http.StatusForbidden {
+		t.Fatalf("consent with a client token: got status %d, want 403", status)
+	}
+
+	// No scope asked means every scope registered for the client.
+	if response = fixture.exchange(t, fixture.public, "", ""); response.Scope != "profile" {
+		t.Fatalf("default scope: got %q", response.Scope)
+	}
+}
+
+func TestRefreshTokenIsBoundToClient(t *testing.T) {
+	fixture := newOAuthFixture(t)
+
+	issued := fixture.exchange(t, fixture.confidential, fixture.secret, "emails")
+
+	tests := []struct {
+		name   string
+		form   url.Values
+		status int
+	}{
+		{
+			name:   "missing secret",
+			form:   url.Values{"client_id": {fixture.confidential.ID}},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong secret",
+			form:   url.Values{"client_id": {fixture.confidential.ID}, "client_secret": {"wrong"}},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "another client",
+			form:   url.Values{"client_id": {fixture.public.ID}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "issuing client",
+			form:   url.Values{"client_id": {fixture.confidential.ID}, "client_secret": {fixture.secret}},
+			status: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.form.Set("grant_type", "refresh_token")
+			test.form.Set("refresh_token", issued.RefreshToken)
+
+			recorder, response := fixture.token(test.form)
+
+			if recorder.Code != test.status {
+				t.Fatalf("got status %d, want %d: %s", recorder.Code, test.status, recorder.Body.String())
+			}
+
+			if test.status == http.StatusOK && response.Scope != "emails" {
+				t.Fatalf("scope: got %q", response.Scope)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenGrantRefusesSessionTokens(t *testing.T) {
+	fixture := newOAuthFixture(t)
+
+	session := models.NewRefreshToken(fixture.user.ID)
+	fixture.refreshTokens.CreateRefreshToken(session, nil)
+
+	recorder, _ := fixture.token(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {session.Token.String()},
+		"client_id":     {fixture.public.ID},
+	})
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("session refresh token: got status %d, want 400", recorder.Code)
+	}
+
+	issued := fixture.exchange(t, fixture.public, "", "profile")
+
+	request := httptest.NewRequest(http.MethodPost, "/refresh_token", strings.NewReader(`{"refresh_token":"`+issued.RefreshToken+`"}`))
+	request.Header.Set("Content-Type", "application/json")
+
+	if status := fixture.do(request).Code; status != http.StatusBadRequest {
+		t.Fatalf("client refresh token on /refresh_token: got status %d, want 400", status)
+	}
+}
@@ -0,0 +1,93 @@
+package oauth
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+const impersonationExpiration = 15 * time.Minute
+
+const (
+	accessTokenType = "urn:ietf:params:oauth:token-type:access_token"
+	userIDTokenType = "urn:go-auth:params:oauth:token-type:user_id"
+)
+
+// tokenExchangeGrant implements impersonation on top of RFC 8693: the actor
+// token is the caller's own access token and the subject token names the
+// user to act as. Every exchange is recorded before the token is handed out.
+func (controller OAuthController) tokenExchangeGrant(c *gin.Context) {
+	client, ok := controller.authenticateClient(c)
+
+	if !ok {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	if c.PostForm("actor_token_type") != accessTokenType || c.PostForm("subject_token_type") != userIDTokenType {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "Unsupported token types")
+		return
+	}
+
+	claims, err := controller.JwtProvider.ValidateToken(c.PostForm("actor_token"))
+
+	if err != nil || claims.IsClient() || claims.IsImpersonation() || claims.IsDelegated() {
+		log.Println(err)
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid actor token")
+		return
+	}
+
+	actor, err := controller.UserRepository.GetUserByID(claims.ID.String())
+
+	if err != nil || !actor.CanImpersonate() || !actor.IsActive() {
+		log.Println(err)
+		oauthError(c, http.StatusForbidden, "access_denied", "Actor is not allowed to impersonate")
+		return
+	}
+
+	subject, err := controller.UserRepository.GetUserByID(c.PostForm("subject_token"))
+
+	if err != nil || !subject.IsActive() {
+		log.Println(err)
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid subject token")
+		return
+	}
+
+	// Staff can't be impersonated at all, otherwise support could act as
+	// another support user or an admin.
+	if subject.ID == actor.ID || subject.CanImpersonate() {
+		oauthError(c, http.StatusForbidden, "access_denied", "This user cannot be impersonated")
+		return
+	}
+
+	impersonation := models.NewImpersonation(actor.ID, subject.ID, client.ID, c.PostForm("reason"), time.Now().Add(impersonationExpiration))
+
+	_, err = controller.ImpersonationRepository.CreateImpersonation(impersonation, nil)
+
+	if err != nil {
+		log.Println(err)
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	log.Println("User ", actor.ID.String(), " impersonating ", subject.ID.String(), " through client ", client.ID)
+
+	token, err := controller.JwtProvider.GenerateImpersonationToken(subject, actor, impersonationExpiration)
+
+	if err != nil {
+		log.Println(err)
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, TokenResponse{
+		AccessToken:     token,
+		IssuedTokenType: accessTokenType,
+		TokenType:       "Bearer",
+		ExpiresIn:       int(impersonationExpiration.Seconds()),
+	})
+}
@@ -0,0 +1,78 @@
+package oauth
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"github.com/thiagoferolla/go-auth/repositories/memory"
+)
+
+func TestTokenExchangeRefusesStaffSubjects(t *testing.T) {
+	fixture := newOAuthFixture(t)
+
+	users := memory.NewUserRepository()
+	clients := memory.NewOAuthClientRepository()
+	impersonations := memory.NewImpersonationRepository()
+	jwtProvider := jwt.NewBaseProvider()
+	cacheProvider := cache.NewMemoryProvider(0, 0)
+	t.Cleanup(cacheProvider.Close)
+
+	client := models.NewOAuthClient("Console", testRedirectURI, "")
+	secret, _ := client.RotateSecret()
+	clients.CreateClient(client, nil)
+
+	newUser := func(email string, role string) models.User {
+		user, _ := models.NewUser("User", email, "password123", "password")
+		user.Role = role
+		users.CreateUser(user, nil)
+
+		return *user
+	}
+
+	actor := newUser("support@example.com", "support")
+	actorToken, _ := jwtProvider.GenerateToken(actor)
+
+	controller := NewOAuthController(users, memory.NewRefreshTokenRepository(), clients, impersonations, jwtProvider, cacheProvider)
+	fixture.engine.POST("/exchange", controller.Token)
+
+	exchange := func(subject models.User) int {
+		recorder, _ := fixture.tokenAt("/exchange", url.Values{
+			"grant_type":         {"urn:ietf:params:oauth:grant-type:token-exchange"},
+			"client_id":          {client.ID},
+			"client_secret":      {secret},
+			"actor_token":        {actorToken},
+			"actor_token_type":   {accessTokenType},
+			"subject_token":      {subject.ID.String()},
+			"subject_token_type": {userIDTokenType},
+		})
+
+		return recorder.Code
+	}
+
+	tests := []struct {
+		name    string
+		subject models.User
+		status  int
+	}{
+		{"self", actor, http.StatusForbidden},
+		{"admin", newUser("admin@example.com", "admin"), http.StatusForbidden},
+		{"support", newUser("other-support@example.com", "support"), http.StatusForbidden},
+		{"user", newUser("jane@example.com", "user"), http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status := exchange(test.subject); status != test.status {
+				t.Fatalf("got status %d, want %d", status, test.status)
+			}
+		})
+	}
+
+	if recorded := impersonations.Impersonations(); len(recorded) != 1 || recorded[0].Actor != actor.ID {
+		t.Fatalf("got %d recorded impersonations, want 1", len(recorded))
+	}
+}
@@ -0,0 +1,279 @@
+package scim
+
+import (
+	"errors"
+	"strings"
+)
+
+var errInvalidFilter = errors.New("unsupported filter")
+
+type condition struct {
+	Attribute string
+	Operator  string
+	Value     string
+	// Filter is set for value paths such as emails[type eq "work"], which
+	// match when one element of the attribute passes it.
+	Filter Filter
+}
+
+// Filter is the subset of RFC 7644 filters identity providers send: attribute
+// comparisons and value paths joined by "and" and "or", without grouping. It
+// is kept as a list of alternatives each made of conditions that must all
+// hold.
+type Filter [][]condition
+
+type token struct {
+	Text   string
+	Quoted bool
+}
+
+func (current token) is(text string) bool {
+	return !current.Quoted && strings.EqualFold(current.Text, text)
+}
+
+// tokenize splits on spaces, the brackets of value paths stand on their own.
+func tokenize(filter string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(filter)
+
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == ' ':
+			continue
+		case runes[i] == '[' || runes[i] == ']':
+			tokens = append(tokens, token{string(runes[i]), false})
+		case runes[i] == '"':
+			var builder strings.Builder
+			i++
+
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+
+				builder.WriteRune(runes[i])
+			}
+
+			if i >= len(runes) {
+				return tokens, errInvalidFilter
+			}
+
+			tokens = append(tokens, token{builder.String(), true})
+		default:
+			start := i
+
+			for i < len(runes) && runes[i] != ' ' && runes[i] != '[' && runes[i] != ']' {
+				i++
+			}
+
+			tokens = append(tokens, token{string(runes[start:i]), false})
+			i--
+		}
+	}
+
+	return tokens, nil
+}
+
+// filterAttribute lowercases the attribute path and drops the core schema
+// URN some identity providers qualify it with.
+func filterAttribute(attribute string) string {
+	attribute = strings.ToLower(attribute)
+
+	for _, schema := range []string{UserSchema, GroupSchema} {
+		attribute = strings.TrimPrefix(attribute, strings.ToLower(schema)+":")
+	}
+
+	return attribute
+}
+
+func ParseFilter(filter string) (Filter, error) {
+	if len(strings.TrimSpace(filter)) <= 0 {
+		return Filter{}, nil
+	}
+
+	tokens, err := tokenize(filter)
+
+	if err != nil {
+		return Filter{}, err
+	}
+
+	parsed, i, err := parseFilter(tokens, 0)
+
+	if err != nil || i < len(tokens) {
+		return Filter{}, errInvalidFilter
+	}
+
+	return parsed, nil
+}
+
+// parseFilter reads conditions joined by "and" and "or" up to the end of the
+// filter or the bracket closing a value path.
+func parseFilter(tokens []token, i int) (Filter, int, error) {
+	parsed := Filter{}
+	conditions := []condition{}
+
+	for {
+		current, next, err := parseCondition(tokens, i)
+
+		if err != nil {
+			return parsed, next, err
+		}
+
+		conditions = append(conditions, current)
+		i = next
+
+		if i >= len(tokens) || tokens[i].is("]") {
+			return append(parsed, conditions), i, nil
+		}
+
+		switch {
+		case tokens[i].is("and"):
+		case tokens[i].is("or"):
+			parsed = append(parsed, conditions)
+			conditions = []condition{}
+		default:
+			return parsed, i, errInvalidFilter
+		}
+
+		i++
+	}
+}
+
+func parseCondition(tokens []token, i int) (condition, int, error) {
+	if len(tokens)-i < 2 || tokens[i].Quoted || tokens[i].is("[") || tokens[i].is("]") {
+		return condition{}, i, errInvalidFilter
+	}
+
+	current := condition{Attribute: filterAttribute(tokens[i].Text)}
+	i++
+
+	if tokens[i].is("[") {
+		filter, next, err := parseFilter(tokens, i+1)
+
+		if err != nil || next >= len(tokens) || !tokens[next].is("]") {
+			return current, next, errInvalidFilter
+		}
+
+		current.Filter = filter
+
+		return current, next + 1, nil
+	}
+
+	current.Operator = strings.ToLower(tokens[i].Text)
+	i++
+
+	switch current.Operator {
+	case "pr":
+	case "eq", "ne", "co", "sw", "ew":
+		if i >= len(tokens) || tokens[i].is("[") || tokens[i].is("]") {
+			return current, i, errInvalidFilter
+		}
+
+		current.Value = tokens[i].Text
+
+		if !tokens[i].Quoted && current.Value == "null" {
+			current.Value = ""
+		}
+
+		i++
+	default:
+		return current, i, errInvalidFilter
+	}
+
+	return current, i, nil
+}
+
+// matchesElement runs a value path filter against each element of the
+// attribute, the sub-attributes of the element at index are read at that
+// same index.
+func (current condition) matchesElement(values func(attribute string) []string) bool {
+	for index := range values(current.Attribute) {
+		element := func(attribute string) []string {
+			subValues := values(current.Attribute + "." + attribute)
+
+			if index < len(subValues) {
+				return subValues[index : index+1]
+			}
+
+			return []string{}
+		}
+
+		if current.Filter.Matches(element) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (current condition) matches(values []string) bool {
+	if current.Operator == "ne" {
+		for _, value := range values {
+			if strings.EqualFold(value, current.Value) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	for _, value := range values {
+		lowerValue, lowerExpected := strings.ToLower(value), strings.ToLower(current.Value)
+
+		switch current.Operator {
+		case "pr":
+			if len(value) > 0 {
+				return true
+			}
+		case "eq":
+			if lowerValue == lowerExpected {
+				return true
+			}
+		case "co":
+			if strings.Contains(lowerValue, lowerExpected) {
+				return true
+			}
+		case "sw":
+			if strings.HasPrefix(lowerValue, lowerExpected) {
+				return true
+			}
+		case "ew":
+			if strings.HasSuffix(lowerValue, lowerExpected) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Matches resolves every attribute through values, which receives the
+// attribute path lowercased. Multi-valued sub-attributes such as emails.type
+// must list one value per element, in the same order as the attribute.
+func (filter Filter) Matches(values func(attribute string) []string) bool {
+	if len(filter) <= 0 {
+		return true
+	}
+
+	for _, conditions := range filter {
+		matched := true
+
+		for _, current := range conditions {
+			if current.Filter != nil && !current.matchesElement(values) {
+				matched = false
+				break
+			}
+
+			if current.Filter == nil && !current.matches(values(current.Attribute)) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
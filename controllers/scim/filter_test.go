@@ -0,0 +1,100 @@
+package scim
+
+import "testing"
+
+func testUser() User {
+	active := true
+
+	return User{
+		ID:         "2819c223",
+		ExternalID: "bjensen",
+		UserName:   "bjensen@example.com",
+		Emails: []MultiValue{
+			{Value: "bjensen@example.com", Type: "work", Primary: true},
+			{Value: "babs@jensen.org", Type: "home"},
+		},
+		Active: &active,
+		Groups: []MultiValue{{Value: "member", Display: "member"}, {Value: "admin", Display: "admin"}},
+	}
+}
+
+// The filters come from RFC 7644 section 3.4.2.2 and from what the common
+// identity providers send.
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter  string
+		matches bool
+	}{
+		{``, true},
+		{`userName eq "bjensen@example.com"`, true},
+		{`userName eq "BJENSEN@example.com"`, true},
+		{`userName eq "someone@example.com"`, false},
+		{`userName ne "someone@example.com"`, true},
+		{`userName co "jensen"`, true},
+		{`userName sw "bj"`, true},
+		{`userName ew "example.com"`, true},
+		{`externalId eq "bjensen"`, true},
+		{`externalId pr`, true},
+		{`displayName pr`, false},
+		{`active eq true`, true},
+		{`active eq false`, false},
+		{`emails co "jensen.org"`, true},
+		{`emails.value eq "babs@jensen.org"`, true},
+		{`userName eq "someone@example.com" or externalId eq "bjensen"`, true},
+		{`userName eq "bjensen@example.com" and externalId eq "someone"`, false},
+		{`userName eq "someone" or userName eq "bjensen@example.com" and active eq true`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "bjensen@example.com"`, true},
+		{`URN:IETF:PARAMS:SCIM:SCHEMAS:CORE:2.0:USER:externalId eq "bjensen"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "someone@example.com"`, false},
+		{`emails[type eq "work"]`, true},
+		{`emails[type eq "other"]`, false},
+		{`emails[type eq "work" and value co "@example.com"]`, true},
+		{`emails[type eq "work" and value co "@jensen.org"]`, false},
+		{`emails[type eq "home" and value co "@jensen.org"]`, true},
+		{`emails[type eq "other" or primary eq true]`, true},
+		{`emails[type eq "work"] and userName sw "bj"`, true},
+		{`userName sw "x" or emails[value eq "babs@jensen.org"]`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:emails[type eq "work"]`, true},
+		{`groups[display eq "admin"]`, true},
+		{`groups[value eq "owner"]`, false},
+		{`userName eq "a[b]"`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			filter, err := ParseFilter(test.filter)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if matches := filter.Matches(userValues(testUser())); matches != test.matches {
+				t.Fatalf("got %v, want %v", matches, test.matches)
+			}
+		})
+	}
+}
+
+func TestParseFilterRejectsInvalidFilters(t *testing.T) {
+	for _, filter := range []string{
+		`userName`,
+		`userName eq`,
+		`userName gt "a"`,
+		`"userName" eq "a"`,
+		`userName eq "unterminated`,
+		`userName eq "a" and`,
+		`userName eq "a" xor userName eq "b"`,
+		`emails[type eq "work"`,
+		`emails[]`,
+		`emails type eq "work"]`,
+		`userName eq "a"]`,
+		`[type eq "work"]`,
+		`emails[type eq "work"] eq "a"`,
+	} {
+		t.Run(filter, func(t *testing.T) {
+			if _, err := ParseFilter(filter); err == nil {
+				t.Fatal("filter was accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,487 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+// Groups are the organization roles, so pushing a group from the identity
+// provider assigns the role to its members. The group id and displayName are
+// the role name, and the member group holds everyone in the organization.
+var roles = []string{models.OwnerRole, models.AdminRole, models.MemberRole}
+
+var memberValuePath = regexp.MustCompile(`^members\[value eq "([^"]+)"\]$`)
+
+func groupRole(name string) (string, bool) {
+	role := strings.ToLower(strings.TrimSpace(name))
+
+	return role, models.ValidateMembershipRole(role)
+}
+
+func toScimGroup(role string, users map[string]models.User, memberships map[string]models.Membership) Group {
+	group := Group{
+		Schemas:     []string{GroupSchema},
+		ID:          role,
+		DisplayName: role,
+		Members:     []MultiValue{},
+		Meta:        &Meta{ResourceType: "Group", Location: location("Groups", role)},
+	}
+
+	for id, membership := range memberships {
+		if membership.Role == role || role == models.MemberRole {
+			group.Members = append(group.Members, MultiValue{Value: id, Display: users[id].Email, Ref: location("Users", id)})
+		}
+	}
+
+	sort.Slice(group.Members, func(i, j int) bool {
+		return group.Members[i].Value < group.Members[j].Value
+	})
+
+	return group
+}
+
+func groupValues(group Group) func(attribute string) []string {
+	return func(attribute string) []string {
+		switch attribute {
+		case "id", "displayname":
+			return []string{group.ID}
+		case "members", "members.value", "members.display":
+			values := []string{}
+
+			for _, member := range group.Members {
+				if attribute == "members.display" {
+					values = append(values, member.Display)
+				} else {
+					values = append(values, member.Value)
+				}
+			}
+
+			return values
+		}
+
+		return []string{}
+	}
+}
+
+func (controller ScimController) organizationMembers(c *gin.Context) (map[string]models.User, map[string]models.Membership, bool) {
+	organization := provisioningClient(c).Organization.String()
+	usersByID := map[string]models.User{}
+	membershipsByUser := map[string]models.Membership{}
+
+	users, err := controller.UserRepository.GetUsersByOrganization(organization)
+
+	if err != nil {
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return usersByID, membershipsByUser, false
+	}
+
+	memberships, err := controller.MembershipRepository.GetMembershipsByOrganization(organization)
+
+	if err != nil {
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return usersByID, membershipsByUser, false
+	}
+
+	for _, user := range users {
+		usersByID[user.ID.String()] = user
+	}
+
+	for _, membership := range memberships {
+		membershipsByUser[membership.User.String()] = membership
+	}
+
+	return usersByID, membershipsByUser, true
+}
+
+// updateRoles saves the role changes, refusing to leave the organization
+// without an owner.
+func (controller ScimController) updateRoles(c *gin.Context, memberships map[string]models.Membership, changes map[string]string) bool {
+	owners := 0
+
+	for id, membership := range memberships {
+		role := membership.Role
+
+		if changed, ok := changes[id]; ok {
+			role = changed
+		}
+
+		if role == models.OwnerRole {
+			owners++
+		}
+	}
+
+	for id := range changes {
+		if _, ok := memberships[id]; !ok {
+			scimError(c, http.StatusBadRequest, "invalidValue", "User "+id+" is not a member")
+			return false
+		}
+	}
+
+	if owners <= 0 {
+		scimError(c, http.StatusBadRequest, "mutability", "Organization must keep an owner")
+		return false
+	}
+
+	transaction, err := controller.UserRepository.BeginTransaction()
+
+	if err != nil {
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return false
+	}
+
+	for id, role := range changes {
+		membership := memberships[id]
+
+		if membership.Role == role {
+			continue
+		}
+
+		membership.Role = role
+
+		_, err = controller.MembershipRepository.UpdateMembership(&membership, transaction)
+
+		if err != nil {
+			transaction.Rollback()
+			log.Println(err)
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return false
+		}
+
+		memberships[id] = membership
+	}
+
+	err = transaction.Commit()
+
+	if err != nil {
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return false
+	}
+
+	return true
+}
+
+// removedRole is where members taken out of a group end up, leaving the
+// member group changes nothing since every member has a role.
+func removedRole(role string, membership models.Membership) string {
+	if role == models.MemberRole || membership.Role != role {
+		return membership.Role
+	}
+
+	return models.MemberRole
+}
+
+// addMembers never lowers a role, every owner and admin also counts as a
+// member of the member group.
+func addMembers(changes map[string]string, role string, members []MultiValue, memberships map[string]models.Membership) {
+	for _, member := range members {
+		current, changed := changes[member.Value]
+
+		if !changed {
+			current = memberships[member.Value].Role
+		}
+
+		if role == models.MemberRole && (current == models.OwnerRole || current == models.AdminRole) {
+			continue
+		}
+
+		changes[member.Value] = role
+	}
+}
+
+func replaceMembers(changes map[string]string, role string, members []MultiValue, memberships map[string]models.Membership) {
+	for id, membership := range memberships {
+		if membership.Role == role {
+			changes[id] = removedRole(role, membership)
+		}
+	}
+
+	addMembers(changes, role, members, memberships)
+}
+
+func (controller ScimController) ListGroups(c *gin.Context) {
+	filter, err := ParseFilter(c.Query("filter"))
+
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	users, memberships, ok := controller.organizationMembers(c)
+
+	if !ok {
+		return
+	}
+
+	excludeMembers := strings.Contains(c.Query("excludedAttributes"), "members")
+	resources := []any{}
+
+	for _, role := range roles {
+		group := toScimGroup(role, users, memberships)
+
+		if !filter.Matches(groupValues(group)) {
+			continue
+		}
+
+		if excludeMembers {
+			group.Members = nil
+		}
+
+		resources = append(resources, group)
+	}
+
+	respond(c, http.StatusOK, paginate(c, resources))
+
+	return
+}
+
+func (controller ScimController) GetGroup(c *gin.Context) {
+	role, ok := groupRole(c.Param("id"))
+
+	if !ok {
+		scimError(c, http.StatusNotFound, "", "Group not found")
+		return
+	}
+
+	users, memberships, ok := controller.organizationMembers(c)
+
+	if !ok {
+		return
+	}
+
+	group := toScimGroup(role, users, memberships)
+
+	if strings.Contains(c.Query("excludedAttributes"), "members") {
+		group.Members = nil
+	}
+
+	respond(c, http.StatusOK, group)
+
+	return
+}
+
+// CreateGroup only accepts the role names, the group already exists so its
+// members are added to it.
+func (controller ScimController) CreateGroup(c *gin.Context) {
+	var payload Group
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	role, ok := groupRole(payload.DisplayName)
+
+	if !ok {
+		scimError(c, http.StatusBadRequest, "invalidValue", "Groups are the organization roles: owner, admin and member")
+		return
+	}
+
+	users, memberships, ok := controller.organizationMembers(c)
+
+	if !ok {
+		return
+	}
+
+	changes := map[string]string{}
+	addMembers(changes, role, payload.Members, memberships)
+
+	if !controller.updateRoles(c, memberships, changes) {
+		return
+	}
+
+	respond(c, http.StatusCreated, toScimGroup(role, users, memberships))
+
+	return
+}
+
+func (controller ScimController) ReplaceGroup(c *gin.Context) {
+	var payload Group
+
+	role, ok := groupRole(c.Param("id"))
+
+	if !ok {
+		scimError(c, http.StatusNotFound, "", "Group not found")
+		return
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	if renamed, _ := groupRole(payload.DisplayName); len(payload.DisplayName) > 0 && renamed != role {
+		scimError(c, http.StatusBadRequest, "mutability", "Groups cannot be renamed")
+		return
+	}
+
+	users, memberships, ok := controller.organizationMembers(c)
+
+	if !ok {
+		return
+	}
+
+	changes := map[string]string{}
+	replaceMembers(changes, role, payload.Members, memberships)
+
+	if !controller.updateRoles(c, memberships, changes) {
+		return
+	}
+
+	respond(c, http.StatusOK, toScimGroup(role, users, memberships))
+
+	return
+}
+
+// applyGroupPatch turns one patch operation into role changes.
+func applyGroupPatch(changes map[string]string, role string, operation PatchOperation, memberships map[string]models.Membership) error {
+	op, err := normalizeOp(operation.Op)
+
+	if err != nil {
+		return err
+	}
+
+	path := strings.TrimSpace(operation.Path)
+
+	if len(path) <= 0 {
+		if op == "remove" {
+			return requestError{"noTarget", "remove requires a path"}
+		}
+
+		attributes := map[string]json.RawMessage{}
+
+		if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+			return invalidValue("Expected an object of attributes")
+		}
+
+		for attribute, value := range attributes {
+			if err := applyGroupPatch(changes, role, PatchOperation{Op: op, Path: attribute, Value: value}, memberships); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if match := memberValuePath.FindStringSubmatch(path); match != nil {
+		if op != "remove" {
+			return invalidPath(path)
+		}
+
+		if membership, ok := memberships[match[1]]; ok {
+			changes[match[1]] = removedRole(role, membership)
+		}
+
+		return nil
+	}
+
+	switch strings.ToLower(path) {
+	case "id", "schemas", "meta":
+		return nil
+	case "displayname":
+		name, err := parseString(operation.Value)
+
+		if err != nil {
+			return err
+		}
+
+		if renamed, _ := groupRole(name); renamed != role {
+			return requestError{"mutability", "Groups cannot be renamed"}
+		}
+
+		return nil
+	case "members":
+		members := []MultiValue{}
+
+		if len(operation.Value) > 0 && json.Unmarshal(operation.Value, &members) != nil {
+			return invalidValue("Expected a list of members")
+		}
+
+		switch op {
+		case "add":
+			addMembers(changes, role, members, memberships)
+		case "replace":
+			replaceMembers(changes, role, members, memberships)
+		case "remove":
+			if len(members) <= 0 {
+				replaceMembers(changes, role, members, memberships)
+			}
+
+			for _, member := range members {
+				if membership, ok := memberships[member.Value]; ok {
+					changes[member.Value] = removedRole(role, membership)
+				}
+			}
+		}
+
+		return nil
+	}
+
+	return invalidPath(path)
+}
+
+func (controller ScimController) PatchGroup(c *gin.Context) {
+	var payload PatchRequest
+
+	role, ok := groupRole(c.Param("id"))
+
+	if !ok {
+		scimError(c, http.StatusNotFound, "", "Group not found")
+		return
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	users, memberships, ok := controller.organizationMembers(c)
+
+	if !ok {
+		return
+	}
+
+	changes := map[string]string{}
+
+	for _, operation := range payload.Operations {
+		if err := applyGroupPatch(changes, role, operation, memberships); err != nil {
+			var invalid requestError
+
+			if errors.As(err, &invalid) {
+				scimError(c, http.StatusBadRequest, invalid.ScimType, invalid.Detail)
+				return
+			}
+
+			scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+
+	if !controller.updateRoles(c, memberships, changes) {
+		return
+	}
+
+	respond(c, http.StatusOK, toScimGroup(role, users, memberships))
+
+	return
+}
+
+func (controller ScimController) DeleteGroup(c *gin.Context) {
+	scimError(c, http.StatusBadRequest, "mutability", "Groups are the organization roles and cannot be deleted")
+
+	return
+}
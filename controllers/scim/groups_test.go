@@ -0,0 +1,131 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+func TestApplyGroupPatch(t *testing.T) {
+	memberships := map[string]models.Membership{
+		"owner":  {Organization: uuid.New(), Role: models.OwnerRole},
+		"admin":  {Organization: uuid.New(), Role: models.AdminRole},
+		"member": {Organization: uuid.New(), Role: models.MemberRole},
+	}
+
+	tests := []struct {
+		name      string
+		role      string
+		operation PatchOperation
+		changes   map[string]string
+		scimType  string
+	}{
+		{
+			name:      "add members",
+			role:      models.AdminRole,
+			operation: PatchOperation{Op: "add", Path: "members", Value: json.RawMessage(`[{"value":"member"}]`)},
+			changes:   map[string]string{"member": models.AdminRole},
+		},
+		{
+			name:      "add to the member group keeps higher roles",
+			role:      models.MemberRole,
+			operation: PatchOperation{Op: "add", Path: "members", Value: json.RawMessage(`[{"value":"admin"},{"value":"member"}]`)},
+			changes:   map[string]string{"member": models.MemberRole},
+		},
+		{
+			name:      "add without a path",
+			role:      models.AdminRole,
+			operation: PatchOperation{Op: "Add", Value: json.RawMessage(`{"members":[{"value":"member"}]}`)},
+			changes:   map[string]string{"member": models.AdminRole},
+		},
+		{
+			name:      "remove a member by value path",
+			role:      models.AdminRole,
+			operation: PatchOperation{Op: "remove", Path: `members[value eq "admin"]`},
+			changes:   map[string]string{"admin": models.MemberRole},
+		},
+		{
+			name:      "remove a member by value",
+			role:      models.AdminRole,
+			operation: PatchOperation{Op: "remove", Path: "members", Value: json.RawMessage(`[{"value":"admin"}]`)},
+			changes:   map[string]string{"admin": models.MemberRole},
+		},
+		{
+			name:      "remove from a group the user is not in",
+			role:      models.OwnerRole,
+			operation: PatchOperation{Op: "remove", Path: `members[value eq "admin"]`},
+			changes:   map[string]string{"admin": models.AdminRole},
+		},
+		{
+			name:      "remove every member",
+			role:      models.AdminRole,
+			operation: PatchOperation{Op: "remove", Path: "members"},
+			changes:   map[string]string{"admin": models.MemberRole},
+		},
+		{
+			name:      "replace the members",
+			role:      models.AdminRole,
+			operation: PatchOperation{Op: "replace", Path: "members", Value: json.RawMessage(`[{"value":"member"}]`)},
+			changes:   map[string]string{"admin": models.MemberRole, "member": models.AdminRole},
+		},
+		{
+			name:      "replace the same name",
+			role:      models.AdminRole,
+			operation: PatchOperation{Op: "replace", Path: "displayName", Value: json.RawMessage(`"Admin"`)},
+			changes:   map[string]string{},
+		},
+		{
+			name:      "rename",
+			role:      models.AdminRole,
+			operation: PatchOperation{Op: "replace", Path: "displayName", Value: json.RawMessage(`"owner"`)},
+			scimType:  "mutability",
+		},
+		{
+			name:      "add by value path",
+			role:      models.AdminRole,
+			operation: PatchOperation{Op: "add", Path: `members[value eq "member"]`},
+			scimType:  "invalidPath",
+		},
+		{
+			name:      "remove without a path",
+			role:      models.AdminRole,
+			operation: PatchOperation{Op: "remove"},
+			scimType:  "noTarget",
+		},
+		{
+			name:      "not a list of members",
+			role:      models.AdminRole,
+			operation: PatchOperation{Op: "add", Path: "members", Value: json.RawMessage(`{"value":"member"}`)},
+			scimType:  "invalidValue",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := map[string]string{}
+			err := applyGroupPatch(changes, test.role, test.operation, memberships)
+
+			if len(test.scimType) > 0 {
+				var invalid requestError
+
+				if !errors.As(err, &invalid) || invalid.ScimType != test.scimType {
+					t.Fatalf("got %v, want a %s error", err, test.scimType)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(changes, test.changes) {
+				t.Fatalf("got %v, want %v", changes, test.changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package scim
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// requestError carries the scimType to answer with when a request cannot be
+// applied.
+type requestError struct {
+	ScimType string
+	Detail   string
+}
+
+func (err requestError) Error() string {
+	return err.Detail
+}
+
+func invalidValue(detail string) error {
+	return requestError{"invalidValue", detail}
+}
+
+func invalidPath(path string) error {
+	return requestError{"invalidPath", "Unsupported path " + path}
+}
+
+func parseString(raw json.RawMessage) (string, error) {
+	var value string
+
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", invalidValue("Expected a string")
+	}
+
+	return value, nil
+}
+
+// parseBool also takes "True" and "False" strings, which some identity
+// providers send for booleans.
+func parseBool(raw json.RawMessage) (bool, error) {
+	var value bool
+
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value, nil
+	}
+
+	text, err := parseString(raw)
+
+	if err != nil || (!strings.EqualFold(text, "true") && !strings.EqualFold(text, "false")) {
+		return false, invalidValue("Expected a boolean")
+	}
+
+	return strings.EqualFold(text, "true"), nil
+}
+
+func normalizeOp(op string) (string, error) {
+	op = strings.ToLower(op)
+
+	if op != "add" && op != "replace" && op != "remove" {
+		return op, invalidValue("Unsupported op " + op)
+	}
+
+	return op, nil
+}
+
+// ApplyUserPatch applies one operation to the user, an operation without a
+// path carries an object of attributes to set.
+func ApplyUserPatch(user *User, operation PatchOperation) error {
+	op, err := normalizeOp(operation.Op)
+
+	if err != nil {
+		return err
+	}
+
+	if len(operation.Path) > 0 {
+		return applyUserAttribute(user, op, operation.Path, operation.Value)
+	}
+
+	if op == "remove" {
+		return requestError{"noTarget", "remove requires a path"}
+	}
+
+	attributes := map[string]json.RawMessage{}
+
+	if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+		return invalidValue("Expected an object of attributes")
+	}
+
+	for path, value := range attributes {
+		if err := applyUserAttribute(user, op, path, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func applyUserAttribute(user *User, op string, path string, raw json.RawMessage) error {
+	attribute := strings.TrimPrefix(strings.ToLower(path), strings.ToLower(UserSchema)+":")
+	remove := op == "remove"
+
+	if strings.HasPrefix(attribute, "urn:") {
+		// Extension schemas are not stored.
+		return nil
+	}
+
+	if user.Name == nil {
+		user.Name = &Name{}
+	}
+
+	var err error
+
+	switch {
+	case attribute == "id" || attribute == "schemas" || attribute == "meta":
+		return nil
+	case attribute == "active":
+		if remove {
+			return requestError{"mutability", "active cannot be removed"}
+		}
+
+		var active bool
+		active, err = parseBool(raw)
+		user.Active = &active
+	case attribute == "username":
+		if remove {
+			return requestError{"mutability", "userName cannot be removed"}
+		}
+
+		user.UserName, err = parseString(raw)
+	case attribute == "password":
+		if remove {
+			return requestError{"mutability", "password cannot be removed"}
+		}
+
+		user.Password, err = parseString(raw)
+	case attribute == "externalid":
+		user.ExternalID = ""
+
+		if !remove {
+			user.ExternalID, err = parseString(raw)
+		}
+	case attribute == "displayname":
+		user.DisplayName = ""
+
+		if !remove {
+			user.DisplayName, err = parseString(raw)
+		}
+	case attribute == "locale":
+		user.Locale = ""
+
+		if !remove {
+			user.Locale, err = parseString(raw)
+		}
+	case attribute == "preferredlanguage":
+		user.Locale = ""
+		user.PreferredLanguage = ""
+
+		if !remove {
+			user.PreferredLanguage, err = parseString(raw)
+		}
+	case attribute == "name":
+		user.Name = &Name{}
+
+		if !remove && json.Unmarshal(raw, user.Name) != nil {
+			err = invalidValue("Expected a name object")
+		}
+	case attribute == "name.formatted":
+		user.Name.Formatted = ""
+
+		if !remove {
+			user.Name.Formatted, err = parseString(raw)
+		}
+	case attribute == "name.givenname":
+		user.Name.Formatted = ""
+		user.Name.GivenName = ""
+
+		if !remove {
+			user.Name.GivenName, err = parseString(raw)
+		}
+	case attribute == "name.familyname":
+		user.Name.Formatted = ""
+		user.Name.FamilyName = ""
+
+		if !remove {
+			user.Name.FamilyName, err = parseString(raw)
+		}
+	case attribute == "emails":
+		if remove {
+			return requestError{"mutability", "emails cannot be removed"}
+		}
+
+		emails := []MultiValue{}
+
+		if json.Unmarshal(raw, &emails) != nil || len(emails) <= 0 {
+			return invalidValue("Expected a list of emails")
+		}
+
+		user.Emails = emails
+	case strings.HasPrefix(attribute, "emails[") && strings.HasSuffix(attribute, "].value"):
+		// Covers emails[type eq "work"].value and similar, there is a single
+		// address so whichever email is targeted becomes the primary one.
+		if remove {
+			return requestError{"mutability", "emails cannot be removed"}
+		}
+
+		var email string
+		email, err = parseString(raw)
+		user.Emails = []MultiValue{{Value: email, Type: "work", Primary: true}}
+	case attribute == "groups" || strings.HasPrefix(attribute, "groups"):
+		return requestError{"mutability", "groups are managed through the Groups endpoint"}
+	default:
+		return invalidPath(path)
+	}
+
+	return err
+}
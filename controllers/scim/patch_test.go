@@ -0,0 +1,121 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// The operations come from RFC 7644 section 3.5.2 and from what the common
+// identity providers send.
+func TestApplyUserPatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation PatchOperation
+		check     func(user User) bool
+		scimType  string
+	}{
+		{
+			name:      "replace active",
+			operation: PatchOperation{Op: "replace", Path: "active", Value: json.RawMessage(`false`)},
+			check:     func(user User) bool { return user.Active != nil && !*user.Active },
+		},
+		{
+			name:      "replace active with a string",
+			operation: PatchOperation{Op: "Replace", Path: "active", Value: json.RawMessage(`"False"`)},
+			check:     func(user User) bool { return user.Active != nil && !*user.Active },
+		},
+		{
+			name:      "replace without a path",
+			operation: PatchOperation{Op: "replace", Value: json.RawMessage(`{"active":false,"displayName":"Babs","name.givenName":"Barbara"}`)},
+			check: func(user User) bool {
+				return !*user.Active && user.DisplayName == "Babs" && user.Name.GivenName == "Barbara"
+			},
+		},
+		{
+			name:      "replace the email of a type",
+			operation: PatchOperation{Op: "replace", Path: `emails[type eq "work"].value`, Value: json.RawMessage(`"barbara@example.com"`)},
+			check:     func(user User) bool { return user.PrimaryEmail() == "barbara@example.com" },
+		},
+		{
+			name:      "replace with the schema prefix",
+			operation: PatchOperation{Op: "replace", Path: UserSchema + ":userName", Value: json.RawMessage(`"barbara@example.com"`)},
+			check:     func(user User) bool { return user.UserName == "barbara@example.com" },
+		},
+		{
+			name:      "add the external id",
+			operation: PatchOperation{Op: "add", Path: "externalId", Value: json.RawMessage(`"babs"`)},
+			check:     func(user User) bool { return user.ExternalID == "babs" },
+		},
+		{
+			name:      "remove the external id",
+			operation: PatchOperation{Op: "remove", Path: "externalId"},
+			check:     func(user User) bool { return user.ExternalID == "" },
+		},
+		{
+			name:      "extension schema",
+			operation: PatchOperation{Op: "replace", Path: "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", Value: json.RawMessage(`"Sales"`)},
+			check:     func(user User) bool { return user.UserName == "bjensen@example.com" },
+		},
+		{
+			name:      "remove the user name",
+			operation: PatchOperation{Op: "remove", Path: "userName"},
+			scimType:  "mutability",
+		},
+		{
+			name:      "remove the emails",
+			operation: PatchOperation{Op: "remove", Path: `emails[type eq "work"].value`},
+			scimType:  "mutability",
+		},
+		{
+			name:      "change the groups",
+			operation: PatchOperation{Op: "add", Path: "groups", Value: json.RawMessage(`[{"value":"admin"}]`)},
+			scimType:  "mutability",
+		},
+		{
+			name:      "remove without a path",
+			operation: PatchOperation{Op: "remove"},
+			scimType:  "noTarget",
+		},
+		{
+			name:      "unknown attribute",
+			operation: PatchOperation{Op: "replace", Path: "nickName", Value: json.RawMessage(`"babs"`)},
+			scimType:  "invalidPath",
+		},
+		{
+			name:      "unknown op",
+			operation: PatchOperation{Op: "move", Path: "userName", Value: json.RawMessage(`"babs"`)},
+			scimType:  "invalidValue",
+		},
+		{
+			name:      "not a boolean",
+			operation: PatchOperation{Op: "replace", Path: "active", Value: json.RawMessage(`"maybe"`)},
+			scimType:  "invalidValue",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user := testUser()
+			err := ApplyUserPatch(&user, test.operation)
+
+			if len(test.scimType) > 0 {
+				var invalid requestError
+
+				if !errors.As(err, &invalid) || invalid.ScimType != test.scimType {
+					t.Fatalf("got %v, want a %s error", err, test.scimType)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !test.check(user) {
+				t.Fatalf("unexpected user %+v", user)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package scim
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/i18n"
+)
+
+const (
+	UserSchema          = "urn:ietf:params:scim:schemas:core:2.0:User"
+	GroupSchema         = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ListResponseSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpSchema       = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema         = "urn:ietf:params:scim:api:messages:2.0:Error"
+	ServiceConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+const maxResults = 200
+
+// Meta leaves the timestamps out for groups, which are the organization
+// roles and are never created nor modified.
+type Meta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location"`
+}
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// MultiValue is the shape SCIM uses for emails, group members and a user's
+// groups alike.
+type MultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type User struct {
+	Schemas           []string     `json:"schemas"`
+	ID                string       `json:"id,omitempty"`
+	ExternalID        string       `json:"externalId,omitempty"`
+	UserName          string       `json:"userName"`
+	Name              *Name        `json:"name,omitempty"`
+	DisplayName       string       `json:"displayName,omitempty"`
+	Emails            []MultiValue `json:"emails,omitempty"`
+	Active            *bool        `json:"active,omitempty"`
+	Password          string       `json:"password,omitempty"`
+	Locale            string       `json:"locale,omitempty"`
+	PreferredLanguage string       `json:"preferredLanguage,omitempty"`
+	Groups            []MultiValue `json:"groups,omitempty"`
+	Meta              *Meta        `json:"meta,omitempty"`
+}
+
+type Group struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []MultiValue `json:"members,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+func location(resourceType string, id string) string {
+	return os.Getenv("SCIM_BASE_URL") + "/" + resourceType + "/" + id
+}
+
+// PrimaryEmail is the email flagged primary, or the first one.
+func (user User) PrimaryEmail() string {
+	for _, email := range user.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+
+	if len(user.Emails) > 0 {
+		return user.Emails[0].Value
+	}
+
+	return ""
+}
+
+// FullName picks the most complete name the identity provider sent.
+func (user User) FullName() string {
+	if user.Name != nil {
+		if len(user.Name.Formatted) > 0 {
+			return user.Name.Formatted
+		}
+
+		if len(user.Name.GivenName) > 0 || len(user.Name.FamilyName) > 0 {
+			if len(user.Name.GivenName) > 0 && len(user.Name.FamilyName) > 0 {
+				return user.Name.GivenName + " " + user.Name.FamilyName
+			}
+
+			return user.Name.GivenName + user.Name.FamilyName
+		}
+	}
+
+	return user.DisplayName
+}
+
+// PreferredLocale reads locale first, the attribute meant for localization,
+// and falls back to preferredLanguage, which follows the Accept-Language
+// syntax.
+func (user User) PreferredLocale() string {
+	if len(user.Locale) > 0 {
+		return i18n.Normalize(user.Locale)
+	}
+
+	if len(user.PreferredLanguage) > 0 {
+		return i18n.Negotiate(user.PreferredLanguage)
+	}
+
+	return ""
+}
+
+func respond(c *gin.Context, status int, body any) {
+	c.Header("Content-Type", "application/scim+json")
+	c.JSON(status, body)
+}
+
+func scimError(c *gin.Context, status int, scimType string, detail string) {
+	body := gin.H{
+		"schemas": []string{ErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+
+	if len(scimType) > 0 {
+		body["scimType"] = scimType
+	}
+
+	respond(c, status, body)
+}
@@ -0,0 +1,622 @@
+package scim
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"gopkg.in/guregu/null.v4"
+)
+
+// ScimController serves SCIM 2.0 to the provisioning client set by the
+// WithProvisioningClient middleware, every resource is limited to the
+// members of the client's organization.
+type ScimController struct {
+	UserRepository         models.UserRepository
+	RefreshTokenRepository models.RefreshTokenRepository
+	IdentityRepository     models.IdentityRepository
+	MembershipRepository   models.MembershipRepository
+}
+
+func NewScimController(userRepository models.UserRepository, refreshTokenRepository models.RefreshTokenRepository, identityRepository models.IdentityRepository, membershipRepository models.MembershipRepository) *ScimController {
+	return &ScimController{userRepository, refreshTokenRepository, identityRepository, membershipRepository}
+}
+
+func provisioningClient(c *gin.Context) models.ProvisioningClient {
+	return c.MustGet("provisioning_client").(models.ProvisioningClient)
+}
+
+func toScimUser(user models.User, membership models.Membership) User {
+	active := user.IsActive()
+	id := user.ID.String()
+
+	scimUser := User{
+		Schemas:     []string{UserSchema},
+		ID:          id,
+		ExternalID:  membership.ExternalID.String,
+		UserName:    user.Email,
+		DisplayName: user.Name.String,
+		Emails:      []MultiValue{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Locale:      user.Locale,
+		Groups:      []MultiValue{{Value: models.MemberRole, Display: models.MemberRole, Ref: location("Groups", models.MemberRole)}},
+		Meta:        &Meta{ResourceType: "User", Created: &user.CreatedAt, LastModified: &user.UpdatedAt, Location: location("Users", id)},
+	}
+
+	if membership.Role != models.MemberRole {
+		scimUser.Groups = append(scimUser.Groups, MultiValue{Value: membership.Role, Display: membership.Role, Ref: location("Groups", membership.Role)})
+	}
+
+	if user.Name.Valid {
+		scimUser.Name = &Name{Formatted: user.Name.String}
+	}
+
+	return scimUser
+}
+
+func userValues(user User) func(attribute string) []string {
+	return func(attribute string) []string {
+		switch attribute {
+		case "id":
+			return []string{user.ID}
+		case "username":
+			return []string{user.UserName}
+		case "externalid":
+			return []string{user.ExternalID}
+		case "displayname", "name.formatted":
+			return []string{user.DisplayName}
+		case "emails", "emails.value", "emails.type", "emails.primary":
+			values := []string{}
+
+			for _, email := range user.Emails {
+				switch attribute {
+				case "emails.type":
+					values = append(values, email.Type)
+				case "emails.primary":
+					values = append(values, strconv.FormatBool(email.Primary))
+				default:
+					values = append(values, email.Value)
+				}
+			}
+
+			return values
+		case "active":
+			return []string{strconv.FormatBool(user.Active != nil && *user.Active)}
+		case "groups", "groups.value", "groups.display":
+			values := []string{}
+
+			for _, group := range user.Groups {
+				if attribute == "groups.display" {
+					values = append(values, group.Display)
+				} else {
+					values = append(values, group.Value)
+				}
+			}
+
+			return values
+		}
+
+		return []string{}
+	}
+}
+
+// paginate applies the 1-based startIndex and count query parameters.
+func paginate(c *gin.Context, resources []any) ListResponse {
+	startIndex, err := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+
+	count, err := strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(maxResults)))
+
+	if err != nil || count > maxResults {
+		count = maxResults
+	} else if count < 0 {
+		count = 0
+	}
+
+	page := []any{}
+
+	if startIndex-1 < len(resources) {
+		end := startIndex - 1 + count
+
+		if end > len(resources) {
+			end = len(resources)
+		}
+
+		page = resources[startIndex-1 : end]
+	}
+
+	return ListResponse{
+		Schemas:      []string{ListResponseSchema},
+		TotalResults: len(resources),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	}
+}
+
+// scimEmail reads the address from userName, falling back to the primary
+// email for identity providers that use another kind of user name.
+func scimEmail(user User) string {
+	if models.ValidateEmail(user.UserName) {
+		return strings.TrimSpace(user.UserName)
+	}
+
+	return strings.TrimSpace(user.PrimaryEmail())
+}
+
+// member loads a user of the client's organization, answering 404 for anyone
+// else.
+func (controller ScimController) member(c *gin.Context) (models.User, models.Membership, bool) {
+	membership, err := controller.MembershipRepository.GetMembership(provisioningClient(c).Organization.String(), c.Param("id"))
+
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println(err)
+		}
+
+		scimError(c, http.StatusNotFound, "", "User not found")
+		return models.User{}, membership, false
+	}
+
+	user, err := controller.UserRepository.GetUserByID(membership.User.String())
+
+	if err != nil {
+		log.Println(err)
+		scimError(c, http.StatusNotFound, "", "User not found")
+		return user, membership, false
+	}
+
+	return user, membership, true
+}
+
+func (controller ScimController) ListUsers(c *gin.Context) {
+	organization := provisioningClient(c).Organization.String()
+
+	filter, err := ParseFilter(c.Query("filter"))
+
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	users, err := controller.UserRepository.GetUsersByOrganization(organization)
+
+	if err != nil {
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	memberships, err := controller.MembershipRepository.GetMembershipsByOrganization(organization)
+
+	if err != nil {
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	membershipsByUser := map[string]models.Membership{}
+
+	for _, membership := range memberships {
+		membershipsByUser[membership.User.String()] = membership
+	}
+
+	resources := []any{}
+
+	for _, user := range users {
+		scimUser := toScimUser(user, membershipsByUser[user.ID.String()])
+
+		if filter.Matches(userValues(scimUser)) {
+			resources = append(resources, scimUser)
+		}
+	}
+
+	respond(c, http.StatusOK, paginate(c, resources))
+
+	return
+}
+
+func (controller ScimController) GetUser(c *gin.Context) {
+	user, membership, ok := controller.member(c)
+
+	if !ok {
+		return
+	}
+
+	respond(c, http.StatusOK, toScimUser(user, membership))
+
+	return
+}
+
+// CreateUser provisions a new account in the organization, the identity
+// provider vouches for the email so it starts verified. Addresses that
+// already have an account have to join through an invitation instead.
+func (controller ScimController) CreateUser(c *gin.Context) {
+	var payload User
+	client := provisioningClient(c)
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	email := scimEmail(payload)
+
+	if !models.ValidateEmail(email) {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName must be an email")
+		return
+	}
+
+	_, err := controller.UserRepository.GetUserByEmail(email)
+
+	if err == nil {
+		scimError(c, http.StatusConflict, "uniqueness", "User already exists")
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	var user *models.User
+	var identity *models.Identity
+
+	if len(payload.Password) > 0 {
+		user, err = models.NewUser(payload.FullName(), email, payload.Password, "scim")
+	} else {
+		user, err = models.NewPasswordlessUser(payload.FullName(), email, "scim")
+	}
+
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	if len(payload.Password) > 0 {
+		identity = models.NewIdentity(user.ID, "password", user.ID.String())
+	} else {
+		identity = models.NewIdentity(user.ID, "email", email)
+	}
+
+	user.EmailVerifiedAt = null.NewTime(time.Now(), true)
+	user.OrganizationID = null.NewString(client.Organization.String(), true)
+
+	if locale := payload.PreferredLocale(); len(locale) > 0 {
+		user.Locale = locale
+	}
+
+	if payload.Active != nil && !*payload.Active {
+		user.DeactivatedAt = null.NewTime(time.Now(), true)
+	}
+
+	membership := models.NewMembership(client.Organization, user.ID, models.MemberRole)
+	membership.ExternalID = null.NewString(payload.ExternalID, len(payload.ExternalID) > 0)
+	membership.Provisioned = true
+
+	transaction, err := controller.UserRepository.BeginTransaction()
+
+	if err != nil {
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	_, err = controller.UserRepository.CreateUser(user, transaction)
+
+	if err == nil {
+		_, err = controller.IdentityRepository.CreateIdentity(identity, transaction)
+	}
+
+	if err == nil {
+		_, err = controller.MembershipRepository.CreateMembership(membership, transaction)
+	}
+
+	if err != nil {
+		transaction.Rollback()
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	err = transaction.Commit()
+
+	if err != nil {
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	respond(c, http.StatusCreated, toScimUser(*user, *membership))
+
+	return
+}
+
+// saveUser writes the SCIM representation back onto the user and its
+// membership. Deactivating the user revokes their sessions. Accounts the
+// organization did not provision belong to their owner, only the membership
+// follows the identity provider for them.
+func (controller ScimController) saveUser(c *gin.Context, user models.User, membership models.Membership, payload User) {
+	if !membership.Provisioned {
+		controller.saveMembership(c, user, membership, payload)
+		return
+	}
+
+	email := scimEmail(payload)
+
+	if !models.ValidateEmail(email) {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName must be an email")
+		return
+	}
+
+	if !strings.EqualFold(email, user.Email) {
+		_, err := controller.UserRepository.GetUserByEmail(email)
+
+		if err == nil {
+			scimError(c, http.StatusConflict, "uniqueness", "Email already in use")
+			return
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			log.Println(err)
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+
+		// The bounce was for the old address.
+		user.EmailUndeliverableAt = null.Time{}
+	}
+
+	wasActive := user.IsActive()
+	name := payload.FullName()
+
+	user.Email = email
+	user.Name = null.NewString(name, len(name) > 0)
+	membership.ExternalID = null.NewString(payload.ExternalID, len(payload.ExternalID) > 0)
+
+	if locale := payload.PreferredLocale(); len(locale) > 0 {
+		user.Locale = locale
+	}
+
+	if payload.Active != nil && *payload.Active {
+		user.DeactivatedAt = null.Time{}
+	} else if payload.Active != nil && wasActive {
+		user.DeactivatedAt = null.NewTime(time.Now(), true)
+	}
+
+	linkPassword := false
+
+	if len(payload.Password) > 0 {
+		user.Password = payload.Password
+
+		if err := user.HashPassword(); err != nil {
+			log.Println(err)
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+
+		_, err := controller.IdentityRepository.GetIdentity("password", user.ID.String())
+		linkPassword = errors.Is(err, sql.ErrNoRows)
+
+		if err != nil && !linkPassword {
+			log.Println(err)
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+	}
+
+	transaction, err := controller.UserRepository.BeginTransaction()
+
+	if err != nil {
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	_, err = controller.UserRepository.UpdateUser(&user, transaction)
+
+	if err == nil {
+		_, err = controller.MembershipRepository.UpdateMembership(&membership, transaction)
+	}
+
+	if err == nil && linkPassword {
+		_, err = controller.IdentityRepository.CreateIdentity(models.NewIdentity(user.ID, "password", user.ID.String()), transaction)
+	}
+
+	if err == nil && wasActive && !user.IsActive() {
+		err = controller.RefreshTokenRepository.InvalidateTokensByOwner(user.ID.String(), transaction)
+	}
+
+	if err != nil {
+		transaction.Rollback()
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	err = transaction.Commit()
+
+	if err != nil {
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, toScimUser(user, membership))
+}
+
+// saveMembership keeps the account of a member who joined on their own as
+// it is, deactivating them in the identity provider removes them from the
+// organization instead of locking them out of every other one.
+func (controller ScimController) saveMembership(c *gin.Context, user models.User, membership models.Membership, payload User) {
+	if len(payload.Password) > 0 {
+		scimError(c, http.StatusBadRequest, "mutability", "Only users provisioned by the organization can have their password set")
+		return
+	}
+
+	if payload.Active != nil && !*payload.Active {
+		if !controller.removeMember(c, user, membership) {
+			return
+		}
+
+		scimUser := toScimUser(user, membership)
+		scimUser.Active = payload.Active
+
+		respond(c, http.StatusOK, scimUser)
+		return
+	}
+
+	membership.ExternalID = null.NewString(payload.ExternalID, len(payload.ExternalID) > 0)
+
+	_, err := controller.MembershipRepository.UpdateMembership(&membership, nil)
+
+	if err != nil {
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, toScimUser(user, membership))
+}
+
+// removeMember takes the user out of the organization and signs them out so
+// their tokens stop carrying it.
+func (controller ScimController) removeMember(c *gin.Context, user models.User, membership models.Membership) bool {
+	transaction, err := controller.UserRepository.BeginTransaction()
+
+	if err != nil {
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return false
+	}
+
+	err = controller.MembershipRepository.DeleteMembership(membership.Organization.String(), user.ID.String(), transaction)
+
+	if err == nil && user.OrganizationID.String == membership.Organization.String() {
+		user.OrganizationID = null.String{}
+		_, err = controller.UserRepository.UpdateUser(&user, transaction)
+	}
+
+	if err == nil {
+		err = controller.RefreshTokenRepository.InvalidateTokensByOwner(user.ID.String(), transaction)
+	}
+
+	if err != nil {
+		transaction.Rollback()
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return false
+	}
+
+	err = transaction.Commit()
+
+	if err != nil {
+		log.Println(err)
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return false
+	}
+
+	return true
+}
+
+func (controller ScimController) ReplaceUser(c *gin.Context) {
+	var payload User
+
+	user, membership, ok := controller.member(c)
+
+	if !ok {
+		return
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	controller.saveUser(c, user, membership, payload)
+
+	return
+}
+
+func (controller ScimController) PatchUser(c *gin.Context) {
+	var payload PatchRequest
+
+	user, membership, ok := controller.member(c)
+
+	if !ok {
+		return
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	scimUser := toScimUser(user, membership)
+
+	for _, operation := range payload.Operations {
+		if err := ApplyUserPatch(&scimUser, operation); err != nil {
+			var invalid requestError
+
+			if errors.As(err, &invalid) {
+				scimError(c, http.StatusBadRequest, invalid.ScimType, invalid.Detail)
+				return
+			}
+
+			scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+
+	controller.saveUser(c, user, membership, scimUser)
+
+	return
+}
+
+// DeleteUser removes the user from the organization and signs them out, the
+// account itself is kept as it may belong to other organizations.
+func (controller ScimController) DeleteUser(c *gin.Context) {
+	user, membership, ok := controller.member(c)
+
+	if !ok {
+		return
+	}
+
+	if !controller.removeMember(c, user, membership) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+	c.Abort()
+
+	return
+}
+
+func (controller ScimController) ServiceProviderConfig(c *gin.Context) {
+	respond(c, http.StatusOK, gin.H{
+		"schemas":        []string{ServiceConfigSchema},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": maxResults},
+		"changePassword": gin.H{"supported": true},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "Provisioning client token created by an organization admin",
+			"primary":     true,
+		}},
+	})
+
+	return
+}
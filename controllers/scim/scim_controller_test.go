@@ -0,0 +1,244 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/repositories/memory"
+	"gopkg.in/guregu/null.v4"
+)
+
+type scimFixture struct {
+	engine        *gin.Engine
+	organization  uuid.UUID
+	users         *memory.UserRepository
+	memberships   *memory.MembershipRepository
+	refreshTokens *memory.RefreshTokenRepository
+}
+
+func newScimFixture(t *testing.T) scimFixture {
+	gin.SetMode(gin.TestMode)
+
+	users := memory.NewUserRepository()
+	memberships := memory.NewMembershipRepository()
+	refreshTokens := memory.NewRefreshTokenRepository()
+	users.Memberships = memberships
+
+	organization := uuid.New()
+	client := models.ProvisioningClient{ID: uuid.New(), Organization: organization, Name: "Identity provider"}
+
+	controller := NewScimController(users, refreshTokens, memory.NewIdentityRepository(), memberships)
+
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) { c.Set("provisioning_client", client) })
+	engine.GET("/Users", controller.ListUsers)
+	engine.POST("/Users", controller.CreateUser)
+	engine.PUT("/Users/:id", controller.ReplaceUser)
+	engine.PATCH("/Users/:id", controller.PatchUser)
+
+	return scimFixture{engine, organization, users, memberships, refreshTokens}
+}
+
+func (f scimFixture) do(method string, path string, body string) (*httptest.ResponseRecorder, User) {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/scim+json")
+
+	recorder := httptest.NewRecorder()
+	f.engine.ServeHTTP(recorder, request)
+
+	var user User
+	json.Unmarshal(recorder.Body.Bytes(), &user)
+
+	return recorder, user
+}
+
+// provisioned creates the user through SCIM, so the organization owns it.
+func (f scimFixture) provisioned(t *testing.T, email string) models.User {
+	recorder, created := f.do(http.MethodPost, "/Users", `{"userName":"`+email+`","externalId":"ext","password":"password123"}`)
+
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("create: got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	user, _ := f.users.GetUserByID(created.ID)
+
+	return user
+}
+
+// joined is a user with an account of their own who joined the organization.
+func (f scimFixture) joined(t *testing.T, email string) models.User {
+	user, err := models.NewUser("Jane", email, "password123", "password")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user.OrganizationID = null.NewString(f.organization.String(), true)
+	f.users.CreateUser(user, nil)
+	f.memberships.CreateMembership(models.NewMembership(f.organization, user.ID, models.MemberRole), nil)
+
+	return *user
+}
+
+func (f scimFixture) patch(id string, operations string) (*httptest.ResponseRecorder, User) {
+	return f.do(http.MethodPatch, "/Users/"+id, `{"schemas":["`+PatchOpSchema+`"],"Operations":`+operations+`}`)
+}
+
+func TestPatchProvisionedUser(t *testing.T) {
+	fixture := newScimFixture(t)
+	user := fixture.provisioned(t, "babs@example.com")
+	session := models.NewRefreshToken(user.ID)
+	fixture.refreshTokens.CreateRefreshToken(session, nil)
+
+	recorder, _ := fixture.patch(user.ID.String(), `[
+		{"op":"replace","path":"userName","value":"barbara@example.com"},
+		{"op":"replace","path":"password","value":"another-password"},
+		{"op":"replace","path":"active","value":"False"}
+	]`)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	updated, _ := fixture.users.GetUserByID(user.ID.String())
+
+	if updated.Email != "barbara@example.com" {
+		t.Fatalf("email: got %q", updated.Email)
+	}
+
+	if updated.Password == user.Password {
+		t.Fatal("password was not changed")
+	}
+
+	if updated.IsActive() {
+		t.Fatal("user is still active")
+	}
+
+	if token, _ := fixture.refreshTokens.GetRefreshTokenByToken(session.Token.String()); token.Valid {
+		t.Fatal("session was kept")
+	}
+
+	if _, err := fixture.memberships.GetMembership(fixture.organization.String(), user.ID.String()); err != nil {
+		t.Fatalf("membership: %v", err)
+	}
+}
+
+func TestPatchJoinedMemberOnlyChangesMembership(t *testing.T) {
+	fixture := newScimFixture(t)
+	user := fixture.joined(t, "jane@example.com")
+
+	recorder, patched := fixture.patch(user.ID.String(), `[
+		{"op":"replace","value":{"userName":"someone@example.com","displayName":"Someone","externalId":"jane"}}
+	]`)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	updated, _ := fixture.users.GetUserByID(user.ID.String())
+
+	if updated.Email != user.Email || updated.Name != user.Name {
+		t.Fatalf("account changed: got %q %q", updated.Email, updated.Name.String)
+	}
+
+	membership, _ := fixture.memberships.GetMembership(fixture.organization.String(), user.ID.String())
+
+	if membership.ExternalID.String != "jane" || patched.ExternalID != "jane" {
+		t.Fatalf("external id: got %q", membership.ExternalID.String)
+	}
+
+	recorder, _ = fixture.patch(user.ID.String(), `[{"op":"replace","path":"password","value":"another-password"}]`)
+
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "mutability") {
+		t.Fatalf("password: got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	updated, _ = fixture.users.GetUserByID(user.ID.String())
+
+	if updated.Password != user.Password {
+		t.Fatal("password was changed")
+	}
+}
+
+func TestDeactivateJoinedMemberRemovesMembership(t *testing.T) {
+	fixture := newScimFixture(t)
+	user := fixture.joined(t, "jane@example.com")
+	session := models.NewRefreshToken(user.ID)
+	fixture.refreshTokens.CreateRefreshToken(session, nil)
+
+	recorder, patched := fixture.do(http.MethodPut, "/Users/"+user.ID.String(), `{"userName":"jane@example.com","active":false}`)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	if patched.Active == nil || *patched.Active {
+		t.Fatal("response does not show the user as inactive")
+	}
+
+	if _, err := fixture.memberships.GetMembership(fixture.organization.String(), user.ID.String()); err == nil {
+		t.Fatal("membership was kept")
+	}
+
+	updated, _ := fixture.users.GetUserByID(user.ID.String())
+
+	if !updated.IsActive() || updated.DeactivatedAt.Valid {
+		t.Fatal("account was deactivated")
+	}
+
+	if updated.OrganizationID.Valid {
+		t.Fatalf("organization: got %q", updated.OrganizationID.String)
+	}
+
+	if token, _ := fixture.refreshTokens.GetRefreshTokenByToken(session.Token.String()); token.Valid {
+		t.Fatal("session was kept")
+	}
+
+	recorder, _ = fixture.patch(user.ID.String(), `[{"op":"replace","path":"active","value":true}]`)
+
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("after removal: got status %d, want 404", recorder.Code)
+	}
+}
+
+func TestListUsersWithSchemaPrefixedFilter(t *testing.T) {
+	fixture := newScimFixture(t)
+	fixture.provisioned(t, "babs@example.com")
+	fixture.joined(t, "jane@example.com")
+
+	tests := []struct {
+		filter string
+		total  int
+	}{
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "jane@example.com"`, 1},
+		{`emails[type eq "work" and value ew "example.com"]`, 2},
+		{`externalId eq "ext"`, 1},
+		{`userName eq "nobody@example.com"`, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			recorder, _ := fixture.do(http.MethodGet, "/Users?filter="+url.QueryEscape(test.filter), "")
+
+			var response ListResponse
+			json.Unmarshal(recorder.Body.Bytes(), &response)
+
+			if recorder.Code != http.StatusOK || response.TotalResults != test.total {
+				t.Fatalf("got status %d and %d results, want %d: %s", recorder.Code, response.TotalResults, test.total, recorder.Body.String())
+			}
+		})
+	}
+
+	recorder, _ := fixture.do(http.MethodGet, "/Users?filter="+url.QueryEscape(`emails[type eq "work"`), "")
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("invalid filter: got status %d, want 400", recorder.Code)
+	}
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/guregu/null.v4"
+)
+
+// ApiKeyPrefix marks bearer tokens that are API keys rather than JWTs.
+const ApiKeyPrefix = "gak_"
+
+// ApiKey is a long lived credential a user creates for scripts, only the hash
+// of the secret is stored. Prefix keeps the first characters of the key so
+// the user can tell their keys apart. Scopes is a space separated list.
+type ApiKey struct {
+	ID         uuid.UUID `json:"id"`
+	Owner      uuid.UUID `json:"owner"`
+	Name       string    `json:"name"`
+	Prefix     string    `json:"prefix"`
+	SecretHash string    `json:"-"`
+	Scopes     string    `json:"scopes"`
+	ExpiresAt  null.Time `json:"expires_at"`
+	LastUsedAt null.Time `json:"last_used_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type ApiKeyRepository interface {
+	GetApiKeyBySecretHash(secretHash string) (ApiKey, error)
+	GetApiKeysByOwner(owner string) ([]ApiKey, error)
+	CreateApiKey(apiKey *ApiKey, transaction *sql.Tx) (*ApiKey, error)
+	TouchApiKey(id string) error
+	DeleteApiKey(id string, owner string) error
+}
+
+// NewApiKey returns the key along with its secret, which is never stored and
+// has to be shown to the user right away.
+func NewApiKey(owner uuid.UUID, name string, scopes string, expiresAt null.Time) (*ApiKey, string, error) {
+	buffer := make([]byte, 32)
+
+	if _, err := rand.Read(buffer); err != nil {
+		return nil, "", err
+	}
+
+	secret := ApiKeyPrefix + base64.RawURLEncoding.EncodeToString(buffer)
+
+	return &ApiKey{
+		ID:         uuid.New(),
+		Owner:      owner,
+		Name:       name,
+		Prefix:     secret[:len(ApiKeyPrefix)+6],
+		SecretHash: HashApiKey(secret),
+		Scopes:     strings.Join(strings.Fields(scopes), " "),
+		ExpiresAt:  expiresAt,
+	}, secret, nil
+}
+
+func IsApiKey(token string) bool {
+	return strings.HasPrefix(token, ApiKeyPrefix)
+}
+
+func HashApiKey(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(hash[:])
+}
+
+func (apiKey ApiKey) IsExpired() bool {
+	return apiKey.ExpiresAt.Valid && apiKey.ExpiresAt.Time.Before(time.Now())
+}
+
+func (apiKey ApiKey) AllowsScope(scope string) bool {
+	for _, candidate := range strings.Fields(apiKey.Scopes) {
+		if candidate == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+const (
+	SuppressionBounce    = "bounce"
+	SuppressionComplaint = "complaint"
+	SuppressionManual    = "manual"
+)
+
+// EmailSuppression is an address nothing is sent to anymore, it is keyed by
+// the lowercased email and records the event that put it on the list.
+type EmailSuppression struct {
+	Email     string      `json:"email"`
+	Reason    string      `json:"reason"`
+	Provider  string      `json:"provider"`
+	Detail    null.String `json:"detail"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+func NewEmailSuppression(email string, reason string, provider string, detail string) *EmailSuppression {
+	return &EmailSuppression{
+		Email:    strings.ToLower(strings.TrimSpace(email)),
+		Reason:   reason,
+		Provider: provider,
+		Detail:   null.NewString(detail, len(detail) > 0),
+	}
+}
+
+type EmailSuppressionRepository interface {
+	GetEmailSuppression(email string) (EmailSuppression, error)
+	GetEmailSuppressions() ([]EmailSuppression, error)
+	// CreateEmailSuppression keeps a single entry per address, suppressing it
+	// again records the latest event.
+	CreateEmailSuppression(suppression *EmailSuppression, transaction *sql.Tx) (*EmailSuppression, error)
+	DeleteEmailSuppression(email string, transaction *sql.Tx) error
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Identity is one way of signing in to a user account, the subject is what
+// the provider calls the user: the user id for passwords, the address for
+// email links and the provider's own id for social logins.
+type Identity struct {
+	ID        uuid.UUID `json:"id"`
+	Owner     uuid.UUID `json:"owner"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewIdentity(owner uuid.UUID, provider string, subject string) *Identity {
+	return &Identity{
+		ID:       uuid.New(),
+		Owner:    owner,
+		Provider: provider,
+		Subject:  subject,
+	}
+}
+
+type IdentityRepository interface {
+	GetIdentity(provider string, subject string) (Identity, error)
+	GetIdentitiesByOwner(owner string) ([]Identity, error)
+	CreateIdentity(identity *Identity, transaction *sql.Tx) (*Identity, error)
+	DeleteIdentity(id string, owner string, transaction *sql.Tx) error
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Impersonation is the audit record of a token issued to Actor acting as
+// Subject.
+type Impersonation struct {
+	ID        uuid.UUID `json:"id"`
+	Actor     uuid.UUID `json:"actor"`
+	Subject   uuid.UUID `json:"subject"`
+	ClientID  string    `json:"client_id"`
+	Reason    string    `json:"reason"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewImpersonation(actor uuid.UUID, subject uuid.UUID, clientID string, reason string, expiresAt time.Time) *Impersonation {
+	return &Impersonation{
+		ID:        uuid.New(),
+		Actor:     actor,
+		Subject:   subject,
+		ClientID:  clientID,
+		Reason:    reason,
+		ExpiresAt: expiresAt,
+	}
+}
+
+type ImpersonationRepository interface {
+	CreateImpersonation(impersonation *Impersonation, transaction *sql.Tx) (*Impersonation, error)
+}
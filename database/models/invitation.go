@@ -0,0 +1,64 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/guregu/null.v4"
+)
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+)
+
+const InvitationExpiration = 7 * 24 * time.Hour
+
+// Invitation lets someone join the platform, or an organization when
+// Organization is set. Role is the membership role for organization
+// invitations and the platform role otherwise.
+type Invitation struct {
+	ID           uuid.UUID   `json:"id"`
+	Inviter      uuid.UUID   `json:"inviter"`
+	Email        string      `json:"email"`
+	Organization null.String `json:"organization"`
+	Role         string      `json:"role"`
+	TokenHash    string      `json:"-"`
+	Status       string      `json:"status"`
+	ExpiresAt    time.Time   `json:"expires_at"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+type InvitationRepository interface {
+	GetInvitationByID(id string) (Invitation, error)
+	GetInvitationByTokenHash(tokenHash string) (Invitation, error)
+	GetPendingInvitations(organization null.String) ([]Invitation, error)
+	CreateInvitation(invitation *Invitation, transaction *sql.Tx) (*Invitation, error)
+	UpdateInvitation(invitation *Invitation, transaction *sql.Tx) (*Invitation, error)
+	// AcceptInvitation marks the invitation accepted only while it is still
+	// open, returning sql.ErrNoRows when it was accepted, revoked or expired.
+	AcceptInvitation(invitation *Invitation, transaction *sql.Tx) (*Invitation, error)
+}
+
+func NewInvitation(inviter uuid.UUID, email string, organization null.String, role string) *Invitation {
+	return &Invitation{
+		ID:           uuid.New(),
+		Inviter:      inviter,
+		Email:        email,
+		Organization: organization,
+		Role:         role,
+		Status:       InvitationPending,
+	}
+}
+
+func (invitation Invitation) IsExpired() bool {
+	return invitation.ExpiresAt.Before(time.Now())
+}
+
+// IsOpen tells whether the invitation can still be accepted.
+func (invitation Invitation) IsOpen() bool {
+	return invitation.Status == InvitationPending && !invitation.IsExpired()
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/guregu/null.v4"
+)
+
+const (
+	OwnerRole  = "owner"
+	AdminRole  = "admin"
+	MemberRole = "member"
+)
+
+// Membership gives a user a role inside an organization, it is independent
+// from User.Role which applies to the whole platform. ExternalID is the id
+// the organization's identity provider knows the user by. Provisioned is set
+// when the organization created the account itself through SCIM, only then
+// does it manage the account's credentials, email and activation.
+type Membership struct {
+	Organization uuid.UUID   `json:"organization"`
+	User         uuid.UUID   `json:"user"`
+	Role         string      `json:"role"`
+	ExternalID   null.String `json:"external_id"`
+	Provisioned  bool        `json:"provisioned"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+type MembershipRepository interface {
+	GetMembership(organization string, user string) (Membership, error)
+	GetMembershipsByOrganization(organization string) ([]Membership, error)
+	CountMembershipsByRole(organization string, role string) (int, error)
+	CreateMembership(membership *Membership, transaction *sql.Tx) (*Membership, error)
+	UpdateMembership(membership *Membership, transaction *sql.Tx) (*Membership, error)
+	DeleteMembership(organization string, user string, transaction *sql.Tx) error
+}
+
+func NewMembership(organization uuid.UUID, user uuid.UUID, role string) *Membership {
+	return &Membership{
+		Organization: organization,
+		User:         user,
+		Role:         role,
+	}
+}
+
+func ValidateMembershipRole(role string) bool {
+	return role == OwnerRole || role == AdminRole || role == MemberRole
+}
+
+// CanManageMembers tells whether the member may add, remove and change the
+// role of other members.
+func (membership Membership) CanManageMembers() bool {
+	return membership.Role == OwnerRole || membership.Role == AdminRole
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/guregu/null.v4"
+)
+
+// OAuthClient is an application registered to use the authorization server,
+// RedirectURIs and Scopes hold space separated lists. Confidential clients
+// have a SecretHash and may use the client credentials grant.
+type OAuthClient struct {
+	ID           string      `json:"client_id"`
+	Name         string      `json:"name"`
+	RedirectURIs string      `json:"redirect_uris"`
+	Scopes       string      `json:"scopes"`
+	SecretHash   null.String `json:"-"`
+	RevokedAt    null.Time   `json:"revoked_at"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+type OAuthClientRepository interface {
+	GetClientByID(id string) (OAuthClient, error)
+	GetClients() ([]OAuthClient, error)
+	CreateClient(client *OAuthClient, transaction *sql.Tx) (*OAuthClient, error)
+	UpdateClient(client *OAuthClient, transaction *sql.Tx) (*OAuthClient, error)
+}
+
+func NewOAuthClient(name string, redirectURIs string, scopes string) *OAuthClient {
+	return &OAuthClient{
+		ID:           uuid.New().String(),
+		Name:         name,
+		RedirectURIs: redirectURIs,
+		Scopes:       scopes,
+	}
+}
+
+func hashClientSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// RotateSecret replaces the client secret and returns the new one, it is only
+// kept hashed so this is the single time it can be shown.
+func (client *OAuthClient) RotateSecret() (string, error) {
+	buffer := make([]byte, 32)
+
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+
+	secret := base64.RawURLEncoding.EncodeToString(buffer)
+	client.SecretHash = null.NewString(hashClientSecret(secret), true)
+
+	return secret, nil
+}
+
+func (client OAuthClient) VerifySecret(secret string) bool {
+	if !client.SecretHash.Valid || len(secret) <= 0 {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(client.SecretHash.String), []byte(hashClientSecret(secret))) == 1
+}
+
+func (client OAuthClient) IsConfidential() bool {
+	return client.SecretHash.Valid
+}
+
+func (client OAuthClient) IsRevoked() bool {
+	return client.RevokedAt.Valid
+}
+
+// AllowsScope checks every requested scope was granted to the client.
+func (client OAuthClient) AllowsScope(scope string) bool {
+	allowed := strings.Fields(client.Scopes)
+
+	for _, requested := range strings.Fields(scope) {
+		found := false
+
+		for _, candidate := range allowed {
+			if candidate == requested {
+				found = true
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AllowsRedirectURI only accepts exact matches, as OAuth 2.1 requires.
+func (client OAuthClient) AllowsRedirectURI(redirectURI string) bool {
+	for _, allowed := range strings.Fields(client.RedirectURIs) {
+		if allowed == redirectURI {
+			return true
+		}
+	}
+
+	return false
+}
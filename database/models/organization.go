@@ -0,0 +1,37 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Organization is a tenant, users reach it through a Membership.
+type Organization struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type OrganizationRepository interface {
+	BeginTransaction() (*sql.Tx, error)
+	GetOrganizationByID(id string) (Organization, error)
+	GetOrganizationsByMember(user string) ([]Organization, error)
+	CreateOrganization(organization *Organization, transaction *sql.Tx) (*Organization, error)
+	UpdateOrganization(organization *Organization, transaction *sql.Tx) (*Organization, error)
+	DeleteOrganization(id string, transaction *sql.Tx) error
+}
+
+func NewOrganization(name string) (*Organization, error) {
+	if len(name) <= 0 {
+		return nil, errors.New("name is required")
+	}
+
+	return &Organization{
+		ID:   uuid.New(),
+		Name: name,
+	}, nil
+}
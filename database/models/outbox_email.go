@@ -0,0 +1,156 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/guregu/null.v4"
+)
+
+// Suppressed emails were addressed to a suppressed address and are not
+// retried.
+const (
+	OutboxPending    = "pending"
+	OutboxSent       = "sent"
+	OutboxDead       = "dead"
+	OutboxSuppressed = "suppressed"
+)
+
+// OutboxMaxAttempts is how many deliveries are tried before a message is
+// dead-lettered, with the backoff below that is about five hours.
+const OutboxMaxAttempts = 10
+
+const (
+	outboxBaseBackoff = 30 * time.Second
+	outboxMaxBackoff  = 6 * time.Hour
+)
+
+// Substitutions is stored as a JSON object.
+type Substitutions map[string]string
+
+func (substitutions Substitutions) Value() (driver.Value, error) {
+	if substitutions == nil {
+		return []byte("{}"), nil
+	}
+
+	return json.Marshal(substitutions)
+}
+
+func (substitutions *Substitutions) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case []byte:
+		return json.Unmarshal(data, substitutions)
+	case string:
+		return json.Unmarshal([]byte(data), substitutions)
+	case nil:
+		*substitutions = Substitutions{}
+		return nil
+	}
+
+	return errors.New("unsupported substitutions value")
+}
+
+// OutboxEmail is an email written alongside the change that caused it and
+// delivered later by the dispatcher. IdempotencyKey is unique, enqueueing the
+// same key twice keeps the first message. Substitutions carry tokens, they
+// are never serialized and are cleared once the message leaves the queue.
+// Provider is the provider that delivered it.
+type OutboxEmail struct {
+	ID             uuid.UUID     `json:"id"`
+	IdempotencyKey string        `json:"idempotency_key"`
+	From           string        `json:"from"`
+	Name           string        `json:"name"`
+	To             string        `json:"to"`
+	Locale         string        `json:"locale"`
+	Template       string        `json:"template"`
+	Substitutions  Substitutions `json:"-"`
+	Status         string        `json:"status"`
+	Attempts       int           `json:"attempts"`
+	LastError      null.String   `json:"last_error"`
+	NextAttemptAt  time.Time     `json:"next_attempt_at"`
+	SentAt         null.Time     `json:"sent_at"`
+	Provider       null.String   `json:"provider"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+type OutboxEmailRepository interface {
+	GetOutboxEmailByID(id string) (OutboxEmail, error)
+	GetOutboxEmailsByStatus(status string) ([]OutboxEmail, error)
+	CreateOutboxEmail(email *OutboxEmail, transaction *sql.Tx) (*OutboxEmail, error)
+	// ClaimOutboxEmails takes due pending messages, counting the attempt and
+	// pushing NextAttemptAt by lease so no other dispatcher picks them up
+	// meanwhile, and a crashed one hands them back once the lease is over.
+	ClaimOutboxEmails(limit int, lease time.Duration) ([]OutboxEmail, error)
+	UpdateOutboxEmail(email *OutboxEmail, transaction *sql.Tx) (*OutboxEmail, error)
+}
+
+func NewOutboxEmail(idempotencyKey string, from string, name string, to string, locale string, template string, substitutions map[string]string) *OutboxEmail {
+	return &OutboxEmail{
+		ID:             uuid.New(),
+		IdempotencyKey: idempotencyKey,
+		From:           from,
+		Name:           name,
+		To:             to,
+		Locale:         locale,
+		Template:       template,
+		Substitutions:  substitutions,
+		Status:         OutboxPending,
+		NextAttemptAt:  time.Now(),
+	}
+}
+
+func (email *OutboxEmail) MarkSent(provider string) {
+	email.Status = OutboxSent
+	email.Substitutions = Substitutions{}
+	email.SentAt = null.NewTime(time.Now(), true)
+	email.Provider = null.NewString(provider, true)
+	email.LastError = null.String{}
+}
+
+// MarkFailed schedules the next attempt with exponential backoff and jitter,
+// or dead-letters the message once it is out of attempts.
+func (email *OutboxEmail) MarkFailed(err error) {
+	email.LastError = null.NewString(err.Error(), true)
+
+	if email.Attempts >= OutboxMaxAttempts {
+		email.Status = OutboxDead
+		email.Substitutions = Substitutions{}
+		return
+	}
+
+	backoff := outboxBaseBackoff << max(email.Attempts-1, 0)
+
+	if backoff <= 0 || backoff > outboxMaxBackoff {
+		backoff = outboxMaxBackoff
+	}
+
+	backoff += time.Duration(rand.Int63n(int64(backoff / 4)))
+
+	email.NextAttemptAt = time.Now().Add(backoff)
+}
+
+func (email *OutboxEmail) MarkSuppressed(err error) {
+	email.Status = OutboxSuppressed
+	email.Substitutions = Substitutions{}
+	email.LastError = null.NewString(err.Error(), true)
+}
+
+// Retry puts a dead or suppressed message back in the queue with a fresh set of attempts.
+// Only messages whose substitutions were never cleared can be retried.
+func (email *OutboxEmail) Retry() {
+	email.Status = OutboxPending
+	email.Attempts = 0
+	email.NextAttemptAt = time.Now()
+}
+
+// HasContent tells whether the substitutions the template needs are still
+// stored.
+func (email *OutboxEmail) HasContent() bool {
+	return len(email.Substitutions) > 0
+}
@@ -0,0 +1,32 @@
+package models
+
+import "strings"
+
+const UserPrincipal = "user"
+
+// Principal is whoever presented the access token, Client is also set for a
+// user token a third-party client obtained. Actor is set when User is being impersonated and holds the person
+// really making the request.
+type Principal struct {
+	Type   string
+	User   *User
+	Client *OAuthClient
+	Actor  *User
+	Scope  string
+}
+
+// IsDelegated is true for user tokens issued to a third-party client, they
+// only carry the scopes the user granted it.
+func (principal Principal) IsDelegated() bool {
+	return principal.Type == UserPrincipal && principal.Client != nil
+}
+
+func (principal Principal) AllowsScope(scope string) bool {
+	for _, candidate := range strings.Fields(principal.Scope) {
+		if candidate == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/guregu/null.v4"
+)
+
+const ProvisioningTokenPrefix = "gsp_"
+
+// ProvisioningClient is an identity provider allowed to push the members of
+// one organization through SCIM, it authenticates with a static bearer token
+// of which only the hash is stored.
+type ProvisioningClient struct {
+	ID           uuid.UUID `json:"id"`
+	Organization uuid.UUID `json:"organization"`
+	Name         string    `json:"name"`
+	Prefix       string    `json:"prefix"`
+	TokenHash    string    `json:"-"`
+	RevokedAt    null.Time `json:"revoked_at"`
+	LastUsedAt   null.Time `json:"last_used_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type ProvisioningClientRepository interface {
+	GetProvisioningClientByID(id string) (ProvisioningClient, error)
+	GetProvisioningClientByTokenHash(tokenHash string) (ProvisioningClient, error)
+	GetProvisioningClientsByOrganization(organization string) ([]ProvisioningClient, error)
+	CreateProvisioningClient(client *ProvisioningClient, transaction *sql.Tx) (*ProvisioningClient, error)
+	UpdateProvisioningClient(client *ProvisioningClient, transaction *sql.Tx) (*ProvisioningClient, error)
+}
+
+// NewProvisioningClient returns the client along with its token, which has to
+// be handed to the identity provider right away.
+func NewProvisioningClient(organization uuid.UUID, name string) (*ProvisioningClient, string, error) {
+	buffer := make([]byte, 32)
+
+	if _, err := rand.Read(buffer); err != nil {
+		return nil, "", err
+	}
+
+	token := ProvisioningTokenPrefix + base64.RawURLEncoding.EncodeToString(buffer)
+
+	return &ProvisioningClient{
+		ID:           uuid.New(),
+		Organization: organization,
+		Name:         name,
+		Prefix:       token[:len(ProvisioningTokenPrefix)+6],
+		TokenHash:    HashProvisioningToken(token),
+	}, token, nil
+}
+
+func HashProvisioningToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(hash[:])
+}
+
+func (client ProvisioningClient) IsRevoked() bool {
+	return client.RevokedAt.Valid
+}
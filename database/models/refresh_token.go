@@ -5,11 +5,16 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gopkg.in/guregu/null.v4"
 )
 
+// RefreshToken keeps a session going, ClientID and Scope are set when it was
+// issued to a third-party client, which is the only one that may redeem it.
 type RefreshToken struct {
 	Token     uuid.UUID
 	Owner     uuid.UUID
+	ClientID  null.String
+	Scope     string
 	Valid     bool
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -23,8 +28,17 @@ func NewRefreshToken(owner uuid.UUID) *RefreshToken {
 	}
 }
 
+func NewClientRefreshToken(owner uuid.UUID, clientID string, scope string) *RefreshToken {
+	refreshToken := NewRefreshToken(owner)
+	refreshToken.ClientID = null.NewString(clientID, true)
+	refreshToken.Scope = scope
+
+	return refreshToken
+}
+
 type RefreshTokenRepository interface {
 	GetRefreshTokenByToken(token string) (RefreshToken, error)
 	InvalidateToken(token string) error
+	InvalidateTokensByOwner(owner string, transaction *sql.Tx) error
 	CreateRefreshToken(refreshToken *RefreshToken, transaction *sql.Tx) (*RefreshToken, error)
 }
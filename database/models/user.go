@@ -4,29 +4,39 @@ import (
 	"database/sql"
 	"errors"
 	"net/mail"
+	"regexp"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/thiagoferolla/go-auth/i18n"
 	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/guregu/null.v4"
 )
 
 type User struct {
-	ID              uuid.UUID   `json:"id"`
-	Name            null.String `json:"name"`
-	Email           string      `json:"email"`
-	Password        string      `json:"-"`
-	Provider        string      `json:"provider"`
-	EmailVerifiedAt null.Time   `json:"email_verified_at"`
-	Role            string      `json:"role"`
-	CreatedAt       time.Time   `json:"created_at"`
-	UpdatedAt       time.Time   `json:"updated_at"`
+	ID                   uuid.UUID   `json:"id"`
+	Name                 null.String `json:"name"`
+	Email                string      `json:"email"`
+	Password             string      `json:"-"`
+	Provider             string      `json:"provider"`
+	EmailVerifiedAt      null.Time   `json:"email_verified_at"`
+	Phone                null.String `json:"phone"`
+	PhoneVerifiedAt      null.Time   `json:"phone_verified_at"`
+	Role                 string      `json:"role"`
+	OrganizationID       null.String `json:"organization_id"`
+	DeactivatedAt        null.Time   `json:"deactivated_at"`
+	Locale               string      `json:"locale"`
+	EmailUndeliverableAt null.Time   `json:"email_undeliverable_at"`
+	CreatedAt            time.Time   `json:"created_at"`
+	UpdatedAt            time.Time   `json:"updated_at"`
 }
 
 type UserRepository interface {
 	BeginTransaction() (*sql.Tx, error)
 	GetUserByID(id string) (User, error)
 	GetUserByEmail(email string) (User, error)
+	GetUserByPhone(phone string) (User, error)
+	GetUsersByOrganization(organization string) ([]User, error)
 	CreateUser(user *User, transaction *sql.Tx) (*User, error)
 	UpdateUser(user *User, transaction *sql.Tx) (*User, error)
 	DeleteUser(id string, transaction *sql.Tx) error
@@ -42,6 +52,13 @@ func ValidateEmail(email string) bool {
 	return true
 }
 
+var phoneRegexp = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// ValidatePhone checks the number is in E.164 format.
+func ValidatePhone(phone string) bool {
+	return phoneRegexp.MatchString(phone)
+}
+
 func NewUser(name string, email string, password string, provider string) (*User, error) {
 	if len(password) <= 0 {
 		return nil, errors.New("password is required")
@@ -56,6 +73,7 @@ func NewUser(name string, email string, password string, provider string) (*User
 		Password: password,
 		Provider: provider,
 		Role:     "user",
+		Locale:   i18n.DefaultLocale,
 	}
 
 	err := newUser.HashPassword()
@@ -67,6 +85,47 @@ func NewUser(name string, email string, password string, provider string) (*User
 	return newUser, nil
 }
 
+// NewPasswordlessUser creates a user that signs in through an external
+// proof of identity, so it has no password to verify.
+func NewPasswordlessUser(name string, email string, provider string) (*User, error) {
+	if !ValidateEmail(email) {
+		return nil, errors.New("invalid email")
+	}
+
+	return &User{
+		ID:       uuid.New(),
+		Name:     null.NewString(name, len(name) > 0),
+		Email:    email,
+		Provider: provider,
+		Role:     "user",
+		Locale:   i18n.DefaultLocale,
+	}, nil
+}
+
+// IsActive is false once the user was deactivated, they can no longer sign
+// in nor use tokens issued before.
+func (u User) IsActive() bool {
+	return !u.DeactivatedAt.Valid
+}
+
+// EmailDeliverable is false once the address hard-bounced or the recipient
+// complained, nothing is sent to it until an admin lifts the suppression.
+func (u User) EmailDeliverable() bool {
+	return !u.EmailUndeliverableAt.Valid
+}
+
+// ValidatePlatformRole checks a role applying to the whole platform, as
+// opposed to the organization roles of ValidateMembershipRole.
+func ValidatePlatformRole(role string) bool {
+	return role == "user" || role == "support" || role == "admin"
+}
+
+// CanImpersonate tells whether the user may obtain tokens acting as other
+// users through the token exchange grant.
+func (u User) CanImpersonate() bool {
+	return u.Role == "admin" || u.Role == "support"
+}
+
 func (u *User) HashPassword() error {
 	hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
 
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebAuthnCredential struct {
+	ID              []byte
+	Owner           uuid.UUID
+	PublicKey       []byte
+	AttestationType string
+	Transports      string
+	AAGUID          []byte
+	SignCount       uint32
+	CloneWarning    bool
+	Flags           byte
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+type WebAuthnCredentialRepository interface {
+	GetCredentialByID(id []byte) (WebAuthnCredential, error)
+	GetCredentialsByOwner(owner string) ([]WebAuthnCredential, error)
+	CreateCredential(credential *WebAuthnCredential, transaction *sql.Tx) (*WebAuthnCredential, error)
+	UpdateSignCount(credential *WebAuthnCredential) error
+	DeleteCredential(id []byte, owner string) error
+}
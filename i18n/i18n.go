@@ -0,0 +1,194 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const DefaultLocale = "en"
+
+// Catalogs map the English message, as written in the code, to its
+// translation. English itself needs no catalog.
+//
+//go:embed catalogs
+var catalogFiles embed.FS
+
+var catalogs = loadCatalogs()
+
+// Supported lists the locales we have translations for, the default first.
+var Supported = supportedLocales()
+
+func loadCatalogs() map[string]map[string]string {
+	loaded := map[string]map[string]string{}
+
+	files, err := fs.Glob(catalogFiles, "catalogs/*.json")
+
+	if err != nil {
+		panic(err)
+	}
+
+	for _, file := range files {
+		data, err := catalogFiles.ReadFile(file)
+
+		if err != nil {
+			panic(err)
+		}
+
+		catalog := map[string]string{}
+
+		if err = json.Unmarshal(data, &catalog); err != nil {
+			panic(err)
+		}
+
+		loaded[strings.TrimSuffix(path.Base(file), ".json")] = catalog
+	}
+
+	return loaded
+}
+
+func supportedLocales() []string {
+	locales := []string{}
+
+	for locale := range catalogs {
+		if locale != DefaultLocale {
+			locales = append(locales, locale)
+		}
+	}
+
+	sort.Strings(locales)
+
+	return append([]string{DefaultLocale}, locales...)
+}
+
+// Normalize writes a language tag the way the catalogs are named, "pt_br"
+// becomes "pt-BR".
+func Normalize(tag string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"), "-")
+
+	parts[0] = strings.ToLower(parts[0])
+
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		} else if len(parts[i]) == 4 {
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		} else {
+			parts[i] = strings.ToLower(parts[i])
+		}
+	}
+
+	return strings.Join(parts, "-")
+}
+
+func language(locale string) string {
+	return strings.Split(locale, "-")[0]
+}
+
+// Fallbacks is the chain looked up for a locale: the locale itself, its bare
+// language, the supported regional variants of that language and finally the
+// default. "pt-PT" yields pt-PT, pt, pt-BR, en.
+func Fallbacks(locale string) []string {
+	locale = Normalize(locale)
+	chain := []string{}
+
+	add := func(candidate string) {
+		for _, existing := range chain {
+			if existing == candidate {
+				return
+			}
+		}
+
+		chain = append(chain, candidate)
+	}
+
+	if len(locale) > 0 {
+		add(locale)
+		add(language(locale))
+
+		for _, supported := range Supported {
+			if language(supported) == language(locale) {
+				add(supported)
+			}
+		}
+	}
+
+	add(DefaultLocale)
+
+	return chain
+}
+
+// Resolve picks the first supported locale of the chain.
+func Resolve(locale string) string {
+	for _, candidate := range Fallbacks(locale) {
+		if IsSupported(candidate) {
+			return candidate
+		}
+	}
+
+	return DefaultLocale
+}
+
+func IsSupported(locale string) bool {
+	_, ok := catalogs[locale]
+
+	return ok || locale == DefaultLocale
+}
+
+// Negotiate picks the supported locale that best matches an Accept-Language
+// header, honouring quality values.
+func Negotiate(acceptLanguage string) string {
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+
+	tags := []weighted{}
+
+	for _, entry := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		quality := 1.0
+
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+
+			if err != nil {
+				continue
+			}
+
+			quality = parsed
+		}
+
+		if len(tag) <= 0 || tag == "*" || quality <= 0 {
+			continue
+		}
+
+		tags = append(tags, weighted{tag, quality})
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].quality > tags[j].quality })
+
+	for _, tag := range tags {
+		if locale := Resolve(tag.tag); locale != DefaultLocale || language(Normalize(tag.tag)) == DefaultLocale {
+			return locale
+		}
+	}
+
+	return DefaultLocale
+}
+
+// Translate returns message in the first locale of the chain that has it, or
+// message itself.
+func Translate(locale string, message string) string {
+	for _, candidate := range Fallbacks(locale) {
+		if translated, ok := catalogs[candidate][message]; ok {
+			return translated
+		}
+	}
+
+	return message
+}
@@ -0,0 +1,95 @@
+package i18n
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"pt-BR", "pt-BR"},
+		{"pt_br", "pt-BR"},
+		{" EN-us ", "en-US"},
+		{"zh-hant-tw", "zh-Hant-TW"},
+		{"es-419", "es-419"},
+		{"ES", "es"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := Normalize(test.tag); got != test.want {
+			t.Errorf("Normalize(%q): got %q, want %q", test.tag, got, test.want)
+		}
+	}
+}
+
+func TestFallbacks(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   []string
+	}{
+		{"pt-PT", []string{"pt-PT", "pt", "pt-BR", "en"}},
+		{"pt_br", []string{"pt-BR", "pt", "en"}},
+		{"es-MX", []string{"es-MX", "es", "en"}},
+		{"en", []string{"en"}},
+		{"", []string{"en"}},
+	}
+
+	for _, test := range tests {
+		if got := Fallbacks(test.locale); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Fallbacks(%q): got %v, want %v", test.locale, got, test.want)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		want           string
+	}{
+		{"exact match", "pt-BR", "pt-BR"},
+		{"other region of the language", "pt-PT", "pt-BR"},
+		{"bare language", "es", "es"},
+		{"lowercase region", "pt-br", "pt-BR"},
+		{"first supported wins", "fr-FR, es;q=0.8, en;q=0.5", "es"},
+		{"quality over order", "en;q=0.4, pt-BR;q=0.9", "pt-BR"},
+		{"english preferred over a translation", "en-GB, pt-BR;q=0.8", "en"},
+		{"refused language", "pt-BR;q=0, es;q=0.5", "es"},
+		{"unsupported only", "fr, de;q=0.9", "en"},
+		{"wildcard", "*", "en"},
+		{"malformed quality", "pt-BR;q=abc, es;q=0.1", "es"},
+		{"empty header", "", "en"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Negotiate(test.acceptLanguage); got != test.want {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		locale  string
+		message string
+		want    string
+	}{
+		{"pt-BR", "Invalid code", "Código inválido"},
+		{"pt-PT", "Invalid code", "Código inválido"},
+		{"es", "Not found", "No encontrado"},
+		{"en", "Invalid code", "Invalid code"},
+		{"pt-BR", "A message nobody translated", "A message nobody translated"},
+	}
+
+	for _, test := range tests {
+		if got := Translate(test.locale, test.message); got != test.want {
+			t.Errorf("Translate(%q, %q): got %q, want %q", test.locale, test.message, got, test.want)
+		}
+	}
+}
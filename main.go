@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+
 	"github.com/gin-gonic/gin"
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/thiagoferolla/go-auth/database"
@@ -19,7 +21,9 @@ func main() {
 
 	server := gin.Default()
 
-	routes.NewRouter(server, databaseConnection)
+	router := routes.NewRouter(server, databaseConnection, secretProvider)
+
+	go router.Outbox.Run(context.Background())
 
 	server.Run()
 }
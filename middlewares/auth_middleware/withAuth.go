@@ -3,6 +3,7 @@ package auth_middleware
 import (
 	"log"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/thiagoferolla/go-auth/database/models"
@@ -10,48 +11,206 @@ import (
 )
 
 type WithAuthMiddleware struct {
-	UserRepository models.UserRepository
-	JwtProvider    jwt.JWTProvider
+	UserRepository        models.UserRepository
+	OAuthClientRepository models.OAuthClientRepository
+	ApiKeyRepository      models.ApiKeyRepository
+	JwtProvider           jwt.JWTProvider
 }
 
-func NewWithAuthMiddleware(userRepository models.UserRepository, jwtProvider jwt.JWTProvider) *WithAuthMiddleware {
-	return &WithAuthMiddleware{userRepository, jwtProvider}
+func NewWithAuthMiddleware(userRepository models.UserRepository, oauthClientRepository models.OAuthClientRepository, apiKeyRepository models.ApiKeyRepository, jwtProvider jwt.JWTProvider) *WithAuthMiddleware {
+	return &WithAuthMiddleware{userRepository, oauthClientRepository, apiKeyRepository, jwtProvider}
 }
 
+func bearerToken(c *gin.Context) (string, bool) {
+	authHeader := c.GetHeader("Authorization")
+
+	if len(authHeader) <= 0 {
+		return "", false
+	}
+
+	tokenMap := strings.Split(authHeader, "Bearer")
+
+	if len(tokenMap) < 2 {
+		return "", false
+	}
+
+	return strings.TrimSpace(tokenMap[1]), true
+}
+
+func (auth WithAuthMiddleware) bearerClaims(token string) (jwt.JwtClaims, bool) {
+	claims, err := auth.JwtProvider.ValidateToken(token)
+
+	if err != nil {
+		return jwt.JwtClaims{}, false
+	}
+
+	return claims, true
+}
+
+// setUser loads the user named by the token, along with the actor when the
+// token was issued through impersonation.
+func (auth WithAuthMiddleware) setUser(c *gin.Context, claims jwt.JwtClaims) bool {
+	user, err := auth.UserRepository.GetUserByID(claims.ID.String())
+
+	if err != nil || !user.IsActive() {
+		log.Println(err)
+		return false
+	}
+
+	principal := models.Principal{Type: models.UserPrincipal, User: &user}
+
+	if claims.IsDelegated() {
+		client, err := auth.OAuthClientRepository.GetClientByID(claims.ClientID)
+
+		if err != nil || client.IsRevoked() {
+			log.Println(err)
+			return false
+		}
+
+		principal.Client = &client
+		principal.Scope = claims.Scope
+	}
+
+	if claims.IsImpersonation() {
+		actor, err := auth.UserRepository.GetUserByID(claims.Act.Sub)
+
+		if err != nil || !actor.CanImpersonate() || !actor.IsActive() {
+			log.Println(err)
+			return false
+		}
+
+		principal.Actor = &actor
+		c.Set("actor", actor)
+	}
+
+	c.Set("user", user)
+	c.Set("principal", principal)
+
+	return true
+}
+
+// setApiKey resolves the user owning the key, the key scopes end up in the
+// principal so handlers can narrow what scripts are allowed to do.
+func (auth WithAuthMiddleware) setApiKey(c *gin.Context, token string) bool {
+	apiKey, err := auth.ApiKeyRepository.GetApiKeyBySecretHash(models.HashApiKey(token))
+
+	if err != nil || apiKey.IsExpired() {
+		log.Println(err)
+		return false
+	}
+
+	user, err := auth.UserRepository.GetUserByID(apiKey.Owner.String())
+
+	if err != nil || !user.IsActive() {
+		log.Println(err)
+		return false
+	}
+
+	if !apiKey.LastUsedAt.Valid || time.Since(apiKey.LastUsedAt.Time) > time.Minute {
+		if err := auth.ApiKeyRepository.TouchApiKey(apiKey.ID.String()); err != nil {
+			log.Println(err)
+		}
+	}
+
+	c.Set("user", user)
+	c.Set("api_key", apiKey)
+	c.Set("principal", models.Principal{Type: models.UserPrincipal, User: &user, Scope: apiKey.Scopes})
+
+	return true
+}
+
+// WithAuth only lets users through, tokens issued to machine clients are
+// rejected since the handlers behind it act on c.MustGet("user"). Client
+// tokens are meant for the services that verify them on their own.
 func (auth WithAuthMiddleware) WithAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
+		token, ok := bearerToken(c)
 
-		if len(authHeader) <= 0 {
-			c.AbortWithStatusJSON(403, gin.H{"error": "Not authorized"})
+		if ok && models.IsApiKey(token) {
+			if !auth.setApiKey(c, token) {
+				c.AbortWithStatusJSON(403, gin.H{"error": "Not authorized"})
+				return
+			}
+
+			c.Next()
 			return
 		}
 
-		tokenMap := strings.Split(authHeader, "Bearer")
+		claims, ok := auth.bearerClaims(token)
 
-		if len(tokenMap) < 2 {
+		if !ok || claims.IsClient() {
 			c.AbortWithStatusJSON(403, gin.H{"error": "Not authorized"})
 			return
 		}
 
-		bearerToken := strings.TrimSpace(tokenMap[1])
+		if !auth.setUser(c, claims) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "Not authorized"})
+			return
+		}
 
-		claims, err := auth.JwtProvider.ValidateToken(bearerToken)
+		c.Next()
+	}
+}
+
+// RequireRole must run after WithAuth.
+func (auth WithAuthMiddleware) RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(models.User)
 
-		if err != nil {
+		if user.Role != role {
 			c.AbortWithStatusJSON(403, gin.H{"error": "Not authorized"})
 			return
 		}
 
-		user, err := auth.UserRepository.GetUserByID(claims.ID.String())
+		c.Next()
+	}
+}
 
-		if err != nil {
-			log.Println(err)
-			c.AbortWithStatusJSON(403, gin.H{"error": "Not authorized"})
+// DenyImpersonation must run after WithAuth, it keeps impersonated sessions
+// away from endpoints that change credentials or grant access.
+func (auth WithAuthMiddleware) DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, impersonated := c.Get("actor"); impersonated {
+			c.AbortWithStatusJSON(403, gin.H{"error": "Not allowed while impersonating"})
 			return
 		}
 
-		c.Set("user", user)
+		c.Next()
+	}
+}
+
+// DenyApiKey must run after WithAuth, API keys cannot manage credentials,
+// including other API keys, and neither can third-party clients.
+func (auth WithAuthMiddleware) DenyApiKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, usingApiKey := c.Get("api_key"); usingApiKey {
+			c.AbortWithStatusJSON(403, gin.H{"error": "Not allowed with an API key"})
+			return
+		}
+
+		if principal, ok := c.Get("principal"); ok && principal.(models.Principal).IsDelegated() {
+			c.AbortWithStatusJSON(403, gin.H{"error": "Not allowed with a client token"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireScope must run after WithAuth, sessions carry every scope while API
+// keys only carry the ones picked when they were created and third-party
+// clients the ones the user granted.
+func (auth WithAuthMiddleware) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if value, usingApiKey := c.Get("api_key"); usingApiKey && !value.(models.ApiKey).AllowsScope(scope) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "Missing scope " + scope})
+			return
+		}
+
+		if principal, ok := c.Get("principal"); ok && principal.(models.Principal).IsDelegated() && !principal.(models.Principal).AllowsScope(scope) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "Missing scope " + scope})
+			return
+		}
 
 		c.Next()
 	}
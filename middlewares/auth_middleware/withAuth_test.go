@@ -0,0 +1,147 @@
+package auth_middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"github.com/thiagoferolla/go-auth/repositories/memory"
+	"gopkg.in/guregu/null.v4"
+)
+
+type withAuthFixture struct {
+	engine  *gin.Engine
+	users   *memory.UserRepository
+	apiKeys *memory.ApiKeyRepository
+	user    models.User
+	session string
+}
+
+// newWithAuthFixture lays out routes the way the routes package does: one
+// open to any user token, one closed to API keys and one needing a scope.
+func newWithAuthFixture(t *testing.T) withAuthFixture {
+	gin.SetMode(gin.TestMode)
+
+	users := memory.NewUserRepository()
+	apiKeys := memory.NewApiKeyRepository()
+	jwtProvider := jwt.NewBaseProvider()
+
+	user, err := models.NewUser("Jane", "jane@example.com", "password123", "password")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users.CreateUser(user, nil)
+	session, _ := jwtProvider.GenerateToken(*user)
+
+	auth := NewWithAuthMiddleware(users, memory.NewOAuthClientRepository(), apiKeys, jwtProvider)
+
+	engine := gin.New()
+	withAuth := engine.Group("/")
+	withAuth.Use(auth.WithAuth())
+
+	whoami := func(c *gin.Context) {
+		c.String(http.StatusOK, c.MustGet("user").(models.User).ID.String())
+	}
+
+	withAuth.GET("/me", whoami)
+	withAuth.GET("/identities", auth.DenyApiKey(), whoami)
+	withAuth.GET("/organizations", auth.RequireScope("organizations"), whoami)
+
+	return withAuthFixture{engine, users, apiKeys, *user, session}
+}
+
+func (f withAuthFixture) apiKey(t *testing.T, scopes string, expiresAt null.Time) (models.ApiKey, string) {
+	apiKey, secret, err := models.NewApiKey(f.user.ID, "script", scopes, expiresAt)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.apiKeys.CreateApiKey(apiKey, nil)
+
+	return *apiKey, secret
+}
+
+func (f withAuthFixture) get(path string, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	recorder := httptest.NewRecorder()
+	f.engine.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+func TestWithAuthApiKeys(t *testing.T) {
+	fixture := newWithAuthFixture(t)
+
+	_, scoped := fixture.apiKey(t, "organizations", null.Time{})
+	_, unscoped := fixture.apiKey(t, "", null.Time{})
+	_, expired := fixture.apiKey(t, "organizations", null.NewTime(time.Now().Add(-time.Minute), true))
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{"session", "/me", fixture.session, http.StatusOK},
+		{"session needs no scope", "/organizations", fixture.session, http.StatusOK},
+		{"session reaches credentials", "/identities", fixture.session, http.StatusOK},
+		{"api key", "/me", scoped, http.StatusOK},
+		{"api key with the scope", "/organizations", scoped, http.StatusOK},
+		{"api key without the scope", "/organizations", unscoped, http.StatusForbidden},
+		{"api key on a route denying them", "/identities", scoped, http.StatusForbidden},
+		{"expired api key", "/me", expired, http.StatusForbidden},
+		{"unknown api key", "/me", models.ApiKeyPrefix + "unknown", http.StatusForbidden},
+		{"no token", "/me", "", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := fixture.get(test.path, test.token)
+
+			if recorder.Code != test.status {
+				t.Fatalf("got status %d, want %d", recorder.Code, test.status)
+			}
+
+			if test.status == http.StatusOK && recorder.Body.String() != fixture.user.ID.String() {
+				t.Fatalf("got user %q", recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWithAuthTracksApiKeyUse(t *testing.T) {
+	fixture := newWithAuthFixture(t)
+	apiKey, secret := fixture.apiKey(t, "", null.Time{})
+
+	if recorder := fixture.get("/me", secret); recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d", recorder.Code)
+	}
+
+	keys, _ := fixture.apiKeys.GetApiKeysByOwner(apiKey.Owner.String())
+
+	if len(keys) != 1 || !keys[0].LastUsedAt.Valid {
+		t.Fatal("last use was not recorded")
+	}
+}
+
+func TestWithAuthRefusesApiKeysOfDeactivatedUsers(t *testing.T) {
+	fixture := newWithAuthFixture(t)
+	_, secret := fixture.apiKey(t, "", null.Time{})
+
+	user := fixture.user
+	user.DeactivatedAt = null.NewTime(time.Now(), true)
+	fixture.users.UpdateUser(&user, nil)
+
+	if recorder := fixture.get("/me", secret); recorder.Code != http.StatusForbidden {
+		t.Fatalf("got status %d, want 403", recorder.Code)
+	}
+}
@@ -0,0 +1,62 @@
+package auth_middleware
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"gopkg.in/guregu/null.v4"
+)
+
+type WithProvisioningClientMiddleware struct {
+	ProvisioningClientRepository models.ProvisioningClientRepository
+}
+
+func NewWithProvisioningClientMiddleware(provisioningClientRepository models.ProvisioningClientRepository) *WithProvisioningClientMiddleware {
+	return &WithProvisioningClientMiddleware{provisioningClientRepository}
+}
+
+// WithProvisioningClient authenticates SCIM requests, failures are answered
+// with a SCIM error since identity providers parse them.
+func (auth WithProvisioningClientMiddleware) WithProvisioningClient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c)
+
+		if !ok || !strings.HasPrefix(token, models.ProvisioningTokenPrefix) {
+			unauthorizedScim(c)
+			return
+		}
+
+		client, err := auth.ProvisioningClientRepository.GetProvisioningClientByTokenHash(models.HashProvisioningToken(token))
+
+		if err != nil || client.IsRevoked() {
+			log.Println(err)
+			unauthorizedScim(c)
+			return
+		}
+
+		if !client.LastUsedAt.Valid || time.Since(client.LastUsedAt.Time) > time.Minute {
+			client.LastUsedAt = null.NewTime(time.Now(), true)
+
+			if _, err := auth.ProvisioningClientRepository.UpdateProvisioningClient(&client, nil); err != nil {
+				log.Println(err)
+			}
+		}
+
+		c.Set("provisioning_client", client)
+
+		c.Next()
+	}
+}
+
+func unauthorizedScim(c *gin.Context) {
+	c.Header("Content-Type", "application/scim+json")
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"schemas": []string{"urn:ietf:params:scim:api:messages:2.0:Error"},
+		"status":  "401",
+		"detail":  "Not authorized",
+	})
+}
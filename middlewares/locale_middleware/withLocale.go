@@ -0,0 +1,80 @@
+package locale_middleware
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/i18n"
+)
+
+// RequestLocale is the signed in user's locale, or the best match for the
+// Accept-Language header before authentication.
+func RequestLocale(c *gin.Context) string {
+	if user, ok := c.Get("user"); ok {
+		if locale := user.(models.User).Locale; len(locale) > 0 {
+			return i18n.Resolve(locale)
+		}
+	}
+
+	return i18n.Negotiate(c.GetHeader("Accept-Language"))
+}
+
+type translatingWriter struct {
+	gin.ResponseWriter
+	context *gin.Context
+}
+
+// Write translates the "error" message of JSON error bodies, which gin's
+// JSON renderer writes in a single call.
+func (writer *translatingWriter) Write(data []byte) (int, error) {
+	if writer.Status() < 400 || !strings.HasPrefix(writer.Header().Get("Content-Type"), "application/json") {
+		return writer.ResponseWriter.Write(data)
+	}
+
+	var body map[string]interface{}
+
+	if err := json.Unmarshal(data, &body); err != nil {
+		return writer.ResponseWriter.Write(data)
+	}
+
+	message, ok := body["error"].(string)
+
+	if !ok {
+		return writer.ResponseWriter.Write(data)
+	}
+
+	locale := RequestLocale(writer.context)
+	translation := i18n.Translate(locale, message)
+
+	if translation == message {
+		return writer.ResponseWriter.Write(data)
+	}
+
+	body["error"] = translation
+
+	translated, err := json.Marshal(body)
+
+	if err != nil {
+		return writer.ResponseWriter.Write(data)
+	}
+
+	writer.Header().Set("Content-Language", locale)
+
+	if _, err = writer.ResponseWriter.Write(translated); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// WithLocale translates API error messages to the request locale. The
+// locale is resolved when the response is written, so it sees the user set
+// by authentication middlewares running after this one.
+func WithLocale() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer = &translatingWriter{c.Writer, c}
+		c.Next()
+	}
+}
@@ -0,0 +1,86 @@
+package locale_middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+func newLocaleEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	engine := gin.New()
+	engine.Use(WithLocale())
+
+	engine.GET("/error", func(c *gin.Context) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+	})
+
+	engine.GET("/untranslated", func(c *gin.Context) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Something nobody translated"})
+	})
+
+	engine.GET("/ok", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"error": "Invalid code"})
+	})
+
+	// The user is set after WithLocale, the way authentication middlewares
+	// registered on route groups do.
+	engine.GET("/signed_in", func(c *gin.Context) {
+		c.Set("user", models.User{Locale: "es"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	})
+
+	return engine
+}
+
+func TestWithLocale(t *testing.T) {
+	engine := newLocaleEngine()
+
+	tests := []struct {
+		name            string
+		path            string
+		acceptLanguage  string
+		want            string
+		contentLanguage string
+	}{
+		{"pt-BR yields a translated error", "/error", "pt-BR", "Código inválido", "pt-BR"},
+		{"regional variant falls back", "/error", "pt-PT,en;q=0.5", "Código inválido", "pt-BR"},
+		{"english is left alone", "/error", "en-US", "Invalid code", ""},
+		{"no header", "/error", "", "Invalid code", ""},
+		{"missing translation", "/untranslated", "pt-BR", "Something nobody translated", ""},
+		{"successful responses are left alone", "/ok", "pt-BR", "Invalid code", ""},
+		{"the user's locale beats the header", "/signed_in", "pt-BR", "No encontrado", "es"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, test.path, nil)
+
+			if len(test.acceptLanguage) > 0 {
+				request.Header.Set("Accept-Language", test.acceptLanguage)
+			}
+
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, request)
+
+			var body map[string]string
+
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid body %q: %v", recorder.Body.String(), err)
+			}
+
+			if body["error"] != test.want {
+				t.Fatalf("got error %q, want %q", body["error"], test.want)
+			}
+
+			if language := recorder.Header().Get("Content-Language"); language != test.contentLanguage {
+				t.Fatalf("got Content-Language %q, want %q", language, test.contentLanguage)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrFull is returned when a new key would go over MaxEntries, the memory
+// provider never drops live keys to make room since counters and tokens
+// would silently reset.
+var ErrFull = errors.New("cache: full")
+
+type memoryEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+func (entry memoryEntry) expired(now time.Time) bool {
+	return !entry.expiresAt.IsZero() && !now.Before(entry.expiresAt)
+}
+
+// MemoryProvider keeps the cache in process, for tests and deployments
+// running a single node. Expired keys are never returned and are swept every
+// EvictionInterval, once MaxEntries is reached the expired keys are swept
+// right away and new keys are refused with ErrFull if none were.
+type MemoryProvider struct {
+	MaxEntries       int
+	EvictionInterval time.Duration
+	mutex            sync.Mutex
+	entries          map[string]*memoryEntry
+	stop             chan struct{}
+}
+
+func NewMemoryProvider(maxEntries int, evictionInterval time.Duration) *MemoryProvider {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+
+	if evictionInterval <= 0 {
+		evictionInterval = time.Minute
+	}
+
+	provider := &MemoryProvider{
+		MaxEntries:       maxEntries,
+		EvictionInterval: evictionInterval,
+		entries:          map[string]*memoryEntry{},
+		stop:             make(chan struct{}),
+	}
+
+	go provider.run()
+
+	return provider
+}
+
+func (provider *MemoryProvider) run() {
+	ticker := time.NewTicker(provider.EvictionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-provider.stop:
+			return
+		case <-ticker.C:
+			provider.EvictExpired()
+		}
+	}
+}
+
+// Close stops the background eviction.
+func (provider *MemoryProvider) Close() {
+	close(provider.stop)
+}
+
+// EvictExpired drops every expired key and returns how many there were.
+func (provider *MemoryProvider) EvictExpired() int {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	return provider.evictExpired()
+}
+
+// evictExpired is EvictExpired for callers holding the mutex.
+func (provider *MemoryProvider) evictExpired() int {
+	now := time.Now()
+	evicted := 0
+
+	for key, entry := range provider.entries {
+		if entry.expired(now) {
+			delete(provider.entries, key)
+			evicted++
+		}
+	}
+
+	return evicted
+}
+
+// Len counts the stored keys, expired ones included until they are evicted.
+func (provider *MemoryProvider) Len() int {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	return len(provider.entries)
+}
+
+// lookup returns the live entry for the key, dropping it if it expired. The
+// caller holds the mutex.
+func (provider *MemoryProvider) lookup(key string) (*memoryEntry, bool) {
+	entry, ok := provider.entries[key]
+
+	if !ok {
+		return nil, false
+	}
+
+	if entry.expired(time.Now()) {
+		delete(provider.entries, key)
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// store sets the key, the caller holds the mutex. Overwriting a key always
+// succeeds, a new one needs room.
+func (provider *MemoryProvider) store(key string, value string, expiration time.Duration) error {
+	entry := &memoryEntry{value: value}
+
+	if expiration > 0 {
+		entry.expiresAt = time.Now().Add(expiration)
+	}
+
+	if _, ok := provider.entries[key]; !ok && len(provider.entries) >= provider.MaxEntries {
+		if provider.evictExpired() <= 0 {
+			return ErrFull
+		}
+	}
+
+	provider.entries[key] = entry
+
+	return nil
+}
+
+func (provider *MemoryProvider) Get(key string) (string, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	entry, ok := provider.lookup(key)
+
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return entry.value, nil
+}
+
+func (provider *MemoryProvider) Set(key string, value string) error {
+	return provider.SetEx(key, value, 0)
+}
+
+func (provider *MemoryProvider) SetEx(key string, value string, expiration time.Duration) error {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	return provider.store(key, value, expiration)
+}
+
+func (provider *MemoryProvider) SetNX(key string, value string, expiration time.Duration) (bool, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	if _, ok := provider.lookup(key); ok {
+		return false, nil
+	}
+
+	if err := provider.store(key, value, expiration); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (provider *MemoryProvider) Delete(key string) error {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	delete(provider.entries, key)
+
+	return nil
+}
+
+func (provider *MemoryProvider) GetDel(key string) (string, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	entry, ok := provider.lookup(key)
+
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	delete(provider.entries, key)
+
+	return entry.value, nil
+}
+
+func (provider *MemoryProvider) Incr(key string, expiration time.Duration) (int64, error) {
+	return provider.IncrBy(key, 1, expiration)
+}
+
+func (provider *MemoryProvider) IncrBy(key string, value int64, expiration time.Duration) (int64, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	entry, ok := provider.lookup(key)
+
+	if !ok {
+		if err := provider.store(key, strconv.FormatInt(value, 10), expiration); err != nil {
+			return 0, err
+		}
+
+		return value, nil
+	}
+
+	current, err := strconv.ParseInt(entry.value, 10, 64)
+
+	if err != nil {
+		return 0, errors.New("cache: value is not an integer")
+	}
+
+	entry.value = strconv.FormatInt(current+value, 10)
+
+	if entry.expiresAt.IsZero() && expiration > 0 {
+		entry.expiresAt = time.Now().Add(expiration)
+	}
+
+	return current + value, nil
+}
+
+func (provider *MemoryProvider) TTL(key string) (time.Duration, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	entry, ok := provider.lookup(key)
+
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	if entry.expiresAt.IsZero() {
+		return NoExpiration, nil
+	}
+
+	return time.Until(entry.expiresAt), nil
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemoryProviderRefusesNewKeysWhenFull(t *testing.T) {
+	provider := NewMemoryProvider(3, 0)
+	t.Cleanup(provider.Close)
+
+	provider.Set("permanent", "value")
+	provider.Incr("counter", time.Hour)
+	provider.SetEx("token", "user", time.Hour)
+
+	if err := provider.Set("new", "value"); !errors.Is(err, ErrFull) {
+		t.Fatalf("Set: got %v, want ErrFull", err)
+	}
+
+	if stored, err := provider.SetNX("new", "value", time.Hour); stored || !errors.Is(err, ErrFull) {
+		t.Fatalf("SetNX: got %v, %v, want ErrFull", stored, err)
+	}
+
+	if _, err := provider.Incr("new", time.Hour); !errors.Is(err, ErrFull) {
+		t.Fatalf("Incr: got %v, want ErrFull", err)
+	}
+
+	// Keys already stored keep working.
+	if err := provider.Set("permanent", "changed"); err != nil {
+		t.Fatalf("overwrite: got %v", err)
+	}
+
+	if count, err := provider.Incr("counter", time.Hour); err != nil || count != 2 {
+		t.Fatalf("Incr existing: got %d, %v", count, err)
+	}
+
+	for _, key := range []string{"permanent", "counter", "token"} {
+		if _, err := provider.Get(key); err != nil {
+			t.Fatalf("%s was dropped: %v", key, err)
+		}
+	}
+
+	if _, err := provider.Get("new"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("new: got %v", err)
+	}
+
+	// Deleting makes room again.
+	provider.Delete("token")
+
+	if err := provider.Set("new", "value"); err != nil {
+		t.Fatalf("after delete: got %v", err)
+	}
+}
+
+func TestMemoryProviderEvictsExpiredKeysToMakeRoom(t *testing.T) {
+	provider := NewMemoryProvider(3, time.Hour)
+	t.Cleanup(provider.Close)
+
+	provider.Set("permanent", "value")
+	provider.SetEx("first", "value", 50*time.Millisecond)
+	provider.Incr("counter", 50*time.Millisecond)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if provider.Len() != 3 {
+		t.Fatalf("Len: got %d", provider.Len())
+	}
+
+	if err := provider.Set("new", "value"); err != nil {
+		t.Fatalf("Set: got %v", err)
+	}
+
+	if provider.Len() != 2 {
+		t.Fatalf("Len after evicting: got %d", provider.Len())
+	}
+
+	for _, key := range []string{"permanent", "new"} {
+		if _, err := provider.Get(key); err != nil {
+			t.Fatalf("%s: got %v", key, err)
+		}
+	}
+}
+
+func TestMemoryProviderEvictExpired(t *testing.T) {
+	provider := NewMemoryProvider(0, time.Hour)
+	t.Cleanup(provider.Close)
+
+	for i := 0; i < 10; i++ {
+		provider.SetEx("expiring:"+strconv.Itoa(i), "value", 50*time.Millisecond)
+	}
+
+	provider.Set("permanent", "value")
+
+	time.Sleep(100 * time.Millisecond)
+
+	if evicted := provider.EvictExpired(); evicted != 10 {
+		t.Fatalf("EvictExpired: got %d", evicted)
+	}
+
+	if provider.Len() != 1 {
+		t.Fatalf("Len: got %d", provider.Len())
+	}
+}
@@ -1,7 +1,34 @@
 package cache
 
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned for missing and expired keys alike.
+var ErrNotFound = errors.New("cache: key not found")
+
+// NoExpiration is the TTL of keys stored without an expiration.
+const NoExpiration time.Duration = -1
+
+// CacheProvider stores short lived values, an expiration of zero or less
+// means the key never expires.
 type CacheProvider interface {
 	Get(key string) (string, error)
 	Set(key string, value string) error
-	SetEx(key string, value string, expiration int) error
+	SetEx(key string, value string, expiration time.Duration) error
+	// SetNX only stores the value if the key is absent and tells whether it
+	// did.
+	SetNX(key string, value string, expiration time.Duration) (bool, error)
+	Delete(key string) error
+	// GetDel reads and removes the key atomically, only one of concurrent
+	// callers gets the value, which makes tokens single-use.
+	GetDel(key string) (string, error)
+	// Incr and IncrBy count from zero for missing keys, the expiration is
+	// set when the counter is created and not pushed back by increments.
+	Incr(key string, expiration time.Duration) (int64, error)
+	IncrBy(key string, value int64, expiration time.Duration) (int64, error)
+	// TTL is the time left before the key expires, NoExpiration for keys
+	// that don't.
+	TTL(key string) (time.Duration, error)
 }
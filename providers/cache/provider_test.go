@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thiagoferolla/go-auth/providers/secret"
+)
+
+// testProviderContract runs the behaviour every CacheProvider has to share,
+// the memory provider stands in for Redis so both must answer alike.
+func testProviderContract(t *testing.T, provider CacheProvider) {
+	t.Run("missing keys", func(t *testing.T) {
+		if _, err := provider.Get("missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get: got %v", err)
+		}
+
+		if _, err := provider.GetDel("missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetDel: got %v", err)
+		}
+
+		if _, err := provider.TTL("missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("TTL: got %v", err)
+		}
+
+		if err := provider.Delete("missing"); err != nil {
+			t.Fatalf("Delete: got %v", err)
+		}
+	})
+
+	t.Run("set without expiration", func(t *testing.T) {
+		for _, set := range []func() error{
+			func() error { return provider.Set("set", "value") },
+			func() error { return provider.SetEx("set", "value", 0) },
+			func() error { return provider.SetEx("set", "value", -time.Second) },
+		} {
+			if err := set(); err != nil {
+				t.Fatal(err)
+			}
+
+			if value, err := provider.Get("set"); err != nil || value != "value" {
+				t.Fatalf("Get: got %q, %v", value, err)
+			}
+
+			if ttl, err := provider.TTL("set"); err != nil || ttl != NoExpiration {
+				t.Fatalf("TTL: got %v, %v", ttl, err)
+			}
+		}
+
+		if err := provider.Delete("set"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := provider.Get("set"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get after Delete: got %v", err)
+		}
+	})
+
+	t.Run("set with expiration", func(t *testing.T) {
+		if err := provider.SetEx("expiring", "value", 200*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+
+		if value, err := provider.Get("expiring"); err != nil || value != "value" {
+			t.Fatalf("Get: got %q, %v", value, err)
+		}
+
+		if ttl, err := provider.TTL("expiring"); err != nil || ttl <= 0 || ttl > 200*time.Millisecond {
+			t.Fatalf("TTL: got %v, %v", ttl, err)
+		}
+
+		time.Sleep(300 * time.Millisecond)
+
+		if _, err := provider.Get("expiring"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get after expiring: got %v", err)
+		}
+
+		if _, err := provider.TTL("expiring"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("TTL after expiring: got %v", err)
+		}
+	})
+
+	t.Run("set clears the expiration", func(t *testing.T) {
+		provider.SetEx("overwritten", "first", time.Minute)
+
+		if err := provider.Set("overwritten", "second"); err != nil {
+			t.Fatal(err)
+		}
+
+		if ttl, _ := provider.TTL("overwritten"); ttl != NoExpiration {
+			t.Fatalf("TTL: got %v", ttl)
+		}
+
+		provider.Delete("overwritten")
+	})
+
+	t.Run("set if absent", func(t *testing.T) {
+		if stored, err := provider.SetNX("lock", "first", 200*time.Millisecond); err != nil || !stored {
+			t.Fatalf("first: got %v, %v", stored, err)
+		}
+
+		if stored, err := provider.SetNX("lock", "second", 200*time.Millisecond); err != nil || stored {
+			t.Fatalf("second: got %v, %v", stored, err)
+		}
+
+		if value, _ := provider.Get("lock"); value != "first" {
+			t.Fatalf("Get: got %q", value)
+		}
+
+		time.Sleep(300 * time.Millisecond)
+
+		if stored, err := provider.SetNX("lock", "third", 0); err != nil || !stored {
+			t.Fatalf("after expiring: got %v, %v", stored, err)
+		}
+
+		provider.Delete("lock")
+	})
+
+	t.Run("get and delete", func(t *testing.T) {
+		provider.SetEx("token", "user", time.Minute)
+
+		if value, err := provider.GetDel("token"); err != nil || value != "user" {
+			t.Fatalf("first: got %q, %v", value, err)
+		}
+
+		if _, err := provider.GetDel("token"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("second: got %v", err)
+		}
+
+		provider.SetEx("token", "user", time.Minute)
+
+		var wait sync.WaitGroup
+		var mutex sync.Mutex
+		winners := 0
+
+		for i := 0; i < 20; i++ {
+			wait.Add(1)
+
+			go func() {
+				defer wait.Done()
+
+				if _, err := provider.GetDel("token"); err == nil {
+					mutex.Lock()
+					winners++
+					mutex.Unlock()
+				}
+			}()
+		}
+
+		wait.Wait()
+
+		if winners != 1 {
+			t.Fatalf("got %d callers reading the token", winners)
+		}
+	})
+
+	t.Run("counters", func(t *testing.T) {
+		if count, err := provider.Incr("counter", 300*time.Millisecond); err != nil || count != 1 {
+			t.Fatalf("Incr: got %d, %v", count, err)
+		}
+
+		if count, err := provider.IncrBy("counter", 5, time.Hour); err != nil || count != 6 {
+			t.Fatalf("IncrBy: got %d, %v", count, err)
+		}
+
+		// Increments don't push the window back.
+		if ttl, err := provider.TTL("counter"); err != nil || ttl <= 0 || ttl > 300*time.Millisecond {
+			t.Fatalf("TTL: got %v, %v", ttl, err)
+		}
+
+		time.Sleep(400 * time.Millisecond)
+
+		if count, err := provider.Incr("counter", 0); err != nil || count != 1 {
+			t.Fatalf("Incr after expiring: got %d, %v", count, err)
+		}
+
+		if ttl, _ := provider.TTL("counter"); ttl != NoExpiration {
+			t.Fatalf("TTL without expiration: got %v", ttl)
+		}
+
+		// A counter without expiration gets the first one asked for.
+		provider.Incr("counter", time.Minute)
+
+		if ttl, _ := provider.TTL("counter"); ttl <= 0 || ttl > time.Minute {
+			t.Fatalf("TTL once set: got %v", ttl)
+		}
+
+		provider.Delete("counter")
+		provider.Set("counter", "not a number")
+
+		if _, err := provider.Incr("counter", 0); err == nil {
+			t.Fatal("Incr on a string")
+		}
+
+		provider.Delete("counter")
+	})
+}
+
+func TestMemoryProviderContract(t *testing.T) {
+	provider := NewMemoryProvider(0, 0)
+	t.Cleanup(provider.Close)
+
+	testProviderContract(t, provider)
+}
+
+// The Redis run needs a server, REDIS_URL points at one.
+func TestRedisProviderContract(t *testing.T) {
+	if len(os.Getenv("REDIS_URL")) <= 0 {
+		t.Skip("REDIS_URL is not set")
+	}
+
+	config, err := RedisConfigFromSecrets(secret.NewMockSecretProvider())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.KeyPrefix = "go-auth-test:" + uuid.New().String() + ":"
+
+	provider, err := NewRedisProvider(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		keys, _ := provider.RedisClient.Keys(config.KeyPrefix + "*").Result()
+
+		if len(keys) > 0 {
+			provider.RedisClient.Del(keys...)
+		}
+
+		provider.RedisClient.Close()
+	})
+
+	testProviderContract(t, provider)
+}
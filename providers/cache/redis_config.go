@@ -0,0 +1,265 @@
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/thiagoferolla/go-auth/providers/secret"
+)
+
+const (
+	RedisSingle   = "single"
+	RedisSentinel = "sentinel"
+	RedisCluster  = "cluster"
+)
+
+// RedisConfig describes the Redis deployment. Addrs holds the server for the
+// single mode, the sentinels for the sentinel mode and the seed nodes for the
+// cluster mode. KeyPrefix namespaces every key so environments can share a
+// server. Zero values leave the go-redis defaults.
+type RedisConfig struct {
+	Mode               string
+	Addrs              []string
+	MasterName         string
+	Password           string
+	DB                 int
+	TLS                bool
+	TLSServerName      string
+	CACertificateFile  string
+	CertificateFile    string
+	KeyFile            string
+	InsecureSkipVerify bool
+	KeyPrefix          string
+	PoolSize           int
+	MinIdleConns       int
+	MaxRetries         int
+	DialTimeout        time.Duration
+	ReadTimeout        time.Duration
+	WriteTimeout       time.Duration
+	PoolTimeout        time.Duration
+	IdleTimeout        time.Duration
+}
+
+// RedisConfigFromSecrets reads REDIS_URL, redis:// or rediss:// with the
+// password and database index, and lets the other REDIS_ secrets override
+// it. Without a URL it falls back to REDIS_HOST and REDIS_PORT.
+func RedisConfigFromSecrets(secretProvider secret.SecretProvider) (RedisConfig, error) {
+	optional := func(name string) string {
+		value, err := secretProvider.Get(name)
+
+		if err != nil {
+			return ""
+		}
+
+		return value
+	}
+
+	config := RedisConfig{Mode: RedisSingle}
+
+	if redisURL := optional("REDIS_URL"); len(redisURL) > 0 {
+		options, err := redis.ParseURL(redisURL)
+
+		if err != nil {
+			return config, err
+		}
+
+		config.Addrs = []string{options.Addr}
+		config.Password = options.Password
+		config.DB = options.DB
+		config.TLS = options.TLSConfig != nil
+	} else {
+		port := optional("REDIS_PORT")
+
+		if len(port) <= 0 {
+			port = "6379"
+		}
+
+		config.Addrs = []string{net.JoinHostPort(optional("REDIS_HOST"), port)}
+	}
+
+	if addrs := optional("REDIS_ADDRS"); len(addrs) > 0 {
+		config.Addrs = strings.Split(addrs, ",")
+	}
+
+	if mode := optional("REDIS_MODE"); len(mode) > 0 {
+		config.Mode = mode
+	}
+
+	if password := optional("REDIS_PASSWORD"); len(password) > 0 {
+		config.Password = password
+	}
+
+	config.MasterName = optional("REDIS_MASTER_NAME")
+	config.TLSServerName = optional("REDIS_TLS_SERVER_NAME")
+	config.CACertificateFile = optional("REDIS_TLS_CA_FILE")
+	config.CertificateFile = optional("REDIS_TLS_CERT_FILE")
+	config.KeyFile = optional("REDIS_TLS_KEY_FILE")
+	config.InsecureSkipVerify = optional("REDIS_TLS_INSECURE_SKIP_VERIFY") == "true"
+	config.KeyPrefix = optional("REDIS_KEY_PREFIX")
+	config.TLS = config.TLS || optional("REDIS_TLS") == "true"
+
+	integers := map[string]*int{
+		"REDIS_DB":             &config.DB,
+		"REDIS_POOL_SIZE":      &config.PoolSize,
+		"REDIS_MIN_IDLE_CONNS": &config.MinIdleConns,
+		"REDIS_MAX_RETRIES":    &config.MaxRetries,
+	}
+
+	for name, field := range integers {
+		if value := optional(name); len(value) > 0 {
+			parsed, err := strconv.Atoi(value)
+
+			if err != nil {
+				return config, errors.New("invalid " + name + ": " + value)
+			}
+
+			*field = parsed
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"REDIS_DIAL_TIMEOUT":  &config.DialTimeout,
+		"REDIS_READ_TIMEOUT":  &config.ReadTimeout,
+		"REDIS_WRITE_TIMEOUT": &config.WriteTimeout,
+		"REDIS_POOL_TIMEOUT":  &config.PoolTimeout,
+		"REDIS_IDLE_TIMEOUT":  &config.IdleTimeout,
+	}
+
+	for name, field := range durations {
+		if value := optional(name); len(value) > 0 {
+			parsed, err := time.ParseDuration(value)
+
+			if err != nil {
+				return config, errors.New("invalid " + name + ": " + value)
+			}
+
+			*field = parsed
+		}
+	}
+
+	return config, nil
+}
+
+func (config RedisConfig) tlsConfig() (*tls.Config, error) {
+	if !config.TLS {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         config.TLSServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	// go-redis hands the connection to tls.Client as is, which needs a name
+	// to verify the certificate against. Sentinels and cluster nodes don't
+	// share one host, so they must share the name on their certificates.
+	if len(tlsConfig.ServerName) <= 0 && len(config.Addrs) == 1 {
+		host, _, err := net.SplitHostPort(config.Addrs[0])
+
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.ServerName = host
+	} else if len(tlsConfig.ServerName) <= 0 && !config.InsecureSkipVerify {
+		return nil, errors.New("REDIS_TLS_SERVER_NAME is required to verify the certificates of several redis addresses")
+	}
+
+	if len(config.CACertificateFile) > 0 {
+		data, err := os.ReadFile(config.CACertificateFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificate found in " + config.CACertificateFile)
+		}
+	}
+
+	if len(config.CertificateFile) > 0 {
+		certificate, err := tls.LoadX509KeyPair(config.CertificateFile, config.KeyFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// NewClient builds the client for the configured mode.
+func (config RedisConfig) NewClient() (redis.UniversalClient, error) {
+	tlsConfig, err := config.tlsConfig()
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.Mode {
+	case RedisSingle:
+		return redis.NewClient(&redis.Options{
+			Addr:         config.Addrs[0],
+			Password:     config.Password,
+			DB:           config.DB,
+			MaxRetries:   config.MaxRetries,
+			DialTimeout:  config.DialTimeout,
+			ReadTimeout:  config.ReadTimeout,
+			WriteTimeout: config.WriteTimeout,
+			PoolSize:     config.PoolSize,
+			MinIdleConns: config.MinIdleConns,
+			PoolTimeout:  config.PoolTimeout,
+			IdleTimeout:  config.IdleTimeout,
+			TLSConfig:    tlsConfig,
+		}), nil
+	case RedisSentinel:
+		if len(config.MasterName) <= 0 {
+			return nil, errors.New("REDIS_MASTER_NAME is required in sentinel mode")
+		}
+
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    config.MasterName,
+			SentinelAddrs: config.Addrs,
+			Password:      config.Password,
+			DB:            config.DB,
+			MaxRetries:    config.MaxRetries,
+			DialTimeout:   config.DialTimeout,
+			ReadTimeout:   config.ReadTimeout,
+			WriteTimeout:  config.WriteTimeout,
+			PoolSize:      config.PoolSize,
+			MinIdleConns:  config.MinIdleConns,
+			PoolTimeout:   config.PoolTimeout,
+			IdleTimeout:   config.IdleTimeout,
+			TLSConfig:     tlsConfig,
+		}), nil
+	case RedisCluster:
+		// Clusters only have database 0.
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        config.Addrs,
+			Password:     config.Password,
+			MaxRetries:   config.MaxRetries,
+			DialTimeout:  config.DialTimeout,
+			ReadTimeout:  config.ReadTimeout,
+			WriteTimeout: config.WriteTimeout,
+			PoolSize:     config.PoolSize,
+			MinIdleConns: config.MinIdleConns,
+			PoolTimeout:  config.PoolTimeout,
+			IdleTimeout:  config.IdleTimeout,
+			TLSConfig:    tlsConfig,
+		}), nil
+	}
+
+	return nil, errors.New("unknown redis mode " + config.Mode)
+}
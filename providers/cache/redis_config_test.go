@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedisTLSServerName(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     RedisConfig
+		serverName string
+		err        string
+	}{
+		{
+			name:       "single address",
+			config:     RedisConfig{TLS: true, Addrs: []string{"redis.example.com:6380"}},
+			serverName: "redis.example.com",
+		},
+		{
+			name:       "explicit name",
+			config:     RedisConfig{TLS: true, Addrs: []string{"10.0.0.1:6380"}, TLSServerName: "redis.example.com"},
+			serverName: "redis.example.com",
+		},
+		{
+			name:       "several addresses with a name",
+			config:     RedisConfig{TLS: true, Mode: RedisCluster, Addrs: []string{"10.0.0.1:6380", "10.0.0.2:6380"}, TLSServerName: "redis.example.com"},
+			serverName: "redis.example.com",
+		},
+		{
+			name:   "several addresses without a name",
+			config: RedisConfig{TLS: true, Mode: RedisSentinel, Addrs: []string{"10.0.0.1:26379", "10.0.0.2:26379"}},
+			err:    "REDIS_TLS_SERVER_NAME",
+		},
+		{
+			name:   "several addresses without verification",
+			config: RedisConfig{TLS: true, Mode: RedisCluster, Addrs: []string{"10.0.0.1:6380", "10.0.0.2:6380"}, InsecureSkipVerify: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tlsConfig, err := test.config.tlsConfig()
+
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %v, want an error about %s", err, test.err)
+				}
+
+				if _, err := test.config.NewClient(); err == nil {
+					t.Fatal("NewClient built a client")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tlsConfig.ServerName != test.serverName {
+				t.Fatalf("got %q, want %q", tlsConfig.ServerName, test.serverName)
+			}
+		})
+	}
+
+	if tlsConfig, err := (RedisConfig{Addrs: []string{"10.0.0.1:6379", "10.0.0.2:6379"}}).tlsConfig(); err != nil || tlsConfig != nil {
+		t.Fatalf("without TLS: got %v, %v", tlsConfig, err)
+	}
+}
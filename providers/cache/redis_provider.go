@@ -1,32 +1,119 @@
 package cache
 
 import (
-	"os"
+	"fmt"
 	"time"
 
 	"github.com/go-redis/redis"
 )
 
+// getDelScript stands in for GETDEL, which needs Redis 6.2.
+var getDelScript = redis.NewScript(`
+local value = redis.call("GET", KEYS[1])
+
+if value then
+	redis.call("DEL", KEYS[1])
+end
+
+return value
+`)
+
+// incrByScript only sets the expiration on counters that have none, so the
+// window starts with the first increment.
+var incrByScript = redis.NewScript(`
+local value = redis.call("INCRBY", KEYS[1], ARGV[1])
+
+if tonumber(ARGV[2]) > 0 and redis.call("PTTL", KEYS[1]) == -1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+
+return value
+`)
+
 type RedisProvider struct {
-	RedisClient *redis.Client
+	RedisClient redis.UniversalClient
+	KeyPrefix   string
 }
 
-func NewRedisProvider() *RedisProvider {
-	redisClient := redis.NewClient(&redis.Options{
-		Addr: os.Getenv("REDIS_HOST") + ":6379",
-	})
+// NewRedisProvider connects and pings the server, so a misconfigured cache
+// fails at startup rather than on the first sign in.
+func NewRedisProvider(config RedisConfig) (*RedisProvider, error) {
+	redisClient, err := config.NewClient()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = redisClient.Ping().Err(); err != nil {
+		redisClient.Close()
+		return nil, fmt.Errorf("redis ping: %w", err)
+	}
 
-	return &RedisProvider{redisClient}
+	return &RedisProvider{redisClient, config.KeyPrefix}, nil
+}
+
+func (provider RedisProvider) key(key string) string {
+	return provider.KeyPrefix + key
 }
 
 func (provider RedisProvider) Get(key string) (string, error) {
-	return provider.RedisClient.Get(key).Result()
+	value, err := provider.RedisClient.Get(provider.key(key)).Result()
+
+	if err == redis.Nil {
+		return value, ErrNotFound
+	}
+
+	return value, err
 }
 
 func (provider RedisProvider) Set(key string, value string) error {
-	return provider.RedisClient.Set(key, value, 0).Err()
+	return provider.RedisClient.Set(provider.key(key), value, 0).Err()
 }
 
-func (provider RedisProvider) SetEx(key string, value string, expiration int) error {
-	return provider.RedisClient.Set(key, value, time.Duration(expiration)).Err()
+func (provider RedisProvider) SetEx(key string, value string, expiration time.Duration) error {
+	return provider.RedisClient.Set(provider.key(key), value, max(expiration, 0)).Err()
+}
+
+func (provider RedisProvider) SetNX(key string, value string, expiration time.Duration) (bool, error) {
+	return provider.RedisClient.SetNX(provider.key(key), value, max(expiration, 0)).Result()
+}
+
+func (provider RedisProvider) Delete(key string) error {
+	return provider.RedisClient.Del(provider.key(key)).Err()
+}
+
+func (provider RedisProvider) GetDel(key string) (string, error) {
+	value, err := getDelScript.Run(provider.RedisClient, []string{provider.key(key)}).String()
+
+	if err == redis.Nil {
+		return value, ErrNotFound
+	}
+
+	return value, err
+}
+
+func (provider RedisProvider) Incr(key string, expiration time.Duration) (int64, error) {
+	return provider.IncrBy(key, 1, expiration)
+}
+
+func (provider RedisProvider) IncrBy(key string, value int64, expiration time.Duration) (int64, error) {
+	return incrByScript.Run(provider.RedisClient, []string{provider.key(key)}, value, expiration.Milliseconds()).Int64()
+}
+
+func (provider RedisProvider) TTL(key string) (time.Duration, error) {
+	ttl, err := provider.RedisClient.PTTL(provider.key(key)).Result()
+
+	if err != nil {
+		return ttl, err
+	}
+
+	// PTTL answers -2 for missing keys and -1 for keys without expiration.
+	switch ttl {
+	case -2 * time.Millisecond:
+		return 0, ErrNotFound
+	case -1 * time.Millisecond:
+		return NoExpiration, nil
+	}
+
+	return ttl, nil
 }
@@ -0,0 +1,83 @@
+package directory
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// LdapConfig declares one directory and the email domains it answers for.
+// With UserDNTemplate set users bind directly, otherwise the service account
+// searches for the user with UserFilter and then binds as the entry found.
+// An ldap:// URL is upgraded with StartTLS unless AllowPlaintext is set, for
+// local directories only, an ldaps:// one uses implicit TLS. A user in
+// several mapped groups gets the first of their roles in RolePriority.
+type LdapConfig struct {
+	Name               string            `json:"name"`
+	Domains            []string          `json:"domains"`
+	URL                string            `json:"url"`
+	AllowPlaintext     bool              `json:"allow_plaintext"`
+	CACertificateFile  string            `json:"ca_certificate_file"`
+	InsecureSkipVerify bool              `json:"insecure_skip_verify"`
+	BindDN             string            `json:"bind_dn"`
+	BindPassword       string            `json:"bind_password"`
+	UserDNTemplate     string            `json:"user_dn_template"`
+	BaseDN             string            `json:"base_dn"`
+	UserFilter         string            `json:"user_filter"`
+	EmailAttribute     string            `json:"email_attribute"`
+	NameAttribute      string            `json:"name_attribute"`
+	GroupAttribute     string            `json:"group_attribute"`
+	GroupRoleMapping   map[string]string `json:"group_role_mapping"`
+	RolePriority       []string          `json:"role_priority"`
+	DefaultRole        string            `json:"default_role"`
+	PoolSize           int               `json:"pool_size"`
+}
+
+func LoadLdapConfigs(path string) ([]LdapConfig, error) {
+	configs := []LdapConfig{}
+
+	if len(path) <= 0 {
+		return configs, nil
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return configs, err
+	}
+
+	err = json.Unmarshal([]byte(os.ExpandEnv(string(data))), &configs)
+
+	return configs, err
+}
+
+// NewDirectories indexes the configured directories by email domain.
+func NewDirectories(configs []LdapConfig) (map[string]DirectoryProvider, error) {
+	directories := map[string]DirectoryProvider{}
+
+	for _, config := range configs {
+		provider, err := NewLdapProvider(config)
+
+		if err != nil {
+			return directories, err
+		}
+
+		for _, domain := range config.Domains {
+			directories[strings.ToLower(domain)] = provider
+		}
+	}
+
+	return directories, nil
+}
+
+func DirectoryForEmail(directories map[string]DirectoryProvider, email string) (DirectoryProvider, bool) {
+	at := strings.LastIndex(email, "@")
+
+	if at < 0 {
+		return nil, false
+	}
+
+	provider, ok := directories[strings.ToLower(email[at+1:])]
+
+	return provider, ok
+}
@@ -0,0 +1,282 @@
+package directory
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type LdapProvider struct {
+	Config    LdapConfig
+	TLSConfig *tls.Config
+	pool      chan *ldap.Conn
+}
+
+func NewLdapProvider(config LdapConfig) (*LdapProvider, error) {
+	if config.PoolSize <= 0 {
+		config.PoolSize = 4
+	}
+
+	if len(config.EmailAttribute) <= 0 {
+		config.EmailAttribute = "mail"
+	}
+
+	if len(config.UserFilter) <= 0 {
+		config.UserFilter = "(" + config.EmailAttribute + "=%s)"
+	}
+
+	if len(config.DefaultRole) <= 0 {
+		config.DefaultRole = "user"
+	}
+
+	if len(config.RolePriority) <= 0 {
+		config.RolePriority = []string{"admin", "support", "user"}
+	}
+
+	err := validateLdapConfig(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(config.URL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if serverURL.Scheme != "ldap" && serverURL.Scheme != "ldaps" {
+		return nil, errors.New("ldap directory " + config.Name + " needs an ldap:// or ldaps:// url")
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         serverURL.Hostname(),
+		InsecureSkipVerify: config.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if len(config.CACertificateFile) > 0 {
+		certificate, err := os.ReadFile(config.CACertificateFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(certificate) {
+			return nil, errors.New("no certificate found in " + config.CACertificateFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	return &LdapProvider{config, tlsConfig, make(chan *ldap.Conn, config.PoolSize)}, nil
+}
+
+// validateLdapConfig refuses mappings to roles that don't exist or that the
+// priority order can't rank, the role a user gets must not depend on the
+// order the directory lists their groups in.
+func validateLdapConfig(config LdapConfig) error {
+	roles := []string{config.DefaultRole}
+
+	for _, role := range config.GroupRoleMapping {
+		roles = append(roles, role)
+	}
+
+	for _, role := range roles {
+		if !models.ValidatePlatformRole(role) {
+			return errors.New("ldap directory " + config.Name + " maps to unknown role " + role)
+		}
+
+		if rolePriority(config.RolePriority, role) < 0 {
+			return errors.New("ldap directory " + config.Name + " has no priority for role " + role)
+		}
+	}
+
+	return nil
+}
+
+func rolePriority(priority []string, role string) int {
+	for i, candidate := range priority {
+		if candidate == role {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (provider *LdapProvider) Name() string {
+	return provider.Config.Name
+}
+
+func (provider *LdapProvider) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(provider.Config.URL, ldap.DialWithTLSConfig(provider.TLSConfig))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Passwords are bound on this connection, it is never left in plaintext
+	// unless the config says so.
+	if !strings.HasPrefix(strings.ToLower(provider.Config.URL), "ldaps://") && !provider.Config.AllowPlaintext {
+		if err = conn.StartTLS(provider.TLSConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// bindService leaves the connection bound as the service account, the state
+// every pooled connection is kept in.
+func (provider *LdapProvider) bindService(conn *ldap.Conn) error {
+	if len(provider.Config.BindDN) <= 0 {
+		return conn.UnauthenticatedBind("")
+	}
+
+	return conn.Bind(provider.Config.BindDN, provider.Config.BindPassword)
+}
+
+func (provider *LdapProvider) acquire() (*ldap.Conn, error) {
+	select {
+	case conn := <-provider.pool:
+		if !conn.IsClosing() {
+			return conn, nil
+		}
+	default:
+	}
+
+	conn, err := provider.dial()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = provider.bindService(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (provider *LdapProvider) release(conn *ldap.Conn) {
+	if conn.IsClosing() || provider.bindService(conn) != nil {
+		conn.Close()
+		return
+	}
+
+	select {
+	case provider.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (provider *LdapProvider) Authenticate(email string, password string) (DirectoryUser, error) {
+	if len(password) <= 0 {
+		return DirectoryUser{}, ErrInvalidCredentials
+	}
+
+	conn, err := provider.acquire()
+
+	if err != nil {
+		return DirectoryUser{}, err
+	}
+
+	defer provider.release(conn)
+
+	attributes := []string{}
+
+	for _, attribute := range []string{provider.Config.EmailAttribute, provider.Config.NameAttribute, provider.Config.GroupAttribute} {
+		if len(attribute) > 0 {
+			attributes = append(attributes, attribute)
+		}
+	}
+
+	var userDN string
+
+	if len(provider.Config.UserDNTemplate) > 0 {
+		userDN = fmt.Sprintf(provider.Config.UserDNTemplate, ldap.EscapeDN(strings.Split(email, "@")[0]))
+	} else {
+		entry, err := provider.search(conn, fmt.Sprintf(provider.Config.UserFilter, ldap.EscapeFilter(email)), attributes)
+
+		if err != nil {
+			return DirectoryUser{}, err
+		}
+
+		userDN = entry.DN
+	}
+
+	err = conn.Bind(userDN, password)
+
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return DirectoryUser{}, ErrInvalidCredentials
+	} else if err != nil {
+		return DirectoryUser{}, err
+	}
+
+	// Read the entry as the user itself, directories commonly let users see
+	// their own group memberships.
+	entry, err := provider.search(conn, fmt.Sprintf(provider.Config.UserFilter, ldap.EscapeFilter(email)), attributes)
+
+	if err != nil {
+		return DirectoryUser{}, err
+	}
+
+	user := DirectoryUser{
+		Subject: entry.DN,
+		Email:   entry.GetAttributeValue(provider.Config.EmailAttribute),
+		Name:    entry.GetAttributeValue(provider.Config.NameAttribute),
+		Role:    provider.Config.DefaultRole,
+	}
+
+	mapped := false
+
+	for _, group := range entry.GetAttributeValues(provider.Config.GroupAttribute) {
+		role, ok := provider.Config.GroupRoleMapping[group]
+
+		if ok && (!mapped || rolePriority(provider.Config.RolePriority, role) < rolePriority(provider.Config.RolePriority, user.Role)) {
+			user.Role = role
+			mapped = true
+		}
+	}
+
+	if len(user.Email) <= 0 {
+		user.Email = email
+	}
+
+	return user, nil
+}
+
+func (provider *LdapProvider) search(conn *ldap.Conn, filter string, attributes []string) (*ldap.Entry, error) {
+	request := ldap.NewSearchRequest(
+		provider.Config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		filter,
+		attributes,
+		nil,
+	)
+
+	result, err := conn.Search(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	return result.Entries[0], nil
+}
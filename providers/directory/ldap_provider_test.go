@@ -0,0 +1,615 @@
+package directory
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	testBaseDN     = "ou=people,dc=example,dc=com"
+	testServiceDN  = "cn=go-auth,dc=example,dc=com"
+	testServicePwd = "service-secret"
+)
+
+type ldapEntry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// fakeDirectory is an in-process LDAP server speaking just enough of the
+// protocol for simple binds, equality searches and StartTLS. Like real
+// servers it accepts a bind with a DN and no password as an unauthenticated
+// bind, and once given a certificate it refuses binds in plaintext.
+type fakeDirectory struct {
+	listener net.Listener
+	scheme   string
+	tls      *tls.Config
+	entries  []ldapEntry
+	mutex    sync.Mutex
+	binds    []string
+}
+
+func newFakeDirectory(t *testing.T, entries ...ldapEntry) *fakeDirectory {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries = append(entries, ldapEntry{DN: testServiceDN, Password: testServicePwd})
+	server := &fakeDirectory{listener: listener, scheme: "ldap", entries: entries}
+	t.Cleanup(func() { listener.Close() })
+
+	go server.serve()
+
+	return server
+}
+
+// newTLSFakeDirectory serves TLS from the first byte when implicit, as on
+// ldaps://, or after StartTLS otherwise. It returns the file of the
+// certificate clients must trust.
+func newTLSFakeDirectory(t *testing.T, implicit bool, entries ...ldapEntry) (*fakeDirectory, string) {
+	server := newFakeDirectory(t, entries...)
+	certificate, certificateFile := testCertificate(t)
+
+	server.tls = &tls.Config{Certificates: []tls.Certificate{certificate}}
+
+	if implicit {
+		server.scheme = "ldaps"
+		server.listener = tls.NewListener(server.listener, server.tls)
+	}
+
+	return server, certificateFile
+}
+
+// testCertificate issues a self-signed certificate for 127.0.0.1.
+func testCertificate(t *testing.T) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "ca.crt")
+
+	if err = os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, file
+}
+
+func (server *fakeDirectory) URL() string {
+	return server.scheme + "://" + server.listener.Addr().String()
+}
+
+// Binds lists the DNs bound to, anonymous binds aside, in order.
+func (server *fakeDirectory) Binds() []string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return append([]string{}, server.binds...)
+}
+
+func (server *fakeDirectory) serve() {
+	for {
+		conn, err := server.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		go server.handle(conn)
+	}
+}
+
+func (server *fakeDirectory) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	boundDN := ""
+	_, encrypted := conn.(*tls.Conn)
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+
+		messageID := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+
+		switch request.Tag {
+		case ldap.ApplicationExtendedRequest:
+			if server.tls == nil || encrypted || request.Children[0].Data.String() != "1.3.6.1.4.1.1466.20037" {
+				server.respond(conn, messageID, ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError)
+				continue
+			}
+
+			server.respond(conn, messageID, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess)
+			conn = tls.Server(conn, server.tls)
+			encrypted = true
+		case ldap.ApplicationBindRequest:
+			if server.tls != nil && !encrypted {
+				server.respond(conn, messageID, ldap.ApplicationBindResponse, ldap.LDAPResultConfidentialityRequired)
+				continue
+			}
+
+			dn := request.Children[1].Data.String()
+			password := request.Children[2].Data.String()
+
+			code := server.bind(dn, password)
+
+			if code == ldap.LDAPResultSuccess {
+				boundDN = dn
+			}
+
+			server.respond(conn, messageID, ldap.ApplicationBindResponse, code)
+		case ldap.ApplicationSearchRequest:
+			if len(boundDN) <= 0 {
+				server.respond(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights)
+				continue
+			}
+
+			for _, entry := range server.search(request.Children[0].Data.String(), request.Children[6]) {
+				conn.Write(searchResultEntry(messageID, entry, request.Children[7]).Bytes())
+			}
+
+			server.respond(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func (server *fakeDirectory) bind(dn string, password string) uint16 {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if len(dn) > 0 {
+		server.binds = append(server.binds, dn)
+	}
+
+	if len(password) <= 0 {
+		return ldap.LDAPResultSuccess
+	}
+
+	for _, entry := range server.entries {
+		if strings.EqualFold(entry.DN, dn) && entry.Password == password {
+			return ldap.LDAPResultSuccess
+		}
+	}
+
+	return ldap.LDAPResultInvalidCredentials
+}
+
+// search only understands equality filters, which is all the provider sends.
+func (server *fakeDirectory) search(baseDN string, filter *ber.Packet) []ldapEntry {
+	found := []ldapEntry{}
+
+	if filter.Tag != ldap.FilterEqualityMatch || len(filter.Children) != 2 {
+		return found
+	}
+
+	attribute := filter.Children[0].Data.String()
+	value := filter.Children[1].Data.String()
+
+	for _, entry := range server.entries {
+		if !strings.HasSuffix(strings.ToLower(entry.DN), strings.ToLower(baseDN)) {
+			continue
+		}
+
+		for _, candidate := range entry.Attributes[attribute] {
+			if strings.EqualFold(candidate, value) {
+				found = append(found, entry)
+				break
+			}
+		}
+	}
+
+	return found
+}
+
+func (server *fakeDirectory) respond(conn io.Writer, messageID int64, tag ber.Tag, code uint16) {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+
+	conn.Write(envelope(messageID, response).Bytes())
+}
+
+func searchResultEntry(messageID int64, entry ldapEntry, requested *ber.Packet) *ber.Packet {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "Object Name"))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+
+	for _, name := range requested.Children {
+		values, ok := entry.Attributes[name.Data.String()]
+
+		if !ok {
+			continue
+		}
+
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name.Data.String(), "Type"))
+
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+
+	response.AppendChild(attributes)
+
+	return envelope(messageID, response)
+}
+
+func envelope(messageID int64, response *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	packet.AppendChild(response)
+
+	return packet
+}
+
+var (
+	jane = ldapEntry{
+		DN:       "uid=jane,ou=people,dc=example,dc=com",
+		Password: "jane-password",
+		Attributes: map[string][]string{
+			"mail":     {"jane@example.com"},
+			"cn":       {"Jane Doe"},
+			"memberOf": {"cn=staff,ou=groups,dc=example,dc=com", "cn=go-auth-admins,ou=groups,dc=example,dc=com"},
+		},
+	}
+	john = ldapEntry{
+		DN:       "uid=john,ou=people,dc=example,dc=com",
+		Password: "john-password",
+		Attributes: map[string][]string{
+			"mail": {"john@example.com"},
+			"cn":   {"John Roe"},
+		},
+	}
+)
+
+func testLdapConfig(server *fakeDirectory) LdapConfig {
+	return LdapConfig{
+		Name:             "corp",
+		Domains:          []string{"example.com"},
+		URL:              server.URL(),
+		AllowPlaintext:   true,
+		BindDN:           testServiceDN,
+		BindPassword:     testServicePwd,
+		BaseDN:           testBaseDN,
+		NameAttribute:    "cn",
+		GroupAttribute:   "memberOf",
+		GroupRoleMapping: map[string]string{"cn=go-auth-admins,ou=groups,dc=example,dc=com": "admin"},
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	server := newFakeDirectory(t, jane, john)
+
+	searchThenBind := testLdapConfig(server)
+
+	directBind := testLdapConfig(server)
+	directBind.BindDN = ""
+	directBind.BindPassword = ""
+	directBind.UserDNTemplate = "uid=%s,ou=people,dc=example,dc=com"
+
+	tests := []struct {
+		name     string
+		config   LdapConfig
+		email    string
+		password string
+		want     DirectoryUser
+		wantErr  error
+	}{
+		{
+			name:     "search then bind maps groups to roles",
+			config:   searchThenBind,
+			email:    "jane@example.com",
+			password: "jane-password",
+			want:     DirectoryUser{Subject: jane.DN, Email: "jane@example.com", Name: "Jane Doe", Role: "admin"},
+		},
+		{
+			name:     "search then bind without groups",
+			config:   searchThenBind,
+			email:    "john@example.com",
+			password: "john-password",
+			want:     DirectoryUser{Subject: john.DN, Email: "john@example.com", Name: "John Roe", Role: "user"},
+		},
+		{
+			name:     "direct bind",
+			config:   directBind,
+			email:    "jane@example.com",
+			password: "jane-password",
+			want:     DirectoryUser{Subject: jane.DN, Email: "jane@example.com", Name: "Jane Doe", Role: "admin"},
+		},
+		{
+			name:     "wrong password",
+			config:   searchThenBind,
+			email:    "jane@example.com",
+			password: "john-password",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     "direct bind with wrong password",
+			config:   directBind,
+			email:    "jane@example.com",
+			password: "wrong",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     "unknown user",
+			config:   searchThenBind,
+			email:    "mallory@example.com",
+			password: "jane-password",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     "filter injection",
+			config:   searchThenBind,
+			email:    "*",
+			password: "jane-password",
+			wantErr:  ErrInvalidCredentials,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider, err := NewLdapProvider(test.config)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user, err := provider.Authenticate(test.email, test.password)
+
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+
+			if user != test.want {
+				t.Fatalf("got %+v, want %+v", user, test.want)
+			}
+		})
+	}
+}
+
+// An empty password would be an unauthenticated bind, which the directory
+// accepts for any DN, so it must never reach the server.
+func TestAuthenticateRejectsEmptyPassword(t *testing.T) {
+	server := newFakeDirectory(t, jane)
+
+	for _, template := range []string{"", "uid=%s,ou=people,dc=example,dc=com"} {
+		config := testLdapConfig(server)
+		config.UserDNTemplate = template
+
+		provider, err := NewLdapProvider(config)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := provider.Authenticate("jane@example.com", ""); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("got error %v, want ErrInvalidCredentials", err)
+		}
+	}
+
+	for _, dn := range server.Binds() {
+		if dn == jane.DN {
+			t.Fatal("the user was bound with an empty password")
+		}
+	}
+}
+
+func TestAuthenticateWithBadServiceAccount(t *testing.T) {
+	server := newFakeDirectory(t, jane)
+
+	config := testLdapConfig(server)
+	config.BindPassword = "wrong"
+
+	provider, err := NewLdapProvider(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Users must not be told their password is wrong when the directory is
+	// misconfigured.
+	if _, err := provider.Authenticate("jane@example.com", "jane-password"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got error %v, want a configuration error", err)
+	}
+}
+
+func TestAuthenticateReusesServiceConnection(t *testing.T) {
+	server := newFakeDirectory(t, jane)
+
+	provider, err := NewLdapProvider(testLdapConfig(server))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := provider.Authenticate("jane@example.com", "jane-password"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The pooled connection goes back to the service account after each
+	// login, so the search of the next one isn't made as the previous user.
+	binds := server.Binds()
+	want := []string{testServiceDN, jane.DN, testServiceDN, jane.DN, testServiceDN, jane.DN, testServiceDN}
+
+	if strings.Join(binds[len(binds)-len(want):], "|") != strings.Join(want, "|") {
+		t.Fatalf("got binds %v", binds)
+	}
+}
+
+func TestAuthenticateOverTLS(t *testing.T) {
+	tests := []struct {
+		name     string
+		implicit bool
+	}{
+		{"starttls", false},
+		{"ldaps", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, certificateFile := newTLSFakeDirectory(t, test.implicit, jane)
+
+			config := testLdapConfig(server)
+			config.AllowPlaintext = false
+			config.CACertificateFile = certificateFile
+
+			provider, err := NewLdapProvider(config)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := provider.Authenticate("jane@example.com", "jane-password"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// Without the opt-out a directory that can't upgrade the connection is never
+// sent a password.
+func TestAuthenticateRequiresStartTLS(t *testing.T) {
+	server := newFakeDirectory(t, jane)
+
+	config := testLdapConfig(server)
+	config.AllowPlaintext = false
+
+	provider, err := NewLdapProvider(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.Authenticate("jane@example.com", "jane-password"); err == nil {
+		t.Fatal("authenticated without TLS")
+	}
+
+	if binds := server.Binds(); len(binds) > 0 {
+		t.Fatalf("got binds %v in plaintext", binds)
+	}
+}
+
+// Jane's groups list staff before admins, and the directory could list them
+// the other way around, her role follows the configured priority instead.
+func TestAuthenticateRanksMappedRoles(t *testing.T) {
+	server := newFakeDirectory(t, jane)
+
+	tests := []struct {
+		name     string
+		priority []string
+		want     string
+	}{
+		{"default priority", nil, "admin"},
+		{"configured priority", []string{"support", "admin", "user"}, "support"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testLdapConfig(server)
+			config.RolePriority = test.priority
+			config.GroupRoleMapping = map[string]string{
+				"cn=go-auth-admins,ou=groups,dc=example,dc=com": "admin",
+				"cn=staff,ou=groups,dc=example,dc=com":          "support",
+			}
+
+			provider, err := NewLdapProvider(config)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user, err := provider.Authenticate("jane@example.com", "jane-password")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if user.Role != test.want {
+				t.Fatalf("got role %q, want %q", user.Role, test.want)
+			}
+		})
+	}
+}
+
+func TestNewLdapProviderValidatesConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		edit   func(*LdapConfig)
+		wantOk bool
+	}{
+		{"valid", func(config *LdapConfig) {}, true},
+		{"ldaps url", func(config *LdapConfig) { config.URL = "ldaps://ldap.example.com" }, true},
+		{"unknown scheme", func(config *LdapConfig) { config.URL = "http://ldap.example.com" }, false},
+		{"unknown mapped role", func(config *LdapConfig) { config.GroupRoleMapping = map[string]string{"cn=owners": "owner"} }, false},
+		{"unknown default role", func(config *LdapConfig) { config.DefaultRole = "member" }, false},
+		{"role without priority", func(config *LdapConfig) { config.RolePriority = []string{"user"} }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := LdapConfig{
+				Name:             "corp",
+				URL:              "ldap://ldap.example.com",
+				GroupRoleMapping: map[string]string{"cn=admins": "admin"},
+			}
+			test.edit(&config)
+
+			if _, err := NewLdapProvider(config); (err == nil) != test.wantOk {
+				t.Fatalf("got %v, want ok=%v", err, test.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package directory
+
+import "errors"
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+type DirectoryUser struct {
+	Subject string
+	Email   string
+	Name    string
+	Role    string
+}
+
+// DirectoryProvider authenticates users against an external directory that
+// owns their passwords.
+type DirectoryProvider interface {
+	Name() string
+	Authenticate(email string, password string) (DirectoryUser, error)
+}
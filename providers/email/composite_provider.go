@@ -0,0 +1,172 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// circuitBreaker opens after threshold consecutive failures and lets a
+// single trial through once cooldown is over, the trial closes it again on
+// success and keeps it open for another cooldown on failure.
+type circuitBreaker struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+func (breaker *circuitBreaker) Allow() bool {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	if breaker.failures < breaker.threshold {
+		return true
+	}
+
+	if time.Now().Before(breaker.openUntil) {
+		return false
+	}
+
+	breaker.openUntil = time.Now().Add(breaker.cooldown)
+
+	return true
+}
+
+func (breaker *circuitBreaker) Success() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.failures = 0
+}
+
+func (breaker *circuitBreaker) Failure() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.failures++
+
+	if breaker.failures >= breaker.threshold {
+		breaker.openUntil = time.Now().Add(breaker.cooldown)
+	}
+}
+
+type compositeMember struct {
+	Name     string
+	Provider EmailProvider
+	breaker  *circuitBreaker
+}
+
+// CompositeEmailProvider tries the providers routed for the template in
+// priority order, skipping those whose circuit is open, and falls back to
+// the default order for templates without a route.
+type CompositeEmailProvider struct {
+	FailureThreshold int
+	Cooldown         time.Duration
+	Routes           map[string][]string
+	Default          []string
+	members          map[string]*compositeMember
+}
+
+func NewCompositeEmailProvider(failureThreshold int, cooldown time.Duration) *CompositeEmailProvider {
+	if failureThreshold <= 0 {
+		failureThreshold = 5
+	}
+
+	if cooldown <= 0 {
+		cooldown = time.Minute
+	}
+
+	return &CompositeEmailProvider{failureThreshold, cooldown, map[string][]string{}, []string{}, map[string]*compositeMember{}}
+}
+
+// Add registers a provider, those added without a route are tried in the
+// order they were added.
+func (provider *CompositeEmailProvider) Add(name string, member EmailProvider) {
+	provider.members[name] = &compositeMember{name, member, &circuitBreaker{threshold: provider.FailureThreshold, cooldown: provider.Cooldown}}
+	provider.Default = append(provider.Default, name)
+}
+
+func (provider *CompositeEmailProvider) known(names []string) error {
+	for _, name := range names {
+		if _, ok := provider.members[name]; !ok {
+			return fmt.Errorf("unknown email provider %s", name)
+		}
+	}
+
+	return nil
+}
+
+// Route sets the priority order for a template, names must have been added.
+func (provider *CompositeEmailProvider) Route(template string, names ...string) error {
+	if err := provider.known(names); err != nil {
+		return err
+	}
+
+	provider.Routes[template] = names
+
+	return nil
+}
+
+// SetDefault replaces the order of addition for templates without a route.
+func (provider *CompositeEmailProvider) SetDefault(names ...string) error {
+	if err := provider.known(names); err != nil {
+		return err
+	}
+
+	provider.Default = names
+
+	return nil
+}
+
+func (provider *CompositeEmailProvider) Name() string {
+	return "composite"
+}
+
+func (provider *CompositeEmailProvider) SendEmail(from string, name string, to string, template string, locale string, substitutions map[string]string) error {
+	_, err := provider.Deliver(from, name, to, template, locale, substitutions)
+
+	return err
+}
+
+// Deliver sends the email and reports which provider delivered it.
+func (provider *CompositeEmailProvider) Deliver(from string, name string, to string, template string, locale string, substitutions map[string]string) (string, error) {
+	order, ok := provider.Routes[template]
+
+	if !ok {
+		order = provider.Default
+	}
+
+	failures := []error{}
+
+	for _, memberName := range order {
+		member := provider.members[memberName]
+
+		if !member.breaker.Allow() {
+			failures = append(failures, fmt.Errorf("%s: circuit open", memberName))
+			continue
+		}
+
+		err := member.Provider.SendEmail(from, name, to, template, locale, substitutions)
+
+		if err == nil {
+			member.breaker.Success()
+			return member.Name, nil
+		}
+
+		// A provider lacking the template is misconfigured, not down.
+		if !errors.Is(err, ErrUnknownTemplate) {
+			member.breaker.Failure()
+		}
+
+		failures = append(failures, fmt.Errorf("%s: %w", memberName, err))
+	}
+
+	if len(failures) <= 0 {
+		return "", errors.New("no email provider routed for " + template)
+	}
+
+	return "", errors.Join(failures...)
+}
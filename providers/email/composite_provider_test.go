@@ -0,0 +1,150 @@
+package email
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var errUnavailable = errors.New("service unavailable")
+
+func newTestComposite(threshold int, primary error, secondary error) (*CompositeEmailProvider, *stubProvider, *stubProvider) {
+	composite := NewCompositeEmailProvider(threshold, time.Hour)
+
+	first := &stubProvider{name: "primary", err: primary}
+	second := &stubProvider{name: "secondary", err: secondary}
+
+	composite.Add("primary", first)
+	composite.Add("secondary", second)
+
+	return composite, first, second
+}
+
+func deliverReset(composite *CompositeEmailProvider) (string, error) {
+	return composite.Deliver("from@example.com", "Jane", "jane@example.com", "reset_password", "en", nil)
+}
+
+// endCooldown lets the breaker of the member half-open on its next use.
+func endCooldown(composite *CompositeEmailProvider, name string) {
+	composite.members[name].breaker.openUntil = time.Now().Add(-time.Second)
+}
+
+func TestCompositeDeliverFailsOverInOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		primary   error
+		secondary error
+		route     []string
+		want      string
+		wantCalls [2]int
+	}{
+		{"first provider delivers", nil, nil, nil, "primary", [2]int{1, 0}},
+		{"fails over to the next", errUnavailable, nil, nil, "secondary", [2]int{1, 1}},
+		{"route overrides the order", nil, nil, []string{"secondary", "primary"}, "secondary", [2]int{0, 1}},
+		{"route fails over too", nil, errUnavailable, []string{"secondary", "primary"}, "primary", [2]int{1, 1}},
+		{"missing template fails over", ErrUnknownTemplate, nil, nil, "secondary", [2]int{1, 1}},
+		{"all fail", errUnavailable, errUnavailable, nil, "", [2]int{1, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			composite, primary, secondary := newTestComposite(5, test.primary, test.secondary)
+
+			if test.route != nil {
+				if err := composite.Route("reset_password", test.route...); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			delivered, err := deliverReset(composite)
+
+			if delivered != test.want || (err == nil) != (len(test.want) > 0) {
+				t.Fatalf("got %q, %v, want %q", delivered, err, test.want)
+			}
+
+			if calls := [2]int{primary.calls(), secondary.calls()}; calls != test.wantCalls {
+				t.Fatalf("got calls %v, want %v", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCompositeCircuitBreaker(t *testing.T) {
+	composite, primary, secondary := newTestComposite(3, errUnavailable, nil)
+
+	steps := []struct {
+		name        string
+		cooldown    bool
+		recover     bool
+		want        string
+		wantPrimary int
+	}{
+		{"first failure", false, false, "secondary", 1},
+		{"second failure", false, false, "secondary", 2},
+		{"third failure opens", false, false, "secondary", 3},
+		{"open circuit is skipped", false, false, "secondary", 3},
+		{"one trial after cooldown", true, false, "secondary", 4},
+		{"failed trial keeps it open", false, false, "secondary", 4},
+		{"recovered trial closes it", true, true, "primary", 5},
+		{"closed circuit is used", false, false, "primary", 6},
+	}
+
+	for _, step := range steps {
+		if step.cooldown {
+			endCooldown(composite, "primary")
+		}
+
+		if step.recover {
+			primary.err = nil
+		}
+
+		delivered, err := deliverReset(composite)
+
+		if err != nil || delivered != step.want {
+			t.Fatalf("%s: got %q, %v, want %q", step.name, delivered, err, step.want)
+		}
+
+		if calls := primary.calls(); calls != step.wantPrimary {
+			t.Fatalf("%s: primary called %d times, want %d", step.name, calls, step.wantPrimary)
+		}
+	}
+
+	if calls := secondary.calls(); calls != 6 {
+		t.Fatalf("secondary called %d times, want 6", calls)
+	}
+}
+
+// Concurrent sends after the cooldown must not all hit a provider that may
+// still be down.
+func TestCircuitBreakerAllowsOneHalfOpenTrial(t *testing.T) {
+	breaker := &circuitBreaker{threshold: 1, cooldown: time.Hour}
+	breaker.Failure()
+
+	if breaker.Allow() {
+		t.Fatal("open breaker allowed a send")
+	}
+
+	breaker.openUntil = time.Now().Add(-time.Second)
+
+	if !breaker.Allow() {
+		t.Fatal("breaker allowed no trial after the cooldown")
+	}
+
+	if breaker.Allow() {
+		t.Fatal("breaker allowed a second trial")
+	}
+}
+
+func TestCompositeUnknownTemplateIsNotAFailure(t *testing.T) {
+	composite, primary, _ := newTestComposite(1, ErrUnknownTemplate, nil)
+
+	for i := 0; i < 3; i++ {
+		if delivered, err := deliverReset(composite); err != nil || delivered != "secondary" {
+			t.Fatalf("got %q, %v", delivered, err)
+		}
+	}
+
+	if calls := primary.calls(); calls != 3 {
+		t.Fatalf("primary called %d times, want 3: its circuit opened", calls)
+	}
+}
@@ -0,0 +1,161 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers covered by the signature, in signing order.
+var dkimSignedHeaders = []string{"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type"}
+
+// DkimSigner signs outgoing messages following RFC 6376 with rsa-sha256 and
+// relaxed/relaxed canonicalization.
+type DkimSigner struct {
+	Domain     string
+	Selector   string
+	PrivateKey *rsa.PrivateKey
+}
+
+func NewDkimSigner(domain string, selector string, privateKeyFile string) (*DkimSigner, error) {
+	data, err := os.ReadFile(privateKeyFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+
+	if block == nil {
+		return nil, errors.New("dkim private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return &DkimSigner{domain, selector, key}, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+
+	if !ok {
+		return nil, errors.New("dkim private key must be an RSA key")
+	}
+
+	return &DkimSigner{domain, selector, key}, nil
+}
+
+// Sign returns the DKIM-Signature header line, CRLF terminated, to prepend to
+// a message made of CRLF separated headers and body.
+func (signer DkimSigner) Sign(message []byte) (string, error) {
+	separator := bytes.Index(message, []byte("\r\n\r\n"))
+
+	if separator < 0 {
+		return "", errors.New("message has no body")
+	}
+
+	headers := parseHeaders(string(message[:separator+2]))
+	bodyHash := sha256.Sum256(relaxedBody(message[separator+4:]))
+
+	signed := []string{}
+	hash := sha256.New()
+
+	for _, name := range dkimSignedHeaders {
+		value, ok := headers[strings.ToLower(name)]
+
+		if !ok {
+			continue
+		}
+
+		signed = append(signed, name)
+		hash.Write([]byte(relaxedHeader(name, value) + "\r\n"))
+	}
+
+	signature := "v=1; a=rsa-sha256; c=relaxed/relaxed; d=" + signer.Domain +
+		"; s=" + signer.Selector +
+		"; t=" + strconv.FormatInt(time.Now().Unix(), 10) +
+		"; h=" + strings.Join(signed, ":") +
+		"; bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) +
+		"; b="
+
+	hash.Write([]byte(relaxedHeader("DKIM-Signature", signature)))
+
+	b, err := rsa.SignPKCS1v15(rand.Reader, signer.PrivateKey, crypto.SHA256, hash.Sum(nil))
+
+	if err != nil {
+		return "", err
+	}
+
+	return "DKIM-Signature: " + signature + base64.StdEncoding.EncodeToString(b) + "\r\n", nil
+}
+
+// parseHeaders keeps the last occurrence of every header, which is the one
+// verifiers pick first.
+func parseHeaders(header string) map[string]string {
+	headers := map[string]string{}
+	lines := strings.Split(strings.TrimSuffix(header, "\r\n"), "\r\n")
+
+	for i := 0; i < len(lines); i++ {
+		name, value, ok := strings.Cut(lines[i], ":")
+
+		if !ok {
+			continue
+		}
+
+		for i+1 < len(lines) && len(lines[i+1]) > 0 && (lines[i+1][0] == ' ' || lines[i+1][0] == '\t') {
+			i++
+			value += "\r\n" + lines[i]
+		}
+
+		headers[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+
+	return headers
+}
+
+func collapseWhitespace(value string) string {
+	return strings.Join(strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == '\t' }), " ")
+}
+
+func relaxedHeader(name string, value string) string {
+	value = strings.NewReplacer("\r\n", "", "\n", "").Replace(value)
+
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + collapseWhitespace(value)
+}
+
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, " \t")
+		lines[i] = collapseWhitespace(trimmed)
+
+		if len(trimmed) > 0 && (trimmed[0] == ' ' || trimmed[0] == '\t') {
+			lines[i] = " " + lines[i]
+		}
+	}
+
+	for len(lines) > 0 && len(lines[len(lines)-1]) <= 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) <= 0 {
+		return []byte{}
+	}
+
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
@@ -0,0 +1,202 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var signatureValue = regexp.MustCompile(`(^|;)(\s*b=)[^;]*`)
+
+// verifyDkim checks the DKIM-Signature of the message the way a receiving
+// server does, against the public key published for the selector.
+func verifyDkim(message []byte, domain string, selector string, publicKey *rsa.PublicKey) error {
+	separator := bytes.Index(message, []byte("\r\n\r\n"))
+
+	if separator < 0 {
+		return errors.New("message has no body")
+	}
+
+	headers := parseHeaders(string(message[:separator+2]))
+	signature, ok := headers["dkim-signature"]
+
+	if !ok {
+		return errors.New("message is not signed")
+	}
+
+	tags := map[string]string{}
+
+	for _, tag := range strings.Split(signature, ";") {
+		name, value, _ := strings.Cut(tag, "=")
+		tags[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+
+	if tags["v"] != "1" || tags["a"] != "rsa-sha256" || tags["c"] != "relaxed/relaxed" {
+		return errors.New("unexpected signature parameters")
+	}
+
+	if tags["d"] != domain || tags["s"] != selector {
+		return errors.New("signature is for another domain or selector")
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(message[separator+4:]))
+
+	if tags["bh"] != base64.StdEncoding.EncodeToString(bodyHash[:]) {
+		return errors.New("body hash does not match")
+	}
+
+	hash := sha256.New()
+
+	for _, name := range strings.Split(tags["h"], ":") {
+		value, ok := headers[strings.ToLower(name)]
+
+		if !ok {
+			return errors.New("signed header " + name + " is missing")
+		}
+
+		hash.Write([]byte(relaxedHeader(name, value) + "\r\n"))
+	}
+
+	hash.Write([]byte(relaxedHeader("DKIM-Signature", signatureValue.ReplaceAllString(signature, "$1$2"))))
+
+	b, err := base64.StdEncoding.DecodeString(tags["b"])
+
+	if err != nil {
+		return err
+	}
+
+	return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash.Sum(nil), b)
+}
+
+// writeDkimKey stores a new key the way NewDkimSigner reads it and returns
+// its path.
+func writeDkimKey(t *testing.T, pkcs8 bool) (string, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+
+	if pkcs8 {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	file := filepath.Join(t.TempDir(), "dkim.pem")
+
+	if err := os.WriteFile(file, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file, key
+}
+
+// The example of RFC 6376 section 3.4.5.
+func TestRelaxedCanonicalization(t *testing.T) {
+	headers := parseHeaders("A: X\r\nB : Y\t\r\n\tZ  \r\n")
+
+	if got := relaxedHeader("A", headers["a"]) + "\r\n" + relaxedHeader("B", headers["b"]) + "\r\n"; got != "a:X\r\nb:Y Z\r\n" {
+		t.Fatalf("headers: got %q", got)
+	}
+
+	if got := string(relaxedBody([]byte(" C \r\nD \t E\r\n\r\n\r\n"))); got != " C\r\nD E\r\n" {
+		t.Fatalf("body: got %q", got)
+	}
+
+	if got := string(relaxedBody([]byte("\r\n\r\n"))); got != "" {
+		t.Fatalf("empty body: got %q", got)
+	}
+}
+
+func TestDkimSignatureVerifies(t *testing.T) {
+	for _, pkcs8 := range []bool{false, true} {
+		file, key := writeDkimKey(t, pkcs8)
+
+		signer, err := NewDkimSigner("example.com", "mail", file)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rendered, err := RenderTemplate(ConfirmEmailTemplate, "en", map[string]string{"name": "Jane", "token": "token", "link": "https://example.com/confirm_email?token=token"})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		message, err := buildMessage("noreply@example.com", mail.Address{Name: "Jane", Address: "jane@example.com"}, rendered)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signature, err := signer.Sign(message)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signed := append([]byte(signature), message...)
+
+		if err := verifyDkim(signed, "example.com", "mail", &key.PublicKey); err != nil {
+			t.Fatalf("pkcs8 %v: %v", pkcs8, err)
+		}
+
+		other, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+		if verifyDkim(signed, "example.com", "mail", &other.PublicKey) == nil {
+			t.Fatal("verified against another key")
+		}
+
+		tampered := bytes.Replace(signed, []byte("To: "), []byte("To: attacker@example.net, "), 1)
+
+		if verifyDkim(tampered, "example.com", "mail", &key.PublicKey) == nil {
+			t.Fatal("verified with a changed header")
+		}
+
+		tampered = append(append([]byte{}, signed...), []byte("appended\r\n")...)
+
+		if verifyDkim(tampered, "example.com", "mail", &key.PublicKey) == nil {
+			t.Fatal("verified with a changed body")
+		}
+
+		// Relaxed canonicalization survives relays that rewrap whitespace.
+		rewrapped := bytes.Replace(signed, []byte("MIME-Version: 1.0"), []byte("MIME-Version:   1.0 "), 1)
+
+		if err := verifyDkim(rewrapped, "example.com", "mail", &key.PublicKey); err != nil {
+			t.Fatalf("relaxed header: %v", err)
+		}
+	}
+}
+
+func TestNewDkimSignerRejectsInvalidKeys(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dkim.pem")
+	os.WriteFile(file, []byte("not a key"), 0600)
+
+	if _, err := NewDkimSigner("example.com", "mail", file); err == nil {
+		t.Fatal("accepted a file without a PEM block")
+	}
+
+	if _, err := NewDkimSigner("example.com", "mail", filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Fatal("accepted a missing file")
+	}
+}
@@ -0,0 +1,144 @@
+package email
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// mailboxCapacity bounds the captured messages, the oldest are dropped first.
+const mailboxCapacity = 500
+
+var (
+	linkRegexp = regexp.MustCompile(`https?://[^\s"'<>]+`)
+	codeRegexp = regexp.MustCompile(`(?m)^\s*([0-9]{6})\s*$`)
+)
+
+// CapturedEmail is a rendered email kept by the mailbox, with the links, the
+// token query parameters of those links and the one-time codes it contains.
+type CapturedEmail struct {
+	ID        string    `json:"id"`
+	From      string    `json:"from"`
+	Name      string    `json:"name"`
+	To        string    `json:"to"`
+	Template  string    `json:"template"`
+	Locale    string    `json:"locale"`
+	Subject   string    `json:"subject"`
+	Text      string    `json:"text"`
+	Html      string    `json:"html"`
+	Links     []string  `json:"links"`
+	Tokens    []string  `json:"tokens"`
+	Codes     []string  `json:"codes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MailboxEmailProvider keeps every email in memory instead of sending it, so
+// local development and integration tests can read the tokens back. It is
+// meant for development only.
+type MailboxEmailProvider struct {
+	mutex  sync.RWMutex
+	emails []CapturedEmail
+}
+
+func NewMailboxEmailProvider() *MailboxEmailProvider {
+	return &MailboxEmailProvider{emails: []CapturedEmail{}}
+}
+
+func (provider *MailboxEmailProvider) Name() string {
+	return "mailbox"
+}
+
+func (provider *MailboxEmailProvider) SendEmail(from string, name string, to string, template string, locale string, substitutions map[string]string) error {
+	rendered, err := RenderTemplate(template, locale, substitutions)
+
+	if err != nil {
+		return err
+	}
+
+	captured := CapturedEmail{
+		ID:        uuid.New().String(),
+		From:      from,
+		Name:      name,
+		To:        to,
+		Template:  template,
+		Locale:    locale,
+		Subject:   rendered.Subject,
+		Text:      rendered.Text,
+		Html:      rendered.Html,
+		Links:     linkRegexp.FindAllString(rendered.Text, -1),
+		Tokens:    []string{},
+		Codes:     []string{},
+		CreatedAt: time.Now(),
+	}
+
+	for _, link := range captured.Links {
+		if parsed, err := url.Parse(link); err == nil && parsed.Query().Has("token") {
+			captured.Tokens = append(captured.Tokens, parsed.Query().Get("token"))
+		}
+	}
+
+	for _, match := range codeRegexp.FindAllStringSubmatch(rendered.Text, -1) {
+		captured.Codes = append(captured.Codes, match[1])
+	}
+
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	provider.emails = append(provider.emails, captured)
+
+	if len(provider.emails) > mailboxCapacity {
+		provider.emails = provider.emails[len(provider.emails)-mailboxCapacity:]
+	}
+
+	return nil
+}
+
+// Emails lists the captured emails newest first, only those sent to the
+// address when one is given.
+func (provider *MailboxEmailProvider) Emails(to string) []CapturedEmail {
+	provider.mutex.RLock()
+	defer provider.mutex.RUnlock()
+
+	emails := []CapturedEmail{}
+
+	for i := len(provider.emails) - 1; i >= 0; i-- {
+		if len(to) <= 0 || strings.EqualFold(provider.emails[i].To, to) {
+			emails = append(emails, provider.emails[i])
+		}
+	}
+
+	return emails
+}
+
+func (provider *MailboxEmailProvider) Email(id string) (CapturedEmail, bool) {
+	provider.mutex.RLock()
+	defer provider.mutex.RUnlock()
+
+	for _, captured := range provider.emails {
+		if captured.ID == id {
+			return captured, true
+		}
+	}
+
+	return CapturedEmail{}, false
+}
+
+// Clear drops the emails sent to the address, or all of them.
+func (provider *MailboxEmailProvider) Clear(to string) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	emails := []CapturedEmail{}
+
+	for _, captured := range provider.emails {
+		if len(to) > 0 && !strings.EqualFold(captured.To, to) {
+			emails = append(emails, captured)
+		}
+	}
+
+	provider.emails = emails
+}
@@ -0,0 +1,131 @@
+package email
+
+import (
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Message is a typed email, it knows its template and hands providers every
+// value the template may use.
+type Message interface {
+	Template() string
+	Substitutions() map[string]string
+}
+
+// PublicLink points at a page of the frontend configured in PUBLIC_BASE_URL,
+// which reads the token from the query and calls the API.
+func PublicLink(path string, query url.Values) string {
+	link := strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/") + path
+
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+
+	return link
+}
+
+type ConfirmEmail struct {
+	Name  string
+	Token string
+}
+
+func (message ConfirmEmail) Template() string {
+	return ConfirmEmailTemplate
+}
+
+func (message ConfirmEmail) Substitutions() map[string]string {
+	return map[string]string{
+		"name":  message.Name,
+		"token": message.Token,
+		"link":  PublicLink("/confirm_email", url.Values{"token": {message.Token}}),
+	}
+}
+
+type ResetPassword struct {
+	Name  string
+	Token string
+}
+
+func (message ResetPassword) Template() string {
+	return ResetPasswordTemplate
+}
+
+func (message ResetPassword) Substitutions() map[string]string {
+	return map[string]string{
+		"name":  message.Name,
+		"token": message.Token,
+		"link":  PublicLink("/reset_password", url.Values{"token": {message.Token}}),
+	}
+}
+
+// PasswordChanged warns the owner, Link leads to asking for a new reset in
+// case they were not the one changing it.
+type PasswordChanged struct {
+	Name string
+}
+
+func (message PasswordChanged) Template() string {
+	return PasswordChangedTemplate
+}
+
+func (message PasswordChanged) Substitutions() map[string]string {
+	return map[string]string{
+		"name": message.Name,
+		"link": PublicLink("/forgot_password", nil),
+	}
+}
+
+type PasswordlessCode struct {
+	Name string
+	Code string
+}
+
+func (message PasswordlessCode) Template() string {
+	return PasswordlessCodeTemplate
+}
+
+func (message PasswordlessCode) Substitutions() map[string]string {
+	return map[string]string{
+		"name": message.Name,
+		"code": message.Code,
+	}
+}
+
+type PasswordlessLink struct {
+	Name  string
+	Email string
+	Token string
+}
+
+func (message PasswordlessLink) Template() string {
+	return PasswordlessLinkTemplate
+}
+
+func (message PasswordlessLink) Substitutions() map[string]string {
+	return map[string]string{
+		"name":  message.Name,
+		"token": message.Token,
+		"link":  PublicLink("/passwordless", url.Values{"email": {message.Email}, "token": {message.Token}}),
+	}
+}
+
+// Invitation leaves Organization empty for invitations to the platform.
+type Invitation struct {
+	InviterName  string
+	Organization string
+	Token        string
+}
+
+func (message Invitation) Template() string {
+	return InvitationTemplate
+}
+
+func (message Invitation) Substitutions() map[string]string {
+	return map[string]string{
+		"name":         message.InviterName,
+		"organization": message.Organization,
+		"token":        message.Token,
+		"link":         PublicLink("/invitations/accept", url.Values{"token": {message.Token}}),
+	}
+}
@@ -0,0 +1,109 @@
+package email
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMessageSubstitutions(t *testing.T) {
+	t.Setenv("PUBLIC_BASE_URL", "https://app.example.com/")
+
+	tests := []struct {
+		name     string
+		message  Message
+		template string
+		want     map[string]string
+	}{
+		{
+			"confirm email",
+			ConfirmEmail{Name: "Jane", Token: "abc"},
+			ConfirmEmailTemplate,
+			map[string]string{"name": "Jane", "token": "abc", "link": "https://app.example.com/confirm_email?token=abc"},
+		},
+		{
+			"reset password",
+			ResetPassword{Name: "Jane", Token: "abc"},
+			ResetPasswordTemplate,
+			map[string]string{"name": "Jane", "token": "abc", "link": "https://app.example.com/reset_password?token=abc"},
+		},
+		{
+			"password changed",
+			PasswordChanged{Name: "Jane"},
+			PasswordChangedTemplate,
+			map[string]string{"name": "Jane", "link": "https://app.example.com/forgot_password"},
+		},
+		{
+			"passwordless code",
+			PasswordlessCode{Name: "Jane", Code: "123456"},
+			PasswordlessCodeTemplate,
+			map[string]string{"name": "Jane", "code": "123456"},
+		},
+		{
+			"passwordless link escapes the email",
+			PasswordlessLink{Name: "Jane", Email: "jane+work@example.com", Token: "abc"},
+			PasswordlessLinkTemplate,
+			map[string]string{"name": "Jane", "token": "abc", "link": "https://app.example.com/passwordless?email=jane%2Bwork%40example.com&token=abc"},
+		},
+		{
+			"invitation to an organization",
+			Invitation{InviterName: "Jane", Organization: "Acme", Token: "abc"},
+			InvitationTemplate,
+			map[string]string{"name": "Jane", "organization": "Acme", "token": "abc", "link": "https://app.example.com/invitations/accept?token=abc"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if template := test.message.Template(); template != test.template {
+				t.Fatalf("got template %q, want %q", template, test.template)
+			}
+
+			if substitutions := test.message.Substitutions(); !reflect.DeepEqual(substitutions, test.want) {
+				t.Fatalf("got substitutions %v, want %v", substitutions, test.want)
+			}
+		})
+	}
+}
+
+// Every message must have templates, and the templates must show what the
+// message is for: the link, the code or the organization.
+func TestMessagesRender(t *testing.T) {
+	t.Setenv("PUBLIC_BASE_URL", "https://app.example.com")
+
+	tests := []struct {
+		message Message
+		want    string
+	}{
+		{ConfirmEmail{Name: "Jane", Token: "abc"}, "https://app.example.com/confirm_email?token=abc"},
+		{ResetPassword{Name: "Jane", Token: "abc"}, "https://app.example.com/reset_password?token=abc"},
+		{PasswordChanged{Name: "Jane"}, "https://app.example.com/forgot_password"},
+		{PasswordlessCode{Name: "Jane", Code: "123456"}, "123456"},
+		{PasswordlessLink{Name: "Jane", Email: "jane@example.com", Token: "abc"}, "https://app.example.com/passwordless?email=jane%40example.com&token=abc"},
+		{Invitation{InviterName: "Jane", Organization: "Acme", Token: "abc"}, "Acme"},
+	}
+
+	for _, test := range tests {
+		for _, locale := range []string{"en", "es", "pt-BR"} {
+			t.Run(test.message.Template()+"/"+locale, func(t *testing.T) {
+				rendered, err := RenderTemplate(test.message.Template(), locale, test.message.Substitutions())
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(strings.TrimSpace(rendered.Subject)) <= 0 {
+					t.Fatal("empty subject")
+				}
+
+				if !strings.Contains(rendered.Text, test.want) {
+					t.Fatalf("text is missing %q:\n%s", test.want, rendered.Text)
+				}
+
+				if !strings.Contains(rendered.Html, "Jane") {
+					t.Fatalf("html is missing the name:\n%s", rendered.Html)
+				}
+			})
+		}
+	}
+}
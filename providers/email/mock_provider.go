@@ -11,10 +11,21 @@ func NewMockEmailProvider() *MockEmailProvider {
 	return &MockEmailProvider{}
 }
 
-func (provider *MockEmailProvider) SendEmail(from string, name string, to string, templateId string, substitutions map[string]string) error {
+func (provider *MockEmailProvider) Name() string {
+	return "mock"
+}
+
+// SendEmail renders the template anyway so broken templates show up without
+// a real provider configured.
+func (provider *MockEmailProvider) SendEmail(from string, name string, to string, template string, locale string, substitutions map[string]string) error {
+	rendered, err := RenderTemplate(template, locale, substitutions)
+
+	if err != nil {
+		return err
+	}
 
 	log.Println(
-		"Send email from ", from, " to ", fmt.Sprintf("%s | %s", name, to), " with template ", templateId,
+		"Send email from ", from, " to ", fmt.Sprintf("%s | %s", name, to), " with template ", template, " (", locale, "): ", rendered.Subject,
 	)
 
 	return nil
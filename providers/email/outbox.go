@@ -0,0 +1,128 @@
+package email
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+// Outbox stores emails in the same transaction as the change that triggers
+// them and delivers them in the background through Provider, retrying with
+// backoff until the message is sent or dead-lettered. Delivery is at least
+// once: a dispatcher that dies after sending but before recording it resends
+// the message when its lease runs out.
+type Outbox struct {
+	From         string
+	Repository   models.OutboxEmailRepository
+	Provider     EmailProvider
+	BatchSize    int
+	PollInterval time.Duration
+	Lease        time.Duration
+	wake         chan struct{}
+}
+
+func NewOutbox(repository models.OutboxEmailRepository, provider EmailProvider, from string) *Outbox {
+	if len(from) <= 0 {
+		from = "no-reply@go-auth.com"
+	}
+
+	return &Outbox{
+		From:         from,
+		Repository:   repository,
+		Provider:     provider,
+		BatchSize:    20,
+		PollInterval: 5 * time.Second,
+		Lease:        2 * time.Minute,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Enqueue stores the message for the recipient in their locale, when called
+// with a transaction the caller must Notify once it commits so the message
+// goes out right away. Enqueueing an idempotency key again is a no-op.
+func (outbox *Outbox) Enqueue(idempotencyKey string, name string, to string, locale string, message Message, transaction *sql.Tx) error {
+	email := models.NewOutboxEmail(idempotencyKey, outbox.From, name, to, locale, message.Template(), message.Substitutions())
+
+	_, err := outbox.Repository.CreateOutboxEmail(email, transaction)
+
+	if err != nil {
+		return err
+	}
+
+	if transaction == nil {
+		outbox.Notify()
+	}
+
+	return nil
+}
+
+// Notify wakes the dispatcher up before its next poll.
+func (outbox *Outbox) Notify() {
+	select {
+	case outbox.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run dispatches due emails until the context is cancelled.
+func (outbox *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(outbox.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// A full batch means more may be due already.
+		if outbox.Dispatch() >= outbox.BatchSize && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-outbox.wake:
+		}
+	}
+}
+
+func (outbox *Outbox) deliver(email *models.OutboxEmail) (string, error) {
+	if router, ok := outbox.Provider.(RoutingEmailProvider); ok {
+		return router.Deliver(email.From, email.Name, email.To, email.Template, email.Locale, email.Substitutions)
+	}
+
+	return outbox.Provider.Name(), outbox.Provider.SendEmail(email.From, email.Name, email.To, email.Template, email.Locale, email.Substitutions)
+}
+
+// Dispatch sends one batch of due emails and returns how many it claimed.
+func (outbox *Outbox) Dispatch() int {
+	emails, err := outbox.Repository.ClaimOutboxEmails(outbox.BatchSize, outbox.Lease)
+
+	if err != nil {
+		log.Println(err)
+		return 0
+	}
+
+	for i := range emails {
+		email := &emails[i]
+
+		provider, err := outbox.deliver(email)
+
+		if errors.Is(err, ErrSuppressed) {
+			email.MarkSuppressed(err)
+		} else if err != nil {
+			log.Println("Email ", email.ID.String(), " attempt ", email.Attempts, " failed: ", err)
+			email.MarkFailed(err)
+		} else {
+			email.MarkSent(provider)
+		}
+
+		if _, err = outbox.Repository.UpdateOutboxEmail(email, nil); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return len(emails)
+}
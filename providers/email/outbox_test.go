@@ -0,0 +1,207 @@
+package email
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+	"github.com/thiagoferolla/go-auth/repositories/memory"
+)
+
+// stubProvider answers every send with err and records who it was sent to.
+type stubProvider struct {
+	name  string
+	err   error
+	mutex sync.Mutex
+	sent  []string
+}
+
+func (provider *stubProvider) Name() string {
+	return provider.name
+}
+
+func (provider *stubProvider) SendEmail(from string, name string, to string, template string, locale string, substitutions map[string]string) error {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	provider.sent = append(provider.sent, to)
+
+	return provider.err
+}
+
+func (provider *stubProvider) calls() int {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	return len(provider.sent)
+}
+
+func newTestOutbox(provider EmailProvider) (*Outbox, *memory.OutboxEmailRepository) {
+	repository := memory.NewOutboxEmailRepository()
+	outbox := NewOutbox(repository, provider, "")
+
+	return outbox, repository
+}
+
+func enqueueReset(t *testing.T, outbox *Outbox, key string) models.OutboxEmail {
+	err := outbox.Enqueue(key, "Jane", "jane@example.com", "en", ResetPassword{Name: "Jane", Token: "secret-token"}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emails, _ := outbox.Repository.GetOutboxEmailsByStatus(models.OutboxPending)
+
+	return emails[len(emails)-1]
+}
+
+func TestDispatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		status      string
+		keepContent bool
+	}{
+		{"sent", nil, models.OutboxSent, false},
+		{"suppressed", ErrSuppressed, models.OutboxSuppressed, false},
+		{"failed", errors.New("connection refused"), models.OutboxPending, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := &stubProvider{name: "stub", err: test.err}
+			outbox, repository := newTestOutbox(provider)
+			queued := enqueueReset(t, outbox, "reset:jane")
+
+			if claimed := outbox.Dispatch(); claimed != 1 {
+				t.Fatalf("claimed %d emails, want 1", claimed)
+			}
+
+			email, _ := repository.GetOutboxEmailByID(queued.ID.String())
+
+			if email.Status != test.status || email.Attempts != 1 {
+				t.Fatalf("got status %q after %d attempts, want %q after 1", email.Status, email.Attempts, test.status)
+			}
+
+			if email.HasContent() != test.keepContent {
+				t.Fatalf("substitutions: got %v", email.Substitutions)
+			}
+
+			if test.status == models.OutboxSent && email.Provider.String != "stub" {
+				t.Fatalf("provider: got %q", email.Provider.String)
+			}
+		})
+	}
+}
+
+func TestEnqueueIsIdempotent(t *testing.T) {
+	provider := &stubProvider{name: "stub"}
+	outbox, repository := newTestOutbox(provider)
+
+	enqueueReset(t, outbox, "reset:jane")
+	enqueueReset(t, outbox, "reset:jane")
+
+	if emails, _ := repository.GetOutboxEmailsByStatus(models.OutboxPending); len(emails) != 1 {
+		t.Fatalf("got %d pending emails, want 1", len(emails))
+	}
+
+	outbox.Dispatch()
+	outbox.Dispatch()
+
+	if calls := provider.calls(); calls != 1 {
+		t.Fatalf("sent %d times, want 1", calls)
+	}
+}
+
+// A claimed message is not handed out again until its lease runs out, which
+// is how the message of a dispatcher that died mid-send gets resent.
+func TestClaimOutboxEmailsLeases(t *testing.T) {
+	outbox, repository := newTestOutbox(&stubProvider{name: "stub"})
+	enqueueReset(t, outbox, "reset:jane")
+
+	claimed, _ := repository.ClaimOutboxEmails(10, time.Hour)
+
+	if len(claimed) != 1 || claimed[0].Attempts != 1 {
+		t.Fatalf("first claim: got %d emails", len(claimed))
+	}
+
+	if again, _ := repository.ClaimOutboxEmails(10, time.Hour); len(again) != 0 {
+		t.Fatalf("claimed a leased email again")
+	}
+
+	expired := claimed[0]
+	expired.NextAttemptAt = time.Now()
+	repository.UpdateOutboxEmail(&expired, nil)
+
+	reclaimed, _ := repository.ClaimOutboxEmails(10, time.Hour)
+
+	if len(reclaimed) != 1 || reclaimed[0].Attempts != 2 {
+		t.Fatalf("after the lease: got %d emails", len(reclaimed))
+	}
+}
+
+func TestMarkFailedBacksOff(t *testing.T) {
+	// The delay doubles from 30 seconds, with up to a quarter more of jitter.
+	tests := []struct {
+		attempts int
+		min      time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{5, 8 * time.Minute},
+		{9, 128 * time.Minute},
+	}
+
+	for _, test := range tests {
+		email := models.NewOutboxEmail("key", "from@example.com", "Jane", "jane@example.com", "en", "reset_password", map[string]string{"token": "secret"})
+		email.Attempts = test.attempts
+
+		before := time.Now()
+		email.MarkFailed(errors.New("timeout"))
+		backoff := email.NextAttemptAt.Sub(before)
+
+		if email.Status != models.OutboxPending || !email.HasContent() {
+			t.Fatalf("attempt %d: got status %q", test.attempts, email.Status)
+		}
+
+		if max := test.min + test.min/4 + time.Second; backoff < test.min || backoff > max {
+			t.Errorf("attempt %d: got backoff %s, want between %s and %s", test.attempts, backoff, test.min, max)
+		}
+	}
+}
+
+func TestMarkFailedDeadLettersAfterMaxAttempts(t *testing.T) {
+	provider := &stubProvider{name: "stub", err: errors.New("mailbox unavailable")}
+	outbox, repository := newTestOutbox(provider)
+	queued := enqueueReset(t, outbox, "reset:jane")
+
+	for attempt := 1; attempt <= models.OutboxMaxAttempts; attempt++ {
+		email, _ := repository.GetOutboxEmailByID(queued.ID.String())
+
+		if email.Status != models.OutboxPending {
+			t.Fatalf("attempt %d: got status %q", attempt, email.Status)
+		}
+
+		// Skip the backoff.
+		email.NextAttemptAt = time.Now()
+		repository.UpdateOutboxEmail(&email, nil)
+
+		outbox.Dispatch()
+	}
+
+	email, _ := repository.GetOutboxEmailByID(queued.ID.String())
+
+	if email.Status != models.OutboxDead || email.Attempts != models.OutboxMaxAttempts {
+		t.Fatalf("got status %q after %d attempts", email.Status, email.Attempts)
+	}
+
+	if email.HasContent() {
+		t.Fatal("dead-lettered email kept its substitutions")
+	}
+
+	if claimed := outbox.Dispatch(); claimed != 0 || provider.calls() != models.OutboxMaxAttempts {
+		t.Fatalf("dead-lettered email was sent again")
+	}
+}
@@ -1,5 +1,19 @@
 package email
 
+import "errors"
+
+var ErrUnknownTemplate = errors.New("unknown email template")
+
 type EmailProvider interface {
-	SendEmail(from string, name string, to string, templateId string, substitutions map[string]string) error
+	Name() string
+	// SendEmail delivers the template in the recipient's locale, providers fall
+	// back along i18n.Fallbacks when they lack a translation.
+	SendEmail(from string, name string, to string, template string, locale string, substitutions map[string]string) error
+}
+
+// RoutingEmailProvider delegates to other providers and reports the name of
+// the one that delivered the message.
+type RoutingEmailProvider interface {
+	EmailProvider
+	Deliver(from string, name string, to string, template string, locale string, substitutions map[string]string) (string, error)
 }
@@ -0,0 +1,83 @@
+package email
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// RoutedProviderConfig declares one member of the composite provider, Smtp is
+// read for the smtp type and SendgridApiKey for sendgrid, which shares the
+// template ids configured through the environment.
+type RoutedProviderConfig struct {
+	Name           string     `json:"name"`
+	Type           string     `json:"type"`
+	Smtp           SmtpConfig `json:"smtp"`
+	SendgridApiKey string     `json:"sendgrid_api_key"`
+}
+
+// RoutingConfig lists the providers by priority. Routes overrides that order
+// per template, Default replaces it for the remaining templates.
+type RoutingConfig struct {
+	Providers        []RoutedProviderConfig `json:"providers"`
+	Routes           map[string][]string    `json:"routes"`
+	Default          []string               `json:"default"`
+	FailureThreshold int                    `json:"failure_threshold"`
+	CooldownSeconds  int                    `json:"cooldown_seconds"`
+}
+
+func LoadRoutingConfig(path string) (RoutingConfig, error) {
+	config := RoutingConfig{}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return config, err
+	}
+
+	err = json.Unmarshal([]byte(os.ExpandEnv(string(data))), &config)
+
+	return config, err
+}
+
+func NewCompositeEmailProviderFromConfig(config RoutingConfig) (*CompositeEmailProvider, error) {
+	composite := NewCompositeEmailProvider(config.FailureThreshold, time.Duration(config.CooldownSeconds)*time.Second)
+
+	for _, member := range config.Providers {
+		if _, ok := composite.members[member.Name]; ok || len(member.Name) <= 0 {
+			return composite, fmt.Errorf("email provider %q: name must be unique", member.Name)
+		}
+
+		switch member.Type {
+		case "smtp":
+			provider, err := NewSmtpProvider(member.Smtp)
+
+			if err != nil {
+				return composite, err
+			}
+
+			composite.Add(member.Name, provider)
+		case "sendgrid":
+			composite.Add(member.Name, NewSendgridEmailProvider(member.SendgridApiKey, SendgridTemplateIDsFromEnv()))
+		case "mock":
+			composite.Add(member.Name, NewMockEmailProvider())
+		default:
+			return composite, fmt.Errorf("email provider %s: unknown type %s", member.Name, member.Type)
+		}
+	}
+
+	for template, names := range config.Routes {
+		if err := composite.Route(template, names...); err != nil {
+			return composite, err
+		}
+	}
+
+	if len(config.Default) > 0 {
+		if err := composite.SetDefault(config.Default...); err != nil {
+			return composite, err
+		}
+	}
+
+	return composite, nil
+}
@@ -1,19 +1,80 @@
 package email
 
 import (
+	"os"
+	"strings"
+
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/thiagoferolla/go-auth/i18n"
 )
 
 type SendgridEmailProvider struct {
-	ApiKey string
+	ApiKey      string
+	TemplateIDs map[string]string
+}
+
+func NewSendgridEmailProvider(apiKey string, templateIDs map[string]string) *SendgridEmailProvider {
+	return &SendgridEmailProvider{apiKey, templateIDs}
 }
 
-func NewSendgridEmailProvider(apiKey string) *SendgridEmailProvider {
-	return &SendgridEmailProvider{apiKey}
+var sendgridTemplateEnv = map[string]string{
+	ConfirmEmailTemplate:     "CONFIRM_EMAIL_TEMPLATE_ID",
+	ResetPasswordTemplate:    "RESET_PASSWORD_TEMPLATE_ID",
+	PasswordChangedTemplate:  "PASSWORD_CHANGED_TEMPLATE_ID",
+	PasswordlessCodeTemplate: "PASSWORDLESS_CODE_TEMPLATE_ID",
+	PasswordlessLinkTemplate: "PASSWORDLESS_LINK_TEMPLATE_ID",
+	InvitationTemplate:       "INVITATION_TEMPLATE_ID",
 }
 
-func (provider SendgridEmailProvider) SendEmail(from string, name string, to string, templateId string, substitutions map[string]string) error {
+func sendgridTemplateKey(template string, locale string) string {
+	if locale == i18n.DefaultLocale {
+		return template
+	}
+
+	return template + ":" + locale
+}
+
+// SendgridTemplateIDsFromEnv maps our template names to the dynamic templates
+// configured in the SendGrid dashboard. Translations are read from the same
+// variable suffixed with the locale, CONFIRM_EMAIL_TEMPLATE_ID_PT_BR.
+func SendgridTemplateIDsFromEnv() map[string]string {
+	templateIDs := map[string]string{}
+
+	for template, variable := range sendgridTemplateEnv {
+		for _, locale := range i18n.Supported {
+			name := variable
+
+			if locale != i18n.DefaultLocale {
+				name += "_" + strings.ToUpper(strings.ReplaceAll(locale, "-", "_"))
+			}
+
+			if templateId := os.Getenv(name); len(templateId) > 0 {
+				templateIDs[sendgridTemplateKey(template, locale)] = templateId
+			}
+		}
+	}
+
+	return templateIDs
+}
+
+func (provider SendgridEmailProvider) Name() string {
+	return "sendgrid"
+}
+
+func (provider SendgridEmailProvider) SendEmail(from string, name string, to string, template string, locale string, substitutions map[string]string) error {
+	templateId := ""
+
+	for _, candidate := range i18n.Fallbacks(locale) {
+		if templateId = provider.TemplateIDs[sendgridTemplateKey(template, candidate)]; len(templateId) > 0 {
+			break
+		}
+	}
+
+	if len(templateId) <= 0 {
+		return ErrUnknownTemplate
+	}
+
 	m := mail.NewV3Mail()
 
 	e := mail.NewEmail(name, from)
@@ -26,8 +87,8 @@ func (provider SendgridEmailProvider) SendEmail(from string, name string, to str
 		mail.NewEmail(name, to),
 	)
 
-	for _, key := range substitutions {
-		p.SetDynamicTemplateData(key, substitutions[key])
+	for key, value := range substitutions {
+		p.SetDynamicTemplateData(key, value)
 	}
 
 	m.AddPersonalizations(p)
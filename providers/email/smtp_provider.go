@@ -0,0 +1,278 @@
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SmtpStartTLS = "starttls"
+	SmtpTLS      = "tls"
+	SmtpPlain    = "none"
+)
+
+// SmtpConfig describes the relay. TLSMode is "starttls" (default) to upgrade
+// a plain connection, "tls" for implicit TLS, usually on port 465, or "none"
+// for local sinks. DKIM signing is enabled when DkimDomain is set.
+type SmtpConfig struct {
+	Host               string        `json:"host"`
+	Port               int           `json:"port"`
+	Username           string        `json:"username"`
+	Password           string        `json:"password"`
+	TLSMode            string        `json:"tls_mode"`
+	InsecureSkipVerify bool          `json:"insecure_skip_verify"`
+	Timeout            time.Duration `json:"-"`
+	DkimDomain         string        `json:"dkim_domain"`
+	DkimSelector       string        `json:"dkim_selector"`
+	DkimPrivateKeyFile string        `json:"dkim_private_key_file"`
+}
+
+func SmtpConfigFromEnv() SmtpConfig {
+	port, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+
+	return SmtpConfig{
+		Host:               os.Getenv("SMTP_HOST"),
+		Port:               port,
+		Username:           os.Getenv("SMTP_USERNAME"),
+		Password:           os.Getenv("SMTP_PASSWORD"),
+		TLSMode:            os.Getenv("SMTP_TLS"),
+		InsecureSkipVerify: os.Getenv("SMTP_INSECURE_SKIP_VERIFY") == "true",
+		DkimDomain:         os.Getenv("DKIM_DOMAIN"),
+		DkimSelector:       os.Getenv("DKIM_SELECTOR"),
+		DkimPrivateKeyFile: os.Getenv("DKIM_PRIVATE_KEY_FILE"),
+	}
+}
+
+type SmtpProvider struct {
+	Config SmtpConfig
+	Dkim   *DkimSigner
+}
+
+func NewSmtpProvider(config SmtpConfig) (*SmtpProvider, error) {
+	if len(config.TLSMode) <= 0 {
+		config.TLSMode = SmtpStartTLS
+	}
+
+	if config.TLSMode != SmtpStartTLS && config.TLSMode != SmtpTLS && config.TLSMode != SmtpPlain {
+		return nil, errors.New("unknown smtp tls mode " + config.TLSMode)
+	}
+
+	if config.Port <= 0 {
+		config.Port = 587
+
+		if config.TLSMode == SmtpTLS {
+			config.Port = 465
+		}
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	provider := &SmtpProvider{Config: config}
+
+	if len(config.DkimDomain) > 0 {
+		signer, err := NewDkimSigner(config.DkimDomain, config.DkimSelector, config.DkimPrivateKeyFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		provider.Dkim = signer
+	}
+
+	return provider, nil
+}
+
+func (provider SmtpProvider) Name() string {
+	return "smtp"
+}
+
+func (provider SmtpProvider) SendEmail(from string, name string, to string, template string, locale string, substitutions map[string]string) error {
+	rendered, err := RenderTemplate(template, locale, substitutions)
+
+	if err != nil {
+		return err
+	}
+
+	message, err := buildMessage(from, mail.Address{Name: name, Address: to}, rendered)
+
+	if err != nil {
+		return err
+	}
+
+	if provider.Dkim != nil {
+		signature, err := provider.Dkim.Sign(message)
+
+		if err != nil {
+			return err
+		}
+
+		message = append([]byte(signature), message...)
+	}
+
+	client, err := provider.dial()
+
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	if len(provider.Config.Username) > 0 {
+		err = client.Auth(smtp.PlainAuth("", provider.Config.Username, provider.Config.Password, provider.Config.Host))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(from); err != nil {
+		return err
+	}
+
+	if err = client.Rcpt(to); err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = writer.Write(message); err != nil {
+		return err
+	}
+
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (provider SmtpProvider) dial() (*smtp.Client, error) {
+	config := provider.Config
+	address := net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	tlsConfig := &tls.Config{ServerName: config.Host, InsecureSkipVerify: config.InsecureSkipVerify, MinVersion: tls.VersionTLS12}
+
+	var conn net.Conn
+	var err error
+
+	if config.TLSMode == SmtpTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// One deadline for the whole exchange, a stuck relay must not hold the
+	// caller forever.
+	conn.SetDeadline(time.Now().Add(config.Timeout))
+
+	client, err := smtp.NewClient(conn, config.Host)
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if config.TLSMode == SmtpStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, errors.New("smtp server does not support STARTTLS")
+		}
+
+		if err = client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// buildMessage writes a multipart/alternative message with CRLF line endings,
+// the form DKIM signs and SMTP transmits.
+func buildMessage(from string, to mail.Address, rendered RenderedEmail) ([]byte, error) {
+	var body bytes.Buffer
+
+	writer := multipart.NewWriter(&body)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", rendered.Text},
+		{"text/html; charset=utf-8", rendered.Html},
+	}
+
+	for _, part := range parts {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := quotedprintable.NewWriter(partWriter)
+
+		if _, err = encoder.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+
+		if err = encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	messageID, err := uuid.NewRandom()
+
+	if err != nil {
+		return nil, err
+	}
+
+	domain := from[strings.LastIndex(from, "@")+1:]
+
+	headers := []string{
+		"From: " + from,
+		"To: " + to.String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", rendered.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: <" + messageID.String() + "@" + domain + ">",
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + writer.Boundary(),
+	}
+
+	var message bytes.Buffer
+
+	message.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+	message.Write(body.Bytes())
+
+	return message.Bytes(), nil
+}
@@ -0,0 +1,322 @@
+package email
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type sinkMessage struct {
+	Auth   string
+	From   string
+	To     string
+	Secure bool
+	Data   []byte
+}
+
+// smtpSink is a relay that keeps what it receives. In "starttls" mode it
+// offers the upgrade, in "tls" mode the connection is TLS from the start.
+type smtpSink struct {
+	listener  net.Listener
+	mode      string
+	tlsConfig *tls.Config
+	mutex     sync.Mutex
+	messages  []sinkMessage
+}
+
+func newSmtpSink(t *testing.T, mode string) *smtpSink {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &smtpSink{listener: listener, mode: mode, tlsConfig: &tls.Config{Certificates: []tls.Certificate{selfSignedCertificate(t)}}}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go sink.serve(conn)
+		}
+	}()
+
+	return sink
+}
+
+func selfSignedCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "smtp sink"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (sink *smtpSink) config() SmtpConfig {
+	address := sink.listener.Addr().(*net.TCPAddr)
+
+	return SmtpConfig{Host: "127.0.0.1", Port: address.Port, TLSMode: sink.mode, InsecureSkipVerify: true, Timeout: 5 * time.Second}
+}
+
+func (sink *smtpSink) received() []sinkMessage {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	return append([]sinkMessage{}, sink.messages...)
+}
+
+func (sink *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+
+	secure := sink.mode == SmtpTLS
+
+	if secure {
+		conn = tls.Server(conn, sink.tlsConfig)
+	}
+
+	text := textproto.NewConn(conn)
+	message := sinkMessage{}
+
+	text.PrintfLine("220 sink ESMTP")
+
+	for {
+		line, err := text.ReadLine()
+
+		if err != nil {
+			return
+		}
+
+		command, argument, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(command) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250-sink")
+
+			if sink.mode == SmtpStartTLS && !secure {
+				text.PrintfLine("250-STARTTLS")
+			}
+
+			text.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			text.PrintfLine("220 Ready to start TLS")
+
+			upgraded := tls.Server(conn, sink.tlsConfig)
+
+			if upgraded.Handshake() != nil {
+				return
+			}
+
+			conn = upgraded
+			text = textproto.NewConn(conn)
+			secure = true
+		case "AUTH":
+			_, initial, _ := strings.Cut(argument, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(initial)
+			message.Auth = string(decoded)
+			text.PrintfLine("235 Authenticated")
+		case "MAIL":
+			message.From = strings.Trim(strings.TrimPrefix(argument, "FROM:"), "<>")
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			message.To = strings.Trim(strings.TrimPrefix(argument, "TO:"), "<>")
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 Send the message")
+
+			data, err := text.ReadDotBytes()
+
+			if err != nil {
+				return
+			}
+
+			// The reader hands lines back with bare LF, the wire form is CRLF.
+			message.Data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+			message.Secure = secure
+
+			sink.mutex.Lock()
+			sink.messages = append(sink.messages, message)
+			sink.mutex.Unlock()
+
+			text.PrintfLine("250 Queued")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func TestSmtpProviderDeliversToSink(t *testing.T) {
+	tests := []struct {
+		mode   string
+		secure bool
+	}{
+		{SmtpStartTLS, true},
+		{SmtpTLS, true},
+		{SmtpPlain, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			sink := newSmtpSink(t, test.mode)
+			keyFile, key := writeDkimKey(t, false)
+
+			config := sink.config()
+			config.Username = "relay"
+			config.Password = "secret"
+			config.DkimDomain = "example.com"
+			config.DkimSelector = "mail"
+			config.DkimPrivateKeyFile = keyFile
+
+			provider, err := NewSmtpProvider(config)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = provider.SendEmail("noreply@example.com", "Jane", "jane@example.com", ResetPasswordTemplate, "en", ResetPassword{Name: "Jane", Token: "reset-token"}.Substitutions())
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			messages := sink.received()
+
+			if len(messages) != 1 {
+				t.Fatalf("got %d messages", len(messages))
+			}
+
+			received := messages[0]
+
+			if received.Secure != test.secure {
+				t.Fatalf("secure: got %v, want %v", received.Secure, test.secure)
+			}
+
+			if received.Auth != "\x00relay\x00secret" {
+				t.Fatalf("auth: got %q", received.Auth)
+			}
+
+			if received.From != "noreply@example.com" || received.To != "jane@example.com" {
+				t.Fatalf("envelope: got %q to %q", received.From, received.To)
+			}
+
+			if err := verifyDkim(received.Data, "example.com", "mail", &key.PublicKey); err != nil {
+				t.Fatalf("dkim: %v", err)
+			}
+
+			parsed, err := mail.ReadMessage(bytes.NewReader(received.Data))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+			body, _ := io.ReadAll(parsed.Body)
+
+			if len(subject) <= 0 || !strings.Contains(parsed.Header.Get("Content-Type"), "multipart/alternative") {
+				t.Fatalf("headers: got subject %q and %q", subject, parsed.Header.Get("Content-Type"))
+			}
+
+			if !bytes.Contains(body, []byte("reset-token")) {
+				t.Fatal("body does not carry the token")
+			}
+		})
+	}
+}
+
+func TestSmtpProviderRefusesInsecureRelays(t *testing.T) {
+	// STARTTLS is required, a relay that does not offer it gets nothing.
+	sink := newSmtpSink(t, SmtpPlain)
+	config := sink.config()
+	config.TLSMode = SmtpStartTLS
+
+	provider, _ := NewSmtpProvider(config)
+
+	if err := provider.SendEmail("noreply@example.com", "Jane", "jane@example.com", PasswordChangedTemplate, "en", PasswordChanged{Name: "Jane"}.Substitutions()); err == nil {
+		t.Fatal("sent without STARTTLS")
+	}
+
+	// The certificate is checked unless verification is turned off.
+	for _, mode := range []string{SmtpStartTLS, SmtpTLS} {
+		sink = newSmtpSink(t, mode)
+		config = sink.config()
+		config.InsecureSkipVerify = false
+
+		provider, _ = NewSmtpProvider(config)
+
+		if err := provider.SendEmail("noreply@example.com", "Jane", "jane@example.com", PasswordChangedTemplate, "en", PasswordChanged{Name: "Jane"}.Substitutions()); err == nil {
+			t.Fatalf("%s: sent to an untrusted certificate", mode)
+		}
+
+		if len(sink.received()) > 0 {
+			t.Fatalf("%s: message reached the relay", mode)
+		}
+	}
+}
+
+func TestNewSmtpProviderDefaults(t *testing.T) {
+	tests := []struct {
+		config SmtpConfig
+		mode   string
+		port   int
+	}{
+		{SmtpConfig{Host: "smtp.example.com"}, SmtpStartTLS, 587},
+		{SmtpConfig{Host: "smtp.example.com", TLSMode: SmtpTLS}, SmtpTLS, 465},
+		{SmtpConfig{Host: "smtp.example.com", TLSMode: SmtpPlain, Port: 1025}, SmtpPlain, 1025},
+	}
+
+	for _, test := range tests {
+		provider, err := NewSmtpProvider(test.config)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if provider.Config.TLSMode != test.mode || provider.Config.Port != test.port {
+			t.Fatalf("got %s on %d, want %s on %d", provider.Config.TLSMode, provider.Config.Port, test.mode, test.port)
+		}
+	}
+
+	if _, err := NewSmtpProvider(SmtpConfig{Host: "smtp.example.com", TLSMode: "ssl"}); err == nil {
+		t.Fatal("accepted an unknown tls mode")
+	}
+}
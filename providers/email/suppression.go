@@ -0,0 +1,57 @@
+package email
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+var ErrSuppressed = errors.New("email address is suppressed")
+
+// SuppressingEmailProvider checks the suppression list before handing the
+// email to Provider, so bounced and complaining addresses get nothing else.
+type SuppressingEmailProvider struct {
+	Repository models.EmailSuppressionRepository
+	Provider   EmailProvider
+}
+
+func NewSuppressingEmailProvider(repository models.EmailSuppressionRepository, provider EmailProvider) *SuppressingEmailProvider {
+	return &SuppressingEmailProvider{repository, provider}
+}
+
+func (provider *SuppressingEmailProvider) Name() string {
+	return provider.Provider.Name()
+}
+
+func (provider *SuppressingEmailProvider) check(to string) error {
+	_, err := provider.Repository.GetEmailSuppression(to)
+
+	if err == nil {
+		return ErrSuppressed
+	} else if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	return err
+}
+
+func (provider *SuppressingEmailProvider) SendEmail(from string, name string, to string, template string, locale string, substitutions map[string]string) error {
+	if err := provider.check(to); err != nil {
+		return err
+	}
+
+	return provider.Provider.SendEmail(from, name, to, template, locale, substitutions)
+}
+
+func (provider *SuppressingEmailProvider) Deliver(from string, name string, to string, template string, locale string, substitutions map[string]string) (string, error) {
+	if err := provider.check(to); err != nil {
+		return "", err
+	}
+
+	if router, ok := provider.Provider.(RoutingEmailProvider); ok {
+		return router.Deliver(from, name, to, template, locale, substitutions)
+	}
+
+	return provider.Provider.Name(), provider.Provider.SendEmail(from, name, to, template, locale, substitutions)
+}
@@ -0,0 +1,107 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/thiagoferolla/go-auth/i18n"
+)
+
+// Template names shared by every provider, SendGrid maps them to its own
+// template ids while SMTP renders the embedded files below.
+const (
+	ConfirmEmailTemplate     = "confirm_email"
+	ResetPasswordTemplate    = "reset_password"
+	PasswordChangedTemplate  = "password_changed"
+	PasswordlessCodeTemplate = "passwordless_code"
+	PasswordlessLinkTemplate = "passwordless_link"
+	InvitationTemplate       = "invitation"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+type emailTemplate struct {
+	Text *texttemplate.Template
+	Html *htmltemplate.Template
+}
+
+// Templates live in templates/<locale>/, each email type has a <name>.txt
+// file, which also defines the "subject" block, and a <name>.html file. Both
+// receive the substitutions map.
+var templates = loadTemplates()
+
+type RenderedEmail struct {
+	Subject string
+	Text    string
+	Html    string
+}
+
+func loadTemplates() map[string]map[string]emailTemplate {
+	loaded := map[string]map[string]emailTemplate{}
+
+	files, err := fs.Glob(templateFiles, "templates/*/*.txt")
+
+	if err != nil {
+		panic(err)
+	}
+
+	for _, file := range files {
+		locale := path.Base(path.Dir(file))
+		name := strings.TrimSuffix(path.Base(file), ".txt")
+
+		if _, ok := loaded[locale]; !ok {
+			loaded[locale] = map[string]emailTemplate{}
+		}
+
+		loaded[locale][name] = emailTemplate{
+			Text: texttemplate.Must(texttemplate.New(name+".txt").Option("missingkey=zero").ParseFS(templateFiles, file)),
+			Html: htmltemplate.Must(htmltemplate.New(name+".html").Option("missingkey=zero").ParseFS(templateFiles, path.Join(path.Dir(file), name+".html"))),
+		}
+	}
+
+	return loaded
+}
+
+// RenderTemplate uses the first locale of the fallback chain that has the
+// template, English templates exist for every email type.
+func RenderTemplate(name string, locale string, substitutions map[string]string) (RenderedEmail, error) {
+	var rendered RenderedEmail
+	var subject, text, html bytes.Buffer
+	var template emailTemplate
+
+	ok := false
+
+	for _, candidate := range i18n.Fallbacks(locale) {
+		if template, ok = templates[candidate][name]; ok {
+			break
+		}
+	}
+
+	if !ok {
+		return rendered, ErrUnknownTemplate
+	}
+
+	if err := template.Text.ExecuteTemplate(&subject, "subject", substitutions); err != nil {
+		return rendered, err
+	}
+
+	if err := template.Text.Execute(&text, substitutions); err != nil {
+		return rendered, err
+	}
+
+	if err := template.Html.Execute(&html, substitutions); err != nil {
+		return rendered, err
+	}
+
+	rendered.Subject = strings.TrimSpace(subject.String())
+	rendered.Text = strings.TrimSpace(text.String()) + "\n"
+	rendered.Html = html.String()
+
+	return rendered, nil
+}
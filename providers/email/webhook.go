@@ -0,0 +1,178 @@
+package email
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// webhookTolerance bounds how old a signed timestamp may be, so a captured
+// request can't be replayed later.
+const webhookTolerance = 5 * time.Minute
+
+// DeliveryEvent is a bounce or complaint reported by a provider, Reason is
+// one of the models.Suppression constants.
+type DeliveryEvent struct {
+	Email  string
+	Reason string
+	Detail string
+}
+
+type EmailWebhook interface {
+	// ParseEvents verifies the request signature and returns the events that
+	// suppress an address, deliveries and soft bounces are left out.
+	ParseEvents(header http.Header, body []byte) ([]DeliveryEvent, error)
+}
+
+func checkTimestamp(timestamp string) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if math.Abs(time.Since(time.Unix(seconds, 0)).Seconds()) > webhookTolerance.Seconds() {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// SendgridWebhook reads the signed Event Webhook, PublicKey is the
+// verification key shown in the SendGrid dashboard.
+type SendgridWebhook struct {
+	PublicKey *ecdsa.PublicKey
+}
+
+func NewSendgridWebhook(publicKey string) (*SendgridWebhook, error) {
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+
+	if !ok {
+		return nil, errors.New("sendgrid webhook key is not an ECDSA key")
+	}
+
+	return &SendgridWebhook{ecdsaKey}, nil
+}
+
+type sendgridEvent struct {
+	Email  string `json:"email"`
+	Event  string `json:"event"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+func (webhook SendgridWebhook) ParseEvents(header http.Header, body []byte) ([]DeliveryEvent, error) {
+	timestamp := header.Get("X-Twilio-Email-Event-Webhook-Timestamp")
+	signature, err := base64.StdEncoding.DecodeString(header.Get("X-Twilio-Email-Event-Webhook-Signature"))
+
+	if err != nil || checkTimestamp(timestamp) != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	hash := sha256.Sum256(append([]byte(timestamp), body...))
+
+	if !ecdsa.VerifyASN1(webhook.PublicKey, hash[:], signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	var sendgridEvents []sendgridEvent
+
+	if err := json.Unmarshal(body, &sendgridEvents); err != nil {
+		return nil, err
+	}
+
+	events := []DeliveryEvent{}
+
+	for _, event := range sendgridEvents {
+		switch {
+		// Blocked bounces are temporary, the receiving server refused the
+		// message but the mailbox exists.
+		case event.Event == "bounce" && event.Type != "blocked":
+			events = append(events, DeliveryEvent{event.Email, models.SuppressionBounce, event.Reason})
+		case event.Event == "spamreport":
+			events = append(events, DeliveryEvent{event.Email, models.SuppressionComplaint, event.Reason})
+		}
+	}
+
+	return events, nil
+}
+
+// HmacWebhook takes events from relays without a webhook format of their
+// own, usually through a small adapter in front of the SMTP relay. The body
+// is signed with X-Webhook-Signature, the hex HMAC-SHA256 of the
+// X-Webhook-Timestamp header, a dot and the body.
+type HmacWebhook struct {
+	Secret []byte
+}
+
+func NewHmacWebhook(secret string) *HmacWebhook {
+	return &HmacWebhook{[]byte(secret)}
+}
+
+type hmacEvent struct {
+	Email     string `json:"email"`
+	Type      string `json:"type"`
+	Permanent bool   `json:"permanent"`
+	Detail    string `json:"detail"`
+}
+
+func (webhook HmacWebhook) ParseEvents(header http.Header, body []byte) ([]DeliveryEvent, error) {
+	timestamp := header.Get("X-Webhook-Timestamp")
+	signature, err := hex.DecodeString(header.Get("X-Webhook-Signature"))
+
+	if err != nil || checkTimestamp(timestamp) != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, webhook.Secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	var hmacEvents []hmacEvent
+
+	if err := json.Unmarshal(body, &hmacEvents); err != nil {
+		return nil, err
+	}
+
+	events := []DeliveryEvent{}
+
+	for _, event := range hmacEvents {
+		switch {
+		case event.Type == models.SuppressionBounce && event.Permanent:
+			events = append(events, DeliveryEvent{event.Email, models.SuppressionBounce, event.Detail})
+		case event.Type == models.SuppressionComplaint:
+			events = append(events, DeliveryEvent{event.Email, models.SuppressionComplaint, event.Detail})
+		}
+	}
+
+	return events, nil
+}
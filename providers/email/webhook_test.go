@@ -0,0 +1,173 @@
+package email
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+const sendgridEvents = `[
+	{"email": "hard@example.com", "event": "bounce", "type": "bounce", "reason": "550 mailbox does not exist"},
+	{"email": "blocked@example.com", "event": "bounce", "type": "blocked", "reason": "421 try again later"},
+	{"email": "spam@example.com", "event": "spamreport", "reason": "abuse"},
+	{"email": "deferred@example.com", "event": "deferred"},
+	{"email": "delivered@example.com", "event": "delivered"}
+]`
+
+const hmacEvents = `[
+	{"email": "hard@example.com", "type": "bounce", "permanent": true, "detail": "550 mailbox does not exist"},
+	{"email": "soft@example.com", "type": "bounce", "permanent": false, "detail": "452 mailbox full"},
+	{"email": "spam@example.com", "type": "complaint", "detail": "abuse"},
+	{"email": "delivered@example.com", "type": "delivery"}
+]`
+
+// Soft bounces, SendGrid blocks and deliveries never suppress an address.
+var wantEvents = []DeliveryEvent{
+	{"hard@example.com", models.SuppressionBounce, "550 mailbox does not exist"},
+	{"spam@example.com", models.SuppressionComplaint, "abuse"},
+}
+
+func unixTimestamp(at time.Time) string {
+	return strconv.FormatInt(at.Unix(), 10)
+}
+
+type webhookRequest struct {
+	name      string
+	timestamp string
+	signed    string
+	body      string
+	wantErr   error
+}
+
+// webhookRequests signs signed at timestamp and posts body, the two only
+// differ when the body was tampered with.
+func webhookRequests(events string) []webhookRequest {
+	now := unixTimestamp(time.Now())
+
+	return []webhookRequest{
+		{"valid signature", now, events, events, nil},
+		{"tampered body", now, events, `[{"email": "victim@example.com", "event": "spamreport", "type": "complaint"}]`, ErrInvalidSignature},
+		{"stale timestamp", unixTimestamp(time.Now().Add(-webhookTolerance - time.Minute)), events, events, ErrInvalidSignature},
+		{"future timestamp", unixTimestamp(time.Now().Add(webhookTolerance + time.Minute)), events, events, ErrInvalidSignature},
+		{"missing timestamp", "", events, events, ErrInvalidSignature},
+	}
+}
+
+func TestSendgridWebhook(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webhook, err := NewSendgridWebhook(base64.StdEncoding.EncodeToString(der))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range webhookRequests(sendgridEvents) {
+		t.Run(test.name, func(t *testing.T) {
+			hash := sha256.Sum256([]byte(test.timestamp + test.signed))
+			signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			header := http.Header{}
+			header.Set("X-Twilio-Email-Event-Webhook-Timestamp", test.timestamp)
+			header.Set("X-Twilio-Email-Event-Webhook-Signature", base64.StdEncoding.EncodeToString(signature))
+
+			events, err := webhook.ParseEvents(header, []byte(test.body))
+
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+
+			if test.wantErr == nil && !reflect.DeepEqual(events, wantEvents) {
+				t.Fatalf("got events %+v", events)
+			}
+		})
+	}
+}
+
+func TestSendgridWebhookRejectsOtherKeys(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	webhook, _ := NewSendgridWebhook(base64.StdEncoding.EncodeToString(der))
+
+	timestamp := unixTimestamp(time.Now())
+	hash := sha256.Sum256([]byte(timestamp + sendgridEvents))
+	signature, _ := ecdsa.SignASN1(rand.Reader, other, hash[:])
+
+	header := http.Header{}
+	header.Set("X-Twilio-Email-Event-Webhook-Timestamp", timestamp)
+	header.Set("X-Twilio-Email-Event-Webhook-Signature", base64.StdEncoding.EncodeToString(signature))
+
+	if _, err := webhook.ParseEvents(header, []byte(sendgridEvents)); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("got error %v, want ErrInvalidSignature", err)
+	}
+}
+
+func signHmac(secret string, timestamp string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHmacWebhook(t *testing.T) {
+	webhook := NewHmacWebhook("webhook-secret")
+
+	for _, test := range webhookRequests(hmacEvents) {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("X-Webhook-Timestamp", test.timestamp)
+			header.Set("X-Webhook-Signature", signHmac("webhook-secret", test.timestamp, test.signed))
+
+			events, err := webhook.ParseEvents(header, []byte(test.body))
+
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+
+			if test.wantErr == nil && !reflect.DeepEqual(events, wantEvents) {
+				t.Fatalf("got events %+v", events)
+			}
+		})
+	}
+}
+
+func TestHmacWebhookRejectsOtherSecrets(t *testing.T) {
+	webhook := NewHmacWebhook("webhook-secret")
+	timestamp := unixTimestamp(time.Now())
+
+	header := http.Header{}
+	header.Set("X-Webhook-Timestamp", timestamp)
+	header.Set("X-Webhook-Signature", signHmac("guessed-secret", timestamp, hmacEvents))
+
+	if _, err := webhook.ParseEvents(header, []byte(hmacEvents)); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("got error %v, want ErrInvalidSignature", err)
+	}
+}
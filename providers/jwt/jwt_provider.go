@@ -7,6 +7,8 @@ import (
 	"github.com/thiagoferolla/go-auth/database/models"
 )
 
+const TokenExpiration = time.Second * 3700
+
 type JWTBaseProvider struct {
 	Secret []byte
 }
@@ -16,12 +18,13 @@ func NewBaseProvider() *JWTBaseProvider {
 }
 
 func (provider JWTBaseProvider) GenerateToken(user models.User) (string, error) {
-	expiration := time.Now().Add(time.Second * 3700)
+	expiration := time.Now().Add(TokenExpiration)
 
 	claims := JwtClaims{
-		ID:    user.ID,
-		Email: user.Email,
-		Role:  user.Role,
+		ID:           user.ID,
+		Email:        user.Email,
+		Role:         user.Role,
+		Organization: user.OrganizationID.String,
 		StandardClaims: jwt.StandardClaims{
 			Audience:  "go-auth",
 			ExpiresAt: expiration.Unix(),
@@ -35,6 +38,72 @@ func (provider JWTBaseProvider) GenerateToken(user models.User) (string, error)
 	return signedToken, err
 }
 
+func (provider JWTBaseProvider) GenerateClientToken(client models.OAuthClient, scope string) (string, error) {
+	expiration := time.Now().Add(TokenExpiration)
+
+	claims := JwtClaims{
+		ClientID: client.ID,
+		Scope:    scope,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  "go-auth",
+			Subject:   client.ID,
+			ExpiresAt: expiration.Unix(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	signedToken, err := token.SignedString(provider.Secret)
+
+	return signedToken, err
+}
+
+func (provider JWTBaseProvider) GenerateDelegatedToken(user models.User, client models.OAuthClient, scope string) (string, error) {
+	expiration := time.Now().Add(TokenExpiration)
+
+	claims := JwtClaims{
+		ID:           user.ID,
+		Email:        user.Email,
+		Role:         user.Role,
+		ClientID:     client.ID,
+		Scope:        scope,
+		Organization: user.OrganizationID.String,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  "go-auth",
+			ExpiresAt: expiration.Unix(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	signedToken, err := token.SignedString(provider.Secret)
+
+	return signedToken, err
+}
+
+func (provider JWTBaseProvider) GenerateImpersonationToken(user models.User, actor models.User, expiration time.Duration) (string, error) {
+	claims := JwtClaims{
+		ID:           user.ID,
+		Email:        user.Email,
+		Role:         user.Role,
+		Organization: user.OrganizationID.String,
+		Act: &ActorClaim{
+			Sub:   actor.ID.String(),
+			Email: actor.Email,
+		},
+		StandardClaims: jwt.StandardClaims{
+			Audience:  "go-auth",
+			ExpiresAt: time.Now().Add(expiration).Unix(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	signedToken, err := token.SignedString(provider.Secret)
+
+	return signedToken, err
+}
+
 func (provider JWTBaseProvider) ValidateToken(token string) (JwtClaims, error) {
 	claims := &JwtClaims{}
 
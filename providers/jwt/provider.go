@@ -1,6 +1,8 @@
 package jwt
 
 import (
+	"time"
+
 	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
 	"github.com/thiagoferolla/go-auth/database/models"
@@ -8,12 +10,42 @@ import (
 
 type JWTProvider interface {
 	GenerateToken(user models.User) (string, error)
+	GenerateClientToken(client models.OAuthClient, scope string) (string, error)
+	GenerateDelegatedToken(user models.User, client models.OAuthClient, scope string) (string, error)
+	GenerateImpersonationToken(user models.User, actor models.User, expiration time.Duration) (string, error)
 	ValidateToken(token string) (JwtClaims, error)
 }
 
+// ActorClaim is the RFC 8693 act claim, naming who really holds a token
+// issued for someone else.
+type ActorClaim struct {
+	Sub   string `json:"sub"`
+	Email string `json:"email,omitempty"`
+}
+
+// JwtClaims identifies either a user, through ID, or a machine client, through
+// ClientID with a nil ID. A user token with a ClientID was issued to that
+// third-party client and is limited to Scope. Organization is the user's
+// active organization.
 type JwtClaims struct {
-	ID    uuid.UUID
-	Email string
-	Role  string
+	ID           uuid.UUID
+	Email        string
+	Role         string
+	ClientID     string      `json:"client_id,omitempty"`
+	Scope        string      `json:"scope,omitempty"`
+	Act          *ActorClaim `json:"act,omitempty"`
+	Organization string      `json:"org,omitempty"`
 	jwt.StandardClaims
 }
+
+func (claims JwtClaims) IsImpersonation() bool {
+	return claims.Act != nil
+}
+
+func (claims JwtClaims) IsClient() bool {
+	return claims.ID == uuid.Nil && len(claims.ClientID) > 0
+}
+
+func (claims JwtClaims) IsDelegated() bool {
+	return claims.ID != uuid.Nil && len(claims.ClientID) > 0
+}
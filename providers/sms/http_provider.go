@@ -0,0 +1,53 @@
+package sms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HttpSmsProvider posts messages as JSON to an SMS gateway, pointing Url at a
+// local server is enough to run it without a real gateway.
+type HttpSmsProvider struct {
+	Url    string
+	ApiKey string
+	From   string
+	Client *http.Client
+}
+
+func NewHttpSmsProvider(url string, apiKey string, from string) *HttpSmsProvider {
+	return &HttpSmsProvider{url, apiKey, from, &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (provider HttpSmsProvider) SendSms(to string, message string) error {
+	body, err := json.Marshal(map[string]string{"from": provider.From, "to": to, "body": message})
+
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, provider.Url, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+provider.ApiKey)
+
+	response, err := provider.Client.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("sms gateway responded with status %d", response.StatusCode)
+	}
+
+	return nil
+}
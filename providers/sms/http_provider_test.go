@@ -0,0 +1,61 @@
+package sms
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHttpSmsProviderPostsToGateway(t *testing.T) {
+	var received map[string]string
+	var authorization string
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer gateway.Close()
+
+	provider := NewHttpSmsProvider(gateway.URL, "secret", "go-auth")
+
+	if err := provider.SendSms("+5511999999999", "Your code is 123456"); err != nil {
+		t.Fatal(err)
+	}
+
+	if authorization != "Bearer secret" {
+		t.Fatalf("authorization: got %q", authorization)
+	}
+
+	want := map[string]string{"from": "go-auth", "to": "+5511999999999", "body": "Your code is 123456"}
+
+	for key, value := range want {
+		if received[key] != value {
+			t.Fatalf("%s: got %q, want %q", key, received[key], value)
+		}
+	}
+}
+
+func TestHttpSmsProviderFailsOnGatewayError(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer gateway.Close()
+
+	if err := NewHttpSmsProvider(gateway.URL, "secret", "go-auth").SendSms("+5511999999999", "hi"); err == nil {
+		t.Fatal("expected an error for a 503 answer")
+	}
+
+	gateway.Close()
+
+	if err := NewHttpSmsProvider(gateway.URL, "secret", "go-auth").SendSms("+5511999999999", "hi"); err == nil {
+		t.Fatal("expected an error for an unreachable gateway")
+	}
+}
@@ -0,0 +1,44 @@
+package sms
+
+import (
+	"log"
+	"sync"
+)
+
+type SmsMessage struct {
+	To      string
+	Message string
+}
+
+type MockSmsProvider struct {
+	mutex    sync.Mutex
+	Messages []SmsMessage
+}
+
+func NewMockSmsProvider() *MockSmsProvider {
+	return &MockSmsProvider{}
+}
+
+func (provider *MockSmsProvider) SendSms(to string, message string) error {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	log.Println("Send sms to ", to)
+
+	provider.Messages = append(provider.Messages, SmsMessage{To: to, Message: message})
+
+	return nil
+}
+
+func (provider *MockSmsProvider) LastMessage(to string) (SmsMessage, bool) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	for i := len(provider.Messages) - 1; i >= 0; i-- {
+		if provider.Messages[i].To == to {
+			return provider.Messages[i], true
+		}
+	}
+
+	return SmsMessage{}, false
+}
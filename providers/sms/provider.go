@@ -0,0 +1,5 @@
+package sms
+
+type SmsProvider interface {
+	SendSms(to string, message string) error
+}
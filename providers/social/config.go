@@ -0,0 +1,62 @@
+package social
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ProviderConfig declares one social login provider. Configuration files are
+// expanded with environment variables first, so secrets can be written as
+// ${GOOGLE_CLIENT_SECRET} instead of being committed.
+type ProviderConfig struct {
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+}
+
+func LoadProviderConfigs(path string) ([]ProviderConfig, error) {
+	configs := []ProviderConfig{}
+
+	if len(path) <= 0 {
+		return configs, nil
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return configs, err
+	}
+
+	err = json.Unmarshal([]byte(os.ExpandEnv(string(data))), &configs)
+
+	return configs, err
+}
+
+func NewProviders(ctx context.Context, configs []ProviderConfig) (map[string]SocialProvider, error) {
+	providers := map[string]SocialProvider{}
+
+	for _, config := range configs {
+		switch config.Type {
+		case "oidc":
+			provider, err := NewOIDCProvider(ctx, config.Name, config.Issuer, config.ClientID, config.ClientSecret, config.RedirectURL, config.Scopes)
+
+			if err != nil {
+				return providers, err
+			}
+
+			providers[config.Name] = provider
+		case "github":
+			providers[config.Name] = NewGithubProvider(config.Name, config.ClientID, config.ClientSecret, config.RedirectURL, config.Scopes)
+		default:
+			return providers, fmt.Errorf("unknown social provider type %q", config.Type)
+		}
+	}
+
+	return providers, nil
+}
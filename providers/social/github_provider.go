@@ -0,0 +1,111 @@
+package social
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+// GithubProvider uses plain OAuth2 since GitHub has no id token, the identity
+// comes from its REST API instead.
+type GithubProvider struct {
+	ProviderName string
+	Config       oauth2.Config
+	ApiURL       string
+}
+
+func NewGithubProvider(name string, clientID string, clientSecret string, redirectURL string, scopes []string) *GithubProvider {
+	if len(scopes) <= 0 {
+		scopes = []string{"read:user", "user:email"}
+	}
+
+	return &GithubProvider{
+		ProviderName: name,
+		Config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     github.Endpoint,
+			Scopes:       scopes,
+		},
+		ApiURL: "https://api.github.com",
+	}
+}
+
+func (provider GithubProvider) Name() string {
+	return provider.ProviderName
+}
+
+func (provider GithubProvider) AuthCodeURL(state string, codeVerifier string, nonce string) string {
+	return provider.Config.AuthCodeURL(state, oauth2.S256ChallengeOption(codeVerifier))
+}
+
+func (provider GithubProvider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (SocialIdentity, error) {
+	token, err := provider.Config.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+
+	if err != nil {
+		return SocialIdentity{}, err
+	}
+
+	client := provider.Config.Client(ctx, token)
+
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+
+	err = getJSON(client, provider.ApiURL+"/user", &user)
+
+	if err != nil {
+		return SocialIdentity{}, err
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+
+	err = getJSON(client, provider.ApiURL+"/user/emails", &emails)
+
+	if err != nil {
+		return SocialIdentity{}, err
+	}
+
+	identity := SocialIdentity{
+		Provider: provider.ProviderName,
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Name:     user.Name,
+	}
+
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+		}
+	}
+
+	return identity, nil
+}
+
+func getJSON(client *http.Client, url string, value any) error {
+	response, err := client.Get(url)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with status %d", url, response.StatusCode)
+	}
+
+	return json.NewDecoder(response.Body).Decode(value)
+}
@@ -0,0 +1,93 @@
+package social
+
+import (
+	"context"
+	"errors"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider signs users in with any OpenID Connect issuer, id tokens are
+// checked against the keys published in the issuer JWKS.
+type OIDCProvider struct {
+	ProviderName string
+	Config       oauth2.Config
+	Verifier     *oidc.IDTokenVerifier
+}
+
+func NewOIDCProvider(ctx context.Context, name string, issuer string, clientID string, clientSecret string, redirectURL string, scopes []string) (*OIDCProvider, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(scopes) <= 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+
+	return &OIDCProvider{
+		ProviderName: name,
+		Config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		Verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+	}, nil
+}
+
+func (provider OIDCProvider) Name() string {
+	return provider.ProviderName
+}
+
+func (provider OIDCProvider) AuthCodeURL(state string, codeVerifier string, nonce string) string {
+	return provider.Config.AuthCodeURL(state, oauth2.S256ChallengeOption(codeVerifier), oidc.Nonce(nonce))
+}
+
+func (provider OIDCProvider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (SocialIdentity, error) {
+	token, err := provider.Config.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+
+	if err != nil {
+		return SocialIdentity{}, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+
+	if !ok {
+		return SocialIdentity{}, errors.New("id_token missing from token response")
+	}
+
+	idToken, err := provider.Verifier.Verify(ctx, rawIDToken)
+
+	if err != nil {
+		return SocialIdentity{}, err
+	}
+
+	if idToken.Nonce != nonce {
+		return SocialIdentity{}, errors.New("invalid nonce")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+
+	err = idToken.Claims(&claims)
+
+	if err != nil {
+		return SocialIdentity{}, err
+	}
+
+	return SocialIdentity{
+		Provider:      provider.ProviderName,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	}, nil
+}
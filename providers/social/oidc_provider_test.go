@@ -0,0 +1,250 @@
+package social
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt"
+)
+
+// fakeIssuer is a minimal OpenID Connect provider: discovery, JWKS, an
+// authorize endpoint that approves right away and a token endpoint checking
+// PKCE. Claims are merged into every id token it signs.
+type fakeIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// signer signs the id tokens, swapping it for another key simulates a
+	// forged token.
+	signer   *rsa.PrivateKey
+	audience string
+	claims   jwt.MapClaims
+
+	mutex sync.Mutex
+	codes map[string]fakeGrant
+}
+
+type fakeGrant struct {
+	challenge string
+	nonce     string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := &fakeIssuer{key: key, signer: key, audience: "client", claims: jwt.MapClaims{}, codes: map[string]fakeGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/jwks", issuer.jwks)
+	mux.HandleFunc("/authorize", issuer.authorize)
+	mux.HandleFunc("/token", issuer.token)
+
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+
+	return issuer
+}
+
+func (issuer *fakeIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                                issuer.server.URL,
+		"authorization_endpoint":                issuer.server.URL + "/authorize",
+		"token_endpoint":                        issuer.server.URL + "/token",
+		"jwks_uri":                              issuer.server.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (issuer *fakeIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(issuer.key.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(issuer.key.PublicKey.E)).Bytes()),
+		}},
+	})
+}
+
+func (issuer *fakeIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "pkce required", http.StatusBadRequest)
+		return
+	}
+
+	code := base64.RawURLEncoding.EncodeToString([]byte(query.Get("state") + ":code"))
+
+	issuer.mutex.Lock()
+	issuer.codes[code] = fakeGrant{query.Get("code_challenge"), query.Get("nonce")}
+	issuer.mutex.Unlock()
+
+	redirect, _ := url.Parse(query.Get("redirect_uri"))
+	redirect.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (issuer *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	issuer.mutex.Lock()
+	grant, ok := issuer.codes[r.PostForm.Get("code")]
+	delete(issuer.codes, r.PostForm.Get("code"))
+	issuer.mutex.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   issuer.server.URL,
+		"sub":   "subject-1",
+		"aud":   issuer.audience,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": grant.nonce,
+	}
+
+	for name, value := range issuer.claims {
+		claims[name] = value
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+
+	idToken, err := token.SignedString(issuer.signer)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+// approve follows the authorization URL like a browser would and returns the
+// code handed back to the redirect URL.
+func (issuer *fakeIssuer) approve(t *testing.T, authorizationURL string) string {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	response, err := client.Get(authorizationURL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+
+	location, err := url.Parse(response.Header.Get("Location"))
+
+	if err != nil || len(location.Query().Get("code")) <= 0 {
+		t.Fatalf("authorize: status %d, location %q", response.StatusCode, response.Header.Get("Location"))
+	}
+
+	return location.Query().Get("code")
+}
+
+func newTestOIDCProvider(t *testing.T, issuer *fakeIssuer) *OIDCProvider {
+	provider, err := NewOIDCProvider(context.Background(), "fake", issuer.server.URL, "client", "secret", "http://localhost/callback", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return provider
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	issuer.claims = jwt.MapClaims{"email": "jane@example.com", "email_verified": true, "name": "Jane"}
+	provider := newTestOIDCProvider(t, issuer)
+
+	code := issuer.approve(t, provider.AuthCodeURL("state", "verifier-0123456789-0123456789-0123456789", "nonce"))
+
+	identity, err := provider.Exchange(context.Background(), code, "verifier-0123456789-0123456789-0123456789", "nonce")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := SocialIdentity{Provider: "fake", Subject: "subject-1", Email: "jane@example.com", EmailVerified: true, Name: "Jane"}
+
+	if identity != want {
+		t.Fatalf("got %+v, want %+v", identity, want)
+	}
+}
+
+func TestOIDCProviderExchangeRejects(t *testing.T) {
+	const verifier = "verifier-0123456789-0123456789-0123456789"
+
+	forger, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		setup    func(issuer *fakeIssuer)
+		verifier string
+		nonce    string
+	}{
+		{name: "wrong code verifier", verifier: "another-verifier-0123456789-0123456789", nonce: "nonce"},
+		{name: "wrong nonce", verifier: verifier, nonce: "another-nonce"},
+		{name: "forged signature", setup: func(issuer *fakeIssuer) { issuer.signer = forger }, verifier: verifier, nonce: "nonce"},
+		{name: "other audience", setup: func(issuer *fakeIssuer) { issuer.audience = "other-client" }, verifier: verifier, nonce: "nonce"},
+		{name: "expired token", setup: func(issuer *fakeIssuer) {
+			issuer.claims = jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}
+		}, verifier: verifier, nonce: "nonce"},
+		{name: "other issuer", setup: func(issuer *fakeIssuer) {
+			issuer.claims = jwt.MapClaims{"iss": "https://evil.example.com"}
+		}, verifier: verifier, nonce: "nonce"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			issuer := newFakeIssuer(t)
+			provider := newTestOIDCProvider(t, issuer)
+
+			if test.setup != nil {
+				test.setup(issuer)
+			}
+
+			code := issuer.approve(t, provider.AuthCodeURL("state", verifier, "nonce"))
+
+			if _, err := provider.Exchange(context.Background(), code, test.verifier, test.nonce); err == nil {
+				t.Fatal("expected the exchange to fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package social
+
+import "context"
+
+type SocialIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type SocialProvider interface {
+	Name() string
+	AuthCodeURL(state string, codeVerifier string, nonce string) string
+	Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (SocialIdentity, error)
+}
@@ -0,0 +1,66 @@
+package sso
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"os"
+)
+
+// SamlConfig declares one enterprise SAML connection. The IdP is described
+// either by its metadata file or by entity id, SSO url and signing
+// certificate. Attributes are looked up by name in the assertion. A
+// connection only vouches for the email domains and the organization it was
+// set up for, and its roles are roles inside that organization.
+type SamlConfig struct {
+	Name              string            `json:"name"`
+	Organization      string            `json:"organization"`
+	EmailDomains      []string          `json:"email_domains"`
+	IdpMetadataFile   string            `json:"idp_metadata_file"`
+	IdpEntityID       string            `json:"idp_entity_id"`
+	IdpSsoURL         string            `json:"idp_sso_url"`
+	IdpCertificate    string            `json:"idp_certificate"`
+	AllowIdpInitiated bool              `json:"allow_idp_initiated"`
+	EmailAttribute    string            `json:"email_attribute"`
+	NameAttribute     string            `json:"name_attribute"`
+	RoleAttribute     string            `json:"role_attribute"`
+	RoleMapping       map[string]string `json:"role_mapping"`
+	DefaultRole       string            `json:"default_role"`
+}
+
+func LoadSamlConfigs(path string) ([]SamlConfig, error) {
+	configs := []SamlConfig{}
+
+	if len(path) <= 0 {
+		return configs, nil
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return configs, err
+	}
+
+	err = json.Unmarshal([]byte(os.ExpandEnv(string(data))), &configs)
+
+	return configs, err
+}
+
+// LoadServiceProviderKeyPair reads the PEM encoded key and certificate the
+// service provider signs requests with and publishes in its metadata.
+func LoadServiceProviderKeyPair(certificateFile string, keyFile string) (crypto.Signer, *x509.Certificate, error) {
+	keyPair, err := tls.LoadX509KeyPair(certificateFile, keyFile)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certificate, err := x509.ParseCertificate(keyPair.Certificate[0])
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return keyPair.PrivateKey.(crypto.Signer), certificate, nil
+}
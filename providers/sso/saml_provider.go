@@ -0,0 +1,282 @@
+package sso
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/google/uuid"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+// SamlIdentity is the user the IdP vouched for, Role is their role in the
+// connection's organization. AssertionID stays acceptable for ExpiresIn, the
+// caller records it that long to refuse replays.
+type SamlIdentity struct {
+	Connection  string
+	AssertionID string
+	ExpiresIn   time.Duration
+	Subject     string
+	Email       string
+	Name        string
+	Role        string
+}
+
+type SamlConnection struct {
+	Config          SamlConfig
+	ServiceProvider *saml.ServiceProvider
+}
+
+// NewSamlConnection builds the service provider for one connection, its
+// metadata and assertion consumer service live under baseURL.
+func NewSamlConnection(config SamlConfig, baseURL string, key crypto.Signer, certificate *x509.Certificate) (*SamlConnection, error) {
+	err := validateSamlConfig(&config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	idpMetadata, err := idpMetadata(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	metadataURL, err := url.Parse(strings.TrimRight(baseURL, "/") + "/" + config.Name + "/metadata")
+
+	if err != nil {
+		return nil, err
+	}
+
+	acsURL, err := url.Parse(strings.TrimRight(baseURL, "/") + "/" + config.Name + "/acs")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &SamlConnection{
+		Config: config,
+		ServiceProvider: &saml.ServiceProvider{
+			EntityID:          metadataURL.String(),
+			Key:               key,
+			Certificate:       certificate,
+			MetadataURL:       *metadataURL,
+			AcsURL:            *acsURL,
+			IDPMetadata:       idpMetadata,
+			AllowIDPInitiated: config.AllowIdpInitiated,
+		},
+	}, nil
+}
+
+func NewSamlConnections(configs []SamlConfig, baseURL string, key crypto.Signer, certificate *x509.Certificate) (map[string]*SamlConnection, error) {
+	connections := map[string]*SamlConnection{}
+
+	for _, config := range configs {
+		connection, err := NewSamlConnection(config, baseURL, key, certificate)
+
+		if err != nil {
+			return connections, err
+		}
+
+		connections[config.Name] = connection
+	}
+
+	return connections, nil
+}
+
+// validateSamlConfig refuses connections that could sign anyone in: each
+// one provisions accounts just in time, so it must be scoped to the email
+// domains it vouches for, and only maps to organization roles.
+func validateSamlConfig(config *SamlConfig) error {
+	if len(config.EmailDomains) <= 0 {
+		return errors.New("saml connection " + config.Name + " needs email_domains")
+	}
+
+	if len(config.Organization) > 0 {
+		if _, err := uuid.Parse(config.Organization); err != nil {
+			return errors.New("saml connection " + config.Name + " has an invalid organization")
+		}
+	}
+
+	if len(config.DefaultRole) <= 0 {
+		config.DefaultRole = models.MemberRole
+	}
+
+	roles := []string{config.DefaultRole}
+
+	for _, role := range config.RoleMapping {
+		roles = append(roles, role)
+	}
+
+	for _, role := range roles {
+		if !models.ValidateMembershipRole(role) {
+			return errors.New("saml connection " + config.Name + " maps to unknown organization role " + role)
+		}
+	}
+
+	return nil
+}
+
+func idpMetadata(config SamlConfig) (*saml.EntityDescriptor, error) {
+	if len(config.IdpMetadataFile) > 0 {
+		data, err := os.ReadFile(config.IdpMetadataFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		metadata := &saml.EntityDescriptor{}
+		err = xml.Unmarshal(data, metadata)
+
+		return metadata, err
+	}
+
+	certificate := config.IdpCertificate
+
+	// Accept both a PEM block and the bare base64 body metadata files use.
+	if block, _ := pem.Decode([]byte(certificate)); block != nil {
+		certificate = base64.StdEncoding.EncodeToString(block.Bytes)
+	}
+
+	if len(config.IdpEntityID) <= 0 || len(config.IdpSsoURL) <= 0 || len(certificate) <= 0 {
+		return nil, errors.New("saml connection " + config.Name + " needs idp_metadata_file or idp_entity_id, idp_sso_url and idp_certificate")
+	}
+
+	return &saml.EntityDescriptor{
+		EntityID: config.IdpEntityID,
+		IDPSSODescriptors: []saml.IDPSSODescriptor{
+			{
+				SSODescriptor: saml.SSODescriptor{
+					RoleDescriptor: saml.RoleDescriptor{
+						ProtocolSupportEnumeration: "urn:oasis:names:tc:SAML:2.0:protocol",
+						KeyDescriptors: []saml.KeyDescriptor{
+							{
+								Use: "signing",
+								KeyInfo: saml.KeyInfo{
+									X509Data: saml.X509Data{
+										X509Certificates: []saml.X509Certificate{{Data: certificate}},
+									},
+								},
+							},
+						},
+					},
+				},
+				SingleSignOnServices: []saml.Endpoint{
+					{Binding: saml.HTTPRedirectBinding, Location: config.IdpSsoURL},
+				},
+			},
+		},
+	}, nil
+}
+
+// AllowsEmail tells whether the connection may vouch for the address, none
+// passes when no email domain was configured.
+func (connection SamlConnection) AllowsEmail(email string) bool {
+	at := strings.LastIndex(email, "@")
+
+	if at < 0 {
+		return false
+	}
+
+	for _, domain := range connection.Config.EmailDomains {
+		if strings.EqualFold(email[at+1:], domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (connection SamlConnection) Metadata() ([]byte, error) {
+	return xml.MarshalIndent(connection.ServiceProvider.Metadata(), "", "  ")
+}
+
+// AuthenticationRequest starts an SP-initiated login, the request id must be
+// kept to validate the InResponseTo of the assertion that comes back.
+func (connection SamlConnection) AuthenticationRequest(relayState string) (string, string, error) {
+	sp := connection.ServiceProvider
+
+	request, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	redirect, err := request.Redirect(relayState, sp)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return request.ID, redirect.String(), nil
+}
+
+// ParseResponse validates the signed assertion posted to the ACS and maps
+// its attributes, an empty requestIDs only passes for IdP-initiated logins
+// when the connection allows them.
+func (connection SamlConnection) ParseResponse(request *http.Request, requestIDs []string) (SamlIdentity, error) {
+	// crewjam reads request.Form without parsing it.
+	err := request.ParseForm()
+
+	if err != nil {
+		return SamlIdentity{}, err
+	}
+
+	assertion, err := connection.ServiceProvider.ParseResponse(request, requestIDs)
+
+	if err != nil {
+		return SamlIdentity{}, err
+	}
+
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || len(assertion.Subject.NameID.Value) <= 0 {
+		return SamlIdentity{}, errors.New("assertion has no subject")
+	}
+
+	// crewjam accepts the assertion until its conditions expire, give or take
+	// the clock skew it tolerates.
+	identity := SamlIdentity{
+		Connection:  connection.Config.Name,
+		AssertionID: assertion.ID,
+		ExpiresIn:   assertion.Conditions.NotOnOrAfter.Add(saml.MaxClockSkew).Sub(saml.TimeNow()),
+		Subject:     assertion.Subject.NameID.Value,
+		Role:        connection.Config.DefaultRole,
+	}
+
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			if len(attribute.Values) <= 0 {
+				continue
+			}
+
+			value := attribute.Values[0].Value
+
+			switch attribute.Name {
+			case connection.Config.EmailAttribute:
+				identity.Email = value
+			case connection.Config.NameAttribute:
+				identity.Name = value
+			case connection.Config.RoleAttribute:
+				for _, candidate := range attribute.Values {
+					if role, ok := connection.Config.RoleMapping[candidate.Value]; ok {
+						identity.Role = role
+					}
+				}
+			}
+		}
+	}
+
+	if len(identity.Email) <= 0 {
+		identity.Email = identity.Subject
+	}
+
+	return identity, nil
+}
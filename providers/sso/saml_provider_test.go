@@ -0,0 +1,237 @@
+package sso
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+)
+
+// The responses in testdata were signed once by the idp.crt key for the
+// "acme" connection below, they are valid for five minutes from issuedAt.
+var issuedAt = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const testOrganization = "6f1c2a54-9d0e-4c1b-8a57-3f2e1d0c9b8a"
+
+func testSamlConfig(t *testing.T) SamlConfig {
+	certificate, err := os.ReadFile("testdata/idp.crt")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return SamlConfig{
+		Name:              "acme",
+		Organization:      testOrganization,
+		EmailDomains:      []string{"acme.example"},
+		IdpEntityID:       "https://idp.acme.example/metadata",
+		IdpSsoURL:         "https://idp.acme.example/sso",
+		IdpCertificate:    string(certificate),
+		AllowIdpInitiated: true,
+		EmailAttribute:    "email",
+		NameAttribute:     "name",
+		RoleAttribute:     "groups",
+		RoleMapping:       map[string]string{"go-auth-admins": "admin"},
+	}
+}
+
+func newTestConnection(t *testing.T, config SamlConfig) *SamlConnection {
+	key, certificate, err := LoadServiceProviderKeyPair("testdata/sp.crt", "testdata/sp.key")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connection, err := NewSamlConnection(config, "https://sp.example.com/saml", key, certificate)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return connection
+}
+
+// setNow moves the clock crewjam validates assertions against.
+func setNow(t *testing.T, now time.Time) {
+	previous := saml.TimeNow
+	saml.TimeNow = func() time.Time { return now }
+	t.Cleanup(func() { saml.TimeNow = previous })
+}
+
+func responseRequest(t *testing.T, fixture string, edit func(string) string) *http.Request {
+	data, err := os.ReadFile("testdata/" + fixture + ".xml")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := url.Values{"SAMLResponse": {base64.StdEncoding.EncodeToString([]byte(edit(string(data))))}}
+	request := httptest.NewRequest(http.MethodPost, "https://sp.example.com/saml/acme/acs", strings.NewReader(body.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return request
+}
+
+func unchanged(response string) string {
+	return response
+}
+
+// ExpiresIn runs to the five minute validity plus the clock skew crewjam
+// tolerates.
+func TestParseResponseMapsAttributes(t *testing.T) {
+	setNow(t, issuedAt.Add(time.Minute))
+	connection := newTestConnection(t, testSamlConfig(t))
+
+	tests := []struct {
+		fixture string
+		want    SamlIdentity
+	}{
+		{"jane_admin", SamlIdentity{Connection: "acme", AssertionID: "id-jane_admin", ExpiresIn: 7 * time.Minute, Subject: "jane-id", Email: "jane@acme.example", Name: "Jane", Role: "admin"}},
+		{"jane_member", SamlIdentity{Connection: "acme", AssertionID: "id-jane_member", ExpiresIn: 7 * time.Minute, Subject: "jane-id", Email: "jane@acme.example", Name: "Jane Doe", Role: "member"}},
+		{"john", SamlIdentity{Connection: "acme", AssertionID: "id-john", ExpiresIn: 7 * time.Minute, Subject: "john-id", Email: "john@acme.example", Name: "John", Role: "member"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			identity, err := connection.ParseResponse(responseRequest(t, test.fixture, unchanged), nil)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if identity != test.want {
+				t.Fatalf("got %+v, want %+v", identity, test.want)
+			}
+		})
+	}
+}
+
+func TestParseResponseRejectsInvalidAssertions(t *testing.T) {
+	config := testSamlConfig(t)
+
+	tests := []struct {
+		name       string
+		now        time.Time
+		config     func(SamlConfig) SamlConfig
+		edit       func(string) string
+		requestIDs []string
+	}{
+		{
+			name: "tampered email",
+			now:  issuedAt.Add(time.Minute),
+			edit: func(response string) string {
+				return strings.Replace(response, "jane@acme.example", "admin@acme.example", 1)
+			},
+		},
+		{
+			name: "expired",
+			now:  issuedAt.Add(time.Hour),
+		},
+		{
+			name: "another connection",
+			now:  issuedAt.Add(time.Minute),
+			config: func(config SamlConfig) SamlConfig {
+				config.Name = "globex"
+				return config
+			},
+		},
+		{
+			name: "idp initiated not allowed",
+			now:  issuedAt.Add(time.Minute),
+			config: func(config SamlConfig) SamlConfig {
+				config.AllowIdpInitiated = false
+				return config
+			},
+		},
+		{
+			name:       "unsolicited while a request is pending",
+			now:        issuedAt.Add(time.Minute),
+			requestIDs: []string{"id-pending"},
+			config: func(config SamlConfig) SamlConfig {
+				config.AllowIdpInitiated = false
+				return config
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setNow(t, test.now)
+
+			testConfig := config
+
+			if test.config != nil {
+				testConfig = test.config(config)
+			}
+
+			edit := unchanged
+
+			if test.edit != nil {
+				edit = test.edit
+			}
+
+			connection := newTestConnection(t, testConfig)
+
+			if _, err := connection.ParseResponse(responseRequest(t, "jane_admin", edit), test.requestIDs); err == nil {
+				t.Fatal("response was accepted")
+			}
+		})
+	}
+}
+
+func TestValidateSamlConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		edit   func(*SamlConfig)
+		wantOk bool
+	}{
+		{"scoped to organization and domains", func(config *SamlConfig) {}, true},
+		{"scoped to domains only", func(config *SamlConfig) { config.Organization = ""; config.RoleMapping = nil }, true},
+		{"scoped to organization only", func(config *SamlConfig) { config.EmailDomains = nil }, false},
+		{"not scoped", func(config *SamlConfig) { config.Organization = ""; config.EmailDomains = nil }, false},
+		{"invalid organization", func(config *SamlConfig) { config.Organization = "acme" }, false},
+		{"platform role mapped", func(config *SamlConfig) { config.RoleMapping = map[string]string{"staff": "support"} }, false},
+		{"platform default role", func(config *SamlConfig) { config.DefaultRole = "user" }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testSamlConfig(t)
+			test.edit(&config)
+
+			if err := validateSamlConfig(&config); (err == nil) != test.wantOk {
+				t.Fatalf("got %v, want ok=%v", err, test.wantOk)
+			}
+		})
+	}
+}
+
+func TestAllowsEmail(t *testing.T) {
+	connection := SamlConnection{Config: SamlConfig{EmailDomains: []string{"acme.example"}}}
+
+	tests := map[string]bool{
+		"jane@acme.example":           true,
+		"jane@ACME.example":           true,
+		"jane@other.example":          false,
+		"jane@sub.acme.example":       false,
+		"jane@acme.example.evil":      false,
+		"acme.example@evil.test":      false,
+		"jane@evil.test@acme.example": true,
+	}
+
+	for email, want := range tests {
+		if got := connection.AllowsEmail(email); got != want {
+			t.Errorf("%s: got %v, want %v", email, got, want)
+		}
+	}
+
+	if (SamlConnection{}).AllowsEmail("jane@other.example") {
+		t.Error("a connection without domains allowed an email")
+	}
+}
@@ -0,0 +1,84 @@
+package apikey
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/database"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type ApiKeySqlxRepository struct {
+	Database *sqlx.DB
+}
+
+func NewApiKeySqlxRepository(db *sqlx.DB) *ApiKeySqlxRepository {
+	return &ApiKeySqlxRepository{db}
+}
+
+func (r ApiKeySqlxRepository) GetApiKeyBySecretHash(secretHash string) (models.ApiKey, error) {
+	var apiKey models.ApiKey
+
+	err := r.Database.QueryRow("SELECT id, owner, name, prefix, secret_hash, scopes, expires_at, last_used_at, created_at, updated_at FROM api_keys WHERE secret_hash = $1", secretHash).
+		Scan(&apiKey.ID, &apiKey.Owner, &apiKey.Name, &apiKey.Prefix, &apiKey.SecretHash, &apiKey.Scopes, &apiKey.ExpiresAt, &apiKey.LastUsedAt, &apiKey.CreatedAt, &apiKey.UpdatedAt)
+
+	return apiKey, err
+}
+
+func (r ApiKeySqlxRepository) GetApiKeysByOwner(owner string) ([]models.ApiKey, error) {
+	apiKeys := []models.ApiKey{}
+
+	rows, err := r.Database.Query("SELECT id, owner, name, prefix, secret_hash, scopes, expires_at, last_used_at, created_at, updated_at FROM api_keys WHERE owner = $1 ORDER BY created_at", owner)
+
+	if err != nil {
+		return apiKeys, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var apiKey models.ApiKey
+
+		err = rows.Scan(&apiKey.ID, &apiKey.Owner, &apiKey.Name, &apiKey.Prefix, &apiKey.SecretHash, &apiKey.Scopes, &apiKey.ExpiresAt, &apiKey.LastUsedAt, &apiKey.CreatedAt, &apiKey.UpdatedAt)
+
+		if err != nil {
+			return apiKeys, err
+		}
+
+		apiKeys = append(apiKeys, apiKey)
+	}
+
+	return apiKeys, rows.Err()
+}
+
+func (r ApiKeySqlxRepository) CreateApiKey(apiKey *models.ApiKey, transaction *sql.Tx) (*models.ApiKey, error) {
+	client := database.ParseClient(r.Database, transaction)
+
+	err := client.QueryRow("INSERT INTO api_keys (id, owner, name, prefix, secret_hash, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, owner, name, prefix, secret_hash, scopes, expires_at, last_used_at, created_at, updated_at", apiKey.ID, apiKey.Owner, apiKey.Name, apiKey.Prefix, apiKey.SecretHash, apiKey.Scopes, apiKey.ExpiresAt).
+		Scan(&apiKey.ID, &apiKey.Owner, &apiKey.Name, &apiKey.Prefix, &apiKey.SecretHash, &apiKey.Scopes, &apiKey.ExpiresAt, &apiKey.LastUsedAt, &apiKey.CreatedAt, &apiKey.UpdatedAt)
+
+	return apiKey, err
+}
+
+func (r ApiKeySqlxRepository) TouchApiKey(id string) error {
+	_, err := r.Database.Exec("UPDATE api_keys SET last_used_at = NOW() WHERE id = $1", id)
+
+	return err
+}
+
+func (r ApiKeySqlxRepository) DeleteApiKey(id string, owner string) error {
+	rows, err := r.Database.Exec("DELETE FROM api_keys WHERE id = $1 AND owner = $2", id, owner)
+
+	if err != nil {
+		return err
+	}
+
+	numberOfRows, _ := rows.RowsAffected()
+
+	if numberOfRows == 0 {
+		return errors.New("Api key not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package emailsuppression
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/database"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type EmailSuppressionSqlxRepository struct {
+	Database *sqlx.DB
+}
+
+func NewEmailSuppressionSqlxRepository(db *sqlx.DB) *EmailSuppressionSqlxRepository {
+	return &EmailSuppressionSqlxRepository{db}
+}
+
+func (r EmailSuppressionSqlxRepository) GetEmailSuppression(email string) (models.EmailSuppression, error) {
+	var suppression models.EmailSuppression
+
+	err := r.Database.QueryRow("SELECT email, reason, provider, detail, created_at, updated_at FROM email_suppressions WHERE email = $1", strings.ToLower(email)).
+		Scan(&suppression.Email, &suppression.Reason, &suppression.Provider, &suppression.Detail, &suppression.CreatedAt, &suppression.UpdatedAt)
+
+	return suppression, err
+}
+
+func (r EmailSuppressionSqlxRepository) GetEmailSuppressions() ([]models.EmailSuppression, error) {
+	suppressions := []models.EmailSuppression{}
+
+	rows, err := r.Database.Query("SELECT email, reason, provider, detail, created_at, updated_at FROM email_suppressions ORDER BY updated_at DESC")
+
+	if err != nil {
+		return suppressions, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var suppression models.EmailSuppression
+
+		err = rows.Scan(&suppression.Email, &suppression.Reason, &suppression.Provider, &suppression.Detail, &suppression.CreatedAt, &suppression.UpdatedAt)
+
+		if err != nil {
+			return suppressions, err
+		}
+
+		suppressions = append(suppressions, suppression)
+	}
+
+	return suppressions, rows.Err()
+}
+
+func (r EmailSuppressionSqlxRepository) CreateEmailSuppression(suppression *models.EmailSuppression, transaction *sql.Tx) (*models.EmailSuppression, error) {
+	client := database.ParseClient(r.Database, transaction)
+
+	err := client.QueryRow("INSERT INTO email_suppressions (email, reason, provider, detail) VALUES ($1, $2, $3, $4) ON CONFLICT (email) DO UPDATE SET reason = EXCLUDED.reason, provider = EXCLUDED.provider, detail = EXCLUDED.detail, updated_at = NOW() RETURNING email, reason, provider, detail, created_at, updated_at", suppression.Email, suppression.Reason, suppression.Provider, suppression.Detail).
+		Scan(&suppression.Email, &suppression.Reason, &suppression.Provider, &suppression.Detail, &suppression.CreatedAt, &suppression.UpdatedAt)
+
+	return suppression, err
+}
+
+func (r EmailSuppressionSqlxRepository) DeleteEmailSuppression(email string, transaction *sql.Tx) error {
+	client := database.ParseClient(r.Database, transaction)
+
+	rows, err := client.Exec("DELETE FROM email_suppressions WHERE email = $1", strings.ToLower(email))
+
+	if err != nil {
+		return err
+	}
+
+	numberOfRows, _ := rows.RowsAffected()
+
+	if numberOfRows == 0 {
+		return errors.New("Suppression not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package identity
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/database"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type IdentitySqlxRepository struct {
+	Database *sqlx.DB
+}
+
+func NewIdentitySqlxRepository(db *sqlx.DB) *IdentitySqlxRepository {
+	return &IdentitySqlxRepository{db}
+}
+
+func (r IdentitySqlxRepository) GetIdentity(provider string, subject string) (models.Identity, error) {
+	var identity models.Identity
+
+	err := r.Database.QueryRow("SELECT id, owner, provider, subject, created_at, updated_at FROM identities WHERE provider = $1 AND subject = $2", provider, subject).
+		Scan(&identity.ID, &identity.Owner, &identity.Provider, &identity.Subject, &identity.CreatedAt, &identity.UpdatedAt)
+
+	return identity, err
+}
+
+func (r IdentitySqlxRepository) GetIdentitiesByOwner(owner string) ([]models.Identity, error) {
+	identities := []models.Identity{}
+
+	rows, err := r.Database.Query("SELECT id, owner, provider, subject, created_at, updated_at FROM identities WHERE owner = $1 ORDER BY created_at", owner)
+
+	if err != nil {
+		return identities, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var identity models.Identity
+
+		err = rows.Scan(&identity.ID, &identity.Owner, &identity.Provider, &identity.Subject, &identity.CreatedAt, &identity.UpdatedAt)
+
+		if err != nil {
+			return identities, err
+		}
+
+		identities = append(identities, identity)
+	}
+
+	return identities, rows.Err()
+}
+
+func (r IdentitySqlxRepository) CreateIdentity(identity *models.Identity, transaction *sql.Tx) (*models.Identity, error) {
+	client := database.ParseClient(r.Database, transaction)
+
+	err := client.QueryRow("INSERT INTO identities (id, owner, provider, subject) VALUES ($1, $2, $3, $4) RETURNING id, owner, provider, subject, created_at, updated_at", identity.ID, identity.Owner, identity.Provider, identity.Subject).
+		Scan(&identity.ID, &identity.Owner, &identity.Provider, &identity.Subject, &identity.CreatedAt, &identity.UpdatedAt)
+
+	return identity, err
+}
+
+func (r IdentitySqlxRepository) DeleteIdentity(id string, owner string, transaction *sql.Tx) error {
+	client := database.ParseClient(r.Database, transaction)
+
+	rows, err := client.Exec("DELETE FROM identities WHERE id = $1 AND owner = $2", id, owner)
+
+	if err != nil {
+		return err
+	}
+
+	numberOfRows, _ := rows.RowsAffected()
+
+	if numberOfRows == 0 {
+		return errors.New("Identity not found")
+	}
+
+	return nil
+}
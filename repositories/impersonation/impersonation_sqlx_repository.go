@@ -0,0 +1,26 @@
+package impersonation
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/database"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type ImpersonationSqlxRepository struct {
+	Database *sqlx.DB
+}
+
+func NewImpersonationSqlxRepository(db *sqlx.DB) *ImpersonationSqlxRepository {
+	return &ImpersonationSqlxRepository{db}
+}
+
+func (r ImpersonationSqlxRepository) CreateImpersonation(impersonation *models.Impersonation, transaction *sql.Tx) (*models.Impersonation, error) {
+	client := database.ParseClient(r.Database, transaction)
+
+	err := client.QueryRow("INSERT INTO impersonations (id, actor, subject, client_id, reason, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, actor, subject, client_id, reason, expires_at, created_at", impersonation.ID, impersonation.Actor, impersonation.Subject, impersonation.ClientID, impersonation.Reason, impersonation.ExpiresAt).
+		Scan(&impersonation.ID, &impersonation.Actor, &impersonation.Subject, &impersonation.ClientID, &impersonation.Reason, &impersonation.ExpiresAt, &impersonation.CreatedAt)
+
+	return impersonation, err
+}
@@ -0,0 +1,93 @@
+package invitation
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/database"
+	"github.com/thiagoferolla/go-auth/database/models"
+	"gopkg.in/guregu/null.v4"
+)
+
+type InvitationSqlxRepository struct {
+	Database *sqlx.DB
+}
+
+func NewInvitationSqlxRepository(db *sqlx.DB) *InvitationSqlxRepository {
+	return &InvitationSqlxRepository{db}
+}
+
+func (r InvitationSqlxRepository) GetInvitationByID(id string) (models.Invitation, error) {
+	var invitation models.Invitation
+
+	err := r.Database.QueryRow("SELECT id, inviter, email, organization, role, token_hash, status, expires_at, created_at, updated_at FROM invitations WHERE id = $1", id).
+		Scan(&invitation.ID, &invitation.Inviter, &invitation.Email, &invitation.Organization, &invitation.Role, &invitation.TokenHash, &invitation.Status, &invitation.ExpiresAt, &invitation.CreatedAt, &invitation.UpdatedAt)
+
+	return invitation, err
+}
+
+func (r InvitationSqlxRepository) GetInvitationByTokenHash(tokenHash string) (models.Invitation, error) {
+	var invitation models.Invitation
+
+	err := r.Database.QueryRow("SELECT id, inviter, email, organization, role, token_hash, status, expires_at, created_at, updated_at FROM invitations WHERE token_hash = $1", tokenHash).
+		Scan(&invitation.ID, &invitation.Inviter, &invitation.Email, &invitation.Organization, &invitation.Role, &invitation.TokenHash, &invitation.Status, &invitation.ExpiresAt, &invitation.CreatedAt, &invitation.UpdatedAt)
+
+	return invitation, err
+}
+
+// GetPendingInvitations lists platform invitations when organization is
+// null, and the ones to that organization otherwise.
+func (r InvitationSqlxRepository) GetPendingInvitations(organization null.String) ([]models.Invitation, error) {
+	invitations := []models.Invitation{}
+
+	rows, err := r.Database.Query("SELECT id, inviter, email, organization, role, token_hash, status, expires_at, created_at, updated_at FROM invitations WHERE organization IS NOT DISTINCT FROM $1 AND status = $2 ORDER BY created_at", organization, models.InvitationPending)
+
+	if err != nil {
+		return invitations, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var invitation models.Invitation
+
+		err = rows.Scan(&invitation.ID, &invitation.Inviter, &invitation.Email, &invitation.Organization, &invitation.Role, &invitation.TokenHash, &invitation.Status, &invitation.ExpiresAt, &invitation.CreatedAt, &invitation.UpdatedAt)
+
+		if err != nil {
+			return invitations, err
+		}
+
+		invitations = append(invitations, invitation)
+	}
+
+	return invitations, rows.Err()
+}
+
+func (r InvitationSqlxRepository) CreateInvitation(invitation *models.Invitation, transaction *sql.Tx) (*models.Invitation, error) {
+	client := database.ParseClient(r.Database, transaction)
+
+	err := client.QueryRow("INSERT INTO invitations (id, inviter, email, organization, role, token_hash, status, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, inviter, email, organization, role, token_hash, status, expires_at, created_at, updated_at", invitation.ID, invitation.Inviter, invitation.Email, invitation.Organization, invitation.Role, invitation.TokenHash, invitation.Status, invitation.ExpiresAt).
+		Scan(&invitation.ID, &invitation.Inviter, &invitation.Email, &invitation.Organization, &invitation.Role, &invitation.TokenHash, &invitation.Status, &invitation.ExpiresAt, &invitation.CreatedAt, &invitation.UpdatedAt)
+
+	return invitation, err
+}
+
+func (r InvitationSqlxRepository) UpdateInvitation(invitation *models.Invitation, transaction *sql.Tx) (*models.Invitation, error) {
+	client := database.ParseClient(r.Database, transaction)
+
+	err := client.QueryRow("UPDATE invitations SET token_hash = $1, status = $2, expires_at = $3, updated_at = NOW() WHERE id = $4 RETURNING id, inviter, email, organization, role, token_hash, status, expires_at, created_at, updated_at", invitation.TokenHash, invitation.Status, invitation.ExpiresAt, invitation.ID).
+		Scan(&invitation.ID, &invitation.Inviter, &invitation.Email, &invitation.Organization, &invitation.Role, &invitation.TokenHash, &invitation.Status, &invitation.ExpiresAt, &invitation.CreatedAt, &invitation.UpdatedAt)
+
+	return invitation, err
+}
+
+// AcceptInvitation checks the status in the UPDATE itself, two requests with
+// the same token can't both find the invitation pending.
+func (r InvitationSqlxRepository) AcceptInvitation(invitation *models.Invitation, transaction *sql.Tx) (*models.Invitation, error) {
+	client := database.ParseClient(r.Database, transaction)
+
+	err := client.QueryRow("UPDATE invitations SET status = $1, updated_at = NOW() WHERE id = $2 AND status = $3 AND expires_at > NOW() RETURNING id, inviter, email, organization, role, token_hash, status, expires_at, created_at, updated_at", models.InvitationAccepted, invitation.ID, models.InvitationPending).
+		Scan(&invitation.ID, &invitation.Inviter, &invitation.Email, &invitation.Organization, &invitation.Role, &invitation.TokenHash, &invitation.Status, &invitation.ExpiresAt, &invitation.CreatedAt, &invitation.UpdatedAt)
+
+	return invitation, err
+}
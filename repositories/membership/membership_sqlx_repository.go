@@ -0,0 +1,97 @@
+package membership
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/database"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type MembershipSqlxRepository struct {
+	Database *sqlx.DB
+}
+
+func NewMembershipSqlxRepository(db *sqlx.DB) *MembershipSqlxRepository {
+	return &MembershipSqlxRepository{db}
+}
+
+func (r MembershipSqlxRepository) GetMembership(organization string, user string) (models.Membership, error) {
+	var membership models.Membership
+
+	err := r.Database.QueryRow("SELECT organization, user_id, role, external_id, provisioned, created_at, updated_at FROM memberships WHERE organization = $1 AND user_id = $2", organization, user).
+		Scan(&membership.Organization, &membership.User, &membership.Role, &membership.ExternalID, &membership.Provisioned, &membership.CreatedAt, &membership.UpdatedAt)
+
+	return membership, err
+}
+
+func (r MembershipSqlxRepository) GetMembershipsByOrganization(organization string) ([]models.Membership, error) {
+	memberships := []models.Membership{}
+
+	rows, err := r.Database.Query("SELECT organization, user_id, role, external_id, provisioned, created_at, updated_at FROM memberships WHERE organization = $1 ORDER BY created_at", organization)
+
+	if err != nil {
+		return memberships, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var membership models.Membership
+
+		err = rows.Scan(&membership.Organization, &membership.User, &membership.Role, &membership.ExternalID, &membership.Provisioned, &membership.CreatedAt, &membership.UpdatedAt)
+
+		if err != nil {
+			return memberships, err
+		}
+
+		memberships = append(memberships, membership)
+	}
+
+	return memberships, rows.Err()
+}
+
+func (r MembershipSqlxRepository) CountMembershipsByRole(organization string, role string) (int, error) {
+	var count int
+
+	err := r.Database.QueryRow("SELECT COUNT(*) FROM memberships WHERE organization = $1 AND role = $2", organization, role).Scan(&count)
+
+	return count, err
+}
+
+func (r MembershipSqlxRepository) CreateMembership(membership *models.Membership, transaction *sql.Tx) (*models.Membership, error) {
+	client := database.ParseClient(r.Database, transaction)
+
+	err := client.QueryRow("INSERT INTO memberships (organization, user_id, role, external_id, provisioned) VALUES ($1, $2, $3, $4, $5) RETURNING organization, user_id, role, external_id, provisioned, created_at, updated_at", membership.Organization, membership.User, membership.Role, membership.ExternalID, membership.Provisioned).
+		Scan(&membership.Organization, &membership.User, &membership.Role, &membership.ExternalID, &membership.Provisioned, &membership.CreatedAt, &membership.UpdatedAt)
+
+	return membership, err
+}
+
+func (r MembershipSqlxRepository) UpdateMembership(membership *models.Membership, transaction *sql.Tx) (*models.Membership, error) {
+	client := database.ParseClient(r.Database, transaction)
+
+	err := client.QueryRow("UPDATE memberships SET role = $1, external_id = $2, updated_at = NOW() WHERE organization = $3 AND user_id = $4 RETURNING organization, user_id, role, external_id, provisioned, created_at, updated_at", membership.Role, membership.ExternalID, membership.Organization, membership.User).
+		Scan(&membership.Organization, &membership.User, &membership.Role, &membership.ExternalID, &membership.Provisioned, &membership.CreatedAt, &membership.UpdatedAt)
+
+	return membership, err
+}
+
+func (r MembershipSqlxRepository) DeleteMembership(organization string, user string, transaction *sql.Tx) error {
+	client := database.ParseClient(r.Database, transaction)
+
+	rows, err := client.Exec("DELETE FROM memberships WHERE organization = $1 AND user_id = $2", organization, user)
+
+	if err != nil {
+		return err
+	}
+
+	numberOfRows, _ := rows.RowsAffected()
+
+	if numberOfRows == 0 {
+		return errors.New("Membership not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+	"gopkg.in/guregu/null.v4"
+)
+
+type ApiKeyRepository struct {
+	mutex   sync.Mutex
+	apiKeys map[string]models.ApiKey
+}
+
+func NewApiKeyRepository() *ApiKeyRepository {
+	return &ApiKeyRepository{apiKeys: map[string]models.ApiKey{}}
+}
+
+func (r *ApiKeyRepository) GetApiKeyBySecretHash(secretHash string) (models.ApiKey, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, apiKey := range r.apiKeys {
+		if apiKey.SecretHash == secretHash {
+			return apiKey, nil
+		}
+	}
+
+	return models.ApiKey{}, sql.ErrNoRows
+}
+
+func (r *ApiKeyRepository) GetApiKeysByOwner(owner string) ([]models.ApiKey, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	apiKeys := []models.ApiKey{}
+
+	for _, apiKey := range r.apiKeys {
+		if apiKey.Owner.String() == owner {
+			apiKeys = append(apiKeys, apiKey)
+		}
+	}
+
+	return apiKeys, nil
+}
+
+func (r *ApiKeyRepository) CreateApiKey(apiKey *models.ApiKey, transaction *sql.Tx) (*models.ApiKey, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	apiKey.CreatedAt = time.Now()
+	apiKey.UpdatedAt = apiKey.CreatedAt
+	r.apiKeys[apiKey.ID.String()] = *apiKey
+
+	return apiKey, nil
+}
+
+func (r *ApiKeyRepository) TouchApiKey(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	apiKey, ok := r.apiKeys[id]
+
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	apiKey.LastUsedAt = null.NewTime(time.Now(), true)
+	r.apiKeys[id] = apiKey
+
+	return nil
+}
+
+func (r *ApiKeyRepository) DeleteApiKey(id string, owner string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	apiKey, ok := r.apiKeys[id]
+
+	if !ok || apiKey.Owner.String() != owner {
+		return sql.ErrNoRows
+	}
+
+	delete(r.apiKeys, id)
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type IdentityRepository struct {
+	mutex      sync.Mutex
+	identities []models.Identity
+}
+
+func NewIdentityRepository() *IdentityRepository {
+	return &IdentityRepository{identities: []models.Identity{}}
+}
+
+func (r *IdentityRepository) GetIdentity(provider string, subject string) (models.Identity, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+
+	return models.Identity{}, sql.ErrNoRows
+}
+
+func (r *IdentityRepository) GetIdentitiesByOwner(owner string) ([]models.Identity, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	identities := []models.Identity{}
+
+	for _, identity := range r.identities {
+		if identity.Owner.String() == owner {
+			identities = append(identities, identity)
+		}
+	}
+
+	return identities, nil
+}
+
+func (r *IdentityRepository) CreateIdentity(identity *models.Identity, transaction *sql.Tx) (*models.Identity, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return identity, errors.New("duplicate identity")
+		}
+	}
+
+	identity.CreatedAt = time.Now()
+	identity.UpdatedAt = identity.CreatedAt
+	r.identities = append(r.identities, *identity)
+
+	return identity, nil
+}
+
+func (r *IdentityRepository) DeleteIdentity(id string, owner string, transaction *sql.Tx) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, identity := range r.identities {
+		if identity.ID.String() == id && identity.Owner.String() == owner {
+			r.identities = append(r.identities[:i], r.identities[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("Identity not found")
+}
@@ -0,0 +1,36 @@
+package memory
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type ImpersonationRepository struct {
+	mutex          sync.Mutex
+	impersonations []models.Impersonation
+}
+
+func NewImpersonationRepository() *ImpersonationRepository {
+	return &ImpersonationRepository{}
+}
+
+func (r *ImpersonationRepository) CreateImpersonation(impersonation *models.Impersonation, transaction *sql.Tx) (*models.Impersonation, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	impersonation.CreatedAt = time.Now()
+	r.impersonations = append(r.impersonations, *impersonation)
+
+	return impersonation, nil
+}
+
+// Impersonations lists the recorded exchanges, oldest first.
+func (r *ImpersonationRepository) Impersonations() []models.Impersonation {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]models.Impersonation{}, r.impersonations...)
+}
@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+	"gopkg.in/guregu/null.v4"
+)
+
+type InvitationRepository struct {
+	mutex       sync.Mutex
+	invitations []models.Invitation
+}
+
+func NewInvitationRepository() *InvitationRepository {
+	return &InvitationRepository{invitations: []models.Invitation{}}
+}
+
+func (r *InvitationRepository) find(match func(models.Invitation) bool) (models.Invitation, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, invitation := range r.invitations {
+		if match(invitation) {
+			return invitation, nil
+		}
+	}
+
+	return models.Invitation{}, sql.ErrNoRows
+}
+
+func (r *InvitationRepository) GetInvitationByID(id string) (models.Invitation, error) {
+	return r.find(func(invitation models.Invitation) bool {
+		return invitation.ID.String() == id
+	})
+}
+
+func (r *InvitationRepository) GetInvitationByTokenHash(tokenHash string) (models.Invitation, error) {
+	return r.find(func(invitation models.Invitation) bool {
+		return invitation.TokenHash == tokenHash
+	})
+}
+
+func (r *InvitationRepository) GetPendingInvitations(organization null.String) ([]models.Invitation, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	invitations := []models.Invitation{}
+
+	for _, invitation := range r.invitations {
+		if invitation.Organization == organization && invitation.Status == models.InvitationPending {
+			invitations = append(invitations, invitation)
+		}
+	}
+
+	return invitations, nil
+}
+
+func (r *InvitationRepository) CreateInvitation(invitation *models.Invitation, transaction *sql.Tx) (*models.Invitation, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	invitation.CreatedAt = time.Now()
+	invitation.UpdatedAt = invitation.CreatedAt
+	r.invitations = append(r.invitations, *invitation)
+
+	return invitation, nil
+}
+
+func (r *InvitationRepository) UpdateInvitation(invitation *models.Invitation, transaction *sql.Tx) (*models.Invitation, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, existing := range r.invitations {
+		if existing.ID == invitation.ID {
+			invitation.UpdatedAt = time.Now()
+			r.invitations[i] = *invitation
+			return invitation, nil
+		}
+	}
+
+	return invitation, sql.ErrNoRows
+}
+
+func (r *InvitationRepository) AcceptInvitation(invitation *models.Invitation, transaction *sql.Tx) (*models.Invitation, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, existing := range r.invitations {
+		if existing.ID == invitation.ID && existing.IsOpen() {
+			existing.Status = models.InvitationAccepted
+			existing.UpdatedAt = time.Now()
+			r.invitations[i] = existing
+			*invitation = existing
+			return invitation, nil
+		}
+	}
+
+	return invitation, sql.ErrNoRows
+}
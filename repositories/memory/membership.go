@@ -0,0 +1,104 @@
+package memory
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type MembershipRepository struct {
+	mutex       sync.Mutex
+	memberships []models.Membership
+}
+
+func NewMembershipRepository() *MembershipRepository {
+	return &MembershipRepository{memberships: []models.Membership{}}
+}
+
+func (r *MembershipRepository) GetMembership(organization string, user string) (models.Membership, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, membership := range r.memberships {
+		if membership.Organization.String() == organization && membership.User.String() == user {
+			return membership, nil
+		}
+	}
+
+	return models.Membership{}, sql.ErrNoRows
+}
+
+func (r *MembershipRepository) GetMembershipsByOrganization(organization string) ([]models.Membership, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	memberships := []models.Membership{}
+
+	for _, membership := range r.memberships {
+		if membership.Organization.String() == organization {
+			memberships = append(memberships, membership)
+		}
+	}
+
+	return memberships, nil
+}
+
+func (r *MembershipRepository) CountMembershipsByRole(organization string, role string) (int, error) {
+	memberships, err := r.GetMembershipsByOrganization(organization)
+	count := 0
+
+	for _, membership := range memberships {
+		if membership.Role == role {
+			count++
+		}
+	}
+
+	return count, err
+}
+
+func (r *MembershipRepository) CreateMembership(membership *models.Membership, transaction *sql.Tx) (*models.Membership, error) {
+	if _, err := r.GetMembership(membership.Organization.String(), membership.User.String()); err == nil {
+		return membership, errors.New("duplicate membership")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	membership.CreatedAt = time.Now()
+	membership.UpdatedAt = membership.CreatedAt
+	r.memberships = append(r.memberships, *membership)
+
+	return membership, nil
+}
+
+func (r *MembershipRepository) UpdateMembership(membership *models.Membership, transaction *sql.Tx) (*models.Membership, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, existing := range r.memberships {
+		if existing.Organization == membership.Organization && existing.User == membership.User {
+			membership.UpdatedAt = time.Now()
+			r.memberships[i] = *membership
+			return membership, nil
+		}
+	}
+
+	return membership, sql.ErrNoRows
+}
+
+func (r *MembershipRepository) DeleteMembership(organization string, user string, transaction *sql.Tx) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, membership := range r.memberships {
+		if membership.Organization.String() == organization && membership.User.String() == user {
+			r.memberships = append(r.memberships[:i], r.memberships[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("Membership not found")
+}
@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type OAuthClientRepository struct {
+	mutex   sync.Mutex
+	clients map[string]models.OAuthClient
+}
+
+func NewOAuthClientRepository() *OAuthClientRepository {
+	return &OAuthClientRepository{clients: map[string]models.OAuthClient{}}
+}
+
+func (r *OAuthClientRepository) GetClientByID(id string) (models.OAuthClient, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	client, ok := r.clients[id]
+
+	if !ok {
+		return client, sql.ErrNoRows
+	}
+
+	return client, nil
+}
+
+func (r *OAuthClientRepository) GetClients() ([]models.OAuthClient, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	clients := []models.OAuthClient{}
+
+	for _, client := range r.clients {
+		clients = append(clients, client)
+	}
+
+	return clients, nil
+}
+
+func (r *OAuthClientRepository) CreateClient(client *models.OAuthClient, transaction *sql.Tx) (*models.OAuthClient, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	client.CreatedAt = time.Now()
+	client.UpdatedAt = client.CreatedAt
+	r.clients[client.ID] = *client
+
+	return client, nil
+}
+
+func (r *OAuthClientRepository) UpdateClient(client *models.OAuthClient, transaction *sql.Tx) (*models.OAuthClient, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.clients[client.ID]; !ok {
+		return client, sql.ErrNoRows
+	}
+
+	client.UpdatedAt = time.Now()
+	r.clients[client.ID] = *client
+
+	return client, nil
+}
@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+// OrganizationRepository reads members from the membership repository it is
+// given, the way the SQL one joins the memberships table.
+type OrganizationRepository struct {
+	mutex         sync.Mutex
+	organizations map[string]models.Organization
+	memberships   *MembershipRepository
+}
+
+func NewOrganizationRepository(memberships *MembershipRepository) *OrganizationRepository {
+	return &OrganizationRepository{organizations: map[string]models.Organization{}, memberships: memberships}
+}
+
+func (r *OrganizationRepository) BeginTransaction() (*sql.Tx, error) {
+	return BeginTransaction()
+}
+
+func (r *OrganizationRepository) GetOrganizationByID(id string) (models.Organization, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	organization, ok := r.organizations[id]
+
+	if !ok {
+		return models.Organization{}, sql.ErrNoRows
+	}
+
+	return organization, nil
+}
+
+func (r *OrganizationRepository) GetOrganizationsByMember(user string) ([]models.Organization, error) {
+	organizations := []models.Organization{}
+
+	r.memberships.mutex.Lock()
+	memberships := append([]models.Membership{}, r.memberships.memberships...)
+	r.memberships.mutex.Unlock()
+
+	for _, membership := range memberships {
+		if membership.User.String() != user {
+			continue
+		}
+
+		if organization, err := r.GetOrganizationByID(membership.Organization.String()); err == nil {
+			organizations = append(organizations, organization)
+		}
+	}
+
+	return organizations, nil
+}
+
+func (r *OrganizationRepository) CreateOrganization(organization *models.Organization, transaction *sql.Tx) (*models.Organization, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	organization.CreatedAt = time.Now()
+	organization.UpdatedAt = organization.CreatedAt
+	r.organizations[organization.ID.String()] = *organization
+
+	return organization, nil
+}
+
+func (r *OrganizationRepository) UpdateOrganization(organization *models.Organization, transaction *sql.Tx) (*models.Organization, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.organizations[organization.ID.String()]; !ok {
+		return organization, sql.ErrNoRows
+	}
+
+	organization.UpdatedAt = time.Now()
+	r.organizations[organization.ID.String()] = *organization
+
+	return organization, nil
+}
+
+func (r *OrganizationRepository) DeleteOrganization(id string, transaction *sql.Tx) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.organizations[id]; !ok {
+		return sql.ErrNoRows
+	}
+
+	delete(r.organizations, id)
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type OutboxEmailRepository struct {
+	mutex  sync.Mutex
+	emails []models.OutboxEmail
+}
+
+func NewOutboxEmailRepository() *OutboxEmailRepository {
+	return &OutboxEmailRepository{emails: []models.OutboxEmail{}}
+}
+
+func (r *OutboxEmailRepository) GetOutboxEmailByID(id string) (models.OutboxEmail, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, email := range r.emails {
+		if email.ID.String() == id {
+			return email, nil
+		}
+	}
+
+	return models.OutboxEmail{}, sql.ErrNoRows
+}
+
+func (r *OutboxEmailRepository) GetOutboxEmailsByStatus(status string) ([]models.OutboxEmail, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	emails := []models.OutboxEmail{}
+
+	for _, email := range r.emails {
+		if email.Status == status {
+			emails = append(emails, email)
+		}
+	}
+
+	return emails, nil
+}
+
+func (r *OutboxEmailRepository) CreateOutboxEmail(email *models.OutboxEmail, transaction *sql.Tx) (*models.OutboxEmail, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, existing := range r.emails {
+		if existing.IdempotencyKey == email.IdempotencyKey {
+			*email = existing
+			return email, nil
+		}
+	}
+
+	email.CreatedAt = time.Now()
+	email.UpdatedAt = email.CreatedAt
+	r.emails = append(r.emails, *email)
+
+	return email, nil
+}
+
+func (r *OutboxEmailRepository) ClaimOutboxEmails(limit int, lease time.Duration) ([]models.OutboxEmail, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	claimed := []models.OutboxEmail{}
+	now := time.Now()
+
+	for i, email := range r.emails {
+		if len(claimed) >= limit {
+			break
+		}
+
+		if email.Status == models.OutboxPending && !email.NextAttemptAt.After(now) {
+			r.emails[i].Attempts++
+			r.emails[i].NextAttemptAt = now.Add(lease)
+			claimed = append(claimed, r.emails[i])
+		}
+	}
+
+	return claimed, nil
+}
+
+func (r *OutboxEmailRepository) UpdateOutboxEmail(email *models.OutboxEmail, transaction *sql.Tx) (*models.OutboxEmail, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, existing := range r.emails {
+		if existing.ID == email.ID {
+			email.UpdatedAt = time.Now()
+			r.emails[i] = *email
+			return email, nil
+		}
+	}
+
+	return email, sql.ErrNoRows
+}
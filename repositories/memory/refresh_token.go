@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type RefreshTokenRepository struct {
+	mutex  sync.Mutex
+	tokens map[string]models.RefreshToken
+}
+
+func NewRefreshTokenRepository() *RefreshTokenRepository {
+	return &RefreshTokenRepository{tokens: map[string]models.RefreshToken{}}
+}
+
+func (r *RefreshTokenRepository) GetRefreshTokenByToken(token string) (models.RefreshToken, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	refreshToken, ok := r.tokens[token]
+
+	if !ok {
+		return refreshToken, sql.ErrNoRows
+	}
+
+	return refreshToken, nil
+}
+
+func (r *RefreshTokenRepository) InvalidateToken(token string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if refreshToken, ok := r.tokens[token]; ok {
+		refreshToken.Valid = false
+		r.tokens[token] = refreshToken
+	}
+
+	return nil
+}
+
+func (r *RefreshTokenRepository) InvalidateTokensByOwner(owner string, transaction *sql.Tx) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for token, refreshToken := range r.tokens {
+		if refreshToken.Owner.String() == owner {
+			refreshToken.Valid = false
+			r.tokens[token] = refreshToken
+		}
+	}
+
+	return nil
+}
+
+func (r *RefreshTokenRepository) CreateRefreshToken(refreshToken *models.RefreshToken, transaction *sql.Tx) (*models.RefreshToken, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	refreshToken.CreatedAt = time.Now()
+	refreshToken.UpdatedAt = refreshToken.CreatedAt
+	r.tokens[refreshToken.Token.String()] = *refreshToken
+
+	return refreshToken, nil
+}
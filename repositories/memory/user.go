@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type UserRepository struct {
+	mutex sync.Mutex
+	users map[string]models.User
+	// Memberships backs GetUsersByOrganization, it is shared with the
+	// membership repository when both are in use.
+	Memberships *MembershipRepository
+}
+
+func NewUserRepository() *UserRepository {
+	return &UserRepository{users: map[string]models.User{}}
+}
+
+func (r *UserRepository) BeginTransaction() (*sql.Tx, error) {
+	return BeginTransaction()
+}
+
+func (r *UserRepository) find(match func(models.User) bool) (models.User, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, user := range r.users {
+		if match(user) {
+			return user, nil
+		}
+	}
+
+	return models.User{}, sql.ErrNoRows
+}
+
+func (r *UserRepository) GetUserByID(id string) (models.User, error) {
+	return r.find(func(user models.User) bool { return user.ID.String() == id })
+}
+
+func (r *UserRepository) GetUserByEmail(email string) (models.User, error) {
+	return r.find(func(user models.User) bool { return user.Email == email })
+}
+
+func (r *UserRepository) GetUserByPhone(phone string) (models.User, error) {
+	return r.find(func(user models.User) bool { return user.Phone.Valid && user.Phone.String == phone })
+}
+
+func (r *UserRepository) GetUsersByOrganization(organization string) ([]models.User, error) {
+	users := []models.User{}
+
+	if r.Memberships == nil {
+		return users, nil
+	}
+
+	memberships, _ := r.Memberships.GetMembershipsByOrganization(organization)
+
+	for _, membership := range memberships {
+		if user, err := r.GetUserByID(membership.User.String()); err == nil {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+func (r *UserRepository) CreateUser(user *models.User, transaction *sql.Tx) (*models.User, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Email == user.Email {
+			return user, errors.New("duplicate email")
+		}
+	}
+
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	r.users[user.ID.String()] = *user
+
+	return user, nil
+}
+
+func (r *UserRepository) UpdateUser(user *models.User, transaction *sql.Tx) (*models.User, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.users[user.ID.String()]; !ok {
+		return user, sql.ErrNoRows
+	}
+
+	user.UpdatedAt = time.Now()
+	r.users[user.ID.String()] = *user
+
+	return user, nil
+}
+
+func (r *UserRepository) DeleteUser(id string, transaction *sql.Tx) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.users[id]; !ok {
+		return errors.New("User not found")
+	}
+
+	delete(r.users, id)
+
+	return nil
+}
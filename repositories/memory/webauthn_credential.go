@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type WebAuthnCredentialRepository struct {
+	mutex       sync.Mutex
+	credentials []models.WebAuthnCredential
+}
+
+func NewWebAuthnCredentialRepository() *WebAuthnCredentialRepository {
+	return &WebAuthnCredentialRepository{credentials: []models.WebAuthnCredential{}}
+}
+
+func (r *WebAuthnCredentialRepository) GetCredentialByID(id []byte) (models.WebAuthnCredential, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, credential := range r.credentials {
+		if bytes.Equal(credential.ID, id) {
+			return credential, nil
+		}
+	}
+
+	return models.WebAuthnCredential{}, sql.ErrNoRows
+}
+
+func (r *WebAuthnCredentialRepository) GetCredentialsByOwner(owner string) ([]models.WebAuthnCredential, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	credentials := []models.WebAuthnCredential{}
+
+	for _, credential := range r.credentials {
+		if credential.Owner.String() == owner {
+			credentials = append(credentials, credential)
+		}
+	}
+
+	return credentials, nil
+}
+
+func (r *WebAuthnCredentialRepository) CreateCredential(credential *models.WebAuthnCredential, transaction *sql.Tx) (*models.WebAuthnCredential, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	credential.CreatedAt = time.Now()
+	credential.UpdatedAt = credential.CreatedAt
+	r.credentials = append(r.credentials, *credential)
+
+	return credential, nil
+}
+
+func (r *WebAuthnCredentialRepository) UpdateSignCount(credential *models.WebAuthnCredential) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, existing := range r.credentials {
+		if bytes.Equal(existing.ID, credential.ID) {
+			r.credentials[i].SignCount = credential.SignCount
+			r.credentials[i].CloneWarning = credential.CloneWarning
+			r.credentials[i].Flags = credential.Flags
+			r.credentials[i].UpdatedAt = time.Now()
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+func (r *WebAuthnCredentialRepository) DeleteCredential(id []byte, owner string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, credential := range r.credentials {
+		if bytes.Equal(credential.ID, id) && credential.Owner.String() == owner {
+			r.credentials = append(r.credentials[:i], r.credentials[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("Credential not found")
+}
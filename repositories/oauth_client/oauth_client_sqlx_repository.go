@@ -0,0 +1,70 @@
+package oauthclient
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/database"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type OAuthClientSqlxRepository struct {
+	Database *sqlx.DB
+}
+
+func NewOAuthClientSqlxRepository(db *sqlx.DB) *OAuthClientSqlxRepository {
+	return &OAuthClientSqlxRepository{db}
+}
+
+func (r OAuthClientSqlxRepository) GetClientByID(id string) (models.OAuthClient, error) {
+	var client models.OAuthClient
+
+	err := r.Database.QueryRow("SELECT id, name, redirect_uris, scopes, secret_hash, revoked_at, created_at, updated_at FROM oauth_clients WHERE id = $1", id).
+		Scan(&client.ID, &client.Name, &client.RedirectURIs, &client.Scopes, &client.SecretHash, &client.RevokedAt, &client.CreatedAt, &client.UpdatedAt)
+
+	return client, err
+}
+
+func (r OAuthClientSqlxRepository) GetClients() ([]models.OAuthClient, error) {
+	clients := []models.OAuthClient{}
+
+	rows, err := r.Database.Query("SELECT id, name, redirect_uris, scopes, secret_hash, revoked_at, created_at, updated_at FROM oauth_clients ORDER BY created_at")
+
+	if err != nil {
+		return clients, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var client models.OAuthClient
+
+		err = rows.Scan(&client.ID, &client.Name, &client.RedirectURIs, &client.Scopes, &client.SecretHash, &client.RevokedAt, &client.CreatedAt, &client.UpdatedAt)
+
+		if err != nil {
+			return clients, err
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
+
+func (r OAuthClientSqlxRepository) CreateClient(client *models.OAuthClient, transaction *sql.Tx) (*models.OAuthClient, error) {
+	queryClient := database.ParseClient(r.Database, transaction)
+
+	err := queryClient.QueryRow("INSERT INTO oauth_clients (id, name, redirect_uris, scopes, secret_hash, revoked_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, name, redirect_uris, scopes, secret_hash, revoked_at, created_at, updated_at", client.ID, client.Name, client.RedirectURIs, client.Scopes, client.SecretHash, client.RevokedAt).
+		Scan(&client.ID, &client.Name, &client.RedirectURIs, &client.Scopes, &client.SecretHash, &client.RevokedAt, &client.CreatedAt, &client.UpdatedAt)
+
+	return client, err
+}
+
+func (r OAuthClientSqlxRepository) UpdateClient(client *models.OAuthClient, transaction *sql.Tx) (*models.OAuthClient, error) {
+	queryClient := database.ParseClient(r.Database, transaction)
+
+	err := queryClient.QueryRow("UPDATE oauth_clients SET name = $1, redirect_uris = $2, scopes = $3, secret_hash = $4, revoked_at = $5, updated_at = NOW() WHERE id = $6 RETURNING id, name, redirect_uris, scopes, secret_hash, revoked_at, created_at, updated_at", client.Name, client.RedirectURIs, client.Scopes, client.SecretHash, client.RevokedAt, client.ID).
+		Scan(&client.ID, &client.Name, &client.RedirectURIs, &client.Scopes, &client.SecretHash, &client.RevokedAt, &client.CreatedAt, &client.UpdatedAt)
+
+	return client, err
+}
@@ -0,0 +1,96 @@
+package organization
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/database"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type OrganizationSqlxRepository struct {
+	Database *sqlx.DB
+}
+
+func NewOrganizationSqlxRepository(db *sqlx.DB) *OrganizationSqlxRepository {
+	return &OrganizationSqlxRepository{db}
+}
+
+func (r OrganizationSqlxRepository) BeginTransaction() (*sql.Tx, error) {
+	c := context.Background()
+
+	return r.Database.BeginTx(c, nil)
+}
+
+func (r OrganizationSqlxRepository) GetOrganizationByID(id string) (models.Organization, error) {
+	var organization models.Organization
+
+	err := r.Database.QueryRow("SELECT id, name, created_at, updated_at FROM organizations WHERE id = $1", id).
+		Scan(&organization.ID, &organization.Name, &organization.CreatedAt, &organization.UpdatedAt)
+
+	return organization, err
+}
+
+func (r OrganizationSqlxRepository) GetOrganizationsByMember(user string) ([]models.Organization, error) {
+	organizations := []models.Organization{}
+
+	rows, err := r.Database.Query("SELECT o.id, o.name, o.created_at, o.updated_at FROM organizations o INNER JOIN memberships m ON m.organization = o.id WHERE m.user_id = $1 ORDER BY o.name", user)
+
+	if err != nil {
+		return organizations, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var organization models.Organization
+
+		err = rows.Scan(&organization.ID, &organization.Name, &organization.CreatedAt, &organization.UpdatedAt)
+
+		if err != nil {
+			return organizations, err
+		}
+
+		organizations = append(organizations, organization)
+	}
+
+	return organizations, rows.Err()
+}
+
+func (r OrganizationSqlxRepository) CreateOrganization(organization *models.Organization, transaction *sql.Tx) (*models.Organization, error) {
+	client := database.ParseClient(r.Database, transaction)
+
+	err := client.QueryRow("INSERT INTO organizations (id, name) VALUES ($1, $2) RETURNING id, name, created_at, updated_at", organization.ID, organization.Name).
+		Scan(&organization.ID, &organization.Name, &organization.CreatedAt, &organization.UpdatedAt)
+
+	return organization, err
+}
+
+func (r OrganizationSqlxRepository) UpdateOrganization(organization *models.Organization, transaction *sql.Tx) (*models.Organization, error) {
+	client := database.ParseClient(r.Database, transaction)
+
+	err := client.QueryRow("UPDATE organizations SET name = $1, updated_at = NOW() WHERE id = $2 RETURNING id, name, created_at, updated_at", organization.Name, organization.ID).
+		Scan(&organization.ID, &organization.Name, &organization.CreatedAt, &organization.UpdatedAt)
+
+	return organization, err
+}
+
+func (r OrganizationSqlxRepository) DeleteOrganization(id string, transaction *sql.Tx) error {
+	client := database.ParseClient(r.Database, transaction)
+
+	rows, err := client.Exec("DELETE FROM organizations WHERE id = $1", id)
+
+	if err != nil {
+		return err
+	}
+
+	numberOfRows, _ := rows.RowsAffected()
+
+	if numberOfRows == 0 {
+		return errors.New("Organization not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package outboxemail
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/database"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+const outboxEmailColumns = "id, idempotency_key, from_address, name, to_address, locale, template, substitutions, status, attempts, last_error, next_attempt_at, sent_at, provider, created_at, updated_at"
+
+type OutboxEmailSqlxRepository struct {
+	Database *sqlx.DB
+}
+
+func NewOutboxEmailSqlxRepository(db *sqlx.DB) *OutboxEmailSqlxRepository {
+	return &OutboxEmailSqlxRepository{db}
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanOutboxEmail(row scanner, email *models.OutboxEmail) error {
+	return row.Scan(&email.ID, &email.IdempotencyKey, &email.From, &email.Name, &email.To, &email.Locale, &email.Template, &email.Substitutions, &email.Status, &email.Attempts, &email.LastError, &email.NextAttemptAt, &email.SentAt, &email.Provider, &email.CreatedAt, &email.UpdatedAt)
+}
+
+func scanOutboxEmails(rows *sql.Rows) ([]models.OutboxEmail, error) {
+	emails := []models.OutboxEmail{}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var email models.OutboxEmail
+
+		if err := scanOutboxEmail(rows, &email); err != nil {
+			return emails, err
+		}
+
+		emails = append(emails, email)
+	}
+
+	return emails, rows.Err()
+}
+
+func (r OutboxEmailSqlxRepository) GetOutboxEmailByID(id string) (models.OutboxEmail, error) {
+	var email models.OutboxEmail
+
+	err := scanOutboxEmail(r.Database.QueryRow("SELECT "+outboxEmailColumns+" FROM email_outbox WHERE id = $1", id), &email)
+
+	return email, err
+}
+
+func (r OutboxEmailSqlxRepository) GetOutboxEmailsByStatus(status string) ([]models.OutboxEmail, error) {
+	rows, err := r.Database.Query("SELECT "+outboxEmailColumns+" FROM email_outbox WHERE status = $1 ORDER BY updated_at DESC LIMIT 200", status)
+
+	if err != nil {
+		return []models.OutboxEmail{}, err
+	}
+
+	return scanOutboxEmails(rows)
+}
+
+// CreateOutboxEmail returns the stored message when the idempotency key was
+// already enqueued, the no-op update is what makes RETURNING yield it.
+func (r OutboxEmailSqlxRepository) CreateOutboxEmail(email *models.OutboxEmail, transaction *sql.Tx) (*models.OutboxEmail, error) {
+	client := database.ParseClient(r.Database, transaction)
+
+	err := scanOutboxEmail(client.QueryRow("INSERT INTO email_outbox (id, idempotency_key, from_address, name, to_address, locale, template, substitutions, status, attempts, next_attempt_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) ON CONFLICT (idempotency_key) DO UPDATE SET idempotency_key = EXCLUDED.idempotency_key RETURNING "+outboxEmailColumns, email.ID, email.IdempotencyKey, email.From, email.Name, email.To, email.Locale, email.Template, email.Substitutions, email.Status, email.Attempts, email.NextAttemptAt), email)
+
+	return email, err
+}
+
+func (r OutboxEmailSqlxRepository) ClaimOutboxEmails(limit int, lease time.Duration) ([]models.OutboxEmail, error) {
+	rows, err := r.Database.Query("UPDATE email_outbox SET attempts = attempts + 1, next_attempt_at = NOW() + $1 * INTERVAL '1 second', updated_at = NOW() WHERE id IN (SELECT id FROM email_outbox WHERE status = $2 AND next_attempt_at <= NOW() ORDER BY next_attempt_at LIMIT $3 FOR UPDATE SKIP LOCKED) RETURNING "+outboxEmailColumns, lease.Seconds(), models.OutboxPending, limit)
+
+	if err != nil {
+		return []models.OutboxEmail{}, err
+	}
+
+	return scanOutboxEmails(rows)
+}
+
+func (r OutboxEmailSqlxRepository) UpdateOutboxEmail(email *models.OutboxEmail, transaction *sql.Tx) (*models.OutboxEmail, error) {
+	client := database.ParseClient(r.Database, transaction)
+
+	err := scanOutboxEmail(client.QueryRow("UPDATE email_outbox SET status = $1, attempts = $2, last_error = $3, next_attempt_at = $4, sent_at = $5, provider = $6, substitutions = $7, updated_at = NOW() WHERE id = $8 RETURNING "+outboxEmailColumns, email.Status, email.Attempts, email.LastError, email.NextAttemptAt, email.SentAt, email.Provider, email.Substitutions, email.ID), email)
+
+	return email, err
+}
@@ -0,0 +1,79 @@
+package provisioningclient
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/database"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type ProvisioningClientSqlxRepository struct {
+	Database *sqlx.DB
+}
+
+func NewProvisioningClientSqlxRepository(db *sqlx.DB) *ProvisioningClientSqlxRepository {
+	return &ProvisioningClientSqlxRepository{db}
+}
+
+func (r ProvisioningClientSqlxRepository) GetProvisioningClientByID(id string) (models.ProvisioningClient, error) {
+	var client models.ProvisioningClient
+
+	err := r.Database.QueryRow("SELECT id, organization, name, prefix, token_hash, revoked_at, last_used_at, created_at, updated_at FROM provisioning_clients WHERE id = $1", id).
+		Scan(&client.ID, &client.Organization, &client.Name, &client.Prefix, &client.TokenHash, &client.RevokedAt, &client.LastUsedAt, &client.CreatedAt, &client.UpdatedAt)
+
+	return client, err
+}
+
+func (r ProvisioningClientSqlxRepository) GetProvisioningClientByTokenHash(tokenHash string) (models.ProvisioningClient, error) {
+	var client models.ProvisioningClient
+
+	err := r.Database.QueryRow("SELECT id, organization, name, prefix, token_hash, revoked_at, last_used_at, created_at, updated_at FROM provisioning_clients WHERE token_hash = $1", tokenHash).
+		Scan(&client.ID, &client.Organization, &client.Name, &client.Prefix, &client.TokenHash, &client.RevokedAt, &client.LastUsedAt, &client.CreatedAt, &client.UpdatedAt)
+
+	return client, err
+}
+
+func (r ProvisioningClientSqlxRepository) GetProvisioningClientsByOrganization(organization string) ([]models.ProvisioningClient, error) {
+	clients := []models.ProvisioningClient{}
+
+	rows, err := r.Database.Query("SELECT id, organization, name, prefix, token_hash, revoked_at, last_used_at, created_at, updated_at FROM provisioning_clients WHERE organization = $1 ORDER BY created_at", organization)
+
+	if err != nil {
+		return clients, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var client models.ProvisioningClient
+
+		err = rows.Scan(&client.ID, &client.Organization, &client.Name, &client.Prefix, &client.TokenHash, &client.RevokedAt, &client.LastUsedAt, &client.CreatedAt, &client.UpdatedAt)
+
+		if err != nil {
+			return clients, err
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
+
+func (r ProvisioningClientSqlxRepository) CreateProvisioningClient(client *models.ProvisioningClient, transaction *sql.Tx) (*models.ProvisioningClient, error) {
+	queryClient := database.ParseClient(r.Database, transaction)
+
+	err := queryClient.QueryRow("INSERT INTO provisioning_clients (id, organization, name, prefix, token_hash) VALUES ($1, $2, $3, $4, $5) RETURNING id, organization, name, prefix, token_hash, revoked_at, last_used_at, created_at, updated_at", client.ID, client.Organization, client.Name, client.Prefix, client.TokenHash).
+		Scan(&client.ID, &client.Organization, &client.Name, &client.Prefix, &client.TokenHash, &client.RevokedAt, &client.LastUsedAt, &client.CreatedAt, &client.UpdatedAt)
+
+	return client, err
+}
+
+func (r ProvisioningClientSqlxRepository) UpdateProvisioningClient(client *models.ProvisioningClient, transaction *sql.Tx) (*models.ProvisioningClient, error) {
+	queryClient := database.ParseClient(r.Database, transaction)
+
+	err := queryClient.QueryRow("UPDATE provisioning_clients SET name = $1, revoked_at = $2, last_used_at = $3, updated_at = NOW() WHERE id = $4 RETURNING id, organization, name, prefix, token_hash, revoked_at, last_used_at, created_at, updated_at", client.Name, client.RevokedAt, client.LastUsedAt, client.ID).
+		Scan(&client.ID, &client.Organization, &client.Name, &client.Prefix, &client.TokenHash, &client.RevokedAt, &client.LastUsedAt, &client.CreatedAt, &client.UpdatedAt)
+
+	return client, err
+}
@@ -19,8 +19,8 @@ func NewRefreshTokenSqlxRepository(db *sqlx.DB) *RefreshTokenSqlxRepository {
 func (r RefreshTokenSqlxRepository) GetRefreshTokenByToken(token string) (models.RefreshToken, error) {
 	var refreshToken models.RefreshToken
 
-	err := r.Database.QueryRow("SELECT token, owner, valid, created_at, updated_at FROM refresh_tokens WHERE token = $1", token).
-		Scan(&refreshToken.Token, &refreshToken.Owner, &refreshToken.Valid, &refreshToken.CreatedAt, &refreshToken.UpdatedAt)
+	err := r.Database.QueryRow("SELECT token, owner, client_id, scope, valid, created_at, updated_at FROM refresh_tokens WHERE token = $1", token).
+		Scan(&refreshToken.Token, &refreshToken.Owner, &refreshToken.ClientID, &refreshToken.Scope, &refreshToken.Valid, &refreshToken.CreatedAt, &refreshToken.UpdatedAt)
 
 	return refreshToken, err
 }
@@ -31,11 +31,19 @@ func (r RefreshTokenSqlxRepository) InvalidateToken(token string) error {
 	return row.Err()
 }
 
+func (r RefreshTokenSqlxRepository) InvalidateTokensByOwner(owner string, transaction *sql.Tx) error {
+	client := database.ParseClient(r.Database, transaction)
+
+	_, err := client.Exec("UPDATE refresh_tokens SET valid = false, updated_at = NOW() WHERE owner = $1 AND valid = true", owner)
+
+	return err
+}
+
 func (r RefreshTokenSqlxRepository) CreateRefreshToken(refreshToken *models.RefreshToken, transaction *sql.Tx) (*models.RefreshToken, error) {
 	client := database.ParseClient(r.Database, transaction)
 
-	err := client.QueryRow("INSERT INTO refresh_tokens (token, owner, valid) VALUES ($1, $2, $3) RETURNING token, owner, valid, created_at, updated_at", refreshToken.Token, refreshToken.Owner, refreshToken.Valid).
-		Scan(&refreshToken.Token, &refreshToken.Owner, &refreshToken.Valid, &refreshToken.CreatedAt, &refreshToken.UpdatedAt)
+	err := client.QueryRow("INSERT INTO refresh_tokens (token, owner, client_id, scope, valid) VALUES ($1, $2, $3, $4, $5) RETURNING token, owner, client_id, scope, valid, created_at, updated_at", refreshToken.Token, refreshToken.Owner, refreshToken.ClientID, refreshToken.Scope, refreshToken.Valid).
+		Scan(&refreshToken.Token, &refreshToken.Owner, &refreshToken.ClientID, &refreshToken.Scope, &refreshToken.Valid, &refreshToken.CreatedAt, &refreshToken.UpdatedAt)
 
 	return refreshToken, err
 }
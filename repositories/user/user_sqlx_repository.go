@@ -27,8 +27,8 @@ func (r UserSqlxRepository) BeginTransaction() (*sql.Tx, error) {
 func (r UserSqlxRepository) GetUserByID(id string) (models.User, error) {
 	var user models.User
 
-	err := r.Database.QueryRow("SELECT id, name, email, password, provider, email_verified_at, role, created_at, updated_at FROM users WHERE id = $1", id).
-		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Provider, &user.EmailVerifiedAt, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	err := r.Database.QueryRow("SELECT id, name, email, password, provider, email_verified_at, phone, phone_verified_at, role, organization_id, deactivated_at, locale, email_undeliverable_at, created_at, updated_at FROM users WHERE id = $1", id).
+		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Provider, &user.EmailVerifiedAt, &user.Phone, &user.PhoneVerifiedAt, &user.Role, &user.OrganizationID, &user.DeactivatedAt, &user.Locale, &user.EmailUndeliverableAt, &user.CreatedAt, &user.UpdatedAt)
 
 	return user, err
 }
@@ -36,17 +36,52 @@ func (r UserSqlxRepository) GetUserByID(id string) (models.User, error) {
 func (r UserSqlxRepository) GetUserByEmail(email string) (models.User, error) {
 	var user models.User
 
-	err := r.Database.QueryRow("SELECT id, name, email, password, provider, email_verified_at, role, created_at, updated_at FROM users WHERE email = $1", email).
-		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Provider, &user.EmailVerifiedAt, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	err := r.Database.QueryRow("SELECT id, name, email, password, provider, email_verified_at, phone, phone_verified_at, role, organization_id, deactivated_at, locale, email_undeliverable_at, created_at, updated_at FROM users WHERE email = $1", email).
+		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Provider, &user.EmailVerifiedAt, &user.Phone, &user.PhoneVerifiedAt, &user.Role, &user.OrganizationID, &user.DeactivatedAt, &user.Locale, &user.EmailUndeliverableAt, &user.CreatedAt, &user.UpdatedAt)
 
 	return user, err
 }
 
+func (r UserSqlxRepository) GetUserByPhone(phone string) (models.User, error) {
+	var user models.User
+
+	err := r.Database.QueryRow("SELECT id, name, email, password, provider, email_verified_at, phone, phone_verified_at, role, organization_id, deactivated_at, locale, email_undeliverable_at, created_at, updated_at FROM users WHERE phone = $1", phone).
+		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Provider, &user.EmailVerifiedAt, &user.Phone, &user.PhoneVerifiedAt, &user.Role, &user.OrganizationID, &user.DeactivatedAt, &user.Locale, &user.EmailUndeliverableAt, &user.CreatedAt, &user.UpdatedAt)
+
+	return user, err
+}
+
+func (r UserSqlxRepository) GetUsersByOrganization(organization string) ([]models.User, error) {
+	users := []models.User{}
+
+	rows, err := r.Database.Query("SELECT u.id, u.name, u.email, u.password, u.provider, u.email_verified_at, u.phone, u.phone_verified_at, u.role, u.organization_id, u.deactivated_at, u.locale, u.email_undeliverable_at, u.created_at, u.updated_at FROM users u INNER JOIN memberships m ON m.user_id = u.id WHERE m.organization = $1 ORDER BY m.created_at", organization)
+
+	if err != nil {
+		return users, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var user models.User
+
+		err = rows.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Provider, &user.EmailVerifiedAt, &user.Phone, &user.PhoneVerifiedAt, &user.Role, &user.OrganizationID, &user.DeactivatedAt, &user.Locale, &user.EmailUndeliverableAt, &user.CreatedAt, &user.UpdatedAt)
+
+		if err != nil {
+			return users, err
+		}
+
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
 func (r UserSqlxRepository) CreateUser(user *models.User, transaction *sql.Tx) (*models.User, error) {
 	client := database.ParseClient(r.Database, transaction)
 
-	err := client.QueryRow("INSERT INTO users (id, name, email, password, provider, role) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, name, email, password, provider, email_verified_at, role, created_at, updated_at", user.ID, user.Name, user.Email, user.Password, user.Provider, user.Role).
-		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Provider, &user.EmailVerifiedAt, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	err := client.QueryRow("INSERT INTO users (id, name, email, password, provider, email_verified_at, phone, phone_verified_at, role, organization_id, deactivated_at, locale, email_undeliverable_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id, name, email, password, provider, email_verified_at, phone, phone_verified_at, role, organization_id, deactivated_at, locale, email_undeliverable_at, created_at, updated_at", user.ID, user.Name, user.Email, user.Password, user.Provider, user.EmailVerifiedAt, user.Phone, user.PhoneVerifiedAt, user.Role, user.OrganizationID, user.DeactivatedAt, user.Locale, user.EmailUndeliverableAt).
+		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Provider, &user.EmailVerifiedAt, &user.Phone, &user.PhoneVerifiedAt, &user.Role, &user.OrganizationID, &user.DeactivatedAt, &user.Locale, &user.EmailUndeliverableAt, &user.CreatedAt, &user.UpdatedAt)
 
 	return user, err
 }
@@ -54,8 +89,8 @@ func (r UserSqlxRepository) CreateUser(user *models.User, transaction *sql.Tx) (
 func (r UserSqlxRepository) UpdateUser(user *models.User, transaction *sql.Tx) (*models.User, error) {
 	client := database.ParseClient(r.Database, transaction)
 
-	err := client.QueryRow("UPDATE users SET name = $1, email = $2, password = $3, email_verified_at = $5, role = $6, updated_at = NOW() WHERE id = $7 RETURNING id, name, email, password, provider, email_verified_at, role, created_at, updated_at", user.Name, user.Email, user.Password, user.EmailVerifiedAt, user.Role).
-		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Provider, &user.EmailVerifiedAt, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	err := client.QueryRow("UPDATE users SET name = $1, email = $2, password = $3, email_verified_at = $4, phone = $5, phone_verified_at = $6, role = $7, organization_id = $8, deactivated_at = $9, locale = $10, email_undeliverable_at = $11, updated_at = NOW() WHERE id = $12 RETURNING id, name, email, password, provider, email_verified_at, phone, phone_verified_at, role, organization_id, deactivated_at, locale, email_undeliverable_at, created_at, updated_at", user.Name, user.Email, user.Password, user.EmailVerifiedAt, user.Phone, user.PhoneVerifiedAt, user.Role, user.OrganizationID, user.DeactivatedAt, user.Locale, user.EmailUndeliverableAt, user.ID).
+		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Provider, &user.EmailVerifiedAt, &user.Phone, &user.PhoneVerifiedAt, &user.Role, &user.OrganizationID, &user.DeactivatedAt, &user.Locale, &user.EmailUndeliverableAt, &user.CreatedAt, &user.UpdatedAt)
 
 	return user, err
 }
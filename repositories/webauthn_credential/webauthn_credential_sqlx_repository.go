@@ -0,0 +1,84 @@
+package webauthncredential
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/database"
+	"github.com/thiagoferolla/go-auth/database/models"
+)
+
+type WebAuthnCredentialSqlxRepository struct {
+	Database *sqlx.DB
+}
+
+func NewWebAuthnCredentialSqlxRepository(db *sqlx.DB) *WebAuthnCredentialSqlxRepository {
+	return &WebAuthnCredentialSqlxRepository{db}
+}
+
+func (r WebAuthnCredentialSqlxRepository) GetCredentialByID(id []byte) (models.WebAuthnCredential, error) {
+	var credential models.WebAuthnCredential
+
+	err := r.Database.QueryRow("SELECT id, owner, public_key, attestation_type, transports, aaguid, sign_count, clone_warning, flags, created_at, updated_at FROM webauthn_credentials WHERE id = $1", id).
+		Scan(&credential.ID, &credential.Owner, &credential.PublicKey, &credential.AttestationType, &credential.Transports, &credential.AAGUID, &credential.SignCount, &credential.CloneWarning, &credential.Flags, &credential.CreatedAt, &credential.UpdatedAt)
+
+	return credential, err
+}
+
+func (r WebAuthnCredentialSqlxRepository) GetCredentialsByOwner(owner string) ([]models.WebAuthnCredential, error) {
+	credentials := []models.WebAuthnCredential{}
+
+	rows, err := r.Database.Query("SELECT id, owner, public_key, attestation_type, transports, aaguid, sign_count, clone_warning, flags, created_at, updated_at FROM webauthn_credentials WHERE owner = $1 ORDER BY created_at", owner)
+
+	if err != nil {
+		return credentials, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var credential models.WebAuthnCredential
+
+		err = rows.Scan(&credential.ID, &credential.Owner, &credential.PublicKey, &credential.AttestationType, &credential.Transports, &credential.AAGUID, &credential.SignCount, &credential.CloneWarning, &credential.Flags, &credential.CreatedAt, &credential.UpdatedAt)
+
+		if err != nil {
+			return credentials, err
+		}
+
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, rows.Err()
+}
+
+func (r WebAuthnCredentialSqlxRepository) CreateCredential(credential *models.WebAuthnCredential, transaction *sql.Tx) (*models.WebAuthnCredential, error) {
+	client := database.ParseClient(r.Database, transaction)
+
+	err := client.QueryRow("INSERT INTO webauthn_credentials (id, owner, public_key, attestation_type, transports, aaguid, sign_count, clone_warning, flags) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, owner, public_key, attestation_type, transports, aaguid, sign_count, clone_warning, flags, created_at, updated_at", credential.ID, credential.Owner, credential.PublicKey, credential.AttestationType, credential.Transports, credential.AAGUID, credential.SignCount, credential.CloneWarning, credential.Flags).
+		Scan(&credential.ID, &credential.Owner, &credential.PublicKey, &credential.AttestationType, &credential.Transports, &credential.AAGUID, &credential.SignCount, &credential.CloneWarning, &credential.Flags, &credential.CreatedAt, &credential.UpdatedAt)
+
+	return credential, err
+}
+
+func (r WebAuthnCredentialSqlxRepository) UpdateSignCount(credential *models.WebAuthnCredential) error {
+	_, err := r.Database.Exec("UPDATE webauthn_credentials SET sign_count = $1, clone_warning = $2, flags = $3, updated_at = NOW() WHERE id = $4", credential.SignCount, credential.CloneWarning, credential.Flags, credential.ID)
+
+	return err
+}
+
+func (r WebAuthnCredentialSqlxRepository) DeleteCredential(id []byte, owner string) error {
+	rows, err := r.Database.Exec("DELETE FROM webauthn_credentials WHERE id = $1 AND owner = $2", id, owner)
+
+	if err != nil {
+		return err
+	}
+
+	numberOfRows, _ := rows.RowsAffected()
+
+	if numberOfRows == 0 {
+		return errors.New("Credential not found")
+	}
+
+	return nil
+}
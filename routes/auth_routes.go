@@ -1,26 +1,53 @@
 package routes
 
 import (
+	"context"
+	"os"
+
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 	"github.com/thiagoferolla/go-auth/controllers/auth"
 	"github.com/thiagoferolla/go-auth/middlewares/auth_middleware"
 	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/directory"
 	"github.com/thiagoferolla/go-auth/providers/email"
 	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"github.com/thiagoferolla/go-auth/providers/sms"
+	"github.com/thiagoferolla/go-auth/providers/social"
+	"github.com/thiagoferolla/go-auth/providers/sso"
+	apikey "github.com/thiagoferolla/go-auth/repositories/api_key"
+	"github.com/thiagoferolla/go-auth/repositories/identity"
+	"github.com/thiagoferolla/go-auth/repositories/membership"
+	oauthclient "github.com/thiagoferolla/go-auth/repositories/oauth_client"
 	refreshtoken "github.com/thiagoferolla/go-auth/repositories/refresh_token"
 	"github.com/thiagoferolla/go-auth/repositories/user"
+	webauthncredential "github.com/thiagoferolla/go-auth/repositories/webauthn_credential"
 )
 
-func RegisterAuthRoutes(server *gin.Engine, database *sqlx.DB, jwtProvider jwt.JWTProvider, emailProvider email.EmailProvider, cacheProvider cache.CacheProvider) {
+func RegisterAuthRoutes(server *gin.Engine, database *sqlx.DB, jwtProvider jwt.JWTProvider, outbox *email.Outbox, smsProvider sms.SmsProvider, cacheProvider cache.CacheProvider) {
 	group := server.Group("/auth/v1")
 
+	ldapConfigs, err := directory.LoadLdapConfigs(os.Getenv("LDAP_CONFIG"))
+
+	if err != nil {
+		panic(err)
+	}
+
+	directories, err := directory.NewDirectories(ldapConfigs)
+
+	if err != nil {
+		panic(err)
+	}
+
 	authController := auth.NewAuthController(
 		user.NewUserSqlxRepository(database),
 		refreshtoken.NewRefreshTokenSqlxRepository(database),
+		webauthncredential.NewWebAuthnCredentialSqlxRepository(database),
+		identity.NewIdentitySqlxRepository(database),
 		jwtProvider,
-		emailProvider,
+		outbox,
 		cacheProvider,
+		directories,
 	)
 
 	group.POST("/sign_in", authController.CreateUser)
@@ -30,9 +57,123 @@ func RegisterAuthRoutes(server *gin.Engine, database *sqlx.DB, jwtProvider jwt.J
 	group.POST("/confirm_email", authController.ConfirmEmail)
 	group.POST("/reset_password", authController.ResetPassword)
 
-	authMiddleware := auth_middleware.NewWithAuthMiddleware(user.NewUserSqlxRepository(database), jwtProvider)
+	passwordlessController := auth.NewPasswordlessController(
+		user.NewUserSqlxRepository(database),
+		refreshtoken.NewRefreshTokenSqlxRepository(database),
+		webauthncredential.NewWebAuthnCredentialSqlxRepository(database),
+		identity.NewIdentitySqlxRepository(database),
+		jwtProvider,
+		outbox,
+		cacheProvider,
+	)
+
+	group.POST("/passwordless/send", passwordlessController.SendPasswordless)
+	group.POST("/passwordless/verify", passwordlessController.VerifyPasswordless)
+
+	phoneController := auth.NewPhoneController(
+		user.NewUserSqlxRepository(database),
+		refreshtoken.NewRefreshTokenSqlxRepository(database),
+		webauthncredential.NewWebAuthnCredentialSqlxRepository(database),
+		jwtProvider,
+		smsProvider,
+		cacheProvider,
+	)
+
+	group.POST("/sms/send", phoneController.SendLoginCode)
+	group.POST("/sms/verify", phoneController.VerifyLoginCode)
+	group.POST("/mfa/sms/send", phoneController.SendMFACode)
+	group.POST("/mfa/sms/verify", phoneController.VerifyMFACode)
+
+	socialConfigs, err := social.LoadProviderConfigs(os.Getenv("SOCIAL_PROVIDERS_CONFIG"))
+
+	if err != nil {
+		panic(err)
+	}
+
+	socialProviders, err := social.NewProviders(context.Background(), socialConfigs)
+
+	if err != nil {
+		panic(err)
+	}
+
+	socialController := auth.NewSocialController(
+		user.NewUserSqlxRepository(database),
+		refreshtoken.NewRefreshTokenSqlxRepository(database),
+		webauthncredential.NewWebAuthnCredentialSqlxRepository(database),
+		identity.NewIdentitySqlxRepository(database),
+		jwtProvider,
+		cacheProvider,
+		socialProviders,
+	)
+
+	group.GET("/social/:provider/authorize", socialController.Authorize)
+	group.GET("/social/:provider/callback", socialController.Callback)
+
+	samlConfigs, err := sso.LoadSamlConfigs(os.Getenv("SAML_CONNECTIONS_CONFIG"))
+
+	if err != nil {
+		panic(err)
+	}
+
+	if len(samlConfigs) > 0 {
+		key, certificate, err := sso.LoadServiceProviderKeyPair(os.Getenv("SAML_SP_CERT_FILE"), os.Getenv("SAML_SP_KEY_FILE"))
+
+		if err != nil {
+			panic(err)
+		}
+
+		samlConnections, err := sso.NewSamlConnections(samlConfigs, os.Getenv("SAML_SP_BASE_URL"), key, certificate)
+
+		if err != nil {
+			panic(err)
+		}
+
+		samlController := auth.NewSamlController(
+			user.NewUserSqlxRepository(database),
+			refreshtoken.NewRefreshTokenSqlxRepository(database),
+			identity.NewIdentitySqlxRepository(database),
+			membership.NewMembershipSqlxRepository(database),
+			jwtProvider,
+			cacheProvider,
+			samlConnections,
+		)
+
+		group.GET("/saml/:connection/metadata", samlController.Metadata)
+		group.GET("/saml/:connection/login", samlController.Login)
+		group.POST("/saml/:connection/acs", samlController.AssertionConsumerService)
+	}
+
+	identityController := auth.NewIdentityController(
+		user.NewUserSqlxRepository(database),
+		identity.NewIdentitySqlxRepository(database),
+		webauthncredential.NewWebAuthnCredentialSqlxRepository(database),
+		cacheProvider,
+	)
+
+	authMiddleware := auth_middleware.NewWithAuthMiddleware(user.NewUserSqlxRepository(database), oauthclient.NewOAuthClientSqlxRepository(database), apikey.NewApiKeySqlxRepository(database), jwtProvider)
 
 	withAuthRoutes := group.Group("/")
 	withAuthRoutes.Use(authMiddleware.WithAuth())
-	withAuthRoutes.POST("/logout", authController.Logout)
+
+	// API keys and client tokens don't reach the session and credentials
+	// of their owner.
+	sessionRoutes := withAuthRoutes.Group("/")
+	sessionRoutes.Use(authMiddleware.DenyApiKey())
+	sessionRoutes.POST("/logout", authController.Logout)
+	sessionRoutes.GET("/identities", identityController.ListIdentities)
+
+	sensitiveRoutes := sessionRoutes.Group("/")
+	sensitiveRoutes.Use(authMiddleware.DenyImpersonation())
+	sensitiveRoutes.POST("/phone", phoneController.SetPhone)
+	sensitiveRoutes.POST("/phone/verify", phoneController.VerifyPhone)
+	sensitiveRoutes.POST("/reauthenticate", identityController.Reauthenticate)
+	sensitiveRoutes.POST("/identities/password", identityController.LinkPassword)
+	sensitiveRoutes.POST("/identities/social/:provider", socialController.Link)
+	sensitiveRoutes.DELETE("/identities/:id", identityController.UnlinkIdentity)
+
+	apiKeyController := auth.NewApiKeyController(apikey.NewApiKeySqlxRepository(database))
+
+	sessionRoutes.GET("/api_keys", apiKeyController.ListApiKeys)
+	sensitiveRoutes.POST("/api_keys", apiKeyController.CreateApiKey)
+	sensitiveRoutes.DELETE("/api_keys/:id", apiKeyController.DeleteApiKey)
 }
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/thiagoferolla/go-auth/controllers/dev"
+	"github.com/thiagoferolla/go-auth/providers/email"
+)
+
+func RegisterDevRoutes(server *gin.Engine, mailbox *email.MailboxEmailProvider) {
+	group := server.Group("/dev/mailbox")
+
+	mailboxController := dev.NewMailboxController(mailbox)
+
+	group.GET("/", mailboxController.ListEmails)
+	group.GET("/:id", mailboxController.GetEmail)
+	group.DELETE("/", mailboxController.ClearEmails)
+}
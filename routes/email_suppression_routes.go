@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/controllers/auth"
+	"github.com/thiagoferolla/go-auth/middlewares/auth_middleware"
+	"github.com/thiagoferolla/go-auth/providers/email"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	apikey "github.com/thiagoferolla/go-auth/repositories/api_key"
+	emailsuppression "github.com/thiagoferolla/go-auth/repositories/email_suppression"
+	oauthclient "github.com/thiagoferolla/go-auth/repositories/oauth_client"
+	"github.com/thiagoferolla/go-auth/repositories/user"
+)
+
+func RegisterEmailSuppressionRoutes(server *gin.Engine, database *sqlx.DB, jwtProvider jwt.JWTProvider) {
+	suppressionController := auth.NewEmailSuppressionController(user.NewUserSqlxRepository(database), emailsuppression.NewEmailSuppressionSqlxRepository(database), newEmailWebhooks())
+
+	webhookGroup := server.Group("/auth/v1/webhooks/email")
+	webhookGroup.POST("/:provider", suppressionController.HandleWebhook)
+
+	group := server.Group("/auth/v1/admin/email_suppressions")
+
+	authMiddleware := auth_middleware.NewWithAuthMiddleware(user.NewUserSqlxRepository(database), oauthclient.NewOAuthClientSqlxRepository(database), apikey.NewApiKeySqlxRepository(database), jwtProvider)
+
+	group.Use(authMiddleware.WithAuth())
+	group.Use(authMiddleware.DenyImpersonation())
+	group.Use(authMiddleware.RequireRole("admin"))
+	group.Use(authMiddleware.RequireScope("emails"))
+	group.GET("/", suppressionController.ListSuppressions)
+	group.POST("/", suppressionController.CreateSuppression)
+	group.DELETE("/:email", suppressionController.DeleteSuppression)
+}
+
+// newEmailWebhooks accepts events only from the providers whose signing key
+// is configured.
+func newEmailWebhooks() map[string]email.EmailWebhook {
+	webhooks := map[string]email.EmailWebhook{}
+
+	if publicKey := os.Getenv("SENDGRID_WEBHOOK_PUBLIC_KEY"); len(publicKey) > 0 {
+		webhook, err := email.NewSendgridWebhook(publicKey)
+
+		if err != nil {
+			panic(err)
+		}
+
+		webhooks["sendgrid"] = webhook
+	}
+
+	if secret := os.Getenv("SMTP_WEBHOOK_SECRET"); len(secret) > 0 {
+		webhooks["smtp"] = email.NewHmacWebhook(secret)
+	}
+
+	return webhooks
+}
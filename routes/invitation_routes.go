@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/controllers/auth"
+	"github.com/thiagoferolla/go-auth/middlewares/auth_middleware"
+	"github.com/thiagoferolla/go-auth/providers/email"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	apikey "github.com/thiagoferolla/go-auth/repositories/api_key"
+	"github.com/thiagoferolla/go-auth/repositories/identity"
+	"github.com/thiagoferolla/go-auth/repositories/invitation"
+	"github.com/thiagoferolla/go-auth/repositories/membership"
+	oauthclient "github.com/thiagoferolla/go-auth/repositories/oauth_client"
+	"github.com/thiagoferolla/go-auth/repositories/organization"
+	refreshtoken "github.com/thiagoferolla/go-auth/repositories/refresh_token"
+	"github.com/thiagoferolla/go-auth/repositories/user"
+)
+
+func RegisterInvitationRoutes(server *gin.Engine, database *sqlx.DB, jwtProvider jwt.JWTProvider, outbox *email.Outbox) {
+	group := server.Group("/auth/v1/invitations")
+
+	invitationController := auth.NewInvitationController(
+		user.NewUserSqlxRepository(database),
+		refreshtoken.NewRefreshTokenSqlxRepository(database),
+		identity.NewIdentitySqlxRepository(database),
+		organization.NewOrganizationSqlxRepository(database),
+		membership.NewMembershipSqlxRepository(database),
+		invitation.NewInvitationSqlxRepository(database),
+		jwtProvider,
+		outbox,
+	)
+
+	group.POST("/accept", invitationController.AcceptInvitation)
+
+	authMiddleware := auth_middleware.NewWithAuthMiddleware(user.NewUserSqlxRepository(database), oauthclient.NewOAuthClientSqlxRepository(database), apikey.NewApiKeySqlxRepository(database), jwtProvider)
+
+	withAuthRoutes := group.Group("/")
+	withAuthRoutes.Use(authMiddleware.WithAuth())
+	withAuthRoutes.Use(authMiddleware.DenyImpersonation())
+	withAuthRoutes.Use(authMiddleware.RequireScope("invitations"))
+	withAuthRoutes.GET("/", invitationController.ListInvitations)
+	withAuthRoutes.POST("/", invitationController.CreateInvitation)
+	withAuthRoutes.POST("/:id/resend", invitationController.ResendInvitation)
+	withAuthRoutes.POST("/:id/revoke", invitationController.RevokeInvitation)
+}
@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/controllers/oauth"
+	"github.com/thiagoferolla/go-auth/middlewares/auth_middleware"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	apikey "github.com/thiagoferolla/go-auth/repositories/api_key"
+	"github.com/thiagoferolla/go-auth/repositories/impersonation"
+	oauthclient "github.com/thiagoferolla/go-auth/repositories/oauth_client"
+	refreshtoken "github.com/thiagoferolla/go-auth/repositories/refresh_token"
+	"github.com/thiagoferolla/go-auth/repositories/user"
+)
+
+func RegisterOAuthRoutes(server *gin.Engine, database *sqlx.DB, jwtProvider jwt.JWTProvider, cacheProvider cache.CacheProvider) {
+	group := server.Group("/oauth")
+
+	oauthController := oauth.NewOAuthController(
+		user.NewUserSqlxRepository(database),
+		refreshtoken.NewRefreshTokenSqlxRepository(database),
+		oauthclient.NewOAuthClientSqlxRepository(database),
+		impersonation.NewImpersonationSqlxRepository(database),
+		jwtProvider,
+		cacheProvider,
+	)
+
+	group.POST("/token", oauthController.Token)
+	group.POST("/device_authorization", oauthController.DeviceAuthorization)
+
+	authMiddleware := auth_middleware.NewWithAuthMiddleware(user.NewUserSqlxRepository(database), oauthclient.NewOAuthClientSqlxRepository(database), apikey.NewApiKeySqlxRepository(database), jwtProvider)
+
+	withAuthRoutes := group.Group("/")
+	withAuthRoutes.Use(authMiddleware.WithAuth())
+	withAuthRoutes.Use(authMiddleware.DenyImpersonation())
+
+	consentRoutes := withAuthRoutes.Group("/")
+	consentRoutes.Use(authMiddleware.DenyApiKey())
+	consentRoutes.GET("/authorize", oauthController.Authorize)
+	consentRoutes.GET("/device", oauthController.GetDeviceVerification)
+	consentRoutes.POST("/device", oauthController.VerifyDevice)
+
+	clientController := oauth.NewOAuthClientController(oauthclient.NewOAuthClientSqlxRepository(database))
+
+	adminRoutes := withAuthRoutes.Group("/clients")
+	adminRoutes.Use(authMiddleware.RequireRole("admin"))
+	adminRoutes.Use(authMiddleware.RequireScope("oauth_clients"))
+	adminRoutes.GET("/", clientController.ListClients)
+	adminRoutes.POST("/", clientController.CreateClient)
+	adminRoutes.POST("/:id/rotate_secret", clientController.RotateSecret)
+	adminRoutes.POST("/:id/revoke", clientController.RevokeClient)
+}
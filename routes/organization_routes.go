@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/controllers/auth"
+	"github.com/thiagoferolla/go-auth/middlewares/auth_middleware"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	apikey "github.com/thiagoferolla/go-auth/repositories/api_key"
+	"github.com/thiagoferolla/go-auth/repositories/membership"
+	oauthclient "github.com/thiagoferolla/go-auth/repositories/oauth_client"
+	"github.com/thiagoferolla/go-auth/repositories/organization"
+	provisioningclient "github.com/thiagoferolla/go-auth/repositories/provisioning_client"
+	refreshtoken "github.com/thiagoferolla/go-auth/repositories/refresh_token"
+	"github.com/thiagoferolla/go-auth/repositories/user"
+)
+
+func RegisterOrganizationRoutes(server *gin.Engine, database *sqlx.DB, jwtProvider jwt.JWTProvider) {
+	group := server.Group("/auth/v1/organizations")
+
+	organizationController := auth.NewOrganizationController(
+		user.NewUserSqlxRepository(database),
+		refreshtoken.NewRefreshTokenSqlxRepository(database),
+		organization.NewOrganizationSqlxRepository(database),
+		membership.NewMembershipSqlxRepository(database),
+		provisioningclient.NewProvisioningClientSqlxRepository(database),
+		jwtProvider,
+	)
+
+	authMiddleware := auth_middleware.NewWithAuthMiddleware(user.NewUserSqlxRepository(database), oauthclient.NewOAuthClientSqlxRepository(database), apikey.NewApiKeySqlxRepository(database), jwtProvider)
+
+	group.Use(authMiddleware.WithAuth())
+
+	readRoutes := group.Group("/")
+	readRoutes.Use(authMiddleware.RequireScope("organizations"))
+	readRoutes.GET("/", organizationController.ListOrganizations)
+	readRoutes.GET("/:id", organizationController.GetOrganization)
+	readRoutes.GET("/:id/members", organizationController.ListMembers)
+
+	sensitiveRoutes := group.Group("/")
+	sensitiveRoutes.Use(authMiddleware.DenyImpersonation())
+	sensitiveRoutes.Use(authMiddleware.DenyApiKey())
+	sensitiveRoutes.POST("/", organizationController.CreateOrganization)
+	sensitiveRoutes.POST("/:id/members", organizationController.AddMember)
+	sensitiveRoutes.PATCH("/:id/members/:user_id", organizationController.UpdateMember)
+	sensitiveRoutes.DELETE("/:id/members/:user_id", organizationController.RemoveMember)
+	sensitiveRoutes.POST("/:id/switch", organizationController.SwitchOrganization)
+	sensitiveRoutes.GET("/:id/provisioning_clients", organizationController.ListProvisioningClients)
+	sensitiveRoutes.POST("/:id/provisioning_clients", organizationController.CreateProvisioningClient)
+	sensitiveRoutes.POST("/:id/provisioning_clients/:client_id/revoke", organizationController.RevokeProvisioningClient)
+}
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/controllers/auth"
+	"github.com/thiagoferolla/go-auth/middlewares/auth_middleware"
+	"github.com/thiagoferolla/go-auth/providers/email"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	apikey "github.com/thiagoferolla/go-auth/repositories/api_key"
+	oauthclient "github.com/thiagoferolla/go-auth/repositories/oauth_client"
+	outboxemail "github.com/thiagoferolla/go-auth/repositories/outbox_email"
+	"github.com/thiagoferolla/go-auth/repositories/user"
+)
+
+func RegisterOutboxRoutes(server *gin.Engine, database *sqlx.DB, jwtProvider jwt.JWTProvider, outbox *email.Outbox) {
+	group := server.Group("/auth/v1/admin/emails")
+
+	outboxController := auth.NewOutboxController(outboxemail.NewOutboxEmailSqlxRepository(database), outbox)
+
+	authMiddleware := auth_middleware.NewWithAuthMiddleware(user.NewUserSqlxRepository(database), oauthclient.NewOAuthClientSqlxRepository(database), apikey.NewApiKeySqlxRepository(database), jwtProvider)
+
+	group.Use(authMiddleware.WithAuth())
+	group.Use(authMiddleware.DenyImpersonation())
+	group.Use(authMiddleware.RequireRole("admin"))
+	group.Use(authMiddleware.RequireScope("emails"))
+	group.GET("/", outboxController.ListEmails)
+	group.GET("/:id", outboxController.GetEmail)
+	group.POST("/:id/retry", outboxController.RetryEmail)
+}
@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/controllers/auth"
+	"github.com/thiagoferolla/go-auth/middlewares/auth_middleware"
+	"github.com/thiagoferolla/go-auth/providers/cache"
+	"github.com/thiagoferolla/go-auth/providers/jwt"
+	apikey "github.com/thiagoferolla/go-auth/repositories/api_key"
+	"github.com/thiagoferolla/go-auth/repositories/identity"
+	oauthclient "github.com/thiagoferolla/go-auth/repositories/oauth_client"
+	refreshtoken "github.com/thiagoferolla/go-auth/repositories/refresh_token"
+	"github.com/thiagoferolla/go-auth/repositories/user"
+	webauthncredential "github.com/thiagoferolla/go-auth/repositories/webauthn_credential"
+)
+
+func RegisterPasskeyRoutes(server *gin.Engine, database *sqlx.DB, jwtProvider jwt.JWTProvider, cacheProvider cache.CacheProvider) {
+	group := server.Group("/auth/v1/passkeys")
+
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          os.Getenv("WEBAUTHN_RP_ID"),
+		RPDisplayName: os.Getenv("WEBAUTHN_RP_NAME"),
+		RPOrigins:     strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ","),
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	passkeyController := auth.NewPasskeyController(
+		user.NewUserSqlxRepository(database),
+		refreshtoken.NewRefreshTokenSqlxRepository(database),
+		webauthncredential.NewWebAuthnCredentialSqlxRepository(database),
+		identity.NewIdentitySqlxRepository(database),
+		jwtProvider,
+		cacheProvider,
+		webAuthn,
+	)
+
+	group.POST("/login/options", passkeyController.BeginLogin)
+	group.POST("/login/verify", passkeyController.FinishLogin)
+
+	authMiddleware := auth_middleware.NewWithAuthMiddleware(user.NewUserSqlxRepository(database), oauthclient.NewOAuthClientSqlxRepository(database), apikey.NewApiKeySqlxRepository(database), jwtProvider)
+
+	withAuthRoutes := group.Group("/")
+	withAuthRoutes.Use(authMiddleware.WithAuth())
+	withAuthRoutes.Use(authMiddleware.DenyApiKey())
+	withAuthRoutes.GET("/", passkeyController.ListPasskeys)
+
+	sensitiveRoutes := withAuthRoutes.Group("/")
+	sensitiveRoutes.Use(authMiddleware.DenyImpersonation())
+	sensitiveRoutes.DELETE("/:id", passkeyController.DeletePasskey)
+	sensitiveRoutes.POST("/register/options", passkeyController.BeginRegistration)
+	sensitiveRoutes.POST("/register/verify", passkeyController.FinishRegistration)
+}
@@ -1,20 +1,30 @@
 package routes
 
 import (
+	"os"
+	"strconv"
+
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/middlewares/locale_middleware"
 	"github.com/thiagoferolla/go-auth/providers/cache"
 	"github.com/thiagoferolla/go-auth/providers/email"
 	"github.com/thiagoferolla/go-auth/providers/jwt"
+	"github.com/thiagoferolla/go-auth/providers/secret"
+	"github.com/thiagoferolla/go-auth/providers/sms"
+	emailsuppression "github.com/thiagoferolla/go-auth/repositories/email_suppression"
+	outboxemail "github.com/thiagoferolla/go-auth/repositories/outbox_email"
 )
 
 type Router struct {
-	Engine   *gin.Engine
-	Database *sqlx.DB
+	Engine         *gin.Engine
+	Database       *sqlx.DB
+	SecretProvider secret.SecretProvider
+	Outbox         *email.Outbox
 }
 
-func NewRouter(engine *gin.Engine, db *sqlx.DB) *Router {
-	r := &Router{Engine: engine, Database: db}
+func NewRouter(engine *gin.Engine, db *sqlx.DB, secretProvider secret.SecretProvider) *Router {
+	r := &Router{Engine: engine, Database: db, SecretProvider: secretProvider}
 
 	r.RegisterRoutes(engine)
 
@@ -22,11 +32,89 @@ func NewRouter(engine *gin.Engine, db *sqlx.DB) *Router {
 }
 
 func (r *Router) RegisterRoutes(server *gin.Engine) {
+	server.Use(locale_middleware.WithLocale())
 
 	jwtProvider := jwt.NewBaseProvider()
-	// emailProvider := email.NewSendgridEmailProvider(os.Getenv("SENDGRID_API_KEY"))
-	emailProvider := email.NewMockEmailProvider()
-	cacheProvider := cache.NewRedisProvider()
+	provider := newEmailProvider()
+	emailProvider := email.NewSuppressingEmailProvider(emailsuppression.NewEmailSuppressionSqlxRepository(r.Database), provider)
+	r.Outbox = email.NewOutbox(outboxemail.NewOutboxEmailSqlxRepository(r.Database), emailProvider, os.Getenv("EMAIL_FROM"))
+	// smsProvider := sms.NewHttpSmsProvider(os.Getenv("SMS_API_URL"), os.Getenv("SMS_API_KEY"), os.Getenv("SMS_FROM"))
+	smsProvider := sms.NewMockSmsProvider()
+	cacheProvider := newCacheProvider(r.SecretProvider)
+
+	RegisterAuthRoutes(server, r.Database, *jwtProvider, r.Outbox, smsProvider, cacheProvider)
+	RegisterPasskeyRoutes(server, r.Database, *jwtProvider, cacheProvider)
+	RegisterOAuthRoutes(server, r.Database, *jwtProvider, cacheProvider)
+	RegisterOrganizationRoutes(server, r.Database, *jwtProvider)
+	RegisterInvitationRoutes(server, r.Database, *jwtProvider, r.Outbox)
+	RegisterOutboxRoutes(server, r.Database, *jwtProvider, r.Outbox)
+	RegisterEmailSuppressionRoutes(server, r.Database, *jwtProvider)
+	RegisterScimRoutes(server, r.Database)
+
+	if mailbox, ok := provider.(*email.MailboxEmailProvider); ok {
+		RegisterDevRoutes(server, mailbox)
+	}
+}
+
+func newEmailProvider() email.EmailProvider {
+	switch os.Getenv("EMAIL_PROVIDER") {
+	case "smtp":
+		provider, err := email.NewSmtpProvider(email.SmtpConfigFromEnv())
+
+		if err != nil {
+			panic(err)
+		}
+
+		return provider
+	case "sendgrid":
+		return email.NewSendgridEmailProvider(os.Getenv("SENDGRID_API_KEY"), email.SendgridTemplateIDsFromEnv())
+	case "composite":
+		config, err := email.LoadRoutingConfig(os.Getenv("EMAIL_ROUTING_CONFIG"))
+
+		if err != nil {
+			panic(err)
+		}
+
+		provider, err := email.NewCompositeEmailProviderFromConfig(config)
+
+		if err != nil {
+			panic(err)
+		}
+
+		return provider
+	case "mailbox":
+		// The mailbox hands out every token over an unauthenticated API.
+		if gin.Mode() == gin.ReleaseMode {
+			panic("the mailbox email provider is for development only")
+		}
+
+		return email.NewMailboxEmailProvider()
+	default:
+		return email.NewMockEmailProvider()
+	}
+}
+
+// newCacheProvider keeps the cache in memory when asked to, which only holds
+// up with a single node since tokens and challenges aren't shared.
+func newCacheProvider(secretProvider secret.SecretProvider) cache.CacheProvider {
+	switch os.Getenv("CACHE_PROVIDER") {
+	case "memory":
+		maxEntries, _ := strconv.Atoi(os.Getenv("CACHE_MAX_ENTRIES"))
+
+		return cache.NewMemoryProvider(maxEntries, 0)
+	default:
+		config, err := cache.RedisConfigFromSecrets(secretProvider)
+
+		if err != nil {
+			panic(err)
+		}
+
+		provider, err := cache.NewRedisProvider(config)
+
+		if err != nil {
+			panic(err)
+		}
 
-	RegisterAuthRoutes(server, r.Database, *jwtProvider, emailProvider, cacheProvider)
+		return provider
+	}
 }
@@ -0,0 +1,43 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/thiagoferolla/go-auth/controllers/scim"
+	"github.com/thiagoferolla/go-auth/middlewares/auth_middleware"
+	"github.com/thiagoferolla/go-auth/repositories/identity"
+	"github.com/thiagoferolla/go-auth/repositories/membership"
+	provisioningclient "github.com/thiagoferolla/go-auth/repositories/provisioning_client"
+	refreshtoken "github.com/thiagoferolla/go-auth/repositories/refresh_token"
+	"github.com/thiagoferolla/go-auth/repositories/user"
+)
+
+func RegisterScimRoutes(server *gin.Engine, database *sqlx.DB) {
+	group := server.Group("/scim/v2")
+
+	scimController := scim.NewScimController(
+		user.NewUserSqlxRepository(database),
+		refreshtoken.NewRefreshTokenSqlxRepository(database),
+		identity.NewIdentitySqlxRepository(database),
+		membership.NewMembershipSqlxRepository(database),
+	)
+
+	provisioningMiddleware := auth_middleware.NewWithProvisioningClientMiddleware(provisioningclient.NewProvisioningClientSqlxRepository(database))
+
+	group.Use(provisioningMiddleware.WithProvisioningClient())
+	group.GET("/ServiceProviderConfig", scimController.ServiceProviderConfig)
+
+	group.GET("/Users", scimController.ListUsers)
+	group.POST("/Users", scimController.CreateUser)
+	group.GET("/Users/:id", scimController.GetUser)
+	group.PUT("/Users/:id", scimController.ReplaceUser)
+	group.PATCH("/Users/:id", scimController.PatchUser)
+	group.DELETE("/Users/:id", scimController.DeleteUser)
+
+	group.GET("/Groups", scimController.ListGroups)
+	group.POST("/Groups", scimController.CreateGroup)
+	group.GET("/Groups/:id", scimController.GetGroup)
+	group.PUT("/Groups/:id", scimController.ReplaceGroup)
+	group.PATCH("/Groups/:id", scimController.PatchGroup)
+	group.DELETE("/Groups/:id", scimController.DeleteGroup)
+}